@@ -0,0 +1,58 @@
+package mtpx
+
+import (
+	"bufio"
+	"io"
+	"sync"
+)
+
+// a pool of the reusable transfer buffers of [size] bytes
+// a pool is shared by all the files of a batch transfer, so that transferring thousands of small files doesn't allocate new buffers for each of them
+type bufferPool struct {
+	size    int
+	buffers sync.Pool
+	readers sync.Pool
+}
+
+// note: [size] defaults to [defaultTransferBufferSize]
+func newBufferPool(size int) *bufferPool {
+	if size <= 0 {
+		size = defaultTransferBufferSize
+	}
+
+	p := &bufferPool{size: size}
+	p.buffers.New = func() interface{} {
+		b := make([]byte, size)
+
+		return &b
+	}
+	p.readers.New = func() interface{} {
+		return bufio.NewReaderSize(nil, size)
+	}
+
+	return p
+}
+
+// a buffer of [bufferPool.size] bytes; hand it back using [put] once it is no longer used
+func (p *bufferPool) get() *[]byte {
+	return p.buffers.Get().(*[]byte)
+}
+
+func (p *bufferPool) put(b *[]byte) {
+	p.buffers.Put(b)
+}
+
+// a buffered reader of [r] which reads [bufferPool.size] bytes at a time; hand it back using [putReader]
+func (p *bufferPool) reader(r io.Reader) *bufio.Reader {
+	br := p.readers.Get().(*bufio.Reader)
+	br.Reset(r)
+
+	return br
+}
+
+func (p *bufferPool) putReader(br *bufio.Reader) {
+	// drop the reference to the underlying reader
+	br.Reset(nil)
+
+	p.readers.Put(br)
+}
@@ -0,0 +1,277 @@
+package mtpx
+
+import (
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+	"strings"
+	"sync"
+)
+
+type pathCacheKey struct {
+	storageId uint32
+	parentId  uint32
+}
+
+// the location of an object fetched while resolving the path of an objectId
+type pathCacheParent struct {
+	storageId uint32
+	parentId  uint32
+	filename  string
+}
+
+// PathCache keeps the directory listings (filename -> objectId) fetched while resolving paths
+// so that repeated lookups inside the same directory don't rescan all of its children.
+// It also keeps the parents (objectId -> parentId and filename) fetched by [ResolveObjectPathCached].
+// Use [Invalidate] after an object is created, deleted, renamed or moved inside a directory.
+type PathCache struct {
+	mu      sync.Mutex
+	entries map[pathCacheKey]map[string]uint32
+	parents map[uint32]pathCacheParent
+
+	// incremented by every invalidation, so that a fetch which raced with one isn't cached
+	generation uint64
+}
+
+// create a new empty [PathCache]
+func NewPathCache() *PathCache {
+	return &PathCache{
+		entries: map[pathCacheKey]map[string]uint32{},
+		parents: map[uint32]pathCacheParent{},
+	}
+}
+
+// drop the cached listing of the directory [parentId] and the cached parents of its children
+func (c *PathCache) Invalidate(storageId, parentId uint32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation += 1
+	delete(c.entries, pathCacheKey{storageId, parentId})
+
+	for objectId, p := range c.parents {
+		if p.storageId == storageId && p.parentId == parentId {
+			delete(c.parents, objectId)
+		}
+	}
+}
+
+// drop the cached parent of the deleted object [objectId] along with the cached listings and parents of all the objects below it
+func (c *PathCache) InvalidateTree(storageId, objectId uint32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation += 1
+
+	// the listings and the parents are cached independently, so collect the objects below [objectId] from both
+	removed := map[uint32]bool{objectId: true}
+	for changed := true; changed; {
+		changed = false
+
+		for id, p := range c.parents {
+			if p.storageId == storageId && removed[p.parentId] && !removed[id] {
+				removed[id] = true
+				changed = true
+			}
+		}
+
+		for key, children := range c.entries {
+			if key.storageId != storageId || !removed[key.parentId] {
+				continue
+			}
+
+			for _, id := range children {
+				if id != ambiguousPathCacheObjectId && !removed[id] {
+					removed[id] = true
+					changed = true
+				}
+			}
+		}
+	}
+
+	for id := range removed {
+		delete(c.parents, id)
+		delete(c.entries, pathCacheKey{storageId, id})
+	}
+}
+
+// drop all the cached listings and parents
+func (c *PathCache) InvalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation += 1
+	c.entries = map[pathCacheKey]map[string]uint32{}
+	c.parents = map[uint32]pathCacheParent{}
+}
+
+// CacheInvalidator is notified whenever the children of a directory are created, deleted, renamed or moved by this package
+// [PathCache] and [Session] implement it; register it using [AddCacheInvalidator]
+type CacheInvalidator interface {
+	Invalidate(storageId, parentId uint32)
+
+	// the object [objectId] was deleted along with everything below it
+	InvalidateTree(storageId, objectId uint32)
+}
+
+// the registered [CacheInvalidator] of a device
+type cacheInvalidators struct {
+	mu   sync.Mutex
+	list []CacheInvalidator
+}
+
+// register [inv] to be notified of the directories which are changed on [dev]
+// it is kept until [RemoveCacheInvalidator] or [Dispose] is called
+func AddCacheInvalidator(dev *mtp.Device, inv CacheInvalidator) {
+	v, _ := deviceCacheInvalidators.LoadOrStore(dev, &cacheInvalidators{})
+	c := v.(*cacheInvalidators)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.list = append(c.list, inv)
+}
+
+// unregister [inv] added by [AddCacheInvalidator]
+func RemoveCacheInvalidator(dev *mtp.Device, inv CacheInvalidator) {
+	v, ok := deviceCacheInvalidators.Load(dev)
+	if !ok {
+		return
+	}
+	c := v.(*cacheInvalidators)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, l := range c.list {
+		if l == inv {
+			c.list = append(c.list[:i:i], c.list[i+1:]...)
+
+			return
+		}
+	}
+}
+
+// notify the registered [CacheInvalidator] of [dev] that the children of the directories [parentIds] were changed
+func invalidateCaches(dev *mtp.Device, storageId uint32, parentIds ...uint32) {
+	v, ok := deviceCacheInvalidators.Load(dev)
+	if !ok {
+		return
+	}
+	c := v.(*cacheInvalidators)
+
+	c.mu.Lock()
+	list := c.list
+	c.mu.Unlock()
+
+	for _, inv := range list {
+		for _, parentId := range parentIds {
+			inv.Invalidate(storageId, fixParentId(parentId))
+		}
+	}
+}
+
+// notify the registered [CacheInvalidator] of [dev] that the object [objectId] inside the directory [parentId] was deleted
+func invalidateDeletedObject(dev *mtp.Device, storageId, parentId, objectId uint32) {
+	v, ok := deviceCacheInvalidators.Load(dev)
+	if !ok {
+		return
+	}
+	c := v.(*cacheInvalidators)
+
+	c.mu.Lock()
+	list := c.list
+	c.mu.Unlock()
+
+	for _, inv := range list {
+		inv.Invalidate(storageId, fixParentId(parentId))
+		inv.InvalidateTree(storageId, objectId)
+	}
+}
+
+// fetch the parent and the filename of [objectId]
+// the object is fetched from the device if it isn't cached yet
+// the lock isn't held while the device is queried; a result fetched while the cache was invalidated isn't stored
+func (c *PathCache) parent(dev *mtp.Device, objectId uint32) (pathCacheParent, error) {
+	c.mu.Lock()
+	p, ok := c.parents[objectId]
+	generation := c.generation
+	c.mu.Unlock()
+
+	if ok {
+		return p, nil
+	}
+
+	obj := mtp.ObjectInfo{}
+	if err := withCallTimeout(dev, nil, func() error {
+		return dev.GetObjectInfo(objectId, &obj)
+	}); err != nil {
+		return pathCacheParent{}, fileObjectError(err)
+	}
+
+	p = pathCacheParent{storageId: obj.StorageID, parentId: fixParentId(obj.ParentObject), filename: obj.Filename}
+
+	c.mu.Lock()
+	if c.generation == generation {
+		c.parents[objectId] = p
+	}
+	c.mu.Unlock()
+
+	return p, nil
+}
+
+// fetch the objectId of [filename] inside the directory [parentId]
+// the directory listing is fetched from the device if it isn't cached yet
+// the lock isn't held while the listing is fetched, same as [PathCache.parent]
+func (c *PathCache) lookup(dev *mtp.Device, storageId, parentId uint32, filename string) (objectId uint32, found bool, err error) {
+	key := pathCacheKey{storageId, parentId}
+
+	c.mu.Lock()
+	children, ok := c.entries[key]
+	generation := c.generation
+	c.mu.Unlock()
+
+	if !ok {
+		handles := mtp.Uint32Array{}
+		if err := withCallTimeout(dev, nil, func() error {
+			return dev.GetObjectHandles(storageId, mtp.GOH_ALL_ASSOCS, parentId, &handles)
+		}); err != nil {
+			return 0, false, fileObjectError(err)
+		}
+
+		children = map[string]uint32{}
+
+		for _, objId := range handles.Values {
+			var val mtp.StringValue
+			if err := withCallTimeout(dev, nil, func() error {
+				return dev.GetObjectPropValue(objId, mtp.OPC_ObjectFileName, &val)
+			}); err != nil {
+				return 0, false, fileObjectError(err)
+			}
+
+			// the colliding names are resolved by [GetObjectFromParentIdAndFilename]
+			name := pathCacheName(dev, val.Value)
+			if _, ok := children[name]; ok {
+				objId = ambiguousPathCacheObjectId
+			}
+
+			children[name] = objId
+		}
+
+		c.mu.Lock()
+		if c.generation == generation {
+			c.entries[key] = children
+		}
+		c.mu.Unlock()
+	}
+
+	objectId, found = children[pathCacheName(dev, filename)]
+
+	return objectId, found, nil
+}
+
+// marks a cached filename which is shared by more than one object
+const ambiguousPathCacheObjectId = 0
+
+// filenames are normalized and matched case insensitively, same as [GetObjectFromParentIdAndFilename]
+func pathCacheName(dev *mtp.Device, filename string) string {
+	return strings.ToLower(normalizeFilename(dev, filename))
+}
@@ -0,0 +1,113 @@
+package mtpx
+
+import (
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+)
+
+// Capabilities lists the operations, properties and formats advertised by the device in its DeviceInfo
+// use it to feature-detect the optional operations before invoking them
+type Capabilities struct {
+	// operation codes (mtp.OC_*) supported by the device
+	Operations []uint16
+
+	// device property codes (mtp.DPC_*) supported by the device
+	DeviceProperties []uint16
+
+	// object format codes (mtp.OFC_*) the device can capture
+	CaptureFormats []uint16
+
+	// object format codes (mtp.OFC_*) the device can play back
+	PlaybackFormats []uint16
+
+	operations       map[uint16]bool
+	deviceProperties map[uint16]bool
+}
+
+// fetch the capabilities of the device
+// the DeviceInfo doesn't change during a session, so it is fetched once and cached until [Dispose] is called
+func GetDeviceCapabilities(dev *mtp.Device) (*Capabilities, error) {
+	if c, ok := deviceCapabilitiesCache.Load(dev); ok {
+		return c.(*Capabilities), nil
+	}
+
+	info, err := FetchDeviceInfo(dev)
+	if err != nil {
+		return nil, err
+	}
+
+	c := newCapabilities(info)
+	deviceCapabilitiesCache.Store(dev, c)
+
+	return c, nil
+}
+
+func newCapabilities(info *mtp.DeviceInfo) *Capabilities {
+	c := &Capabilities{
+		Operations:       info.OperationsSupported,
+		DeviceProperties: info.DevicePropertiesSupported,
+		CaptureFormats:   info.CaptureFormats,
+		PlaybackFormats:  info.PlaybackFormats,
+		operations:       map[uint16]bool{},
+		deviceProperties: map[uint16]bool{},
+	}
+
+	for _, code := range info.OperationsSupported {
+		c.operations[code] = true
+	}
+
+	for _, code := range info.DevicePropertiesSupported {
+		c.deviceProperties[code] = true
+	}
+
+	return c
+}
+
+// check if the device supports the MTP operation [opCode]
+func (c *Capabilities) SupportsOperation(opCode uint16) bool {
+	return c.operations[opCode]
+}
+
+// check if the device supports the device property [propCode]
+func (c *Capabilities) SupportsDeviceProperty(propCode uint16) bool {
+	return c.deviceProperties[propCode]
+}
+
+// check if the device can capture objects of the [format]
+func (c *Capabilities) SupportsCaptureFormat(format uint16) bool {
+	for _, f := range c.CaptureFormats {
+		if f == format {
+			return true
+		}
+	}
+
+	return false
+}
+
+// check if the device can move objects without copying them (MoveObject)
+func (c *Capabilities) SupportsMove() bool {
+	return c.SupportsOperation(mtp.OC_MoveObject)
+}
+
+// check if the device can copy objects on the device (CopyObject)
+func (c *Capabilities) SupportsCopy() bool {
+	return c.SupportsOperation(mtp.OC_CopyObject)
+}
+
+// check if the device can fetch a part of an object (GetPartialObject or the 64-bit Android extension)
+func (c *Capabilities) SupportsPartialObject() bool {
+	return c.SupportsOperation(mtp.OC_GetPartialObject) || c.SupportsOperation(mtp.OC_ANDROID_GET_PARTIAL_OBJECT64)
+}
+
+// check if the device can rewrite an existing object in place using the Android edit extension
+// (BeginEditObject, TruncateObject, SendPartialObject and EndEditObject); it is supported by the Android devices
+func (c *Capabilities) SupportsEditObject() bool {
+	return c.SupportsOperation(mtp.OC_ANDROID_BEGIN_EDIT_OBJECT) &&
+		c.SupportsOperation(mtp.OC_ANDROID_TRUNCATE_OBJECT) &&
+		c.SupportsOperation(mtp.OC_ANDROID_SEND_PARTIAL_OBJECT) &&
+		c.SupportsOperation(mtp.OC_ANDROID_END_EDIT_OBJECT)
+}
+
+// check if the device can fetch the properties of multiple objects in a single transaction (GetObjectPropList)
+func (c *Capabilities) SupportsPropList() bool {
+	return c.SupportsOperation(mtp.OC_MTP_GetObjPropList)
+}
@@ -2,7 +2,11 @@ package mtpx
 
 import (
 	"github.com/ganeshrvel/go-mtpfs/mtp"
+	"github.com/ganeshrvel/usb"
 	"os"
+	"reflect"
+	"sync"
+	"time"
 )
 
 const PathSep = string(os.PathSeparator)
@@ -13,8 +17,206 @@ const devTimeout = 15000
 
 const newLocalDirectoryMode = 0755
 
+const newLocalFileMode = 0666
+
+// the extension appended to the local filename of a downloaded file for its sidecar (see [DownloadOpts.WriteSidecar])
+const sidecarExtension = ".json"
+
+// number of bytes buffered per file between the device transfer and the local disk writer
+// the chunks are as big as the transfer buffers, so the number of the queued chunks depends on their size; see [newLocalFileWriterPool]
+const localFileWriterBufferSize = 16 * 1024 * 1024
+
 const disallowedFileName = ":*?\"<>|"
 
 var disallowedFiles = []string{".DS_Store", "[-----DS_Store.mtp.test----].txt"}
 
 var allowedSecondExtensions allowedSecondExtMap = map[string]string{"tar": "tar"}
+
+// content types of the media formats which are commonly found on the devices, keyed by their lowercase extension
+// they take precedence over the [mime] package, whose table depends on the system and lacks most of them
+var mediaMimeTypes = map[string]string{
+	"3gp":  "video/3gpp",
+	"aac":  "audio/aac",
+	"amr":  "audio/amr",
+	"arw":  "image/x-sony-arw",
+	"avi":  "video/x-msvideo",
+	"cr2":  "image/x-canon-cr2",
+	"cr3":  "image/x-canon-cr3",
+	"dng":  "image/x-adobe-dng",
+	"flac": "audio/flac",
+	"heic": "image/heic",
+	"heif": "image/heif",
+	"m4a":  "audio/mp4",
+	"m4v":  "video/x-m4v",
+	"mkv":  "video/x-matroska",
+	"mov":  "video/quicktime",
+	"mp3":  "audio/mpeg",
+	"mp4":  "video/mp4",
+	"nef":  "image/x-nikon-nef",
+	"ogg":  "audio/ogg",
+	"opus": "audio/opus",
+	"wav":  "audio/wav",
+	"webm": "video/webm",
+	"webp": "image/webp",
+	"wma":  "audio/x-ms-wma",
+	"wmv":  "video/x-ms-wmv",
+}
+
+// object formats (mtp.OFC_*) of the uploaded files keyed by their lowercase extension; see [objectFormat]
+var objectFormats = map[string]uint16{
+	"3gp":  mtp.OFC_MTP_3GP,
+	"aac":  mtp.OFC_MTP_AAC,
+	"aif":  mtp.OFC_AIFF,
+	"aiff": mtp.OFC_AIFF,
+	"asf":  mtp.OFC_ASF,
+	"avi":  mtp.OFC_AVI,
+	"bmp":  mtp.OFC_BMP,
+	"dng":  mtp.OFC_DNG,
+	"doc":  mtp.OFC_MTP_MSWordDocument,
+	"flac": mtp.OFC_MTP_FLAC,
+	"gif":  mtp.OFC_GIF,
+	"htm":  mtp.OFC_HTML,
+	"html": mtp.OFC_HTML,
+	"jpeg": mtp.OFC_EXIF_JPEG,
+	"jpg":  mtp.OFC_EXIF_JPEG,
+	"m3u":  mtp.OFC_MTP_M3UPlaylist,
+	"m4a":  mtp.OFC_MTP_M4A,
+	"mp3":  mtp.OFC_MP3,
+	"mp4":  mtp.OFC_MTP_MP4,
+	"mpeg": mtp.OFC_MPEG,
+	"mpg":  mtp.OFC_MPEG,
+	"ogg":  mtp.OFC_MTP_OGG,
+	"pls":  mtp.OFC_MTP_PLSPlaylist,
+	"png":  mtp.OFC_PNG,
+	"ppt":  mtp.OFC_MTP_MSPowerpointPresentationPPT,
+	"tif":  mtp.OFC_TIFF,
+	"tiff": mtp.OFC_TIFF,
+	"txt":  mtp.OFC_Text,
+	"wav":  mtp.OFC_WAV,
+	"wma":  mtp.OFC_MTP_WMA,
+	"wmv":  mtp.OFC_MTP_WMV,
+	"wpl":  mtp.OFC_MTP_WPLPlaylist,
+	"xls":  mtp.OFC_MTP_MSExcelSpreadsheetXLS,
+	"xml":  mtp.OFC_MTP_XMLDocument,
+}
+
+// content type of the files whose extension is unknown
+const defaultMimeType = "application/octet-stream"
+
+// the devices created by [Initialize] keyed by [*mtp.Device]
+var initializedDevices sync.Map
+
+// [Capabilities] of the connected devices keyed by [*mtp.Device]
+var deviceCapabilitiesCache sync.Map
+
+// [RetryPolicy] of the connected devices keyed by [*mtp.Device]
+var deviceRetryPolicies sync.Map
+
+// libusb transfer errors which are retried by [withRetry]
+var transientUsbErrors = map[usb.Error]bool{
+	usb.ERROR_IO:          true,
+	usb.ERROR_BUSY:        true,
+	usb.ERROR_TIMEOUT:     true,
+	usb.ERROR_PIPE:        true,
+	usb.ERROR_OVERFLOW:    true,
+	usb.ERROR_INTERRUPTED: true,
+}
+
+// [FilenamePolicy] of the connected devices keyed by [*mtp.Device]
+var deviceFilenamePolicies sync.Map
+
+// the devices which pick the first of the duplicate objects while resolving the paths, keyed by [*mtp.Device]
+var devicePreferFirstDuplicate sync.Map
+
+// the filename normalizers of the connected devices keyed by [*mtp.Device]
+var deviceFilenameNormalizers sync.Map
+
+// the devices which check the access capability of the storage before the mutations, keyed by [*mtp.Device]
+var deviceCheckStorageWritable sync.Map
+
+// the devices with an active [OpenObject], [CreateObjectWriter] or [MtpFS.Open] stream keyed by [*mtp.Device]
+var activeObjectStreams sync.Map
+
+// [*writableObjectProps] of the connected devices keyed by [*mtp.Device]
+var deviceWritableObjectProps sync.Map
+
+// per call timeout of the connected devices keyed by [*mtp.Device]
+var devicePerCallTimeouts sync.Map
+
+// the devices with a timed out transaction which is still running, keyed by [*mtp.Device]
+var deviceStalledTransactions sync.Map
+
+// [*cacheInvalidators] of the connected devices keyed by [*mtp.Device]
+var deviceCacheInvalidators sync.Map
+
+// [*supportedObjectProps] of the connected devices keyed by [*mtp.Device]
+var deviceSupportedObjectProps sync.Map
+
+// Go types of the MTP datatypes (mtp.DTC_*) returned by [decodeObjectPropValue]
+var propDataTypes = map[uint16]reflect.Type{
+	mtp.DTC_INT8:    reflect.TypeOf(int8(0)),
+	mtp.DTC_UINT8:   reflect.TypeOf(uint8(0)),
+	mtp.DTC_INT16:   reflect.TypeOf(int16(0)),
+	mtp.DTC_UINT16:  reflect.TypeOf(uint16(0)),
+	mtp.DTC_INT32:   reflect.TypeOf(int32(0)),
+	mtp.DTC_UINT32:  reflect.TypeOf(uint32(0)),
+	mtp.DTC_INT64:   reflect.TypeOf(int64(0)),
+	mtp.DTC_UINT64:  reflect.TypeOf(uint64(0)),
+	mtp.DTC_INT128:  reflect.TypeOf([16]byte{}),
+	mtp.DTC_UINT128: reflect.TypeOf([16]byte{}),
+}
+
+// format of the OPC_DateModified property
+const dateModifiedFormat = "20060102T150405"
+
+// interval between the GetStorageInfo polls of [WaitForStorage]
+const storageReadyPollInterval = 250 * time.Millisecond
+
+// name of the libusb error returned when the device is gone (usb.ERROR_NO_DEVICE)
+const libusbNoDeviceErrorName = "LIBUSB_ERROR_NO_DEVICE"
+
+// returned by the mtp library once it has closed the connection after a fatal USB error
+const mtpDeviceNotOpenMessage = "device is not open"
+
+// default size of the reusable buffers of the transfers; a multiple of the USB bulk packet sizes
+const defaultTransferBufferSize = 256 * 1024
+
+// buffers of the transfers which aren't a part of a batch (eg: [CreateObjectWriter] and the hashing of the local files)
+var transferBuffers = newBufferPool(defaultTransferBufferSize)
+
+// default sliding window of [ProgressInfo.BytesPerSecond]
+const defaultThroughputWindow = 3 * time.Second
+
+// suffix of the temporary name of a file uploaded by [UploadOpts.Atomic]
+const atomicUploadSuffix = ".mtpx-tmp"
+
+// suffix of the name the replaced file is moved aside to while an atomic upload is committed
+const atomicReplacedSuffix = ".mtpx-old"
+
+// size of the chunks written by the Android SendPartialObject while an existing object is rewritten in place
+const editObjectChunkSize = 1024 * 1024
+
+// suffix of the name of the incomplete object of [UploadFileResume]
+const resumableUploadSuffix = ".mtpx-partial"
+
+// size of the chunks appended by [UploadFileResume]; every chunk is committed on its own, so an interrupted upload loses at most one chunk
+const resumableUploadChunkSize = 16 * 1024 * 1024
+
+// number of leading bytes of an object read by [DetectContentType]; it's the most [http.DetectContentType] considers
+const contentSniffLength = 512
+
+// the difference in the modification times which is ignored while comparing the local and the device files by [SyncToDevice] and [SyncFromDevice]
+// the devices store the modification times in seconds and FAT stores them in 2 second units
+const syncModTimeTolerance = 2 * time.Second
+
+// interval between the object snapshots compared by [PollEvents] if none is given
+const defaultEventPollInterval = 2 * time.Second
+
+// interval between the GetStorageInfo polls of [WatchStorage] if none is given
+const defaultStorageWatchInterval = 5 * time.Second
+
+// number of the largest files listed by [PreScanLocal]
+const preScanLargestFilesCount = 10
+
+// objectId of the directories which are planned but not created by a dry run
+const dryRunObjectId = 0
@@ -0,0 +1,76 @@
+package mtpx
+
+import (
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"log"
+	"math/rand"
+	"testing"
+)
+
+func TestCopyFile(t *testing.T) {
+	dev, err := Initialize(Init{})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	storages, err := FetchStorages(dev)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	sid := storages[0].Sid
+
+	Convey("Copy an existing file | CopyFile", t, func() {
+		// create a random destination directory
+		// test the directory '/mtp-test-files/temp_dir/test-CopyFile/{random}'
+		destParentPath := fmt.Sprintf("/mtp-test-files/temp_dir/test-CopyFile/%x", rand.Int31())
+
+		_, err := MakeDirectory(dev, sid, destParentPath)
+		So(err, ShouldBeNil)
+
+		source, err := GetObjectFromPath(dev, sid, "/mtp-test-files/a.txt")
+		So(err, ShouldBeNil)
+
+		objId, err := CopyFile(dev, sid, source.ObjectId, destParentPath, false)
+		So(err, ShouldBeNil)
+		So(objId, ShouldBeGreaterThan, 0)
+		So(objId, ShouldNotEqual, source.ObjectId)
+
+		fi, err := GetObjectFromPath(dev, sid, getFullPath(destParentPath, "a.txt"))
+		So(err, ShouldBeNil)
+		So(fi.ObjectId, ShouldEqual, objId)
+		So(fi.Size, ShouldEqual, source.Size)
+
+		// copy the file again without overwriting
+		objId2, err := CopyFile(dev, sid, source.ObjectId, destParentPath, false)
+		So(err, ShouldBeNil)
+		So(objId2, ShouldEqual, objId)
+
+		// copy the file again and overwrite the existing one
+		objId3, err := CopyFile(dev, sid, source.ObjectId, destParentPath, true)
+		So(err, ShouldBeNil)
+		So(objId3, ShouldNotEqual, objId)
+
+		fi, err = GetObjectFromPath(dev, sid, getFullPath(destParentPath, "a.txt"))
+		So(err, ShouldBeNil)
+		So(fi.ObjectId, ShouldEqual, objId3)
+	})
+
+	Convey("Copy a file into its own directory | CopyFile | Should throw an error", t, func() {
+		source, err := GetObjectFromPath(dev, sid, "/mtp-test-files/a.txt")
+		So(err, ShouldBeNil)
+
+		objId, err := CopyFile(dev, sid, source.ObjectId, "/mtp-test-files", true)
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+		So(objId, ShouldEqual, 0)
+	})
+
+	Convey("Copy an non existing object | CopyFile | Should throw an error", t, func() {
+		objId, err := CopyFile(dev, sid, 1234567, "/mtp-test-files/temp_dir", false)
+		So(err, ShouldHaveSameTypeAs, FileObjectError{})
+		So(objId, ShouldEqual, 0)
+	})
+
+	Dispose(dev)
+}
@@ -118,3 +118,160 @@ func TestDeleteFile(t *testing.T) {
 
 	Dispose(dev)
 }
+
+func TestDeleteFileRecursive(t *testing.T) {
+	dev, err := Initialize(Init{})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	storages, err := FetchStorages(dev)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	sid := storages[0].Sid
+
+	Convey("Delete a nested directory | using fullPath | DeleteFileRecursive", t, func() {
+		// create a random nested directory tree
+		// test the directory '/mtp-test-files/temp_dir/test-DeleteFileRecursive/{random}'
+		directoryName := fmt.Sprintf("/mtp-test-files/temp_dir/test-DeleteFileRecursive/%x", rand.Int31())
+
+		_, err := MakeDirectory(dev, sid, getFullPath(directoryName, "1/2/3"))
+		So(err, ShouldBeNil)
+
+		_, err = MakeDirectory(dev, sid, getFullPath(directoryName, "4"))
+		So(err, ShouldBeNil)
+
+		count, err := DeleteFileRecursive(dev, sid, 0, directoryName)
+		So(err, ShouldBeNil)
+		So(count, ShouldEqual, 5)
+
+		_, err = GetObjectFromPath(dev, sid, directoryName)
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+	})
+
+	Convey("List a nested directory | DryRun=true | DeleteFileRecursiveWithOpts", t, func() {
+		// create a random nested directory tree
+		// test the directory '/mtp-test-files/temp_dir/test-DeleteFileRecursive/{random}'
+		directoryName := fmt.Sprintf("/mtp-test-files/temp_dir/test-DeleteFileRecursive/%x", rand.Int31())
+
+		_, err := MakeDirectory(dev, sid, getFullPath(directoryName, "1/2/3"))
+		So(err, ShouldBeNil)
+
+		_, err = MakeDirectory(dev, sid, getFullPath(directoryName, "4"))
+		So(err, ShouldBeNil)
+
+		var fullPaths []string
+		count, err := DeleteFileRecursiveWithOpts(dev, sid, 0, directoryName, DeleteOpts{
+			DryRun: true,
+			DryRunCb: func(action DryRunAction, fullPath string, size int64) error {
+				So(action, ShouldEqual, DryRunDelete)
+				fullPaths = append(fullPaths, fullPath)
+
+				return nil
+			},
+		})
+		So(err, ShouldBeNil)
+		So(count, ShouldEqual, 5)
+		So(len(fullPaths), ShouldEqual, 5)
+		So(fullPaths[4], ShouldEqual, directoryName)
+
+		// nothing is deleted
+		_, err = GetObjectFromPath(dev, sid, getFullPath(directoryName, "1/2/3"))
+		So(err, ShouldBeNil)
+
+		count, err = DeleteFileRecursive(dev, sid, 0, directoryName)
+		So(err, ShouldBeNil)
+		So(count, ShouldEqual, 5)
+	})
+
+	Convey("Delete an empty directory | using objectId | DeleteFileRecursive", t, func() {
+		// test the directory '/mtp-test-files/temp_dir/test-DeleteFileRecursive/{random}'
+		directoryName := fmt.Sprintf("/mtp-test-files/temp_dir/test-DeleteFileRecursive/%x", rand.Int31())
+
+		objectId, err := MakeDirectory(dev, sid, directoryName)
+		So(err, ShouldBeNil)
+
+		count, err := DeleteFileRecursive(dev, sid, objectId, "")
+		So(err, ShouldBeNil)
+		So(count, ShouldEqual, 1)
+	})
+
+	Convey("Delete an non existing object | DeleteFileRecursive", t, func() {
+		// test the directory '/mtp-test-files/temp_dir/test-DeleteFileRecursive/{random}'
+		directoryName := fmt.Sprintf("/mtp-test-files/temp_dir/test-DeleteFileRecursive/%x", rand.Int31())
+
+		count, err := DeleteFileRecursive(dev, sid, 0, directoryName)
+		So(err, ShouldBeNil)
+		So(count, ShouldEqual, 0)
+	})
+
+	Convey("Delete the root directory | DeleteFileRecursive | Should throw an error", t, func() {
+		count, err := DeleteFileRecursive(dev, sid, 0, "/")
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+		So(count, ShouldEqual, 0)
+	})
+
+	Dispose(dev)
+}
+
+func TestDeleteFiles(t *testing.T) {
+	dev, err := Initialize(Init{})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	storages, err := FetchStorages(dev)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	sid := storages[0].Sid
+
+	Convey("Delete multiple paths | DeleteFiles", t, func() {
+		// test the directory '/mtp-test-files/temp_dir/test-DeleteFiles/{random}'
+		directoryName := fmt.Sprintf("/mtp-test-files/temp_dir/test-DeleteFiles/%x", rand.Int31())
+
+		_, err := MakeDirectory(dev, sid, getFullPath(directoryName, "1/2"))
+		So(err, ShouldBeNil)
+
+		_, err = MakeDirectory(dev, sid, getFullPath(directoryName, "3"))
+		So(err, ShouldBeNil)
+
+		missing := getFullPath(directoryName, "4")
+
+		// the child is listed after its parent
+		report, err := DeleteFiles(dev, sid, []string{
+			getFullPath(directoryName, "1"), getFullPath(directoryName, "1/2"), getFullPath(directoryName, "3"), missing,
+		}, DeleteOpts{})
+		So(err, ShouldBeNil)
+		So(report.Deleted, ShouldResemble, []string{getFullPath(directoryName, "1/2"), getFullPath(directoryName, "1"), getFullPath(directoryName, "3")})
+		So(report.NotFound, ShouldResemble, []string{missing})
+		So(len(report.Failed), ShouldEqual, 0)
+
+		_, err = GetObjectFromPath(dev, sid, getFullPath(directoryName, "1"))
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+	})
+
+	Convey("Delete the root directory | ContinueOnError=true | DeleteFiles | Should throw an error", t, func() {
+		// test the directory '/mtp-test-files/temp_dir/test-DeleteFiles/{random}'
+		directoryName := fmt.Sprintf("/mtp-test-files/temp_dir/test-DeleteFiles/%x", rand.Int31())
+
+		_, err := MakeDirectory(dev, sid, directoryName)
+		So(err, ShouldBeNil)
+
+		report, err := DeleteFiles(dev, sid, []string{"/", directoryName}, DeleteOpts{ContinueOnError: true})
+		So(err, ShouldHaveSameTypeAs, BatchError{})
+		So(len(report.Failed), ShouldEqual, 1)
+		So(report.Failed[0].FullPath, ShouldEqual, "/")
+		So(report.Deleted, ShouldResemble, []string{directoryName})
+
+		// the deletion stops at the first failure
+		report, err = DeleteFiles(dev, sid, []string{"/"}, DeleteOpts{})
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+		So(len(report.Deleted), ShouldEqual, 0)
+	})
+
+	Dispose(dev)
+}
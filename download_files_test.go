@@ -1,12 +1,18 @@
 package mtpx
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
+	"github.com/ganeshrvel/go-mtpfs/mtp"
 	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestDownloadFiles(t *testing.T) {
@@ -1885,3 +1891,565 @@ func TestDownloadFiles(t *testing.T) {
 
 	Dispose(dev)
 }
+
+func TestDownloadFilesWithOpts(t *testing.T) {
+	dev, err := Initialize(Init{})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	storages, err := FetchStorages(dev)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	sid := storages[0].Sid
+
+	Convey("Single directory | Concurrency=4 | DownloadFilesWithOpts", t, func() {
+		// test directories: '/mtp-test-files/mock_dir1/'
+		destination := newTempMocksDir("test_DownloadFilesWithOpts", true)
+		sourceFile1 := "/mtp-test-files/mock_dir1/"
+		sources := []string{sourceFile1}
+
+		var preprocessedFiles int64
+		var prevBulkSent int64
+		var status TransferStatus
+		totalFiles, totalSize, err := DownloadFilesWithOpts(dev, sid,
+			sources,
+			destination,
+			DownloadOpts{
+				Concurrency: 4,
+				PreprocessCb: func(fi *FileInfo, err error) error {
+					So(err, ShouldBeNil)
+					So(fi.IsDir, ShouldEqual, false)
+
+					preprocessedFiles += 1
+
+					return nil
+				},
+				ProgressCb: func(fi *ProgressInfo, err error) error {
+					So(err, ShouldBeNil)
+					So(fi, ShouldNotBeNil)
+
+					// the files are always pre-processed
+					So(fi.TotalFiles, ShouldEqual, 5)
+					So(fi.BulkFileSize.Total, ShouldEqual, 35)
+
+					So(fi.BulkFileSize.Sent, ShouldBeGreaterThanOrEqualTo, prevBulkSent)
+					prevBulkSent = fi.BulkFileSize.Sent
+
+					So(fi.BytesPerSecond, ShouldBeGreaterThanOrEqualTo, 0)
+					So(fi.Elapsed, ShouldBeGreaterThanOrEqualTo, 0)
+
+					status = fi.Status
+
+					return nil
+				},
+				ThroughputWindow: time.Second,
+			},
+		)
+
+		So(err, ShouldBeNil)
+		So(status, ShouldEqual, Completed)
+		So(preprocessedFiles, ShouldEqual, 5)
+		So(totalFiles, ShouldEqual, 5)
+		So(totalSize, ShouldEqual, 35)
+
+		// compare the downloaded files with the mock files
+		for _, f := range []string{"a.txt", "1/a.txt", "2/b.txt", "3/b.txt", "3/2/b.txt"} {
+			downloaded, err := ioutil.ReadFile(filepath.Join(destination, "mock_dir1", f))
+			So(err, ShouldBeNil)
+
+			original, err := ioutil.ReadFile(getTestMocksAsset(filepath.Join("mock_dir1", f)))
+			So(err, ShouldBeNil)
+
+			So(string(downloaded), ShouldEqual, string(original))
+		}
+	})
+
+	Convey("Invalid source | DownloadFilesWithOpts | It should throw an error", t, func() {
+		destination := newTempMocksDir("test_DownloadFilesWithOpts", true)
+
+		totalFiles, totalSize, err := DownloadFilesWithOpts(dev, sid,
+			[]string{"/mtp-test-files/fake"},
+			destination,
+			DownloadOpts{
+				Concurrency: 2,
+				ProgressCb: func(fi *ProgressInfo, err error) error {
+					return nil
+				},
+				StopOnError: true,
+			},
+		)
+
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+		So(totalFiles, ShouldEqual, 0)
+		So(totalSize, ShouldEqual, 0)
+	})
+
+	Convey("Invalid source along with a valid source | StopOnError=false | DownloadFilesWithOpts | It should return a BatchError", t, func() {
+		destination := newTempMocksDir("test_DownloadFilesWithOpts", true)
+
+		var completed bool
+		totalFiles, totalSize, err := DownloadFilesWithOpts(dev, sid,
+			[]string{"/mtp-test-files/fake", "/mtp-test-files/a.txt"},
+			destination,
+			DownloadOpts{
+				Concurrency: 2,
+				ProgressCb: func(fi *ProgressInfo, err error) error {
+					if fi.Status == Completed {
+						completed = true
+					}
+
+					return nil
+				},
+			},
+		)
+
+		So(err, ShouldHaveSameTypeAs, BatchError{})
+		So(completed, ShouldBeTrue)
+		So(totalFiles, ShouldEqual, 1)
+		So(totalSize, ShouldBeGreaterThan, 0)
+
+		failures := err.(BatchError).Failures
+		So(len(failures), ShouldEqual, 1)
+		So(failures[0].FullPath, ShouldEqual, "/mtp-test-files/fake")
+		So(failures[0].Err, ShouldHaveSameTypeAs, InvalidPathError{})
+
+		So(fileExistsLocal(filepath.Join(destination, "a.txt")), ShouldBeTrue)
+	})
+
+	Convey("Flatten | DownloadFilesWithOpts", t, func() {
+		// test directories: '/mtp-test-files/mock_dir1/'
+		destination := newTempMocksDir("test_DownloadFilesWithOpts", true)
+
+		totalFiles, totalSize, err := DownloadFilesWithOpts(dev, sid,
+			[]string{"/mtp-test-files/mock_dir1/"},
+			destination,
+			DownloadOpts{
+				ProgressCb: func(fi *ProgressInfo, err error) error {
+					return nil
+				},
+				Flatten: true,
+			},
+		)
+
+		So(err, ShouldBeNil)
+		So(totalFiles, ShouldEqual, 5)
+		So(totalSize, ShouldEqual, 35)
+
+		// the colliding names get a numeric suffix and no directory is created
+		entries, err := ioutil.ReadDir(destination)
+		So(err, ShouldBeNil)
+
+		var names []string
+		for _, e := range entries {
+			So(e.IsDir(), ShouldBeFalse)
+
+			names = append(names, e.Name())
+		}
+		So(names, ShouldResemble, []string{"a (1).txt", "a.txt", "b (1).txt", "b (2).txt", "b.txt"})
+	})
+
+	Convey("WriteSidecar | DownloadFilesWithOpts", t, func() {
+		destination := newTempMocksDir("test_DownloadFilesWithOpts", true)
+
+		_, _, err := DownloadFilesWithOpts(dev, sid,
+			[]string{"/mtp-test-files/a.txt"},
+			destination,
+			DownloadOpts{
+				ProgressCb: func(fi *ProgressInfo, err error) error {
+					return nil
+				},
+				WriteSidecar: true,
+				SidecarProps: []uint16{mtp.OPC_ObjectSize, mtp.OPC_ObjectFileName},
+			},
+		)
+		So(err, ShouldBeNil)
+
+		data, err := ioutil.ReadFile(filepath.Join(destination, "a.txt.json"))
+		So(err, ShouldBeNil)
+
+		var sidecar ObjectSidecar
+		So(json.Unmarshal(data, &sidecar), ShouldBeNil)
+		So(sidecar.FullPath, ShouldEqual, "/mtp-test-files/a.txt")
+		So(sidecar.Properties["ObjectFileName"], ShouldEqual, "a.txt")
+		So(sidecar.Properties, ShouldContainKey, "ObjectSize")
+	})
+
+	Convey("Batch progress | DownloadFilesWithOpts", t, func() {
+		destination := newTempMocksDir("test_DownloadFilesWithOpts", true)
+
+		var pTotalBytes, pSentBytes, pTotalFiles, pCompletedFiles int64
+		totalFiles, totalSize, err := DownloadFilesWithOpts(dev, sid,
+			[]string{"/mtp-test-files/mock_dir1"},
+			destination,
+			DownloadOpts{
+				Concurrency: 2,
+				ProgressCb: func(fi *ProgressInfo, err error) error {
+					return nil
+				},
+				BatchProgressCb: func(totalBytes, sentBytes, totalFiles, completedFiles int64, currentPath string) error {
+					So(sentBytes, ShouldBeGreaterThanOrEqualTo, pSentBytes)
+					So(completedFiles, ShouldBeGreaterThanOrEqualTo, pCompletedFiles)
+					So(currentPath, ShouldStartWith, "/mtp-test-files/mock_dir1")
+
+					pTotalBytes = totalBytes
+					pSentBytes = sentBytes
+					pTotalFiles = totalFiles
+					pCompletedFiles = completedFiles
+
+					return nil
+				},
+				StopOnError: true,
+			},
+		)
+
+		So(err, ShouldBeNil)
+		So(totalFiles, ShouldEqual, 5)
+		So(pTotalFiles, ShouldEqual, totalFiles)
+		So(pCompletedFiles, ShouldEqual, totalFiles)
+		So(pTotalBytes, ShouldEqual, totalSize)
+		So(pSentBytes, ShouldEqual, totalSize)
+	})
+
+	Convey("Batch progress | cancel | DownloadFilesWithOpts | It should throw an error", t, func() {
+		destination := newTempMocksDir("test_DownloadFilesWithOpts", true)
+
+		_, _, err := DownloadFilesWithOpts(dev, sid,
+			[]string{"/mtp-test-files/mock_dir1"},
+			destination,
+			DownloadOpts{
+				ProgressCb: func(fi *ProgressInfo, err error) error {
+					return nil
+				},
+				BatchProgressCb: func(totalBytes, sentBytes, totalFiles, completedFiles int64, currentPath string) error {
+					return fmt.Errorf("canceled")
+				},
+			},
+		)
+
+		So(err, ShouldHaveSameTypeAs, FileTransferError{})
+	})
+
+	Convey("DirMode and FileMode | DownloadFilesWithOpts", t, func() {
+		destination := newTempMocksDir("test_DownloadFilesWithOpts", true)
+
+		// the file which already exists gets the configured mode as well
+		existing := filepath.Join(destination, "mock_dir1", "a.txt")
+		err := os.MkdirAll(filepath.Dir(existing), 0755)
+		So(err, ShouldBeNil)
+		err = ioutil.WriteFile(existing, []byte("stale"), 0644)
+		So(err, ShouldBeNil)
+
+		totalFiles, _, err := DownloadFilesWithOpts(dev, sid,
+			[]string{"/mtp-test-files/mock_dir1"},
+			destination,
+			DownloadOpts{
+				Concurrency: 2,
+				ProgressCb: func(fi *ProgressInfo, err error) error {
+					return nil
+				},
+				DirMode:  0700,
+				FileMode: 0600,
+			},
+		)
+
+		So(err, ShouldBeNil)
+		So(totalFiles, ShouldEqual, 5)
+
+		for _, f := range []string{"a.txt", "1/a.txt", "3/2/b.txt"} {
+			fi, err := os.Stat(filepath.Join(destination, "mock_dir1", f))
+			So(err, ShouldBeNil)
+			So(fi.Mode().Perm(), ShouldEqual, os.FileMode(0600))
+		}
+
+		for _, d := range []string{"1", "3", "3/2"} {
+			fi, err := os.Stat(filepath.Join(destination, "mock_dir1", d))
+			So(err, ShouldBeNil)
+			So(fi.Mode().Perm(), ShouldEqual, os.FileMode(0700))
+		}
+
+		downloaded, err := ioutil.ReadFile(existing)
+		So(err, ShouldBeNil)
+		So(string(downloaded), ShouldNotEqual, "stale")
+	})
+
+	Convey("Preserve the modification time | DownloadFilesWithOpts", t, func() {
+		for _, concurrency := range []int{1, 4} {
+			destination := newTempMocksDir("test_DownloadFilesWithOpts", true)
+
+			_, _, err := DownloadFilesWithOpts(dev, sid,
+				[]string{"/mtp-test-files/mock_dir1"},
+				destination,
+				DownloadOpts{
+					Concurrency: concurrency,
+					ProgressCb: func(fi *ProgressInfo, err error) error {
+						return nil
+					},
+				},
+			)
+			So(err, ShouldBeNil)
+
+			for _, f := range []string{"a.txt", "3/2/b.txt"} {
+				fi, err := GetObjectFromPath(dev, sid, filepath.Join("/mtp-test-files/mock_dir1", f))
+				So(err, ShouldBeNil)
+
+				st, err := os.Stat(filepath.Join(destination, "mock_dir1", f))
+				So(err, ShouldBeNil)
+				So(st.ModTime(), ShouldHappenWithin, time.Second, fi.ModTime)
+			}
+		}
+
+		// the files keep the time of the download
+		destination := newTempMocksDir("test_DownloadFilesWithOpts", true)
+		start := time.Now()
+
+		_, _, err := DownloadFilesWithOpts(dev, sid,
+			[]string{"/mtp-test-files/mock_dir1/a.txt"},
+			destination,
+			DownloadOpts{
+				ProgressCb: func(fi *ProgressInfo, err error) error {
+					return nil
+				},
+				SkipPreserveModTime: true,
+			},
+		)
+		So(err, ShouldBeNil)
+
+		st, err := os.Stat(filepath.Join(destination, "a.txt"))
+		So(err, ShouldBeNil)
+		So(st.ModTime(), ShouldHappenWithin, time.Minute, start)
+	})
+
+	Dispose(dev)
+}
+
+func TestDownloadFileResume(t *testing.T) {
+	dev, err := Initialize(Init{})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	storages, err := FetchStorages(dev)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	sid := storages[0].Sid
+
+	fi, err := GetObjectFromPath(dev, sid, "/mtp-test-files/4mb_txt_file")
+	if err != nil {
+		log.Panic(err)
+	}
+
+	original, err := ioutil.ReadFile(getTestMocksAsset("4mb_txt_file"))
+	if err != nil {
+		log.Panic(err)
+	}
+
+	Convey("Download a new file | DownloadFileResume", t, func() {
+		destination := filepath.Join(newTempMocksDir("test_DownloadFileResume", true), "4mb_txt_file")
+
+		err := DownloadFileResume(dev, fi.ObjectId, destination)
+		So(err, ShouldBeNil)
+
+		downloaded, err := ioutil.ReadFile(destination)
+		So(err, ShouldBeNil)
+		So(int64(len(downloaded)), ShouldEqual, fi.Size)
+		So(string(downloaded), ShouldEqual, string(original))
+	})
+
+	Convey("Resume a partially downloaded file | DownloadFileResume", t, func() {
+		destination := filepath.Join(newTempMocksDir("test_DownloadFileResume", true), "4mb_txt_file")
+
+		err := ioutil.WriteFile(destination, original[:len(original)/3], os.ModePerm)
+		So(err, ShouldBeNil)
+
+		err = DownloadFileResume(dev, fi.ObjectId, destination)
+		So(err, ShouldBeNil)
+
+		downloaded, err := ioutil.ReadFile(destination)
+		So(err, ShouldBeNil)
+		So(string(downloaded), ShouldEqual, string(original))
+
+		// resuming a completed file is a no-op
+		err = DownloadFileResume(dev, fi.ObjectId, destination)
+		So(err, ShouldBeNil)
+
+		downloaded, err = ioutil.ReadFile(destination)
+		So(err, ShouldBeNil)
+		So(string(downloaded), ShouldEqual, string(original))
+	})
+
+	Convey("Resume a partial file larger than the object | DownloadFileResume | It should restart the download", t, func() {
+		destination := filepath.Join(newTempMocksDir("test_DownloadFileResume", true), "4mb_txt_file")
+
+		err := ioutil.WriteFile(destination, append(append([]byte{}, original...), []byte("corrupted")...), os.ModePerm)
+		So(err, ShouldBeNil)
+
+		err = DownloadFileResume(dev, fi.ObjectId, destination)
+		So(err, ShouldBeNil)
+
+		downloaded, err := ioutil.ReadFile(destination)
+		So(err, ShouldBeNil)
+		So(string(downloaded), ShouldEqual, string(original))
+	})
+
+	Convey("Resume a directory | DownloadFileResume | It should throw an error", t, func() {
+		dir, err := GetObjectFromPath(dev, sid, "/mtp-test-files/mock_dir1")
+		So(err, ShouldBeNil)
+
+		destination := filepath.Join(newTempMocksDir("test_DownloadFileResume", true), "mock_dir1")
+
+		err = DownloadFileResume(dev, dir.ObjectId, destination)
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+	})
+
+	Dispose(dev)
+}
+
+func TestOpenObject(t *testing.T) {
+	dev, err := Initialize(Init{})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	storages, err := FetchStorages(dev)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	sid := storages[0].Sid
+
+	fi, err := GetObjectFromPath(dev, sid, "/mtp-test-files/4mb_txt_file")
+	if err != nil {
+		log.Panic(err)
+	}
+
+	original, err := ioutil.ReadFile(getTestMocksAsset("4mb_txt_file"))
+	if err != nil {
+		log.Panic(err)
+	}
+
+	Convey("Download a file to many writers | DownloadObjectTo", t, func() {
+		var buf bytes.Buffer
+		h := sha256.New()
+
+		err := DownloadObjectTo(dev, fi.ObjectId, &buf, h)
+		So(err, ShouldBeNil)
+		So(buf.String(), ShouldEqual, string(original))
+
+		expected := sha256.Sum256(original)
+		So(h.Sum(nil), ShouldResemble, expected[:])
+
+		// a failed writer is reported and the session of the device stays usable
+		buf.Reset()
+		err = DownloadObjectTo(dev, fi.ObjectId, &buf, &failingWriter{limit: 1024})
+		So(err, ShouldHaveSameTypeAs, WriterError{})
+		So(err.(WriterError).Index, ShouldEqual, 1)
+
+		_, err = GetObjectFromObjectId(dev, fi.ObjectId, "")
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Stream a file | OpenObject", t, func() {
+		r, err := OpenObject(dev, fi.ObjectId)
+		So(err, ShouldBeNil)
+
+		b, err := ioutil.ReadAll(r)
+		So(err, ShouldBeNil)
+		So(string(b), ShouldEqual, string(original))
+
+		err = r.Close()
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Open a second stream | OpenObject | It should throw an error", t, func() {
+		r, err := OpenObject(dev, fi.ObjectId)
+		So(err, ShouldBeNil)
+
+		_, err = OpenObject(dev, fi.ObjectId)
+		So(err, ShouldHaveSameTypeAs, DeviceBusyError{})
+
+		_ = r.Close()
+
+		// the device is released once the stream is closed
+		r, err = OpenObject(dev, fi.ObjectId)
+		So(err, ShouldBeNil)
+
+		_, err = ioutil.ReadAll(r)
+		So(err, ShouldBeNil)
+		_ = r.Close()
+	})
+
+	Convey("Stream a directory | OpenObject | It should throw an error", t, func() {
+		dir, err := GetObjectFromPath(dev, sid, "/mtp-test-files/mock_dir1")
+		So(err, ShouldBeNil)
+
+		r, err := OpenObject(dev, dir.ObjectId)
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+		So(r, ShouldBeNil)
+	})
+
+	Dispose(dev)
+}
+
+func TestGetThumbnail(t *testing.T) {
+	dev, err := Initialize(Init{})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	storages, err := FetchStorages(dev)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	sid := storages[0].Sid
+
+	Convey("Fetch the thumbnail of a text file | GetThumbnail | It should throw an error", t, func() {
+		fi, err := GetObjectFromPath(dev, sid, "/mtp-test-files/4mb_txt_file")
+		So(err, ShouldBeNil)
+
+		data, err := GetThumbnail(dev, fi.ObjectId)
+		So(err, ShouldHaveSameTypeAs, ThumbnailUnavailableError{})
+		So(data, ShouldBeNil)
+	})
+
+	Dispose(dev)
+}
+
+func TestDetectContentType(t *testing.T) {
+	dev, err := Initialize(Init{})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	storages, err := FetchStorages(dev)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	sid := storages[0].Sid
+
+	Convey("Detect the content type of a file without an extension | DetectContentType", t, func() {
+		fi, err := GetObjectFromPath(dev, sid, "/mtp-test-files/4mb_txt_file")
+		So(err, ShouldBeNil)
+		So(fi.MimeType(), ShouldEqual, "application/octet-stream")
+
+		contentType, err := DetectContentType(dev, fi.ObjectId)
+		So(err, ShouldBeNil)
+		So(contentType, ShouldEqual, "text/plain; charset=utf-8")
+	})
+
+	Convey("Detect the content type of a directory | DetectContentType | It should throw an error", t, func() {
+		fi, err := GetObjectFromPath(dev, sid, "/mtp-test-files")
+		So(err, ShouldBeNil)
+
+		_, err = DetectContentType(dev, fi.ObjectId)
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+	})
+
+	Dispose(dev)
+}
@@ -6,3 +6,84 @@ const (
 	InProgress TransferStatus = "InProgress"
 	Completed  TransferStatus = "Completed"
 )
+
+type HashAlgo string
+
+const (
+	HashMd5    HashAlgo = "md5"
+	HashSha1   HashAlgo = "sha1"
+	HashSha256 HashAlgo = "sha256"
+)
+
+// filename comparison used while resolving the paths
+type FilenameMatch string
+
+const (
+	FilenameMatchExact           FilenameMatch = "exact"
+	FilenameMatchCaseInsensitive FilenameMatch = "caseInsensitive"
+)
+
+// a change on the device reported by [PollEvents]
+type EventType string
+
+const (
+	EventObjectAdded    EventType = "OBJECT_ADDED"
+	EventObjectRemoved  EventType = "OBJECT_REMOVED"
+	EventStorageChanged EventType = "STORAGE_CHANGED"
+)
+
+// an action planned by a dry run
+type DryRunAction string
+
+const (
+	DryRunCreateDir DryRunAction = "CREATE_DIR"
+	DryRunUpload    DryRunAction = "UPLOAD"
+	DryRunOverwrite DryRunAction = "OVERWRITE"
+	DryRunDelete    DryRunAction = "DELETE"
+)
+
+// an action taken by [SyncToDevice] or [SyncFromDevice]
+type SyncActionType string
+
+const (
+	SyncCreateDir SyncActionType = "CREATE_DIR"
+	SyncUpload    SyncActionType = "UPLOAD"
+	SyncDownload  SyncActionType = "DOWNLOAD"
+	SyncUpdate    SyncActionType = "UPDATE"
+	SyncDelete    SyncActionType = "DELETE"
+
+	// the modified file was left untouched by the [SyncOpts.ConflictPolicy], or a file conflicts with a directory
+	SyncSkip SyncActionType = "SKIP"
+)
+
+// resolution of a conflict with an existing file of the same name on the device
+type ConflictPolicy int
+
+const (
+	// leave the existing file untouched
+	ConflictSkip ConflictPolicy = iota
+
+	// replace the existing file
+	ConflictOverwrite
+
+	// replace the existing file if the local file was modified after it
+	ConflictOverwriteIfNewer
+
+	// replace the existing file if its size differs from the local file
+	ConflictOverwriteIfDifferentSize
+
+	// keep the existing file and create the new one as "name (1).ext", "name (2).ext" and so on
+	ConflictRenameWithSuffix
+)
+
+// order of the children listed by [ReadDirPage]
+type SortField string
+
+const (
+	SortByNameAsc     SortField = "nameAsc"
+	SortByNameDesc    SortField = "nameDesc"
+	SortBySizeAsc     SortField = "sizeAsc"
+	SortBySizeDesc    SortField = "sizeDesc"
+	SortByModTimeAsc  SortField = "modTimeAsc"
+	SortByModTimeDesc SortField = "modTimeDesc"
+)
@@ -1,5 +1,30 @@
 package mtpx
 
+import (
+	"errors"
+	"fmt"
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+	"os"
+	"strings"
+)
+
+// sentinel errors matched by the error types of this package using [errors.Is], regardless of the type wrapping them
+// eg: errors.Is(err, ErrNotFound) is true for a [FileNotFoundError] wrapped by a [FileObjectError]
+// the sentinels are the raw errors of the device and of the os, so those match as well
+var (
+	// [FileNotFoundError] and the raw mtp.RC_InvalidObjectHandle response code
+	ErrNotFound error = mtp.RCError(mtp.RC_InvalidObjectHandle)
+
+	// [InvalidPathError] and [RelativePathNotSupportedError]
+	ErrInvalidPath = errors.New("mtpx: invalid path")
+
+	// [FilePermissionError], [ReadOnlyPropertyError], [ReadOnlyStorageError] and [os.ErrPermission]
+	ErrPermission = os.ErrPermission
+
+	// [DeviceBusyError] and the raw mtp.RC_DeviceBusy response code
+	ErrDeviceBusy error = mtp.RCError(mtp.RC_DeviceBusy)
+)
+
 type MtpDetectFailedError struct {
 	error
 }
@@ -8,6 +33,13 @@ type ConfigureError struct {
 	error
 }
 
+// more than one connected device matched the selectors of [Init]
+type MultipleDevicesError struct {
+	error
+
+	Devices []mtp.UsbDeviceInfo
+}
+
 type DeviceInfoError struct {
 	error
 }
@@ -20,6 +52,11 @@ type NoStorageError struct {
 	error
 }
 
+// the storage didn't report a non zero capacity before the timeout of [WaitForStorage]
+type StorageNotReadyError struct {
+	error
+}
+
 type ListDirectoryError struct {
 	error
 }
@@ -51,3 +88,351 @@ type FileObjectError struct {
 type SendObjectError struct {
 	error
 }
+
+type WalkCanceledError struct {
+	error
+}
+
+type UnsupportedOperationError struct {
+	error
+}
+
+type FileAlreadyExistsError struct {
+	error
+}
+
+type InsufficientSpaceError struct {
+	error
+}
+
+type SymlinkCycleError struct {
+	error
+}
+
+type DeviceBusyError struct {
+	error
+}
+
+// the path contains a `.` or `..` component
+type RelativePathNotSupportedError struct {
+	error
+}
+
+// the device can't provide a thumbnail for the object (eg: a text file)
+type ThumbnailUnavailableError struct {
+	error
+}
+
+// the device doesn't allow writing the object property
+type ReadOnlyPropertyError struct {
+	error
+}
+
+// the storage doesn't allow creating or deleting the objects; see [IsStorageWritable]
+type ReadOnlyStorageError struct {
+	error
+}
+
+// the Go value doesn't match the datatype of the object property
+type TypeMismatchError struct {
+	error
+}
+
+// the device was unplugged or its connection was closed after a fatal USB error
+// retrying won't help; the device has to be initialized again
+type DeviceDisconnectedError struct {
+	error
+}
+
+// a device transaction made no progress within the per call timeout of the device; see [SetPerCallTimeout]
+// the device should be initialized again
+type TransactionTimeoutError struct {
+	error
+}
+
+// a device transaction which still failed with a transient error once all the attempts of its [RetryPolicy] were made
+// the error of the last attempt is wrapped; match it using errors.As or [retryCause]
+type RetryError struct {
+	error
+
+	// the number of the attempts which were made
+	Attempts int
+}
+
+// the object passed by its objectId belongs to another storage than the storageId it was passed with
+type StorageMismatchError struct {
+	error
+
+	ObjectId uint32
+
+	// the storageId which was passed
+	StorageId uint32
+
+	// the storageId of the object
+	ObjectStorageId uint32
+}
+
+// the manifest passed to [DiffManifest] isn't a JSON array of [ManifestEntry]
+type InvalidManifestError struct {
+	error
+}
+
+// the filename isn't allowed by the [FilenamePolicy] of the device
+type InvalidFilenameError struct {
+	error
+
+	Filename string
+}
+
+// one of the writers passed to [DownloadObjectTo] failed
+type WriterError struct {
+	error
+
+	// position of the failed writer in the arguments of [DownloadObjectTo]
+	Index int
+}
+
+// returned by a [ProgressCb] to pause the transfer instead of aborting it; see [pausableProgress]
+// the transfer resumes once a nil error is received from [Resume] or the channel is closed, while a non nil error
+// cancels it with a [PausedTransferCanceledError]
+type PauseSignal struct {
+	Resume <-chan error
+}
+
+func (p PauseSignal) Error() string {
+	return "the transfer was paused"
+}
+
+// a transfer paused using a [PauseSignal] was canceled instead of being resumed
+type PausedTransferCanceledError struct {
+	error
+}
+
+// the device listed more than one object with the same filename in a directory
+type DuplicateObjectError struct {
+	error
+
+	Filename  string
+	ObjectIds []uint32
+}
+
+// more than one file in a directory matched a filename case insensitively and none of them matched it exactly
+type AmbiguousPathError struct {
+	error
+
+	Candidates []string
+}
+
+type ChecksumMismatchError struct {
+	error
+
+	ObjectId   uint32
+	LocalHash  string
+	DeviceHash string
+}
+
+// the errors wrapped by the error types are exposed to [errors.Is] and [errors.As]
+func (e MtpDetectFailedError) Unwrap() error {
+	return e.error
+}
+
+func (e ConfigureError) Unwrap() error {
+	return e.error
+}
+
+func (e MultipleDevicesError) Unwrap() error {
+	return e.error
+}
+
+func (e DeviceInfoError) Unwrap() error {
+	return e.error
+}
+
+func (e StorageInfoError) Unwrap() error {
+	return e.error
+}
+
+func (e NoStorageError) Unwrap() error {
+	return e.error
+}
+
+func (e StorageNotReadyError) Unwrap() error {
+	return e.error
+}
+
+func (e ListDirectoryError) Unwrap() error {
+	return e.error
+}
+
+func (e FileNotFoundError) Unwrap() error {
+	return e.error
+}
+
+func (e FilePermissionError) Unwrap() error {
+	return e.error
+}
+
+func (e LocalFileError) Unwrap() error {
+	return e.error
+}
+
+func (e InvalidPathError) Unwrap() error {
+	return e.error
+}
+
+func (e FileTransferError) Unwrap() error {
+	return e.error
+}
+
+func (e FileObjectError) Unwrap() error {
+	return e.error
+}
+
+func (e SendObjectError) Unwrap() error {
+	return e.error
+}
+
+func (e WalkCanceledError) Unwrap() error {
+	return e.error
+}
+
+func (e UnsupportedOperationError) Unwrap() error {
+	return e.error
+}
+
+func (e FileAlreadyExistsError) Unwrap() error {
+	return e.error
+}
+
+func (e InsufficientSpaceError) Unwrap() error {
+	return e.error
+}
+
+func (e SymlinkCycleError) Unwrap() error {
+	return e.error
+}
+
+func (e DeviceBusyError) Unwrap() error {
+	return e.error
+}
+
+func (e RelativePathNotSupportedError) Unwrap() error {
+	return e.error
+}
+
+func (e ThumbnailUnavailableError) Unwrap() error {
+	return e.error
+}
+
+func (e ReadOnlyPropertyError) Unwrap() error {
+	return e.error
+}
+
+func (e ReadOnlyStorageError) Unwrap() error {
+	return e.error
+}
+
+func (e TypeMismatchError) Unwrap() error {
+	return e.error
+}
+
+func (e DeviceDisconnectedError) Unwrap() error {
+	return e.error
+}
+
+func (e TransactionTimeoutError) Unwrap() error {
+	return e.error
+}
+
+func (e StorageMismatchError) Unwrap() error {
+	return e.error
+}
+
+func (e RetryError) Error() string {
+	return fmt.Sprintf("%v (failed after %d attempts)", e.error, e.Attempts)
+}
+
+func (e RetryError) Unwrap() error {
+	return e.error
+}
+
+func (e InvalidManifestError) Unwrap() error {
+	return e.error
+}
+
+func (e InvalidFilenameError) Unwrap() error {
+	return e.error
+}
+
+func (e WriterError) Unwrap() error {
+	return e.error
+}
+
+func (e PausedTransferCanceledError) Unwrap() error {
+	return e.error
+}
+
+func (e DuplicateObjectError) Unwrap() error {
+	return e.error
+}
+
+func (e AmbiguousPathError) Unwrap() error {
+	return e.error
+}
+
+func (e ChecksumMismatchError) Unwrap() error {
+	return e.error
+}
+
+// the error types matching the sentinel errors
+func (e FileNotFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+func (e InvalidPathError) Is(target error) bool {
+	return target == ErrInvalidPath
+}
+
+func (e RelativePathNotSupportedError) Is(target error) bool {
+	return target == ErrInvalidPath
+}
+
+func (e FilePermissionError) Is(target error) bool {
+	return target == ErrPermission
+}
+
+func (e ReadOnlyPropertyError) Is(target error) bool {
+	return target == ErrPermission
+}
+
+func (e ReadOnlyStorageError) Is(target error) bool {
+	return target == ErrPermission
+}
+
+func (e DeviceBusyError) Is(target error) bool {
+	return target == ErrDeviceBusy
+}
+
+// a file which couldn't be transferred in a batch
+type FileFailure struct {
+	// source path of the file; a local path for uploads and a device path for downloads
+	FullPath string
+	Err      error
+}
+
+// returned by the batch transfers once all the files were processed and one or more of them failed
+type BatchError struct {
+	Failures []FileFailure
+}
+
+func (e BatchError) Error() string {
+	var sb strings.Builder
+
+	_, _ = fmt.Fprintf(&sb, "%d file(s) failed to transfer", len(e.Failures))
+
+	for _, f := range e.Failures {
+		_, _ = fmt.Fprintf(&sb, "\n%s: %v", f.FullPath, f.Err)
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,44 @@
+package mtpx
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+	. "github.com/smartystreets/goconvey/convey"
+	"os"
+	"testing"
+)
+
+func TestSentinelErrors(t *testing.T) {
+	Convey("Testing the sentinel errors | errors.Is", t, func() {
+		err := FileObjectError{error: FileNotFoundError{error: fmt.Errorf("file not found: %s", "/a.txt")}}
+		So(errors.Is(err, ErrNotFound), ShouldBeTrue)
+		So(errors.Is(err, ErrInvalidPath), ShouldBeFalse)
+
+		So(errors.Is(RelativePathNotSupportedError{error: fmt.Errorf("relative path")}, ErrInvalidPath), ShouldBeTrue)
+		So(errors.Is(fmt.Errorf("open: %w", DeviceBusyError{error: fmt.Errorf("busy")}), ErrDeviceBusy), ShouldBeTrue)
+
+		// the raw device and os errors
+		So(errors.Is(FileObjectError{error: mtp.RCError(mtp.RC_DeviceBusy)}, ErrDeviceBusy), ShouldBeTrue)
+		So(errors.Is(fmt.Errorf("get object: %w", mtp.RCError(mtp.RC_InvalidObjectHandle)), ErrNotFound), ShouldBeTrue)
+		So(errors.Is(mtp.RCError(mtp.RC_StoreFull), ErrNotFound), ShouldBeFalse)
+		So(errors.Is(LocalFileError{error: &os.PathError{Op: "open", Path: "/a.txt", Err: os.ErrPermission}}, ErrPermission), ShouldBeTrue)
+
+		permErr := FilePermissionError{error: os.ErrPermission}
+		So(errors.Is(permErr, ErrPermission), ShouldBeTrue)
+		So(errors.Is(permErr, os.ErrPermission), ShouldBeTrue)
+
+		So(errors.Is(ReadOnlyStorageError{error: fmt.Errorf("read-only")}, ErrPermission), ShouldBeTrue)
+	})
+
+	Convey("Testing the wrapped errors | errors.As", t, func() {
+		err := SendObjectError{error: FileTransferError{error: mtp.RCError(mtp.RC_StoreFull)}}
+
+		var rcErr mtp.RCError
+		So(errors.As(err, &rcErr), ShouldBeTrue)
+		So(rcErr, ShouldEqual, mtp.RCError(mtp.RC_StoreFull))
+
+		var transferErr FileTransferError
+		So(errors.As(err, &transferErr), ShouldBeTrue)
+	})
+}
@@ -0,0 +1,263 @@
+package mtpx
+
+import (
+	"context"
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+	"sort"
+	"time"
+)
+
+// the objectIds of the objects on each storage keyed by the storageId
+type objectSnapshot map[uint32]map[uint32]bool
+
+// Poll the device for the changes of its objects and report them to [cb] until [ctx] is canceled
+// the objects added to or removed from a storage are reported as [EventObjectAdded] and [EventObjectRemoved] along with their objectId
+// and the storages which were added or removed (eg: an SD card) are reported as [EventStorageChanged]
+// the object handles of the storages [opts.StorageIds] (all of them if it's empty) are listed every [opts.Interval] and compared with the previous listing,
+// so a change is reported up to [opts.Interval] after it happened and listing a large storage keeps the device busy for a while
+// note: these aren't the MTP events; the mtp library doesn't expose the interrupt endpoint on which the devices send them, and not all the devices emit them
+// note: the device can only run one transaction at a time; don't use [dev] concurrently while polling, use it from [cb] instead
+// returns nil once [ctx] is canceled, otherwise the error returned by [cb] or the device
+func PollEvents(ctx context.Context, dev *mtp.Device, opts PollEventsOpts, cb EventCb) error {
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = defaultEventPollInterval
+	}
+
+	snapshot, err := snapshotObjects(dev, opts.StorageIds)
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case <-ticker.C:
+		}
+
+		next, err := snapshotObjects(dev, opts.StorageIds)
+		if err != nil {
+			return err
+		}
+
+		if err := diffObjectSnapshots(snapshot, next, cb); err != nil {
+			return err
+		}
+
+		snapshot = next
+	}
+}
+
+// Poll the space of the storage [storageId] every [interval] and report it to [cb] until [ctx] is canceled
+// the storage is polled once right away; [interval] defaults to [defaultStorageWatchInterval] if it's not positive
+// a failed poll (eg: the device was busy) is reported to [cb] as a [StorageInfoError] and the watch goes on,
+// unless the device was disconnected
+// note: same as [PollEvents], don't use [dev] concurrently while watching, use it from [cb] instead
+// returns nil once [ctx] is canceled, otherwise the error returned by [cb] or a [DeviceDisconnectedError]
+func WatchStorage(ctx context.Context, dev *mtp.Device, storageId uint32, interval time.Duration, cb StorageWatchCb) error {
+	if interval <= 0 {
+		interval = defaultStorageWatchInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := pollStorageUsage(dev, storageId, cb); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case <-ticker.C:
+		}
+	}
+}
+
+// fetch the space of the storage [storageId] and report it to [cb]
+func pollStorageUsage(dev *mtp.Device, storageId uint32, cb StorageWatchCb) error {
+	usage := StorageUsage{Sid: storageId, Time: time.Now()}
+
+	var info mtp.StorageInfo
+	if err := withCallTimeout(dev, nil, func() error {
+		return dev.GetStorageInfo(storageId, &info)
+	}); err != nil {
+		if isDeviceDisconnected(err) {
+			return deviceDisconnectedError(err)
+		}
+
+		return cb(usage, StorageInfoError{error: err})
+	}
+
+	usage.CapacityInBytes = info.MaxCapability
+	usage.FreeSpaceInBytes = info.FreeSpaceInBytes
+	if info.MaxCapability > info.FreeSpaceInBytes {
+		usage.UsedSpaceInBytes = info.MaxCapability - info.FreeSpaceInBytes
+	}
+
+	return cb(usage, nil)
+}
+
+// list the objectIds of all the objects on the storages [storageIds] of [dev]; all the storages are listed if [storageIds] is empty
+// the storages of [storageIds] which don't exist are left out of the snapshot
+func snapshotObjects(dev *mtp.Device, storageIds []uint32) (objectSnapshot, error) {
+	var sids mtp.Uint32Array
+	if err := withRetry(dev, func() error {
+		return withCallTimeout(dev, nil, func() error {
+			return dev.GetStorageIDs(&sids)
+		})
+	}); err != nil {
+		return nil, StorageInfoError{error: err}
+	}
+
+	snapshot := objectSnapshot{}
+	for _, sid := range sids.Values {
+		if len(storageIds) > 0 && !containsUint32(storageIds, sid) {
+			continue
+		}
+
+		objects := map[uint32]bool{}
+		if err := snapshotDirectory(dev, sid, ParentObjectId, objects); err != nil {
+			return nil, err
+		}
+
+		snapshot[sid] = objects
+	}
+
+	return snapshot, nil
+}
+
+// add the objectIds of the objects inside the directory [parentId] to [objects], recursively
+// a sub directory which was removed while it was being listed is skipped; its removal is reported by the next snapshot
+func snapshotDirectory(dev *mtp.Device, storageId, parentId uint32, objects map[uint32]bool) error {
+	formats, err := listObjectFormats(dev, storageId, parentId)
+	if err != nil {
+		if parentId != ParentObjectId && isInvalidObjectError(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	for objectId, format := range formats {
+		objects[objectId] = true
+
+		if format != mtp.OFC_Association {
+			continue
+		}
+
+		if err := snapshotDirectory(dev, storageId, objectId, objects); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// report the differences between the snapshots [prev] and [next] to [cb]
+// the events are reported in the order of the storageIds and the objectIds
+func diffObjectSnapshots(prev, next objectSnapshot, cb EventCb) error {
+	for _, sid := range prev.storageIds() {
+		if _, ok := next[sid]; !ok {
+			if err := cb(Event{Type: EventStorageChanged, Code: mtp.EC_StoreRemoved, StorageId: sid}); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, sid := range next.storageIds() {
+		prevObjects, ok := prev[sid]
+		if !ok {
+			if err := cb(Event{Type: EventStorageChanged, Code: mtp.EC_StoreAdded, StorageId: sid}); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		for _, objectId := range sortedObjectIds(prevObjects) {
+			if !next[sid][objectId] {
+				if err := cb(Event{Type: EventObjectRemoved, Code: mtp.EC_ObjectRemoved, StorageId: sid, ObjectId: objectId}); err != nil {
+					return err
+				}
+			}
+		}
+
+		for _, objectId := range sortedObjectIds(next[sid]) {
+			if !prevObjects[objectId] {
+				if err := cb(Event{Type: EventObjectAdded, Code: mtp.EC_ObjectAdded, StorageId: sid, ObjectId: objectId}); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// the storageIds of [s] in ascending order
+func (s objectSnapshot) storageIds() []uint32 {
+	sids := make([]uint32, 0, len(s))
+	for sid := range s {
+		sids = append(sids, sid)
+	}
+
+	sortUint32s(sids)
+
+	return sids
+}
+
+// the objectIds of [objects] in ascending order
+func sortedObjectIds(objects map[uint32]bool) []uint32 {
+	objectIds := make([]uint32, 0, len(objects))
+	for objectId := range objects {
+		objectIds = append(objectIds, objectId)
+	}
+
+	sortUint32s(objectIds)
+
+	return objectIds
+}
+
+// check if [values] contains [value]
+func containsUint32(values []uint32, value uint32) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func sortUint32s(values []uint32) {
+	sort.Slice(values, func(i, j int) bool {
+		return values[i] < values[j]
+	})
+}
+
+// check if [err] was caused by an object which doesn't exist anymore
+func isInvalidObjectError(err error) bool {
+	switch e := err.(type) {
+	case mtp.RCError:
+		return e == mtp.RC_InvalidObjectHandle || e == mtp.RC_InvalidParentObject
+
+	case ListDirectoryError:
+		return isInvalidObjectError(e.error)
+
+	case FileObjectError:
+		return isInvalidObjectError(e.error)
+
+	case RetryError:
+		return isInvalidObjectError(e.error)
+	}
+
+	return false
+}
@@ -0,0 +1,153 @@
+package mtpx
+
+import (
+	"context"
+	"fmt"
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+	. "github.com/smartystreets/goconvey/convey"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestPollEvents(t *testing.T) {
+	Convey("Testing the changes between the snapshots | diffObjectSnapshots", t, func() {
+		prev := objectSnapshot{
+			1: {10: true, 11: true},
+			2: {20: true},
+		}
+		next := objectSnapshot{
+			1: {10: true, 13: true, 12: true},
+			3: {30: true},
+		}
+
+		var events []Event
+		err := diffObjectSnapshots(prev, next, func(e Event) error {
+			events = append(events, e)
+
+			return nil
+		})
+		So(err, ShouldBeNil)
+		So(events, ShouldResemble, []Event{
+			{Type: EventStorageChanged, Code: mtp.EC_StoreRemoved, StorageId: 2},
+			{Type: EventObjectRemoved, Code: mtp.EC_ObjectRemoved, StorageId: 1, ObjectId: 11},
+			{Type: EventObjectAdded, Code: mtp.EC_ObjectAdded, StorageId: 1, ObjectId: 12},
+			{Type: EventObjectAdded, Code: mtp.EC_ObjectAdded, StorageId: 1, ObjectId: 13},
+			{Type: EventStorageChanged, Code: mtp.EC_StoreAdded, StorageId: 3},
+		})
+
+		// an error returned by the callback stops the diff
+		cbErr := fmt.Errorf("stop")
+		count := 0
+		err = diffObjectSnapshots(prev, next, func(e Event) error {
+			count += 1
+
+			return cbErr
+		})
+		So(err, ShouldEqual, cbErr)
+		So(count, ShouldEqual, 1)
+
+		err = diffObjectSnapshots(prev, prev, func(e Event) error {
+			return fmt.Errorf("unexpected event: %v", e)
+		})
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Testing an object removed while listing | isInvalidObjectError", t, func() {
+		So(isInvalidObjectError(ListDirectoryError{error: mtp.RCError(mtp.RC_InvalidParentObject)}), ShouldBeTrue)
+		So(isInvalidObjectError(FileObjectError{error: mtp.RCError(mtp.RC_InvalidObjectHandle)}), ShouldBeTrue)
+		So(isInvalidObjectError(ListDirectoryError{error: mtp.RCError(mtp.RC_DeviceBusy)}), ShouldBeFalse)
+		So(isInvalidObjectError(fmt.Errorf("usb: i/o error")), ShouldBeFalse)
+	})
+
+	dev, err := Initialize(Init{})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	Convey("Testing the cancellation | PollEvents", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		err := PollEvents(ctx, dev, PollEventsOpts{Interval: 10 * time.Millisecond}, func(e Event) error {
+			So(e.StorageId, ShouldBeGreaterThan, 0)
+
+			return nil
+		})
+		So(err, ShouldBeNil)
+		So(ctx.Err(), ShouldNotBeNil)
+	})
+
+	Convey("Testing the polls | WatchStorage", t, func() {
+		storages, err := FetchStorages(dev)
+		So(err, ShouldBeNil)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var samples []StorageUsage
+		err = WatchStorage(ctx, dev, storages[0].Sid, 10*time.Millisecond, func(usage StorageUsage, err error) error {
+			So(err, ShouldBeNil)
+
+			samples = append(samples, usage)
+			if len(samples) == 3 {
+				cancel()
+			}
+
+			return nil
+		})
+		So(err, ShouldBeNil)
+		So(len(samples), ShouldEqual, 3)
+
+		for _, s := range samples {
+			So(s.Sid, ShouldEqual, storages[0].Sid)
+			So(s.CapacityInBytes, ShouldEqual, storages[0].Info.MaxCapability)
+			So(s.UsedSpaceInBytes+s.FreeSpaceInBytes, ShouldEqual, s.CapacityInBytes)
+		}
+		So(samples[2].Time.After(samples[0].Time), ShouldBeTrue)
+
+		// the error returned by the callback stops the watch
+		cbErr := fmt.Errorf("stop")
+		err = WatchStorage(context.Background(), dev, storages[0].Sid, 0, func(usage StorageUsage, err error) error {
+			return cbErr
+		})
+		So(err, ShouldEqual, cbErr)
+
+		// a failed poll is reported to the callback
+		calls := 0
+		err = WatchStorage(context.Background(), dev, 0xFFFFFFFE, 10*time.Millisecond, func(usage StorageUsage, err error) error {
+			So(err, ShouldHaveSameTypeAs, StorageInfoError{})
+
+			calls += 1
+			if calls == 2 {
+				return cbErr
+			}
+
+			return nil
+		})
+		So(err, ShouldEqual, cbErr)
+		So(calls, ShouldEqual, 2)
+	})
+
+	Convey("Testing a snapshot | snapshotObjects", t, func() {
+		snapshot, err := snapshotObjects(dev, nil)
+		So(err, ShouldBeNil)
+
+		storages, err := FetchStorages(dev)
+		So(err, ShouldBeNil)
+		So(len(snapshot), ShouldEqual, len(storages))
+
+		// the test directory '/mtp-test-files/mock_dir1' is part of the snapshot
+		fi, err := GetObjectFromPath(dev, storages[0].Sid, "/mtp-test-files/mock_dir1")
+		So(err, ShouldBeNil)
+		So(snapshot[storages[0].Sid][fi.ObjectId], ShouldBeTrue)
+
+		// only the given storages are listed
+		snapshot, err = snapshotObjects(dev, []uint32{storages[0].Sid})
+		So(err, ShouldBeNil)
+		So(len(snapshot), ShouldEqual, 1)
+		So(snapshot[storages[0].Sid][fi.ObjectId], ShouldBeTrue)
+	})
+
+	Dispose(dev)
+}
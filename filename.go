@@ -0,0 +1,222 @@
+package mtpx
+
+import (
+	"fmt"
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+	"strings"
+	"unicode/utf8"
+)
+
+// the characters which aren't allowed in the filenames of the FAT backed storages
+const FatInvalidFilenameChars = `"*:<>?\|`
+
+// the maximum length (in bytes) of the filenames on the FAT backed storages
+const FatMaxFilenameLength = 255
+
+// FilenamePolicy controls the validation of the names of the files and directories which are created or renamed on the device
+// the zero value validates the filenames against the limits of the FAT backed storages without sanitizing them
+type FilenamePolicy struct {
+	// if true, the filenames are not validated
+	Disabled bool
+
+	// characters which aren't allowed in a filename
+	// note: defaults to [FatInvalidFilenameChars]
+	InvalidChars string
+
+	// maximum length of a filename in bytes; a negative value disables the check
+	// note: defaults to [FatMaxFilenameLength]
+	MaxLength int
+
+	// if true, the invalid characters are replaced with [Replacement] and the long filenames are truncated
+	// while preserving their extension, instead of returning an [InvalidFilenameError]
+	Sanitize bool
+
+	// note: defaults to "_"
+	Replacement string
+}
+
+// the [FilenamePolicy] of the FAT backed storages
+func FatFilenamePolicy(sanitize bool) FilenamePolicy {
+	return FilenamePolicy{
+		InvalidChars: FatInvalidFilenameChars,
+		MaxLength:    FatMaxFilenameLength,
+		Sanitize:     sanitize,
+	}
+}
+
+// set the [FilenamePolicy] used while creating and renaming the objects of [dev]
+// the policy is kept until [Dispose] is called
+func SetFilenamePolicy(dev *mtp.Device, policy FilenamePolicy) {
+	deviceFilenamePolicies.Store(dev, policy)
+}
+
+// the [FilenamePolicy] of [dev]
+func getFilenamePolicy(dev *mtp.Device) FilenamePolicy {
+	if p, ok := deviceFilenamePolicies.Load(dev); ok {
+		return p.(FilenamePolicy)
+	}
+
+	return FilenamePolicy{}
+}
+
+// set the normalization applied to both sides of the filename comparisons while resolving the paths of [dev]
+// eg: norm.NFC.String of golang.org/x/text/unicode/norm, so that the decomposed "café.jpg" of a macOS caller matches
+// the composed name stored on the device. nil compares the filenames byte by byte, which is the default
+// the normalizer is kept until [Dispose] is called
+func SetFilenameNormalizer(dev *mtp.Device, normalizer func(string) string) {
+	if normalizer == nil {
+		deviceFilenameNormalizers.Delete(dev)
+
+		return
+	}
+
+	deviceFilenameNormalizers.Store(dev, normalizer)
+}
+
+// normalize [filename] using the normalizer of [dev]; see [SetFilenameNormalizer]
+func normalizeFilename(dev *mtp.Device, filename string) string {
+	if n, ok := deviceFilenameNormalizers.Load(dev); ok {
+		return n.(func(string) string)(filename)
+	}
+
+	return filename
+}
+
+// check [filename] against the [FilenamePolicy] of [dev]
+// returns the sanitized filename if [FilenamePolicy.Sanitize] is set, otherwise an [InvalidFilenameError] is returned for an invalid filename
+func checkFilename(dev *mtp.Device, filename string) (string, error) {
+	return getFilenamePolicy(dev).check(filename)
+}
+
+// check each component of the device path [fullPath] against the [FilenamePolicy] of [dev]
+// returns [fullPath] made of the sanitized components so that the reported paths match the created objects
+func checkPath(dev *mtp.Device, fullPath string) (string, error) {
+	components := strings.Split(fullPath, PathSep)
+
+	for i, c := range components {
+		if c == "" {
+			continue
+		}
+
+		name, err := checkFilename(dev, c)
+		if err != nil {
+			return "", err
+		}
+
+		components[i] = name
+	}
+
+	return strings.Join(components, PathSep), nil
+}
+
+// the maximum length (in bytes) of the filenames allowed by the [FilenamePolicy] of [dev]; 0 if the length isn't limited
+func maxFilenameLength(dev *mtp.Device) int {
+	p := getFilenamePolicy(dev).withDefaults()
+	if p.Disabled || p.MaxLength < 0 {
+		return 0
+	}
+
+	return p.MaxLength
+}
+
+// [p] with the default values of the unset fields
+func (p FilenamePolicy) withDefaults() FilenamePolicy {
+	if p.InvalidChars == "" {
+		p.InvalidChars = FatInvalidFilenameChars
+	}
+
+	if p.MaxLength == 0 {
+		p.MaxLength = FatMaxFilenameLength
+	}
+
+	return p
+}
+
+func (p FilenamePolicy) check(filename string) (string, error) {
+	if p.Disabled {
+		return filename, nil
+	}
+
+	p = p.withDefaults()
+
+	invalid := p.InvalidChars != "" && strings.ContainsAny(filename, p.InvalidChars)
+	tooLong := p.MaxLength > 0 && len(filename) > p.MaxLength
+
+	if !invalid && !tooLong {
+		return filename, nil
+	}
+
+	if !p.Sanitize {
+		if invalid {
+			return "", InvalidFilenameError{
+				error:    fmt.Errorf("invalid filename: %s. it contains one or more of the characters: %s", filename, p.InvalidChars),
+				Filename: filename,
+			}
+		}
+
+		return "", InvalidFilenameError{
+			error:    fmt.Errorf("invalid filename: %s. it is longer than %d bytes", filename, p.MaxLength),
+			Filename: filename,
+		}
+	}
+
+	replacement := p.Replacement
+	if replacement == "" {
+		replacement = "_"
+	}
+
+	if strings.ContainsAny(replacement, p.InvalidChars) {
+		return "", InvalidFilenameError{
+			error:    fmt.Errorf("invalid filename replacement: %s", replacement),
+			Filename: filename,
+		}
+	}
+
+	name := filename
+	if invalid {
+		var sb strings.Builder
+
+		for _, r := range filename {
+			if strings.ContainsRune(p.InvalidChars, r) {
+				sb.WriteString(replacement)
+			} else {
+				sb.WriteRune(r)
+			}
+		}
+
+		name = sb.String()
+	}
+
+	if p.MaxLength > 0 && len(name) > p.MaxLength {
+		name = truncateFilename(name, p.MaxLength)
+	}
+
+	return name, nil
+}
+
+// truncate [filename] to at most [maxLength] bytes on a rune boundary
+// the extension is preserved unless it doesn't fit into [maxLength] with at least one character of the name
+func truncateFilename(filename string, maxLength int) string {
+	ext := extension(filename, false)
+	base := strings.TrimSuffix(filename, "."+ext)
+
+	// the hidden files without an extension (eg: ".bashrc")
+	if ext == "" || base == "" || len(ext)+2 > maxLength {
+		return truncateUtf8(filename, maxLength)
+	}
+
+	return truncateUtf8(base, maxLength-len(ext)-1) + "." + ext
+}
+
+// truncate [s] to at most [n] bytes without splitting a multibyte rune
+func truncateUtf8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+
+	return s[:n]
+}
@@ -0,0 +1,139 @@
+package mtpx
+
+import (
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+	. "github.com/smartystreets/goconvey/convey"
+	"strings"
+	"testing"
+)
+
+func TestCheckFilename(t *testing.T) {
+	dev := &mtp.Device{}
+
+	Convey("Testing the default policy | checkFilename", t, func() {
+		name, err := checkFilename(dev, "report.txt")
+		So(err, ShouldBeNil)
+		So(name, ShouldEqual, "report.txt")
+
+		// the zero value uses the FAT limits
+		_, err = checkFilename(dev, "a:b?.txt")
+		So(err, ShouldHaveSameTypeAs, InvalidFilenameError{})
+
+		_, err = checkFilename(dev, strings.Repeat("a", 300))
+		So(err, ShouldHaveSameTypeAs, InvalidFilenameError{})
+	})
+
+	Convey("Testing a disabled policy | checkFilename", t, func() {
+		SetFilenamePolicy(dev, FilenamePolicy{Disabled: true})
+		defer deviceFilenamePolicies.Delete(dev)
+
+		name, err := checkFilename(dev, "a:b?.txt")
+		So(err, ShouldBeNil)
+		So(name, ShouldEqual, "a:b?.txt")
+
+		// a negative [MaxLength] disables only the length check
+		SetFilenamePolicy(dev, FilenamePolicy{MaxLength: -1})
+
+		longName := strings.Repeat("a", 300)
+		name, err = checkFilename(dev, longName)
+		So(err, ShouldBeNil)
+		So(name, ShouldEqual, longName)
+	})
+
+	Convey("Testing the sanitized paths | checkPath", t, func() {
+		SetFilenamePolicy(dev, FatFilenamePolicy(true))
+		defer deviceFilenamePolicies.Delete(dev)
+
+		fullPath, err := checkPath(dev, "/mtp-test-files/a:b/c?.txt")
+		So(err, ShouldBeNil)
+		So(fullPath, ShouldEqual, "/mtp-test-files/a_b/c_.txt")
+
+		rel, err := checkPath(dev, "a:b/c.txt")
+		So(err, ShouldBeNil)
+		So(rel, ShouldEqual, "a_b/c.txt")
+	})
+
+	Convey("Testing the invalid filenames | checkFilename", t, func() {
+		SetFilenamePolicy(dev, FatFilenamePolicy(false))
+		defer deviceFilenamePolicies.Delete(dev)
+
+		name, err := checkFilename(dev, "report.txt")
+		So(err, ShouldBeNil)
+		So(name, ShouldEqual, "report.txt")
+
+		_, err = checkFilename(dev, "a:b.txt")
+		So(err, ShouldHaveSameTypeAs, InvalidFilenameError{})
+		So(err.(InvalidFilenameError).Filename, ShouldEqual, "a:b.txt")
+
+		longName := strings.Repeat("a", 252) + ".txt"
+		_, err = checkFilename(dev, longName)
+		So(err, ShouldHaveSameTypeAs, InvalidFilenameError{})
+		So(err.(InvalidFilenameError).Filename, ShouldEqual, longName)
+	})
+
+	Convey("Testing the sanitized filenames | checkFilename", t, func() {
+		SetFilenamePolicy(dev, FatFilenamePolicy(true))
+		defer deviceFilenamePolicies.Delete(dev)
+
+		name, err := checkFilename(dev, `a:b*c?"<>|\.txt`)
+		So(err, ShouldBeNil)
+		So(name, ShouldEqual, "a_b_c______.txt")
+
+		name, err = checkFilename(dev, strings.Repeat("a", 300)+".tar.gz")
+		So(err, ShouldBeNil)
+		So(len(name), ShouldEqual, FatMaxFilenameLength)
+		So(name, ShouldEndWith, "a.tar.gz")
+
+		// a multibyte rune isn't split
+		name, err = checkFilename(dev, strings.Repeat("é", 200)+".txt")
+		So(err, ShouldBeNil)
+		So(len(name), ShouldBeLessThanOrEqualTo, FatMaxFilenameLength)
+		So(name, ShouldEqual, strings.Repeat("é", 125)+".txt")
+
+		SetFilenamePolicy(dev, FilenamePolicy{InvalidChars: ":", MaxLength: 4, Sanitize: true, Replacement: "-"})
+
+		name, err = checkFilename(dev, "a:b")
+		So(err, ShouldBeNil)
+		So(name, ShouldEqual, "a-b")
+
+		// the extension doesn't fit
+		name, err = checkFilename(dev, "ab.txt")
+		So(err, ShouldBeNil)
+		So(name, ShouldEqual, "ab.t")
+
+		SetFilenamePolicy(dev, FilenamePolicy{InvalidChars: ":", Sanitize: true, Replacement: ":"})
+
+		_, err = checkFilename(dev, "a:b")
+		So(err, ShouldHaveSameTypeAs, InvalidFilenameError{})
+	})
+}
+
+func TestFilenameNormalizer(t *testing.T) {
+	dev := &mtp.Device{}
+
+	// composes the "e" followed by a combining acute accent, as NFC does
+	nfc := strings.NewReplacer("e\u0301", "\u00e9", "E\u0301", "\u00c9").Replace
+
+	composed := "caf\u00e9.jpg"
+	decomposed := "cafe\u0301.jpg"
+
+	Convey("Testing the byte-exact default | normalizeFilename", t, func() {
+		So(normalizeFilename(dev, decomposed), ShouldEqual, decomposed)
+
+		_, err := selectFilenameMatch([]string{normalizeFilename(dev, composed)}, []uint32{1}, normalizeFilename(dev, decomposed), FilenameMatchCaseInsensitive, false)
+		So(err, ShouldHaveSameTypeAs, FileNotFoundError{})
+	})
+
+	Convey("Testing the composed and decomposed names | SetFilenameNormalizer", t, func() {
+		SetFilenameNormalizer(dev, nfc)
+		defer SetFilenameNormalizer(dev, nil)
+
+		So(normalizeFilename(dev, decomposed), ShouldEqual, composed)
+
+		i, err := selectFilenameMatch([]string{"a.jpg", normalizeFilename(dev, composed)}, []uint32{1, 2}, normalizeFilename(dev, decomposed), FilenameMatchExact, false)
+		So(err, ShouldBeNil)
+		So(i, ShouldEqual, 1)
+
+		So(pathCacheName(dev, "CAFE\u0301.JPG"), ShouldEqual, pathCacheName(dev, composed))
+	})
+}
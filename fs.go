@@ -0,0 +1,290 @@
+package mtpx
+
+import (
+	"fmt"
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+	"io"
+	"io/fs"
+	"sort"
+	"time"
+)
+
+// adapts [FileInfo] to [fs.FileInfo]
+type fsFileInfo struct {
+	fi *FileInfo
+}
+
+// AsFS returns the [FileInfo] as an [fs.FileInfo]
+// [fs.FileInfo.Sys] returns the underlying *mtp.ObjectInfo
+func (fi *FileInfo) AsFS() fs.FileInfo {
+	return fsFileInfo{fi: fi}
+}
+
+func (f fsFileInfo) Name() string {
+	return f.fi.Name
+}
+
+func (f fsFileInfo) Size() int64 {
+	return f.fi.Size
+}
+
+func (f fsFileInfo) Mode() fs.FileMode {
+	if f.fi.IsDir {
+		return fs.ModeDir | 0755
+	}
+
+	return 0644
+}
+
+func (f fsFileInfo) ModTime() time.Time {
+	return f.fi.ModTime
+}
+
+func (f fsFileInfo) IsDir() bool {
+	return f.fi.IsDir
+}
+
+func (f fsFileInfo) Sys() interface{} {
+	return f.fi.Info
+}
+
+// MtpFS implements [fs.FS] and [fs.ReadDirFS] over a single MTP storage
+// so that the device tree can be used with [fs.WalkDir], [fs.Glob], [fs.ReadFile] etc.
+// note: MTP allows only one transaction at a time; make sure that an opened file is read fully or closed
+// before the device is used again
+type MtpFS struct {
+	dev       *mtp.Device
+	storageId uint32
+}
+
+// create a new [MtpFS] for the storage [storageId]
+func NewMtpFS(dev *mtp.Device, storageId uint32) *MtpFS {
+	return &MtpFS{dev: dev, storageId: storageId}
+}
+
+// implements [fs.FS]
+// files are streamed from the device using GetObject
+// note: same as [OpenObject], only one file may be open per device at a time;
+// opening a second one returns a [DeviceBusyError] wrapped in an [fs.PathError]
+func (fsys *MtpFS) Open(name string) (fs.File, error) {
+	fi, err := fsys.stat("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	if fi.IsDir {
+		return &mtpDir{fsys: fsys, fi: fi, name: name}, nil
+	}
+
+	if _, busy := activeObjectStreams.LoadOrStore(fsys.dev, fi.ObjectId); busy {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: DeviceBusyError{
+			error: fmt.Errorf("unable to open the object: %d. another object stream is active on the device", fi.ObjectId),
+		}}
+	}
+
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		g := &callGuard{}
+		err := withCallTimeout(fsys.dev, g, func() error {
+			return fsys.dev.GetObject(fi.ObjectId, g.writer(pw), mtp.EmptyProgressFunc)
+		})
+
+		// release the device before the reader sees the end of the stream
+		activeObjectStreams.Delete(fsys.dev)
+
+		if err != nil {
+			if _, ok := err.(TransactionTimeoutError); !ok {
+				err = FileTransferError{error: err}
+			}
+
+			_ = pw.CloseWithError(err)
+
+			return
+		}
+
+		_ = pw.Close()
+	}()
+
+	return &mtpFile{fi: fi, pr: pr, done: done}, nil
+}
+
+// implements [fs.ReadDirFS]
+func (fsys *MtpFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	fi, err := fsys.stat("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !fi.IsDir {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fmt.Errorf("not a directory")}
+	}
+
+	entries, err := fsys.readDir(fi)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+
+	return entries, nil
+}
+
+// resolve the [fs.FS] path [name] to the object on the device
+func (fsys *MtpFS) stat(op, name string) (*FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	// [fs.FS] paths are unrooted; "." is the root directory
+	fullPath := PathSep
+	if name != "." {
+		fullPath = getFullPath(PathSep, name)
+	}
+
+	fi, err := GetObjectFromPath(fsys.dev, fsys.storageId, fullPath)
+	if err != nil {
+		switch err.(type) {
+		case InvalidPathError:
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+
+		default:
+			return nil, &fs.PathError{Op: op, Path: name, Err: err}
+		}
+	}
+
+	// the root directory doesn't have a name on the device
+	if fi.ObjectId == ParentObjectId {
+		fi.Name = "."
+	}
+
+	return fi, nil
+}
+
+// list the children of the directory [fi] sorted by filename
+func (fsys *MtpFS) readDir(fi *FileInfo) ([]fs.DirEntry, error) {
+	handles := mtp.Uint32Array{}
+	if err := withCallTimeout(fsys.dev, nil, func() error {
+		return fsys.dev.GetObjectHandles(fsys.storageId, mtp.GOH_ALL_ASSOCS, fi.ObjectId, &handles)
+	}); err != nil {
+		return nil, ListDirectoryError{error: err}
+	}
+
+	entries := make([]fs.DirEntry, 0, len(handles.Values))
+
+	for _, objId := range handles.Values {
+		_fi, err := GetObjectFromObjectId(fsys.dev, objId, fi.FullPath)
+		if err != nil {
+			continue
+		}
+
+		entries = append(entries, fsDirEntry{fi: _fi})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	return entries, nil
+}
+
+// implements [fs.File] for a file on the device
+type mtpFile struct {
+	fi   *FileInfo
+	pr   *io.PipeReader
+	done chan struct{}
+}
+
+func (f *mtpFile) Stat() (fs.FileInfo, error) {
+	return f.fi.AsFS(), nil
+}
+
+func (f *mtpFile) Read(p []byte) (int, error) {
+	return f.pr.Read(p)
+}
+
+// closing the file aborts the transfer if it wasn't read fully
+// and waits for the GetObject transaction to finish
+func (f *mtpFile) Close() error {
+	err := f.pr.Close()
+	<-f.done
+
+	return err
+}
+
+// implements [fs.ReadDirFile] for a directory on the device
+type mtpDir struct {
+	fsys    *MtpFS
+	fi      *FileInfo
+	name    string
+	entries []fs.DirEntry
+	loaded  bool
+	offset  int
+}
+
+func (d *mtpDir) Stat() (fs.FileInfo, error) {
+	return d.fi.AsFS(), nil
+}
+
+func (d *mtpDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: fmt.Errorf("is a directory")}
+}
+
+func (d *mtpDir) Close() error {
+	return nil
+}
+
+// implements [fs.ReadDirFile]
+func (d *mtpDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.loaded {
+		entries, err := d.fsys.readDir(d.fi)
+		if err != nil {
+			return nil, &fs.PathError{Op: "readdir", Path: d.name, Err: err}
+		}
+
+		d.entries = entries
+		d.loaded = true
+	}
+
+	remaining := d.entries[d.offset:]
+
+	if n <= 0 {
+		d.offset = len(d.entries)
+
+		return remaining, nil
+	}
+
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+
+	if n > len(remaining) {
+		n = len(remaining)
+	}
+
+	d.offset += n
+
+	return remaining[:n], nil
+}
+
+// implements [fs.DirEntry]
+type fsDirEntry struct {
+	fi *FileInfo
+}
+
+func (e fsDirEntry) Name() string {
+	return e.fi.Name
+}
+
+func (e fsDirEntry) IsDir() bool {
+	return e.fi.IsDir
+}
+
+func (e fsDirEntry) Type() fs.FileMode {
+	return e.fi.AsFS().Mode().Type()
+}
+
+func (e fsDirEntry) Info() (fs.FileInfo, error) {
+	return e.fi.AsFS(), nil
+}
@@ -0,0 +1,147 @@
+package mtpx
+
+import (
+	"errors"
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/fs"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestFileInfoAsFS(t *testing.T) {
+	Convey("Test FileInfo.AsFS | file", t, func() {
+		modTime := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+		info := &mtp.ObjectInfo{Filename: "a.txt"}
+
+		fi := &FileInfo{
+			Size:    12,
+			IsDir:   false,
+			ModTime: modTime,
+			Name:    "a.txt",
+			Info:    info,
+		}
+
+		ffi := fi.AsFS()
+
+		So(ffi.Name(), ShouldEqual, "a.txt")
+		So(ffi.Size(), ShouldEqual, 12)
+		So(ffi.IsDir(), ShouldBeFalse)
+		So(ffi.Mode().IsRegular(), ShouldBeTrue)
+		So(ffi.ModTime(), ShouldEqual, modTime)
+		So(ffi.Sys(), ShouldEqual, info)
+	})
+
+	Convey("Test FileInfo.AsFS | directory", t, func() {
+		fi := &FileInfo{
+			IsDir: true,
+			Name:  "DCIM",
+			Info:  &mtp.ObjectInfo{Filename: "DCIM"},
+		}
+
+		ffi := fi.AsFS()
+
+		So(ffi.IsDir(), ShouldBeTrue)
+		So(ffi.Mode()&fs.ModeDir, ShouldNotEqual, 0)
+		So(ffi.Mode().IsDir(), ShouldBeTrue)
+	})
+}
+
+func TestMtpFS(t *testing.T) {
+	dev, err := Initialize(Init{})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	storages, err := FetchStorages(dev)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	sid := storages[0].Sid
+
+	fsys := NewMtpFS(dev, sid)
+
+	Convey("Walk a directory | MtpFS | fs.WalkDir", t, func() {
+		var paths []string
+		err := fs.WalkDir(fsys, "mtp-test-files/mock_dir1", func(path string, d fs.DirEntry, err error) error {
+			So(err, ShouldBeNil)
+
+			paths = append(paths, path)
+
+			return nil
+		})
+
+		So(err, ShouldBeNil)
+		So(paths[0], ShouldEqual, "mtp-test-files/mock_dir1")
+		So(paths, ShouldContain, "mtp-test-files/mock_dir1/a.txt")
+		So(paths, ShouldContain, "mtp-test-files/mock_dir1/1/a.txt")
+		So(paths, ShouldContain, "mtp-test-files/mock_dir1/3/2/b.txt")
+	})
+
+	Convey("Read a directory | MtpFS | fs.ReadDir", t, func() {
+		entries, err := fs.ReadDir(fsys, "mtp-test-files/mock_dir1")
+		So(err, ShouldBeNil)
+
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+
+		So(names, ShouldContain, "a.txt")
+		So(names, ShouldContain, "1")
+
+		entries, err = fs.ReadDir(fsys, ".")
+		So(err, ShouldBeNil)
+		So(len(entries), ShouldBeGreaterThan, 0)
+	})
+
+	Convey("Read a file | MtpFS | fs.ReadFile", t, func() {
+		fi, err := GetObjectFromPath(dev, sid, "/mtp-test-files/a.txt")
+		So(err, ShouldBeNil)
+
+		data, err := fs.ReadFile(fsys, "mtp-test-files/a.txt")
+		So(err, ShouldBeNil)
+		So(len(data), ShouldEqual, fi.Size)
+
+		st, err := fs.Stat(fsys, "mtp-test-files/a.txt")
+		So(err, ShouldBeNil)
+		So(st.Name(), ShouldEqual, "a.txt")
+		So(st.IsDir(), ShouldBeFalse)
+	})
+
+	Convey("Open a second file while a file is open | MtpFS | Should throw an error", t, func() {
+		fi, err := GetObjectFromPath(dev, sid, "/mtp-test-files/a.txt")
+		So(err, ShouldBeNil)
+
+		f, err := fsys.Open("mtp-test-files/a.txt")
+		So(err, ShouldBeNil)
+
+		_, err = fsys.Open("mtp-test-files/a.txt")
+		So(errors.Is(err, ErrDeviceBusy), ShouldBeTrue)
+
+		_, err = OpenObject(dev, fi.ObjectId)
+		So(err, ShouldHaveSameTypeAs, DeviceBusyError{})
+
+		So(f.Close(), ShouldBeNil)
+
+		// the device is released once the file is closed
+		f, err = fsys.Open("mtp-test-files/a.txt")
+		So(err, ShouldBeNil)
+		So(f.Close(), ShouldBeNil)
+	})
+
+	Convey("Open an non existing path | MtpFS | Should throw an error", t, func() {
+		_, err := fsys.Open("mtp-test-files/fake.txt")
+		So(errors.Is(err, fs.ErrNotExist), ShouldBeTrue)
+
+		_, err = fsys.Open("/mtp-test-files/a.txt")
+		So(errors.Is(err, fs.ErrInvalid), ShouldBeTrue)
+
+		_, err = fsys.ReadDir("mtp-test-files/a.txt")
+		So(err, ShouldNotBeNil)
+	})
+
+	Dispose(dev)
+}
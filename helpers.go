@@ -1,12 +1,28 @@
 package mtpx
 
 import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/ganeshrvel/go-mtpfs/mtp"
+	"github.com/ganeshrvel/usb"
+	"hash"
+	"io"
+	"io/ioutil"
+	"math"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -19,7 +35,13 @@ func GetFileSize(dev *mtp.Device, obj *mtp.ObjectInfo, objectId uint32, isDir bo
 	var size int64
 	if obj.CompressedSize == 0xffffffff {
 		var val mtp.Uint64Value
-		if err := dev.GetObjectPropValue(objectId, mtp.OPC_ObjectSize, &val); err != nil {
+		if err := withCallTimeout(dev, nil, func() error {
+			return dev.GetObjectPropValue(objectId, mtp.OPC_ObjectSize, &val)
+		}); err != nil {
+			if _, ok := err.(TransactionTimeoutError); ok {
+				return 0, err
+			}
+
 			return 0, FileObjectError{
 				fmt.Errorf("GetObjectPropValue handle %d failed: %v", objectId, err.Error()),
 			}
@@ -39,7 +61,8 @@ func GetObjectFromObjectId(dev *mtp.Device, objectId uint32, parentPath string)
 	obj := mtp.ObjectInfo{}
 
 	// if the [objectId] is root then return the basic root directory information
-	if objectId == ParentObjectId {
+	// the root isn't an object of the device, so its handle (0xFFFFFFFF) must never be reported as a size; it's always 0
+	if isRootObjectId(objectId) {
 		return &FileInfo{
 			Size:     0,
 			IsDir:    true,
@@ -49,14 +72,17 @@ func GetObjectFromObjectId(dev *mtp.Device, objectId uint32, parentPath string)
 		}, nil
 	}
 
-	if err := dev.GetObjectInfo(objectId, &obj); err != nil {
-		return nil, FileObjectError{error: err}
+	if err := withCallTimeout(dev, nil, func() error {
+		return dev.GetObjectInfo(objectId, &obj)
+	}); err != nil {
+		return nil, fileObjectError(err)
 	}
 
 	isDir := isObjectADir(&obj)
+	// [GetFileSize] already returns a [FileObjectError]; propagate it as is
 	size, err := GetFileSize(dev, &obj, objectId, isDir)
 	if err != nil {
-		return nil, FileObjectError{error: err}
+		return nil, err
 	}
 
 	filename := obj.Filename
@@ -67,7 +93,7 @@ func GetObjectFromObjectId(dev *mtp.Device, objectId uint32, parentPath string)
 		Info:       &obj,
 		Size:       size,
 		IsDir:      isDir,
-		ModTime:    obj.ModificationDate,
+		ModTime:    localDeviceTime(obj.ModificationDate),
 		Name:       obj.Filename,
 		FullPath:   fullPath,
 		ParentPath: _parentPath,
@@ -78,49 +104,309 @@ func GetObjectFromObjectId(dev *mtp.Device, objectId uint32, parentPath string)
 }
 
 // fetch the object using [parentId] and [filename]
-// it matches the [filename] to the list of files in the directory
+// it matches the [filename] to the list of files in the directory case insensitively
+// if the device supports GetObjectPropList then the whole directory is fetched in a single transaction
 // Since the [parentPath] is unavailable here the [fullPath] property of the resulting object [FileInfo] may not be valid.
 func GetObjectFromParentIdAndFilename(dev *mtp.Device, storageId uint32, parentId uint32, filename string) (*FileInfo, error) {
+	return GetObjectFromParentIdAndFilenameWithMatch(dev, storageId, parentId, filename, FilenameMatchCaseInsensitive)
+}
+
+// same as [GetObjectFromParentIdAndFilename] but the [filename] is compared using [match]
+// [FilenameMatchCaseInsensitive] prefers the exact match; if more than one file differs from [filename] only by case then an [AmbiguousPathError] is returned
+// if the device lists more than one object with the same matching name then a [DuplicateObjectError] is returned; see [SetPreferFirstDuplicate]
+// any other value of [match] compares the filenames exactly
+func GetObjectFromParentIdAndFilenameWithMatch(dev *mtp.Device, storageId uint32, parentId uint32, filename string, match FilenameMatch) (*FileInfo, error) {
+	supported, err := isOperationSupported(dev, mtp.OC_MTP_GetObjPropList)
+	if err != nil {
+		return nil, err
+	}
+
+	if supported {
+		return getObjectFromParentIdAndFilenameUsingPropList(dev, storageId, parentId, filename, match)
+	}
+
+	return getObjectFromParentIdAndFilenameUsingPropValue(dev, storageId, parentId, filename, match)
+}
+
+// helper function to fetch the object using [parentId] and [filename]
+// the properties of all the objects in the directory are fetched using a single GetObjectPropList transaction
+func getObjectFromParentIdAndFilenameUsingPropList(dev *mtp.Device, storageId, parentId uint32, filename string, match FilenameMatch) (*FileInfo, error) {
+	var children []*FileInfo
+	err := withRetry(dev, func() (err error) {
+		children, err = getObjectPropList(dev, storageId, parentId, "")
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(children))
+	objectIds := make([]uint32, len(children))
+	for i, fi := range children {
+		names[i] = normalizeFilename(dev, fi.Name)
+		objectIds[i] = fi.ObjectId
+	}
+
+	index, err := selectFilenameMatch(names, objectIds, normalizeFilename(dev, filename), match, isPreferFirstDuplicate(dev))
+	if err != nil {
+		return nil, err
+	}
+
+	return children[index], nil
+}
+
+// helper function to fetch the object using [parentId] and [filename]
+// the ObjectFileName of each object in the directory is fetched one at a time
+func getObjectFromParentIdAndFilenameUsingPropValue(dev *mtp.Device, storageId uint32, parentId uint32, filename string, match FilenameMatch) (*FileInfo, error) {
+	objectId, err := getObjectIdFromParentIdAndFilenameUsingPropValue(dev, storageId, parentId, filename, match)
+	if err != nil {
+		return nil, err
+	}
+
+	var fi *FileInfo
+	err = withRetry(dev, func() (err error) {
+		fi, err = GetObjectFromObjectId(dev, objectId, "")
+
+		return err
+	})
+	if err != nil {
+		return nil, fileObjectError(err)
+	}
+
+	return fi, nil
+}
+
+// fetch the objectId of [filename] inside the directory [parentId] without fetching its ObjectInfo
+// the directory is matched the same way as [GetObjectFromParentIdAndFilenameWithMatch]
+func getObjectIdFromParentIdAndFilename(dev *mtp.Device, storageId uint32, parentId uint32, filename string, match FilenameMatch) (uint32, error) {
+	supported, err := isOperationSupported(dev, mtp.OC_MTP_GetObjPropList)
+	if err != nil {
+		return 0, err
+	}
+
+	if supported {
+		fi, err := getObjectFromParentIdAndFilenameUsingPropList(dev, storageId, parentId, filename, match)
+		if err != nil {
+			return 0, err
+		}
+
+		return fi.ObjectId, nil
+	}
+
+	return getObjectIdFromParentIdAndFilenameUsingPropValue(dev, storageId, parentId, filename, match)
+}
+
+// helper function to fetch the objectId using [parentId] and [filename]
+// the ObjectFileName of each object in the directory is fetched one at a time
+func getObjectIdFromParentIdAndFilenameUsingPropValue(dev *mtp.Device, storageId uint32, parentId uint32, filename string, match FilenameMatch) (uint32, error) {
 	handles := mtp.Uint32Array{}
-	if err := dev.GetObjectHandles(storageId, mtp.GOH_ALL_ASSOCS, parentId, &handles); err != nil {
-		return nil, FileObjectError{error: err}
+	if err := withRetry(dev, func() error {
+		return withCallTimeout(dev, nil, func() error {
+			return dev.GetObjectHandles(storageId, mtp.GOH_ALL_ASSOCS, parentId, &handles)
+		})
+	}); err != nil {
+		return 0, fileObjectError(err)
 	}
 
-	for _, objectId := range handles.Values {
-		// fetch the ObjectFileName
+	_filename := normalizeFilename(dev, filename)
+
+	names, objectIds, unreadable, err := scanFilenames(handles.Values, _filename, func(objectId uint32) (string, error) {
 		var val mtp.StringValue
-		if err := dev.GetObjectPropValue(objectId, mtp.OPC_ObjectFileName, &val); err != nil {
-			return nil, FileObjectError{error: err}
+		if err := withRetry(dev, func() error {
+			return withCallTimeout(dev, nil, func() error {
+				return dev.GetObjectPropValue(objectId, mtp.OPC_ObjectFileName, &val)
+			})
+		}); err != nil {
+			return "", err
+		}
+
+		return normalizeFilename(dev, val.Value), nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	index, err := selectFilenameMatch(names, objectIds, _filename, match, isPreferFirstDuplicate(dev))
+	if err != nil {
+		if _, ok := err.(FileNotFoundError); ok && len(unreadable) > 0 {
+			return 0, FileNotFoundError{error: fmt.Errorf("file not found: %s. the filenames of the objects %v couldn't be read", filename, unreadable)}
+		}
+
+		return 0, err
+	}
+
+	return objectIds[index], nil
+}
+
+// fetch the filename of each of the [handles] using [fetchName] and keep the ones which match [filename] case insensitively
+// the objects whose filename can't be fetched (eg: a corrupt object) are skipped and returned as [unreadable],
+// so that they don't hide the other objects; the scan is aborted only if the device was disconnected or a transaction timed out
+func scanFilenames(handles []uint32, filename string, fetchName func(objectId uint32) (string, error)) (names []string, objectIds, unreadable []uint32, err error) {
+	for _, objectId := range handles {
+		name, err := fetchName(objectId)
+		if err != nil {
+			if isDeviceDisconnected(err) {
+				return nil, nil, nil, DeviceDisconnectedError{error: err}
+			}
+
+			if _, ok := err.(TransactionTimeoutError); ok {
+				return nil, nil, nil, err
+			}
+
+			unreadable = append(unreadable, objectId)
+
+			continue
 		}
 
 		// if the ObjectFileName doesn't match the [filename] then skip the current iteration
 		// this will avoid fetching the whole object properties and improve the performance a bit.
-		if !strings.EqualFold(val.Value, filename) {
+		if !strings.EqualFold(name, filename) {
 			continue
 		}
 
-		fi, err := GetObjectFromObjectId(dev, objectId, "")
-		if err != nil {
-			return nil, FileObjectError{error: err}
+		names = append(names, name)
+		objectIds = append(objectIds, objectId)
+	}
+
+	return names, objectIds, unreadable, nil
+}
+
+// pick the index of the name in [names] which matches [filename] using [match]
+// [objectIds] are the objectIds of the [names]
+// the exact match is always preferred
+// if more than one object has the same matching name then a [DuplicateObjectError] is returned,
+// unless [preferFirst] is true in which case the first of them is picked
+func selectFilenameMatch(names []string, objectIds []uint32, filename string, match FilenameMatch, preferFirst bool) (int, error) {
+	var exact, candidates []int
+
+	for i, name := range names {
+		if name == filename {
+			exact = append(exact, i)
+		} else if match == FilenameMatchCaseInsensitive && strings.EqualFold(name, filename) {
+			candidates = append(candidates, i)
 		}
+	}
 
-		// return the current objectId if the filename == fi.Name
-		if strings.EqualFold(fi.Name, filename) {
-			return fi, nil
+	if len(exact) > 0 {
+		candidates = exact
+	}
+
+	switch len(candidates) {
+	case 0:
+		return 0, FileNotFoundError{error: fmt.Errorf("file not found: %s", filename)}
+
+	case 1:
+		return candidates[0], nil
+	}
+
+	if isDuplicateName(names, candidates) {
+		if preferFirst {
+			return candidates[0], nil
+		}
+
+		var duplicateIds []uint32
+		for _, i := range candidates {
+			duplicateIds = append(duplicateIds, objectIds[i])
+		}
+
+		return 0, DuplicateObjectError{
+			error:     fmt.Errorf("duplicate objects: %s. objectIds: %v", names[candidates[0]], duplicateIds),
+			Filename:  names[candidates[0]],
+			ObjectIds: duplicateIds,
 		}
 	}
 
-	return nil, FileNotFoundError{error: fmt.Errorf("file not found: %s", filename)}
+	var candidateNames []string
+	for _, i := range candidates {
+		candidateNames = append(candidateNames, names[i])
+	}
+
+	return 0, AmbiguousPathError{
+		error:      fmt.Errorf("ambiguous filename: %s. candidates: %s", filename, strings.Join(candidateNames, ", ")),
+		Candidates: candidateNames,
+	}
+}
+
+// check if all the [names] at the indices [candidates] are the same
+func isDuplicateName(names []string, candidates []int) bool {
+	for _, i := range candidates[1:] {
+		if names[i] != names[candidates[0]] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// if [preferFirst] is true then the paths of [dev] are resolved to the first of the objects sharing a filename in a directory
+// instead of returning a [DuplicateObjectError]
+// the setting is kept until [Dispose] is called
+// note: the objects are ordered as listed by the device, so the picked object may change between the sessions
+func SetPreferFirstDuplicate(dev *mtp.Device, preferFirst bool) {
+	devicePreferFirstDuplicate.Store(dev, preferFirst)
+}
+
+func isPreferFirstDuplicate(dev *mtp.Device) bool {
+	if p, ok := devicePreferFirstDuplicate.Load(dev); ok {
+		return p.(bool)
+	}
+
+	return false
+}
+
+// if [check] is true then the uploads, [MakeDirectory], [CopyFile], the trash operations, [SyncToDevice] and the deletions of [dev]
+// return a [ReadOnlyStorageError] up front when the storage is read-only, instead of the error of the device
+// the storage is checked once per call of these functions, which costs a GetStorageInfo; the helpers they share don't check it again
+// the setting is kept until [Dispose] is called
+func SetCheckStorageWritable(dev *mtp.Device, check bool) {
+	deviceCheckStorageWritable.Store(dev, check)
+}
+
+// return a [ReadOnlyStorageError] if [SetCheckStorageWritable] is on and the storage [storageId] doesn't allow the mutation
+// the storages which are read-only with object deletion still allow the deletions ([deletion] is true)
+func checkStorageWritable(dev *mtp.Device, storageId uint32, deletion bool) error {
+	if c, ok := deviceCheckStorageWritable.Load(dev); !ok || !c.(bool) {
+		return nil
+	}
+
+	var info mtp.StorageInfo
+	if err := withCallTimeout(dev, nil, func() error {
+		return dev.GetStorageInfo(storageId, &info)
+	}); err != nil {
+		return StorageInfoError{error: err}
+	}
+
+	switch info.AccessCapability {
+	case mtp.AC_ReadWrite:
+		return nil
+
+	case mtp.AC_ReadOnly_with_Object_Deletion:
+		if deletion {
+			return nil
+		}
+	}
+
+	return ReadOnlyStorageError{error: fmt.Errorf("the storage %d is read-only", storageId)}
 }
 
 // fetch the object information using [fullPath]
+// the path components are matched case insensitively
 // Since the [parentPath] is unavailable here the [fullPath] property of the resulting object [FileInfo] may not be valid.
 func GetObjectFromPath(dev *mtp.Device, storageId uint32, fullPath string) (fInfo *FileInfo, err error) {
+	return GetObjectFromPathWithMatch(dev, storageId, fullPath, FilenameMatchCaseInsensitive)
+}
+
+// same as [GetObjectFromPath] but each path component is compared using [match], see [GetObjectFromParentIdAndFilenameWithMatch]
+func GetObjectFromPathWithMatch(dev *mtp.Device, storageId uint32, fullPath string, match FilenameMatch) (fInfo *FileInfo, err error) {
 	if fullPath == "" {
 		return nil, InvalidPathError{error: fmt.Errorf("path does not Exists. path: %s", fullPath)}
 	}
 
-	_filePath := fixSlash(fullPath)
+	_filePath, err := NormalizePath(fullPath)
+	if err != nil {
+		return nil, err
+	}
 
 	if _filePath == PathSep {
 		return GetObjectFromObjectId(dev, ParentObjectId, "")
@@ -134,7 +420,7 @@ func GetObjectFromPath(dev *mtp.Device, storageId uint32, fullPath string) (fInf
 	const skipIndex = 1
 
 	for i, fName := range splittedFilePath[skipIndex:] {
-		_fi, err := GetObjectFromParentIdAndFilename(dev, storageId, objectId, fName)
+		_fi, err := GetObjectFromParentIdAndFilenameWithMatch(dev, storageId, objectId, fName, match)
 
 		if err != nil {
 			switch err.(type) {
@@ -171,6 +457,93 @@ func GetObjectFromPath(dev *mtp.Device, storageId uint32, fullPath string) (fInf
 	return fi, nil
 }
 
+// fetch the object information using [fullPath]
+// same as [GetObjectFromPath] but the directory listings are read from and stored in [cache]
+// if [cache] is nil then [GetObjectFromPath] is used
+func GetObjectFromPathCached(dev *mtp.Device, storageId uint32, fullPath string, cache *PathCache) (fInfo *FileInfo, err error) {
+	if cache == nil {
+		return GetObjectFromPath(dev, storageId, fullPath)
+	}
+
+	if fullPath == "" {
+		return nil, InvalidPathError{error: fmt.Errorf("path does not Exists. path: %s", fullPath)}
+	}
+
+	_filePath, err := NormalizePath(fullPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if _filePath == PathSep {
+		return GetObjectFromObjectId(dev, ParentObjectId, "")
+	}
+
+	splittedFilePath := strings.Split(_filePath, PathSep)
+
+	var objectId = uint32(ParentObjectId)
+	var fi *FileInfo
+	const skipIndex = 1
+
+	for i, fName := range splittedFilePath[skipIndex:] {
+		_fi, err := getCachedObjectFromParentIdAndFilename(dev, storageId, objectId, fName, cache)
+		if err != nil {
+			switch err.(type) {
+			case FileNotFoundError:
+				return nil, InvalidPathError{
+					error: fmt.Errorf("path not found: %s\nreason: %v", fullPath, err.Error()),
+				}
+
+			default:
+				return nil, err
+			}
+		}
+
+		if !_fi.IsDir && indexExists(splittedFilePath, i+1+skipIndex) {
+			return nil, InvalidPathError{error: fmt.Errorf("path not found: %s", fullPath)}
+		}
+
+		fi = _fi
+		objectId = _fi.ObjectId
+	}
+
+	if fi == nil {
+		return nil, InvalidPathError{error: fmt.Errorf("file not found: %s", fullPath)}
+	}
+
+	fi.FullPath = _filePath
+	fi.ParentPath = filepath.Dir(_filePath)
+
+	return fi, nil
+}
+
+// helper function to fetch the object using [parentId] and [filename] from the [cache]
+// a stale cache entry (the object was removed from the device) invalidates the listing of [parentId] and the lookup is retried once
+func getCachedObjectFromParentIdAndFilename(dev *mtp.Device, storageId, parentId uint32, filename string, cache *PathCache) (*FileInfo, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		objectId, found, err := cache.lookup(dev, storageId, parentId, filename)
+		if err != nil {
+			return nil, err
+		}
+
+		if !found {
+			break
+		}
+
+		if objectId == ambiguousPathCacheObjectId {
+			return GetObjectFromParentIdAndFilename(dev, storageId, parentId, filename)
+		}
+
+		fi, err := GetObjectFromObjectId(dev, objectId, "")
+		if err == nil && strings.EqualFold(fi.Name, filename) {
+			return fi, nil
+		}
+
+		cache.Invalidate(storageId, parentId)
+	}
+
+	return nil, FileNotFoundError{error: fmt.Errorf("file not found: %s", filename)}
+}
+
 // fetch an object using [objectId] and/or [fullPath]
 // Since the [parentPath] is unavailable here the [fullPath] property of the resulting object [FileInfo] may not be valid.
 func GetObjectFromObjectIdOrPath(dev *mtp.Device, storageId uint32, fileProp FileProp) (fInfo *FileInfo, err error) {
@@ -197,220 +570,2534 @@ func GetObjectFromObjectIdOrPath(dev *mtp.Device, storageId uint32, fileProp Fil
 		return nil, err
 	}
 
+	if err := checkObjectStorage(fo, storageId); err != nil {
+		return nil, err
+	}
+
 	return fo, nil
 }
 
-// check if the object is a directory
-func isObjectADir(obj *mtp.ObjectInfo) bool {
-	return obj.ObjectFormat == mtp.OFC_Association
+// returns a [StorageMismatchError] if the object [fi] doesn't belong to the storage [storageId]
+// the root directory belongs to every storage and mtp.GOH_ALL_STORAGE matches every object
+func checkObjectStorage(fi *FileInfo, storageId uint32) error {
+	if fi.ObjectId == ParentObjectId || storageId == mtp.GOH_ALL_STORAGE || fi.Info.StorageID == storageId {
+		return nil
+	}
+
+	return StorageMismatchError{
+		error:           fmt.Errorf("the object %d belongs to the storage %d, not %d", fi.ObjectId, fi.Info.StorageID, storageId),
+		ObjectId:        fi.ObjectId,
+		StorageId:       storageId,
+		ObjectStorageId: fi.Info.StorageID,
+	}
 }
 
-// helper function to create a directory
-func handleMakeDirectory(dev *mtp.Device, storageId, parentId uint32, filename string) (objectId uint32, err error) {
-	send := mtp.ObjectInfo{
-		StorageID:        storageId,
-		ObjectFormat:     mtp.OFC_Association,
-		ParentObject:     parentId,
-		Filename:         filename,
-		CompressedSize:   0,
-		ModificationDate: time.Now(),
+// check if [objectId] is the root directory; 0 is accepted along with [ParentObjectId], see [fixParentId]
+func isRootObjectId(objectId uint32) bool {
+	return objectId == ParentObjectId || objectId == 0
+}
+
+// Resolve the absolute path of the object [objectId] by following its parents up to the root directory
+// see [ResolveObjectPathCached]
+func ResolveObjectPath(dev *mtp.Device, storageId, objectId uint32) (string, error) {
+	return ResolveObjectPathCached(dev, storageId, objectId, nil)
+}
+
+// Resolve the absolute path of the object [objectId]
+// same as [ResolveObjectPath] but the parents are read from and stored in [cache], so that the objects sharing
+// the parents are resolved without fetching them again; if [cache] is nil then a temporary [PathCache] is used
+// a [StorageMismatchError] is returned if the object doesn't belong to [storageId] and an [InvalidPathError]
+// if one of its parents can't be fetched or the parents are cyclic
+func ResolveObjectPathCached(dev *mtp.Device, storageId, objectId uint32, cache *PathCache) (string, error) {
+	if isRootObjectId(objectId) {
+		return PathSep, nil
 	}
 
-	// create a new object handle
-	_, _, objId, err := dev.SendObjectInfo(storageId, parentId, &send)
+	if cache == nil {
+		cache = NewPathCache()
+	}
+
+	p, err := cache.parent(dev, objectId)
 	if err != nil {
-		return 0, SendObjectError{error: err}
+		return "", err
 	}
 
-	return objId, nil
-}
+	if storageId != mtp.GOH_ALL_STORAGE && p.storageId != storageId {
+		return "", StorageMismatchError{
+			error:           fmt.Errorf("the object %d belongs to the storage %d, not %d", objectId, p.storageId, storageId),
+			ObjectId:        objectId,
+			StorageId:       storageId,
+			ObjectStorageId: p.storageId,
+		}
+	}
 
-// helper function to create a device file
-func handleMakeFile(dev *mtp.Device, storageId uint32, obj *mtp.ObjectInfo, fInfo *os.FileInfo, fileBuf *os.File, overwriteExisting bool, progressCb SizeProgressCb) (objectId uint32, err error) {
-	fi, err := GetObjectFromParentIdAndFilename(dev, storageId, obj.ParentObject, obj.Filename)
+	names := []string{p.filename}
+	visited := map[uint32]bool{objectId: true}
 
-	// file Exists
-	if err == nil {
-		// if [overwriteExisting] is false then just return existing [objectId] of the exisiting file
-		if !overwriteExisting {
-			return fi.ObjectId, nil
+	for id := p.parentId; id != ParentObjectId; id = p.parentId {
+		// guard against the devices reporting a cyclic hierarchy
+		if visited[id] {
+			return "", InvalidPathError{error: fmt.Errorf("cyclic parent objects found for the object: %d", objectId)}
 		}
+		visited[id] = true
 
-		fileProp := FileProp{fi.ObjectId, ""}
-		// if [overwriteExisting] is true then delete the existing file
-		if err := DeleteFile(dev, storageId, []FileProp{fileProp}); err != nil {
-			return 0, err
-		}
-	} else {
-		switch err.(type) {
-		// if the file does not Exists then do nothing
-		case FileNotFoundError:
+		p, err = cache.parent(dev, id)
+		if err != nil {
+			if _, ok := err.(FileObjectError); ok {
+				return "", InvalidPathError{error: fmt.Errorf("the parent %d of the object %d couldn't be fetched: %v", id, objectId, err)}
+			}
 
-		default:
-			return 0, err
+			return "", err
 		}
+
+		names = append(names, p.filename)
 	}
 
-	// create a new object handle
-	_, _, objId, err := dev.SendObjectInfo(storageId, obj.ParentObject, obj)
-	if err != nil {
-		return objId, SendObjectError{error: err}
+	// the names were collected from the object up to the root
+	for i, j := 0, len(names)-1; i < j; i, j = i+1, j-1 {
+		names[i], names[j] = names[j], names[i]
 	}
 
-	size := (*fInfo).Size()
-	// send the bytes data to the newly create object handle
-	err = dev.SendObject(fileBuf, size, func(sent int64) error {
-		if err := progressCb(size, sent, objId, nil); err != nil {
-			return err
-		}
+	return PathSep + strings.Join(names, PathSep), nil
+}
 
-		return nil
+// Walk up the parents of the object [objectId] and report whether they lead to the root
+// use it to diagnose the objects which fail to resolve using [ResolveObjectPath] because of a corrupt storage
+// return:
+// (absolute path, false, nil) if the chain reaches the root
+// (relative path, true, nil) if a parent doesn't exist or the parents are cyclic; [path] holds the names below the
+// dangling parent, which are joined without a leading [PathSep]
+// ("", false, err) if [objectId] itself can't be fetched or the device returned an error
+func VerifyObjectChain(dev *mtp.Device, objectId uint32) (path string, broken bool, err error) {
+	cache := NewPathCache()
+
+	return verifyObjectChain(objectId, func(id uint32) (pathCacheParent, error) {
+		return cache.parent(dev, id)
 	})
+}
+
+// helper function of [VerifyObjectChain]; the parent of each object is fetched using [fetchParent]
+func verifyObjectChain(objectId uint32, fetchParent func(objectId uint32) (pathCacheParent, error)) (path string, broken bool, err error) {
+	if isRootObjectId(objectId) {
+		return PathSep, false, nil
+	}
+
+	p, err := fetchParent(objectId)
 	if err != nil {
-		return objId, SendObjectError{error: err}
+		return "", false, err
 	}
 
-	return objId, nil
-}
+	names := []string{p.filename}
+	visited := map[uint32]bool{objectId: true}
 
-// helper function to create a local file
-func handleMakeLocalFile(dev *mtp.Device, fi *FileInfo, destination string, progressCb SizeProgressCb) error {
-	f, err := os.Create(destination)
+	join := func() string {
+		// the names were collected from the object up to the root
+		for i, j := 0, len(names)-1; i < j; i, j = i+1, j-1 {
+			names[i], names[j] = names[j], names[i]
+		}
+
+		return strings.Join(names, PathSep)
+	}
+
+	for id := p.parentId; !isRootObjectId(id); id = p.parentId {
+		if visited[id] {
+			return join(), true, nil
+		}
+		visited[id] = true
+
+		p, err = fetchParent(id)
+		if err != nil {
+			if isInvalidObjectError(err) {
+				return join(), true, nil
+			}
+
+			return "", false, err
+		}
+
+		names = append(names, p.filename)
+	}
+
+	return PathSep + join(), false, nil
+}
+
+// check if the object is a directory
+func isObjectADir(obj *mtp.ObjectInfo) bool {
+	return obj.ObjectFormat == mtp.OFC_Association
+}
+
+// objects in the root directory may report 0 as their parent
+// map it to [ParentObjectId] so that it can be compared with and passed to GetObjectHandles
+func fixParentId(parentId uint32) uint32 {
+	if parentId == 0 {
+		return ParentObjectId
+	}
+
+	return parentId
+}
+
+// helper function to create a directory
+func handleMakeDirectory(dev *mtp.Device, storageId, parentId uint32, filename string) (objectId uint32, err error) {
+	send := mtp.ObjectInfo{
+		StorageID:        storageId,
+		ObjectFormat:     mtp.OFC_Association,
+		ParentObject:     parentId,
+		Filename:         filename,
+		CompressedSize:   0,
+		ModificationDate: time.Now(),
+	}
+
+	// create a new object handle
+	err = withCallTimeout(dev, nil, func() (err error) {
+		_, _, objectId, err = dev.SendObjectInfo(storageId, parentId, &send)
+
+		return err
+	})
+	if err != nil {
+		return 0, SendObjectError{error: err}
+	}
+
+	invalidateCaches(dev, storageId, parentId)
+
+	return objectId, nil
+}
+
+// helper function to create the directory [fullPath] along with its missing parents
+// [dirs] maps the fullPath of the known directories to their objectId; it is updated with the created and the found directories
+// so that every directory is resolved or created only once per upload session
+// if [dryRunCb] is not nil then the missing directories are reported to it instead of being created;
+// they are stored in [dirs] with the objectId [dryRunObjectId]
+func makeDirectoryCached(dev *mtp.Device, storageId uint32, dirs map[string]uint32, fullPath string, dryRunCb DryRunCb) (objectId uint32, err error) {
+	// the path components are checked against the [FilenamePolicy] of [dev] so that [dirs] and [dryRunCb] see the sanitized path
+	_fullPath, err := checkPath(dev, fixSlash(fullPath))
+	if err != nil {
+		return 0, err
+	}
+
+	if _fullPath == PathSep {
+		return ParentObjectId, nil
+	}
+
+	if objId, ok := dirs[_fullPath]; ok {
+		return objId, nil
+	}
+
+	parentPath, filename := path.Split(_fullPath)
+
+	parentId, err := makeDirectoryCached(dev, storageId, dirs, parentPath, dryRunCb)
+	if err != nil {
+		return 0, err
+	}
+
+	// the children of a planned directory don't exist either
+	var fi *FileInfo
+	if parentId == dryRunObjectId {
+		err = FileNotFoundError{error: fmt.Errorf("file not found: %s", filename)}
+	} else {
+		// reuse the directory if it already existed on the device before the upload
+		fi, err = GetObjectFromParentIdAndFilename(dev, storageId, parentId, filename)
+	}
+	if err != nil {
+		switch err.(type) {
+		case FileNotFoundError:
+			if dryRunCb != nil {
+				if err := dryRunCb(DryRunCreateDir, _fullPath, 0); err != nil {
+					return 0, err
+				}
+
+				dirs[_fullPath] = dryRunObjectId
+
+				return dryRunObjectId, nil
+			}
+
+			objId, err := handleMakeDirectory(dev, storageId, parentId, filename)
+			if err != nil {
+				return 0, err
+			}
+
+			dirs[_fullPath] = objId
+
+			return objId, nil
+
+		default:
+			return 0, err
+		}
+	}
+
+	if !fi.IsDir {
+		return 0, InvalidPathError{error: fmt.Errorf("invalid path: %s. The object is not a directory", _fullPath)}
+	}
+
+	dirs[_fullPath] = fi.ObjectId
+
+	return fi.ObjectId, nil
+}
+
+// the [ConflictPolicy] matching the legacy overwriteExisting flag
+func overwriteConflictPolicy(overwriteExisting bool) ConflictPolicy {
+	if overwriteExisting {
+		return ConflictOverwrite
+	}
+
+	return ConflictSkip
+}
+
+// resolve the conflict of the file [filename] which is about to be created in the directory [parentId] using [conflictPolicy]
+// [size] and [modTime] belong to the new file
+// return
+// [name]: the filename to create; it differs from [filename] only for [ConflictRenameWithSuffix]
+// [existingObjectId]: objectId of the existing file which is left untouched or replaced; 0 if there is nothing to replace
+// [skip]: true if the existing file is left untouched and nothing is created
+func resolveFileConflict(dev *mtp.Device, storageId, parentId uint32, filename string, size int64, modTime time.Time, conflictPolicy ConflictPolicy) (name string, existingObjectId uint32, skip bool, err error) {
+	// a directory planned by a dry run has no children
+	if parentId == dryRunObjectId {
+		return filename, 0, false, nil
+	}
+
+	fi, err := GetObjectFromParentIdAndFilename(dev, storageId, parentId, filename)
+	if err != nil {
+		switch err.(type) {
+		// if the file does not Exists then there is no conflict
+		case FileNotFoundError:
+			return filename, 0, false, nil
+
+		default:
+			return "", 0, false, err
+		}
+	}
+
+	switch conflictPolicy {
+	case ConflictSkip:
+		return filename, fi.ObjectId, true, nil
+
+	case ConflictOverwrite:
+		return filename, fi.ObjectId, false, nil
+
+	case ConflictOverwriteIfNewer:
+		return filename, fi.ObjectId, !modTime.After(fi.ModTime), nil
+
+	case ConflictOverwriteIfDifferentSize:
+		return filename, fi.ObjectId, size == fi.Size, nil
+
+	case ConflictRenameWithSuffix:
+		for n := 1; ; n++ {
+			name := filenameWithSuffix(filename, n)
+
+			if _, err := GetObjectFromParentIdAndFilename(dev, storageId, parentId, name); err != nil {
+				switch err.(type) {
+				case FileNotFoundError:
+					return name, 0, false, nil
+
+				default:
+					return "", 0, false, err
+				}
+			}
+		}
+
+	default:
+		return "", 0, false, checkConflictPolicy(conflictPolicy)
+	}
+}
+
+// returns an [UnsupportedOperationError] if the [conflictPolicy] is unknown
+func checkConflictPolicy(conflictPolicy ConflictPolicy) error {
+	if conflictPolicy < ConflictSkip || conflictPolicy > ConflictRenameWithSuffix {
+		return UnsupportedOperationError{error: fmt.Errorf("unsupported conflict policy: %d", conflictPolicy)}
+	}
+
+	return nil
+}
+
+// plan the upload of the file [filename] into the directory [parentId] for a dry run
+// returns an empty action if the existing file is left untouched
+// [name] is the filename which would be created; see [FilenamePolicy] and [resolveFileConflict]
+func planMakeFile(dev *mtp.Device, storageId, parentId uint32, filename string, size int64, modTime time.Time, conflictPolicy ConflictPolicy) (action DryRunAction, name string, err error) {
+	filename, err = checkFilename(dev, filename)
+	if err != nil {
+		return "", "", err
+	}
+
+	name, existingObjectId, skip, err := resolveFileConflict(dev, storageId, parentId, filename, size, modTime, conflictPolicy)
+	if err != nil {
+		return "", "", err
+	}
+
+	if skip {
+		return "", name, nil
+	}
+
+	if existingObjectId != 0 {
+		return DryRunOverwrite, name, nil
+	}
+
+	return DryRunUpload, name, nil
+}
+
+// report the objects which [DeleteFileRecursiveWithOpts] would delete to [dryRunCb] in the order of their deletion
+// [objects] are the nested objects of [fi] listed by the walk
+func planDeleteObjects(dev *mtp.Device, storageId uint32, fi *FileInfo, objects []*FileInfo, dryRunCb DryRunCb) (deletedCount int, err error) {
+	// the [FullPath] of [fi] isn't valid if only the [objectId] is available
+	fullPath := fi.FullPath
+	if fullPath == "" {
+		fullPath, err = ResolveObjectPath(dev, storageId, fi.ObjectId)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	report := func(fullPath string, size int64) error {
+		deletedCount += 1
+
+		if dryRunCb == nil {
+			return nil
+		}
+
+		return dryRunCb(DryRunDelete, fullPath, size)
+	}
+
+	for i := len(objects) - 1; i >= 0; i-- {
+		if err := report(objects[i].FullPath, objects[i].Size); err != nil {
+			return deletedCount, err
+		}
+	}
+
+	if err := report(fullPath, fi.Size); err != nil {
+		return deletedCount, err
+	}
+
+	return deletedCount, nil
+}
+
+// helper function to create a device file
+// [obj.Filename] is checked against the [FilenamePolicy] of [dev]
+// an existing file with the same name is handled using [conflictPolicy]; the [obj.Filename] is updated if the file was renamed or sanitized
+// if the existing file is left untouched then its objectId is returned
+// if [preserveModTime] is true then the new object is stamped with [obj.ModificationDate]; see [setObjectModTime]
+// if [atomic] is true then the file is sent under a temporary name and renamed once it is complete; see [UploadOpts.Atomic]
+func handleMakeFile(dev *mtp.Device, storageId uint32, obj *mtp.ObjectInfo, fInfo *os.FileInfo, fileBuf *os.File, conflictPolicy ConflictPolicy, reuseHandle, preserveModTime, keepPartialObject, atomic bool, buffers *bufferPool, progressCb SizeProgressCb) (objectId uint32, err error) {
+	size := (*fInfo).Size()
+
+	filename, err := checkFilename(dev, obj.Filename)
+	if err != nil {
+		return 0, err
+	}
+
+	name, existingObjectId, skip, err := resolveFileConflict(dev, storageId, obj.ParentObject, filename, size, (*fInfo).ModTime(), conflictPolicy)
+	if err != nil {
+		return 0, err
+	}
+
+	if skip {
+		return existingObjectId, nil
+	}
+
+	// the existing file may be replaced and a partial object may be left behind even if the upload fails
+	defer invalidateCaches(dev, storageId, obj.ParentObject)
+
+	if existingObjectId != 0 && reuseHandle && !atomic {
+		rewritten, err := handleReuseObject(dev, existingObjectId, fileBuf, size, progressCb)
+		if err != nil {
+			return existingObjectId, err
+		}
+
+		if rewritten {
+			if preserveModTime {
+				if err := setObjectModTime(dev, existingObjectId, obj.ObjectFormat, obj.ModificationDate); err != nil {
+					return existingObjectId, err
+				}
+			}
+
+			return existingObjectId, nil
+		}
+	}
+
+	// delete the existing file which is being replaced
+	// an atomic upload replaces it only after the new file was sent
+	if existingObjectId != 0 && !atomic {
+		fileProp := FileProp{existingObjectId, ""}
+		if err := deleteFile(dev, storageId, []FileProp{fileProp}); err != nil {
+			return 0, err
+		}
+	}
+
+	obj.Filename = name
+
+	// the object is created under the temporary name while [obj] keeps the final one
+	sendObj := obj
+	if atomic {
+		tmpName, err := atomicUploadFilename(dev, storageId, obj.ParentObject, name, obj.ObjectFormat)
+		if err != nil {
+			return 0, err
+		}
+
+		_obj := *obj
+		_obj.Filename = tmpName
+		sendObj = &_obj
+	}
+
+	// the file is read [bufferPool.size] bytes at a time using a reader which is reused by the other files of the batch
+	br := buffers.reader(fileBuf)
+	defer buffers.putReader(br)
+
+	// SendObject must follow SendObjectInfo, so a failed transfer is retried starting from a new object handle
+	var objId uint32
+	var timedOut bool
+	err = withRetry(dev, func() error {
+		if objId != 0 {
+			// remove the incomplete object of the previous attempt
+			if err := deleteFile(dev, storageId, []FileProp{{objId, ""}}); err != nil {
+				return permanentError{err}
+			}
+
+			objId = 0
+
+			if _, err := fileBuf.Seek(0, io.SeekStart); err != nil {
+				return permanentError{err}
+			}
+
+			br.Reset(fileBuf)
+		}
+
+		// create a new object handle
+		var _objId uint32
+		err := withCallTimeout(dev, nil, func() (err error) {
+			_, _, _objId, err = dev.SendObjectInfo(storageId, obj.ParentObject, sendObj)
+
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		objId = _objId
+
+		// send the bytes data to the newly create object handle
+		// [br] isn't touched by a timed out transaction once [withCallTimeout] returned
+		var cbErr error
+		g := &callGuard{}
+		err = withCallTimeout(dev, g, func() error {
+			return dev.SendObject(g.reader(br), size, g.progress(func(sent int64) error {
+				if err := progressCb(size, sent, objId, nil); err != nil {
+					cbErr = err
+
+					return err
+				}
+
+				return nil
+			}))
+		})
+		if _, ok := err.(TransactionTimeoutError); ok {
+			timedOut = true
+
+			return err
+		}
+		if cbErr != nil {
+			return permanentError{cbErr}
+		}
+
+		return err
+	})
+	if err != nil {
+		if isDeviceDisconnected(err) {
+			return objId, DeviceDisconnectedError{error: err}
+		}
+
+		// the device is still busy with the transfer, so the partial object can't be deleted
+		if timedOut {
+			return objId, err
+		}
+
+		// remove the partial object which was created by SendObjectInfo, so that it isn't mistaken for a complete file
+		// the error of the transfer is returned even if the cleanup fails
+		if objId != 0 && !keepPartialObject {
+			if cleanupErr := deleteFile(dev, storageId, []FileProp{{objId, ""}}); cleanupErr != nil {
+				return objId, SendObjectError{error: fmt.Errorf("%w (the partial object %d couldn't be deleted: %v)", err, objId, cleanupErr)}
+			}
+
+			return 0, SendObjectError{error: err}
+		}
+
+		return objId, SendObjectError{error: err}
+	}
+
+	if atomic {
+		if err := commitAtomicUpload(dev, storageId, obj.ParentObject, objId, existingObjectId, name); err != nil {
+			return objId, err
+		}
+	}
+
+	if preserveModTime {
+		if err := setObjectModTime(dev, objId, obj.ObjectFormat, obj.ModificationDate); err != nil {
+			return objId, err
+		}
+	}
+
+	return objId, nil
+}
+
+// the temporary name of the file [filename] uploaded by [UploadOpts.Atomic] (eg: .name.ext.mtpx-tmp)
+// the name is shortened to fit the [FilenamePolicy] of [dev]; a leftover object of an interrupted upload with the same name is deleted
+// an [UnsupportedOperationError] is returned if the device doesn't allow renaming the objects of the [format] (mtp.OFC_*)
+func atomicUploadFilename(dev *mtp.Device, storageId, parentId uint32, filename string, format uint16) (string, error) {
+	writable, err := isObjectPropWritable(dev, format, mtp.OPC_ObjectFileName)
+	if err != nil {
+		return "", err
+	}
+
+	if !writable {
+		return "", UnsupportedOperationError{error: fmt.Errorf("unable to upload %s atomically. the device can't rename the objects", filename)}
+	}
+
+	tmpName := temporaryFilename(dev, filename, atomicUploadSuffix)
+
+	fi, err := GetObjectFromParentIdAndFilename(dev, storageId, parentId, tmpName)
+	if err != nil {
+		if _, ok := err.(FileNotFoundError); ok {
+			return tmpName, nil
+		}
+
+		return "", err
+	}
+
+	if err := deleteFile(dev, storageId, []FileProp{{fi.ObjectId, ""}}); err != nil {
+		return "", err
+	}
+
+	return tmpName, nil
+}
+
+// the hidden temporary name of the file [filename] (eg: .name.ext{suffix}) shortened to fit the [FilenamePolicy] of [dev]
+func temporaryFilename(dev *mtp.Device, filename, suffix string) string {
+	tmpName := "." + filename + suffix
+	if maxLength := maxFilenameLength(dev); maxLength > 0 && len(tmpName) > maxLength {
+		tmpName = truncateUtf8("."+filename, maxLength-len(suffix)) + suffix
+	}
+
+	return tmpName
+}
+
+// a temporary name of the file [filename] which isn't taken in any of the directories [parentIds]
+// (eg: .name.ext.mtpx-old, .name (1).ext.mtpx-old)
+func freeTemporaryFilename(dev *mtp.Device, storageId uint32, filename, suffix string, parentIds ...uint32) (string, error) {
+	for n := 0; ; n++ {
+		name := filename
+		if n > 0 {
+			name = filenameWithSuffix(filename, n)
+		}
+
+		tmpName := temporaryFilename(dev, name, suffix)
+
+		free := true
+		for _, parentId := range parentIds {
+			ok, err := isFilenameFree(dev, storageId, parentId, tmpName)
+			if err != nil {
+				return "", err
+			}
+
+			free = free && ok
+		}
+
+		if free {
+			return tmpName, nil
+		}
+	}
+}
+
+// rename the object [objectId] to [filename] using the OPC_ObjectFileName property
+func setObjectFilename(dev *mtp.Device, objectId uint32, filename string) error {
+	return withRetry(dev, func() error {
+		return withCallTimeout(dev, nil, func() error {
+			return dev.SetObjectPropValue(objectId, mtp.OPC_ObjectFileName, &mtp.StringValue{Value: filename})
+		})
+	})
+}
+
+// replace the file [existingObjectId] (if any) of the directory [parentId] with the completely sent object [objectId]
+// and rename it to [filename]
+// the existing file is renamed aside first and deleted only once the new object holds [filename], so that a failure never
+// leaves the directory without a complete file: if the rename fails then the existing file gets its name back and the
+// complete file is left under its temporary name
+func commitAtomicUpload(dev *mtp.Device, storageId, parentId, objectId, existingObjectId uint32, filename string) error {
+	var asideName string
+	if existingObjectId != 0 {
+		var err error
+		asideName, err = freeTemporaryFilename(dev, storageId, filename, atomicReplacedSuffix, parentId)
+		if err != nil {
+			return err
+		}
+
+		if err := setObjectFilename(dev, existingObjectId, asideName); err != nil {
+			return FileObjectError{error: fmt.Errorf("unable to rename the replaced object %d to %s: %w", existingObjectId, asideName, err)}
+		}
+	}
+
+	if err := setObjectFilename(dev, objectId, filename); err != nil {
+		if existingObjectId != 0 {
+			if restoreErr := setObjectFilename(dev, existingObjectId, filename); restoreErr != nil {
+				return FileObjectError{error: fmt.Errorf("unable to rename the uploaded object %d to %s: %v (the replaced object was left as %s: %v)", objectId, filename, err, asideName, restoreErr)}
+			}
+		}
+
+		return FileObjectError{error: fmt.Errorf("unable to rename the uploaded object %d to %s: %w", objectId, filename, err)}
+	}
+
+	if existingObjectId != 0 {
+		if err := deleteFile(dev, storageId, []FileProp{{existingObjectId, ""}}); err != nil {
+			return FileObjectError{error: fmt.Errorf("the file %s was replaced but the previous object %s couldn't be deleted: %w", filename, asideName, err)}
+		}
+	}
+
+	return nil
+}
+
+// the name of the incomplete object of [UploadFileResume] for the file [filename] of [size] bytes modified at [modTime]
+// (eg: .name.ext.400000-5ff1e2a0.mtpx-partial)
+// the size and the modification time identify the source, so an upload is never resumed from the object of another version of the file
+// unlike [atomicUploadFilename] a leftover object with this name is kept, since the upload resumes from it
+func resumableUploadFilename(dev *mtp.Device, filename string, size int64, modTime time.Time) string {
+	return temporaryFilename(dev, filename, fmt.Sprintf(".%x-%x%s", size, modTime.Unix(), resumableUploadSuffix))
+}
+
+// append the [size] bytes of [fileBuf] at [offset] to the object [objectId] using the Android edit extension
+// the edit is committed with EndEditObject, so the size of the object reflects the appended bytes if a later chunk fails
+func handleAppendPartialObject(dev *mtp.Device, objectId uint32, fileBuf *os.File, offset, size int64) error {
+	err := withRetry(dev, func() error {
+		if err := withCallTimeout(dev, nil, func() error {
+			return dev.AndroidBeginEditObject(objectId)
+		}); err != nil {
+			return err
+		}
+
+		g := &callGuard{}
+		if err := withCallTimeout(dev, g, func() error {
+			return dev.AndroidSendPartialObject(objectId, offset, uint32(size), g.reader(io.NewSectionReader(fileBuf, offset, size)))
+		}); err != nil {
+			if _, ok := err.(TransactionTimeoutError); ok {
+				return permanentError{err}
+			}
+
+			// the edit is closed so that the object isn't left locked on the device
+			_ = withCallTimeout(dev, nil, func() error {
+				return dev.AndroidEndEditObject(objectId)
+			})
+
+			return err
+		}
+
+		return withCallTimeout(dev, nil, func() error {
+			return dev.AndroidEndEditObject(objectId)
+		})
+	})
+	if err != nil {
+		if isDeviceDisconnected(err) {
+			return DeviceDisconnectedError{error: err}
+		}
+
+		if _, ok := err.(TransactionTimeoutError); ok {
+			return err
+		}
+
+		return SendObjectError{error: err}
+	}
+
+	return nil
+}
+
+// check if the device can rewrite an existing object in place
+func isEditObjectSupported(dev *mtp.Device) (bool, error) {
+	c, err := GetDeviceCapabilities(dev)
+	if err != nil {
+		return false, err
+	}
+
+	return c.SupportsEditObject(), nil
+}
+
+// truncate the existing object [objectId] and write the [size] bytes of [fileBuf] to it using the Android edit extension
+// the objectId and the properties of the object are kept
+func handleRewriteObject(dev *mtp.Device, objectId uint32, fileBuf *os.File, size int64, progressCb SizeProgressCb) error {
+	err := withRetry(dev, func() error {
+		if _, err := fileBuf.Seek(0, io.SeekStart); err != nil {
+			return permanentError{err}
+		}
+
+		if err := withCallTimeout(dev, nil, func() error {
+			return dev.AndroidBeginEditObject(objectId)
+		}); err != nil {
+			return err
+		}
+
+		if err := writeEditedObject(dev, objectId, fileBuf, size, progressCb); err != nil {
+			// the edit is closed so that the object isn't left locked on the device
+			_ = withCallTimeout(dev, nil, func() error {
+				return dev.AndroidEndEditObject(objectId)
+			})
+
+			return err
+		}
+
+		return withCallTimeout(dev, nil, func() error {
+			return dev.AndroidEndEditObject(objectId)
+		})
+	})
+	if err != nil {
+		if isDeviceDisconnected(err) {
+			return DeviceDisconnectedError{error: err}
+		}
+
+		if _, ok := err.(TransactionTimeoutError); ok {
+			return err
+		}
+
+		return SendObjectError{error: err}
+	}
+
+	return nil
+}
+
+// rewrite the existing file [objectId] in place using [handleRewriteObject] so that its objectId is kept
+// [rewritten] is false if the object has to be replaced by a new one instead: the object is a directory, the device doesn't
+// support the Android edit extension or the rewrite failed; [fileBuf] is rewound for the new transfer
+// an error is returned only if the device was disconnected, the transaction timed out or [progressCb] returned an error
+func handleReuseObject(dev *mtp.Device, objectId uint32, fileBuf *os.File, size int64, progressCb SizeProgressCb) (rewritten bool, err error) {
+	supported, err := isEditObjectSupported(dev)
+	if err != nil || !supported {
+		return false, err
+	}
+
+	fi, err := GetObjectFromObjectId(dev, objectId, "")
+	if err != nil {
+		return false, err
+	}
+
+	// only the files are rewritten
+	if fi.IsDir {
+		return false, nil
+	}
+
+	var cbErr error
+	err = handleRewriteObject(dev, objectId, fileBuf, size, func(total, sent int64, objectId uint32, err error) error {
+		if err := progressCb(total, sent, objectId, err); err != nil {
+			cbErr = err
+
+			return err
+		}
+
+		return nil
+	})
+	if err == nil {
+		return true, nil
+	}
+
+	switch err.(type) {
+	case DeviceDisconnectedError, TransactionTimeoutError:
+		return false, err
+	}
+
+	// the transfer was aborted by [progressCb]
+	if cbErr != nil {
+		return false, err
+	}
+
+	// fallback to delete and create
+	if _, err := fileBuf.Seek(0, io.SeekStart); err != nil {
+		return false, LocalFileError{error: err}
+	}
+
+	return false, nil
+}
+
+// helper function to truncate the object [objectId] which is open for editing and write [fileBuf] to it in chunks of [editObjectChunkSize]
+func writeEditedObject(dev *mtp.Device, objectId uint32, fileBuf *os.File, size int64, progressCb SizeProgressCb) error {
+	if err := withCallTimeout(dev, nil, func() error {
+		return dev.AndroidTruncate(objectId, 0)
+	}); err != nil {
+		return err
+	}
+
+	var sent int64
+	for sent < size {
+		chunk := size - sent
+		if chunk > editObjectChunkSize {
+			chunk = editObjectChunkSize
+		}
+
+		g := &callGuard{}
+		if err := withCallTimeout(dev, g, func() error {
+			return dev.AndroidSendPartialObject(objectId, sent, uint32(chunk), g.reader(io.LimitReader(fileBuf, chunk)))
+		}); err != nil {
+			return err
+		}
+
+		sent += chunk
+
+		if err := progressCb(size, sent, objectId, nil); err != nil {
+			return permanentError{err}
+		}
+	}
+
+	// the empty files are reported once
+	if size == 0 {
+		if err := progressCb(size, sent, objectId, nil); err != nil {
+			return permanentError{err}
+		}
+	}
+
+	return nil
+}
+
+// stamp the object [objectId] with the [modTime] using the OPC_DateModified property
+// the date is written in the local time without a timezone like the ModificationDate of the ObjectInfo, see [localDeviceTime]
+// the devices don't always honor the ModificationDate of the ObjectInfo, so the property is written after the transfer
+// nothing is done if the device doesn't allow writing the property of the objects of the [format] (mtp.OFC_*)
+func setObjectModTime(dev *mtp.Device, objectId uint32, format uint16, modTime time.Time) error {
+	writable, err := isObjectPropWritable(dev, format, mtp.OPC_DateModified)
+	if err != nil {
+		return err
+	}
+
+	if !writable {
+		return nil
+	}
+
+	if err := withCallTimeout(dev, nil, func() error {
+		return dev.SetObjectPropValue(objectId, mtp.OPC_DateModified, &mtp.StringValue{Value: modTime.In(time.Local).Format(dateModifiedFormat)})
+	}); err != nil {
+		return fileObjectError(err)
+	}
+
+	return nil
+}
+
+// helper function to create a local file
+// if [pool] is not nil then the bytes are handed over to the [pool] and written to the disk in the background
+// the file is created with the permissions [mode]; see [createLocalFile]
+// the modification time of the file is set to [modTime] once all of its bytes were written; a zero [modTime] leaves the current time
+func handleMakeLocalFile(dev *mtp.Device, fi *FileInfo, destination string, mode os.FileMode, modTime time.Time, pool *localFileWriterPool, progressCb SizeProgressCb) error {
+	var w io.Writer
+	var f *os.File
+
+	if pool == nil {
+		_f, err := createLocalFile(destination, mode)
+		if err != nil {
+			return err
+		}
+		defer _f.Close()
+
+		f = _f
+		w = f
+	} else {
+		job := pool.submit(fi.FullPath, destination, mode, modTime)
+
+		cw := &chunkWriter{chunks: job.chunks, buffers: pool.buffers}
+		defer func() {
+			cw.flush()
+			close(job.chunks)
+		}()
+
+		w = cw
+	}
+
+	cw := &countingWriter{w: w}
+
+	var totalSent int64 = 0
+	err := withRetry(dev, func() error {
+		if cw.count > 0 {
+			// the bytes handed over to the [pool] can't be taken back
+			if f == nil {
+				return permanentError{FileTransferError{error: fmt.Errorf("unable to retry the partially transferred file: %s", fi.FullPath)}}
+			}
+
+			if err := f.Truncate(0); err != nil {
+				return permanentError{err}
+			}
+
+			if _, err := f.Seek(0, io.SeekStart); err != nil {
+				return permanentError{err}
+			}
+
+			cw.count = 0
+		}
+
+		// [cw] isn't touched by a timed out transaction once [withCallTimeout] returned
+		var cbErr error
+		g := &callGuard{}
+		err := withCallTimeout(dev, g, func() error {
+			return dev.GetObject(fi.ObjectId, g.writer(cw), g.progress(func(sent int64) error {
+				if err := progressCb(fi.Size, sent, fi.ObjectId, nil); err != nil {
+					cbErr = err
+
+					return err
+				}
+
+				totalSent = sent
+				return nil
+			}))
+		})
+		if _, ok := err.(TransactionTimeoutError); ok {
+			return permanentError{err}
+		}
+		if cbErr != nil {
+			return permanentError{cbErr}
+		}
+
+		return err
+	})
+	if err != nil {
+		if isDeviceDisconnected(err) {
+			return DeviceDisconnectedError{error: err}
+		}
+
+		return err
+	}
+
+	// fix the incorrect sent size
+	if totalSent < fi.Size {
+		if err := progressCb(fi.Size, fi.Size, fi.ObjectId, nil); err != nil {
+			return err
+		}
+	}
+
+	// the files of the [pool] are stamped by [writeLocalFileChunks] after their last write
+	if f != nil && !modTime.IsZero() {
+		if err := os.Chtimes(destination, modTime, modTime); err != nil {
+			return LocalFileError{error: err}
+		}
+	}
+
+	return nil
+}
+
+// writes the chunks received from the device into a local file in the background
+type localFileWriterJob struct {
+	// fullPath of the object on the device
+	fullPath    string
+	destination string
+	mode        os.FileMode
+	modTime     time.Time
+	chunks      chan localFileChunk
+}
+
+// the first [n] bytes of a buffer of the [bufferPool] of the [localFileWriterPool]
+type localFileChunk struct {
+	buf *[]byte
+	n   int
+}
+
+// a pool of local file writers
+// the MTP transfers are serialized by the caller while the disk writes of up to [concurrency] files overlap with them
+type localFileWriterPool struct {
+	jobs chan *localFileWriterJob
+	wg   sync.WaitGroup
+
+	// the buffers of the chunks; they are handed back once the chunks are written to the disk
+	buffers *bufferPool
+
+	// the number of chunks queued per file, so that at most [localFileWriterBufferSize] bytes are buffered
+	chunksDepth int
+
+	mu       sync.Mutex
+	err      error
+	failures []FileFailure
+}
+
+// [bufferSize] is the size of the chunks; see [newBufferPool]
+func newLocalFileWriterPool(concurrency, bufferSize int) *localFileWriterPool {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	buffers := newBufferPool(bufferSize)
+
+	chunksDepth := localFileWriterBufferSize / buffers.size
+	if chunksDepth < 1 {
+		chunksDepth = 1
+	}
+
+	p := &localFileWriterPool{
+		jobs:        make(chan *localFileWriterJob),
+		buffers:     buffers,
+		chunksDepth: chunksDepth,
+	}
+
+	for i := 0; i < concurrency; i++ {
+		p.wg.Add(1)
+
+		go func() {
+			defer p.wg.Done()
+
+			for job := range p.jobs {
+				if err := writeLocalFileChunks(job, p.buffers); err != nil {
+					p.setErr(job, err)
+				}
+			}
+		}()
+	}
+
+	return p
+}
+
+// hand over a new file to the pool; blocks until a writer is available
+// the caller must close [chunks] of the returned job once all the bytes were sent
+func (p *localFileWriterPool) submit(fullPath, destination string, mode os.FileMode, modTime time.Time) *localFileWriterJob {
+	job := &localFileWriterJob{
+		fullPath:    fullPath,
+		destination: destination,
+		mode:        mode,
+		modTime:     modTime,
+		chunks:      make(chan localFileChunk, p.chunksDepth),
+	}
+
+	p.jobs <- job
+
+	return job
+}
+
+func (p *localFileWriterPool) setErr(job *localFileWriterJob, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.err == nil {
+		p.err = err
+	}
+
+	p.failures = append(p.failures, FileFailure{FullPath: job.fullPath, Err: err})
+}
+
+// the first error returned by any of the writers
+func (p *localFileWriterPool) firstErr() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.err
+}
+
+// the files whose writes have failed
+func (p *localFileWriterPool) writeFailures() []FileFailure {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.failures
+}
+
+// wait for all the pending writes to finish
+func (p *localFileWriterPool) wait() error {
+	close(p.jobs)
+	p.wg.Wait()
+
+	return p.firstErr()
+}
+
+// write all the [chunks] of the job into the local file and hand their buffers back to [buffers]
+// the [chunks] are always drained so that the device transfer never blocks on a failed write
+func writeLocalFileChunks(job *localFileWriterJob, buffers *bufferPool) error {
+	f, err := createLocalFile(job.destination, job.mode)
+	if err != nil {
+		for chunk := range job.chunks {
+			buffers.put(chunk.buf)
+		}
+
+		return err
+	}
+	defer f.Close()
+
+	for chunk := range job.chunks {
+		if err == nil {
+			_, err = f.Write((*chunk.buf)[:chunk.n])
+		}
+
+		buffers.put(chunk.buf)
+	}
+
+	if err == nil && !job.modTime.IsZero() {
+		if err := os.Chtimes(job.destination, job.modTime, job.modTime); err != nil {
+			return LocalFileError{error: err}
+		}
+	}
+
+	return err
+}
+
+// an [io.Writer] which tees the written bytes to all of [writers], same as [io.MultiWriter]
+// once a writer fails the remaining bytes are discarded instead of failing the write, so that the transaction still
+// reads the whole object and the session of the device stays in sync; the failure is kept in [err]
+type fanOutWriter struct {
+	writers []io.Writer
+	err     error
+}
+
+func (f *fanOutWriter) Write(p []byte) (int, error) {
+	if f.err != nil {
+		return len(p), nil
+	}
+
+	for i, w := range f.writers {
+		n, err := w.Write(p)
+		if err == nil && n < len(p) {
+			err = io.ErrShortWrite
+		}
+
+		if err != nil {
+			f.err = WriterError{error: fmt.Errorf("writer %d failed: %w", i, err), Index: i}
+
+			break
+		}
+	}
+
+	return len(p), nil
+}
+
+// an [io.Writer] which forwards a copy of the written bytes to [chunks]
+// the bytes are collected in the buffers of [buffers] and each buffer is forwarded once it is full, so that the small writes
+// received from the device are written to the disk in the larger chunks; call [flush] to forward the last partial buffer
+type chunkWriter struct {
+	chunks  chan<- localFileChunk
+	buffers *bufferPool
+
+	// the buffer which is being filled and its length
+	buf *[]byte
+	n   int
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	for written := 0; written < len(p); {
+		if w.buf == nil {
+			w.buf = w.buffers.get()
+		}
+
+		m := copy((*w.buf)[w.n:], p[written:])
+		w.n += m
+		written += m
+
+		if w.n == len(*w.buf) {
+			w.flush()
+		}
+	}
+
+	return len(p), nil
+}
+
+// forward the buffered bytes to [chunks]
+func (w *chunkWriter) flush() {
+	if w.buf == nil {
+		return
+	}
+
+	w.chunks <- localFileChunk{buf: w.buf, n: w.n}
+
+	w.buf = nil
+	w.n = 0
+}
+
+// an [io.Writer] which counts the bytes written to [w]
+type countingWriter struct {
+	w     io.Writer
+	count int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.count += int64(n)
+
+	return n, err
+}
+
+// check if the device advertises support for the MTP operation [opCode]
+func isOperationSupported(dev *mtp.Device, opCode uint16) (bool, error) {
+	c, err := GetDeviceCapabilities(dev)
+	if err != nil {
+		return false, err
+	}
+
+	return c.SupportsOperation(opCode), nil
+}
+
+// helper function to move an object to a new parent using the MTP MoveObject operation
+func handleMoveObject(dev *mtp.Device, storageId, objectId, parentId uint32) error {
+	var req, rep mtp.Container
+	req.Code = mtp.OC_MoveObject
+	req.Param = []uint32{objectId, storageId, parentId}
+
+	if err := withCallTimeout(dev, nil, func() error {
+		return dev.RunTransaction(&req, &rep, nil, nil, 0, mtp.EmptyProgressFunc)
+	}); err != nil {
+		return fileObjectError(err)
+	}
+
+	return nil
+}
+
+// helper function to copy an object to a new parent using the MTP CopyObject operation
+// returns the objectId of the newly created object
+func handleCopyObject(dev *mtp.Device, storageId, objectId, parentId uint32) (uint32, error) {
+	var req, rep mtp.Container
+	req.Code = mtp.OC_CopyObject
+	req.Param = []uint32{objectId, storageId, parentId}
+
+	if err := withCallTimeout(dev, nil, func() error {
+		return dev.RunTransaction(&req, &rep, nil, nil, 0, mtp.EmptyProgressFunc)
+	}); err != nil {
+		return 0, fileObjectError(err)
+	}
+
+	invalidateCaches(dev, storageId, parentId)
+
+	if len(rep.Param) < 1 {
+		return 0, FileObjectError{error: fmt.Errorf("CopyObject: got %v, need 1 response parameter", rep.Param)}
+	}
+
+	return rep.Param[0], nil
+}
+
+// the operation code to fetch a partial object of size [objectSize] on the device
+// the 64-bit Android extension is preferred; the standard GetPartialObject supports only 32-bit offsets
+// returns 0 if the device can't fetch partial objects of [objectSize]
+func partialObjectOpCode(dev *mtp.Device, objectSize int64) (uint16, error) {
+	supported, err := isOperationSupported(dev, mtp.OC_ANDROID_GET_PARTIAL_OBJECT64)
+	if err != nil {
+		return 0, err
+	}
+
+	if supported {
+		return mtp.OC_ANDROID_GET_PARTIAL_OBJECT64, nil
+	}
+
+	if objectSize > math.MaxUint32 {
+		return 0, nil
+	}
+
+	supported, err = isOperationSupported(dev, mtp.OC_GetPartialObject)
+	if err != nil {
+		return 0, err
+	}
+
+	if supported {
+		return mtp.OC_GetPartialObject, nil
+	}
+
+	return 0, nil
+}
+
+// helper function to read up to [n] leading bytes of the file [fi]
+// GetPartialObject is preferred; GetObject transfers the whole object since it can't be stopped early without
+// leaving the session out of sync, so the bytes after the first [n] are discarded
+func readObjectHead(dev *mtp.Device, fi *FileInfo, n int64) ([]byte, error) {
+	if fi.Size < n {
+		n = fi.Size
+	}
+
+	head := &headWriter{limit: int(n)}
+	if n == 0 {
+		return head.buf, nil
+	}
+
+	opCode, err := partialObjectOpCode(dev, fi.Size)
+	if err != nil {
+		return nil, err
+	}
+
+	if opCode != 0 {
+		if err := handleGetPartialObject(dev, opCode, fi.ObjectId, head, 0, uint32(n)); err != nil {
+			return nil, err
+		}
+
+		return head.buf, nil
+	}
+
+	supported, err := isOperationSupported(dev, mtp.OC_GetObject)
+	if err != nil {
+		return nil, err
+	}
+
+	if !supported {
+		return nil, UnsupportedOperationError{
+			error: fmt.Errorf("unable to read the object: %d. the device supports neither GetPartialObject nor GetObject", fi.ObjectId),
+		}
+	}
+
+	g := &callGuard{}
+	if err := withCallTimeout(dev, g, func() error {
+		return dev.GetObject(fi.ObjectId, g.writer(head), mtp.EmptyProgressFunc)
+	}); err != nil {
+		return nil, FileTransferError{error: err}
+	}
+
+	return head.buf, nil
+}
+
+// keeps the first [limit] bytes written to it and discards the rest
+type headWriter struct {
+	buf   []byte
+	limit int
+}
+
+func (w *headWriter) Write(p []byte) (int, error) {
+	if remaining := w.limit - len(w.buf); remaining > 0 {
+		if len(p) < remaining {
+			remaining = len(p)
+		}
+
+		w.buf = append(w.buf, p[:remaining]...)
+	}
+
+	return len(p), nil
+}
+
+// helper function to fetch [size] bytes of the object starting at [offset] into [w]
+// [opCode] is the value returned by [partialObjectOpCode]
+func handleGetPartialObject(dev *mtp.Device, opCode uint16, objectId uint32, w io.Writer, offset int64, size uint32) error {
+	if opCode == mtp.OC_ANDROID_GET_PARTIAL_OBJECT64 {
+		g := &callGuard{}
+		if err := withCallTimeout(dev, g, func() error {
+			return dev.AndroidGetPartialObject64(objectId, g.writer(w), offset, size)
+		}); err != nil {
+			return FileTransferError{error: err}
+		}
+
+		return nil
+	}
+
+	var req, rep mtp.Container
+	req.Code = opCode
+	req.Param = []uint32{objectId, uint32(offset), size}
+
+	g := &callGuard{}
+	if err := withCallTimeout(dev, g, func() error {
+		return dev.RunTransaction(&req, &rep, g.writer(w), nil, 0, mtp.EmptyProgressFunc)
+	}); err != nil {
+		return FileTransferError{error: err}
+	}
+
+	return nil
+}
+
+// sort the [files] of a directory listing with the directories first and then by their filename
+// the filenames are compared case insensitively and the ties are broken by the exact filename
+func sortDirEntries(files []*FileInfo) {
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].IsDir != files[j].IsDir {
+			return files[i].IsDir
+		}
+
+		a, b := strings.ToLower(files[i].Name), strings.ToLower(files[j].Name)
+		if a != b {
+			return a < b
+		}
+
+		return files[i].Name < files[j].Name
+	})
+}
+
+// list the immediate children of the directory [parentId] for [ReadDir]
+// if the device supports GetObjectPropList then the children are fetched in a single transaction
+// instead of a GetObjectInfo round trip for each child
+// files matching the [disallowedFiles] list are ignored
+func listDir(dev *mtp.Device, storageId, parentId uint32, parentPath string) ([]*FileInfo, error) {
+	supported, err := isOperationSupported(dev, mtp.OC_MTP_GetObjPropList)
+	if err != nil {
+		return nil, err
+	}
+
+	if supported {
+		return listDirUsingPropList(dev, storageId, parentId, parentPath)
+	}
+
+	var children []*FileInfo
+	if _, _, _, err = proccessWalk(context.Background(), dev, storageId, FileProp{parentId, parentPath}, walkProps{skipDisallowedFiles: true, skipErrors: true},
+		func(objectId uint32, fi *FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			children = append(children, fi)
+
+			return nil
+		},
+	); err != nil {
+		return nil, err
+	}
+
+	return children, nil
+}
+
+// helper function to list the immediate children of the directory [parentId] using a single GetObjectPropList transaction
+// files matching the [disallowedFiles] list are ignored
+func listDirUsingPropList(dev *mtp.Device, storageId, parentId uint32, parentPath string) ([]*FileInfo, error) {
+	var children []*FileInfo
+	if err := withRetry(dev, func() (err error) {
+		children, err = getObjectPropList(dev, storageId, parentId, parentPath)
+
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	// filter in place
+	n := 0
+	for _, fi := range children {
+		if isDisallowedFiles(nil, fi.Name) {
+			continue
+		}
+
+		children[n] = fi
+		n += 1
+	}
+
+	return children[:n], nil
+}
+
+// list the sort keys of the children of the directory [parentId] for [ReadDirPage]
+// if the device supports GetObjectPropList then the children are fully resolved in a single transaction;
+// otherwise only the filename and the property of [sortBy] are fetched for each child
+// files matching the [disallowedFiles] list are ignored
+func listDirPageEntries(dev *mtp.Device, storageId, parentId uint32, parentPath string, sortBy SortField) ([]dirPageEntry, error) {
+	supported, err := isOperationSupported(dev, mtp.OC_MTP_GetObjPropList)
+	if err != nil {
+		return nil, err
+	}
+
+	if supported {
+		children, err := listDirUsingPropList(dev, storageId, parentId, parentPath)
+		if err != nil {
+			return nil, err
+		}
+
+		entries := make([]dirPageEntry, 0, len(children))
+		for _, fi := range children {
+			entries = append(entries, dirPageEntry{objectId: fi.ObjectId, name: fi.Name, size: fi.Size, modTime: fi.ModTime, fi: fi})
+		}
+
+		return entries, nil
+	}
+
+	handles := mtp.Uint32Array{}
+	if err := withRetry(dev, func() error {
+		return withCallTimeout(dev, nil, func() error {
+			return dev.GetObjectHandles(storageId, mtp.GOH_ALL_ASSOCS, parentId, &handles)
+		})
+	}); err != nil {
+		return nil, ListDirectoryError{error: err}
+	}
+
+	entries := make([]dirPageEntry, 0, len(handles.Values))
+	for _, objectId := range handles.Values {
+		e := dirPageEntry{objectId: objectId}
+
+		var name mtp.StringValue
+		if err := withRetry(dev, func() error {
+			return withCallTimeout(dev, nil, func() error {
+				return dev.GetObjectPropValue(objectId, mtp.OPC_ObjectFileName, &name)
+			})
+		}); err != nil {
+			return nil, fileObjectError(err)
+		}
+
+		e.name = name.Value
+		if isDisallowedFiles(nil, e.name) {
+			continue
+		}
+
+		switch sortBy {
+		case SortBySizeAsc, SortBySizeDesc:
+			var size mtp.Uint64Value
+			if err := withRetry(dev, func() error {
+				return withCallTimeout(dev, nil, func() error {
+					return dev.GetObjectPropValue(objectId, mtp.OPC_ObjectSize, &size)
+				})
+			}); err != nil {
+				return nil, fileObjectError(err)
+			}
+
+			e.size = int64(size.Value)
+
+		case SortByModTimeAsc, SortByModTimeDesc:
+			var modTime mtp.StringValue
+			if err := withRetry(dev, func() error {
+				return withCallTimeout(dev, nil, func() error {
+					return dev.GetObjectPropValue(objectId, mtp.OPC_DateModified, &modTime)
+				})
+			}); err != nil {
+				return nil, fileObjectError(err)
+			}
+
+			e.modTime = parseMtpTime(modTime.Value)
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+// the ordering of the [dirPageEntry] for [sortBy]; the ties are broken by the filename
+// an [UnsupportedOperationError] is returned if the [sortBy] is unknown
+func dirPageEntryLess(sortBy SortField) (func(a, b *dirPageEntry) bool, error) {
+	byName := func(a, b *dirPageEntry) bool {
+		return a.name < b.name
+	}
+
+	switch sortBy {
+	case SortByNameAsc:
+		return byName, nil
+
+	case SortByNameDesc:
+		return func(a, b *dirPageEntry) bool {
+			return byName(b, a)
+		}, nil
+
+	case SortBySizeAsc, SortBySizeDesc:
+		desc := sortBy == SortBySizeDesc
+
+		return func(a, b *dirPageEntry) bool {
+			if a.size != b.size {
+				return (a.size < b.size) != desc
+			}
+
+			return byName(a, b)
+		}, nil
+
+	case SortByModTimeAsc, SortByModTimeDesc:
+		desc := sortBy == SortByModTimeDesc
+
+		return func(a, b *dirPageEntry) bool {
+			if !a.modTime.Equal(b.modTime) {
+				return a.modTime.Before(b.modTime) != desc
+			}
+
+			return byName(a, b)
+		}, nil
+
+	default:
+		return nil, UnsupportedOperationError{error: fmt.Errorf("unsupported sort field: %s", sortBy)}
+	}
+}
+
+// helper function to fetch the thumbnail of an object using the MTP GetThumb operation
+func handleGetThumb(dev *mtp.Device, objectId uint32) ([]byte, error) {
+	var req, rep mtp.Container
+	req.Code = mtp.OC_GetThumb
+	req.Param = []uint32{objectId}
+
+	var buf bytes.Buffer
+	if err := withCallTimeout(dev, nil, func() error {
+		return dev.RunTransaction(&req, &rep, &buf, nil, 0, mtp.EmptyProgressFunc)
+	}); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// helper function to fetch the raw value of the object property [propCode] using the MTP GetObjectPropValue operation
+// the library decodes the values only into the fixed types, so the bytes are returned as is
+func handleGetObjectPropValue(dev *mtp.Device, objectId uint32, propCode uint16) ([]byte, error) {
+	var req, rep mtp.Container
+	req.Code = mtp.OC_MTP_GetObjectPropValue
+	req.Param = []uint32{objectId, uint32(propCode)}
+
+	var buf bytes.Buffer
+	if err := withCallTimeout(dev, nil, func() error {
+		return dev.RunTransaction(&req, &rep, &buf, nil, 0, mtp.EmptyProgressFunc)
+	}); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// helper function to set the raw value of the object property [propCode] using the MTP SetObjectPropValue operation
+func handleSetObjectPropValue(dev *mtp.Device, objectId uint32, propCode uint16, data []byte) error {
+	var req, rep mtp.Container
+	req.Code = mtp.OC_MTP_SetObjectPropValue
+	req.Param = []uint32{objectId, uint32(propCode)}
+
+	return withCallTimeout(dev, nil, func() error {
+		return dev.RunTransaction(&req, &rep, nil, bytes.NewReader(data), int64(len(data)), mtp.EmptyProgressFunc)
+	})
+}
+
+// helper function to fetch the objectIds referenced by [objectId] using GetObjectReferences
+func handleGetObjectReferences(dev *mtp.Device, objectId uint32, refs *mtp.Uint32Array) error {
+	var req mtp.Container
+	req.Code = mtp.OC_MTP_GetObjectReferences
+	req.Param = []uint32{objectId}
+
+	return dev.GetData(&req, refs)
+}
+
+// helper function to replace the references of [objectId] using SetObjectReferences
+func handleSetObjectReferences(dev *mtp.Device, objectId uint32, refs []uint32) error {
+	var req, rep mtp.Container
+	req.Code = mtp.OC_MTP_SetObjectReferences
+	req.Param = []uint32{objectId}
+
+	return dev.SendData(&req, &rep, &mtp.Uint32Array{Values: refs})
+}
+
+// helper function to fetch the thumbnail of an object from its OPC_RepresentativeSampleData property
+// the value is an array of bytes prefixed with its uint32 length
+func handleGetRepresentativeSampleData(dev *mtp.Device, objectId uint32) ([]byte, error) {
+	data, err := handleGetObjectPropValue(dev, objectId, mtp.OPC_RepresentativeSampleData)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < 4 {
+		return nil, nil
+	}
+
+	size := binary.LittleEndian.Uint32(data)
+	if int64(size) > int64(len(data)-4) {
+		return nil, fmt.Errorf("RepresentativeSampleData: got %d bytes, need %d", len(data)-4, size)
+	}
+
+	return data[4 : 4+size], nil
+}
+
+// helper function to fetch the datatype (mtp.DTC_*) of the object property [propCode] for the objects of the [format]
+// and whether the property is writable
+// only the fixed head of the ObjectPropDesc dataset is decoded
+func handleGetObjectPropDesc(dev *mtp.Device, propCode, format uint16) (dataType uint16, writable bool, err error) {
+	var req, rep mtp.Container
+	req.Code = mtp.OC_MTP_GetObjectPropDesc
+	req.Param = []uint32{uint32(propCode), uint32(format)}
+
+	var buf bytes.Buffer
+	if err := withCallTimeout(dev, nil, func() error {
+		return dev.RunTransaction(&req, &rep, &buf, nil, 0, mtp.EmptyProgressFunc)
+	}); err != nil {
+		if isObjectPropUnsupported(err) {
+			return 0, false, UnsupportedOperationError{error: fmt.Errorf("object property 0x%04x is not supported for the object format 0x%04x: %v", propCode, format, err)}
+		}
+
+		return 0, false, fileObjectError(err)
+	}
+
+	// ObjectPropertyCode (uint16), DataType (uint16) and GetSet (uint8)
+	data := buf.Bytes()
+	if len(data) < 5 {
+		return 0, false, FileObjectError{error: fmt.Errorf("ObjectPropDesc: got %d bytes, need 5", len(data))}
+	}
+
+	return binary.LittleEndian.Uint16(data[2:]), data[4] == mtp.DPGS_GetSet, nil
+}
+
+// check if [err] is the response of a device which doesn't support the object property or the object format
+func isObjectPropUnsupported(err error) bool {
+	switch err {
+	case mtp.RCError(mtp.RC_OperationNotSupported), mtp.RCError(mtp.RC_MTP_ObjectProp_Not_Supported),
+		mtp.RCError(mtp.RC_MTP_Invalid_ObjectPropCode), mtp.RCError(mtp.RC_InvalidObjectFormatCode):
+		return true
+	}
+
+	return false
+}
+
+// check if [err] reports that the device has no thumbnail for the object
+func isThumbnailUnavailable(err error) bool {
+	switch err {
+	case mtp.RCError(mtp.RC_NoThumbnailPresent), mtp.RCError(mtp.RC_OperationNotSupported),
+		mtp.RCError(mtp.RC_InvalidObjectFormatCode), mtp.RCError(mtp.RC_MTP_ObjectProp_Not_Supported),
+		mtp.RCError(mtp.RC_MTP_Invalid_ObjectPropCode):
+		return true
+	}
+
+	return false
+}
+
+// helper function to copy a file to a new parent by streaming it through the host
+// the object is downloaded into a temporary local file and then uploaded to [parentId]
+func handleCopyFileFallback(dev *mtp.Device, storageId uint32, fi *FileInfo, parentId uint32, overwriteExisting bool) (objectId uint32, err error) {
+	tmpFile, err := ioutil.TempFile("", "mtpx-")
+	if err != nil {
+		return 0, LocalFileError{error: err}
+	}
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+
+	g := &callGuard{}
+	if err := withCallTimeout(dev, g, func() error {
+		return dev.GetObject(fi.ObjectId, g.writer(tmpFile), mtp.EmptyProgressFunc)
+	}); err != nil {
+		return 0, fileObjectError(err)
+	}
+
+	if _, err := tmpFile.Seek(0, io.SeekStart); err != nil {
+		return 0, LocalFileError{error: err}
+	}
+
+	tmpInfo, err := tmpFile.Stat()
+	if err != nil {
+		return 0, LocalFileError{error: err}
+	}
+
+	obj := mtp.ObjectInfo{
+		StorageID:        storageId,
+		ObjectFormat:     fi.Info.ObjectFormat,
+		ParentObject:     parentId,
+		Filename:         fi.Name,
+		CompressedSize:   fi.Info.CompressedSize,
+		ModificationDate: fi.ModTime,
+	}
+
+	return handleMakeFile(dev, storageId, &obj, &tmpInfo, tmpFile, overwriteConflictPolicy(overwriteExisting), false, false, false, false, transferBuffers,
+		func(total, sent int64, objectId uint32, err error) error {
+			return err
+		})
+}
+
+// helper function to copy an object to a new parent when the device does not support CopyObject
+// directories are recreated under [parentId] and their children are copied one at a time
+func handleCopyObjectFallback(dev *mtp.Device, storageId uint32, fi *FileInfo, parentId uint32, overwriteExisting bool) (objectId uint32, err error) {
+	if !fi.IsDir {
+		return handleCopyFileFallback(dev, storageId, fi, parentId, overwriteExisting)
+	}
+
+	dirId, err := handleMakeDirectory(dev, storageId, parentId, fi.Name)
+	if err != nil {
+		return 0, err
+	}
+
+	handles := mtp.Uint32Array{}
+	if err := withCallTimeout(dev, nil, func() error {
+		return dev.GetObjectHandles(storageId, mtp.GOH_ALL_ASSOCS, fi.ObjectId, &handles)
+	}); err != nil {
+		return 0, ListDirectoryError{error: err}
+	}
+
+	for _, objId := range handles.Values {
+		childFi, err := GetObjectFromObjectId(dev, objId, fi.FullPath)
+		if err != nil {
+			return 0, err
+		}
+
+		if _, err := handleCopyObjectFallback(dev, storageId, childFi, dirId, overwriteExisting); err != nil {
+			return 0, err
+		}
+	}
+
+	return dirId, nil
+}
+
+// make sure that the directory [destParentId] is neither the object [objectId] nor one of its descendants
+// the parents of [destParentId] are followed up to the root directory; an [InvalidPathError] is returned otherwise
+func checkDestinationOutsideSource(dev *mtp.Device, objectId, destParentId uint32) error {
+	cache := NewPathCache()
+	visited := map[uint32]bool{}
+
+	for id := fixParentId(destParentId); id != ParentObjectId; {
+		if id == objectId {
+			return InvalidPathError{error: fmt.Errorf("invalid destination: %d. the destination is inside the object %d", destParentId, objectId)}
+		}
+
+		// guard against the devices reporting a cyclic hierarchy
+		if visited[id] {
+			return InvalidPathError{error: fmt.Errorf("cyclic parent objects found for the object: %d", destParentId)}
+		}
+		visited[id] = true
+
+		p, err := cache.parent(dev, id)
+		if err != nil {
+			return err
+		}
+
+		id = p.parentId
+	}
+
+	return nil
+}
+
+// helper function to move [fi] into the directory [parentId]
+// the MTP MoveObject operation is used when the device supports it, otherwise [handleMoveObjectFallback]
+// returns the objectId of the moved object; it is a new objectId if the fallback was used
+func handleMoveFile(dev *mtp.Device, storageId uint32, fi *FileInfo, parentId uint32) (uint32, error) {
+	supported, err := isOperationSupported(dev, mtp.OC_MoveObject)
+	if err != nil {
+		return 0, err
+	}
+
+	// the fallback may have copied the object even if it fails
+	defer invalidateCaches(dev, storageId, fi.ParentId, parentId)
+
+	if supported {
+		if err := handleMoveObject(dev, storageId, fi.ObjectId, parentId); err != nil {
+			return 0, err
+		}
+
+		return fi.ObjectId, nil
+	}
+
+	objId, err := handleMoveObjectFallback(dev, storageId, fi, parentId)
+	if err != nil {
+		return 0, UnsupportedOperationError{
+			error: fmt.Errorf("MoveObject is not supported by the device and the fallback move failed: %w", err),
+		}
+	}
+
+	return objId, nil
+}
+
+// helper function of [MoveFiles] to move the object [objectId] into the directory [destFi]
+// the name conflicts inside [destFi] are resolved using [conflictPolicy]; [skip] is true if the object was left in place
+func moveObjectInto(dev *mtp.Device, storageId, objectId uint32, destFi *FileInfo, conflictPolicy ConflictPolicy) (moved MovedObject, skip bool, err error) {
+	fi, err := GetObjectFromObjectIdOrPath(dev, storageId, FileProp{ObjectId: objectId})
+	if err != nil {
+		return moved, false, err
+	}
+
+	if fi.ObjectId == ParentObjectId {
+		return moved, false, InvalidPathError{error: fmt.Errorf("invalid objectId: %d. the root directory cannot be moved", objectId)}
+	}
+
+	// the object is already inside [destFi]
+	if fixParentId(fi.ParentId) == destFi.ObjectId {
+		return MovedObject{ObjectId: objectId, NewObjectId: fi.ObjectId, FullPath: getFullPath(destFi.FullPath, fi.Name)}, false, nil
+	}
+
+	if err := checkDestinationOutsideSource(dev, fi.ObjectId, destFi.ObjectId); err != nil {
+		return moved, false, err
+	}
+
+	return moveFileInto(dev, storageId, fi, destFi, fi.Name, conflictPolicy)
+}
+
+// helper function to move [fi] into the directory [destFi] under the name [filename]
+// a conflict with an existing object named [filename] is resolved using [conflictPolicy]; see [moveObjectInto]
+// an overwritten file is renamed aside and deleted only once [fi] took its place, and [fi] travels under a name which is free
+// in both the directories, so that neither directory holds two objects with the same name at any point
+func moveFileInto(dev *mtp.Device, storageId uint32, fi *FileInfo, destFi *FileInfo, filename string, conflictPolicy ConflictPolicy) (moved MovedObject, skip bool, err error) {
+	name, existingObjectId, skip, err := resolveFileConflict(dev, storageId, destFi.ObjectId, filename, fi.Size, fi.ModTime, conflictPolicy)
+	if err != nil {
+		return moved, false, err
+	}
+
+	if skip {
+		return moved, true, nil
+	}
+
+	defer invalidateCaches(dev, storageId, fi.ParentId, destFi.ObjectId)
+
+	// the renames which are undone if the move fails
+	var undo []func() error
+	rollback := func(err error) error {
+		for i := len(undo) - 1; i >= 0; i-- {
+			if undoErr := undo[i](); undoErr != nil {
+				return fmt.Errorf("%w (the renames couldn't be undone: %v)", err, undoErr)
+			}
+		}
+
+		return err
+	}
+
+	// move the existing file aside
+	var asideName string
+	if existingObjectId != 0 {
+		existingFi, err := GetObjectFromObjectId(dev, existingObjectId, destFi.FullPath)
+		if err != nil {
+			return moved, false, err
+		}
+
+		if fi.IsDir || existingFi.IsDir {
+			return moved, false, FileAlreadyExistsError{error: fmt.Errorf("file already exists: %s", existingFi.FullPath)}
+		}
+
+		asideName, err = freeTemporaryFilename(dev, storageId, name, atomicReplacedSuffix, destFi.ObjectId)
+		if err != nil {
+			return moved, false, err
+		}
+
+		if err := setObjectFilename(dev, existingObjectId, asideName); err != nil {
+			return moved, false, fileObjectError(err)
+		}
+
+		undo = append(undo, func() error {
+			return setObjectFilename(dev, existingObjectId, name)
+		})
+	}
+
+	// the name [fi] is moved with; it must not be taken in the source directory nor in [destFi]
+	movedFi := *fi
+	if name != fi.Name {
+		movedFi.Name = name
+
+		free, err := isFilenameFree(dev, storageId, fixParentId(fi.ParentId), name)
+		if err != nil {
+			return moved, false, rollback(err)
+		}
+
+		if !free {
+			movedFi.Name, err = freeTemporaryFilename(dev, storageId, name, atomicUploadSuffix, fixParentId(fi.ParentId), destFi.ObjectId)
+			if err != nil {
+				return moved, false, rollback(err)
+			}
+		}
+
+		if err := setObjectFilename(dev, fi.ObjectId, movedFi.Name); err != nil {
+			return moved, false, rollback(fileObjectError(err))
+		}
+
+		undo = append(undo, func() error {
+			return setObjectFilename(dev, fi.ObjectId, fi.Name)
+		})
+	}
+
+	objId, err := handleMoveFile(dev, storageId, &movedFi, destFi.ObjectId)
 	if err != nil {
-		return err
+		return moved, false, rollback(err)
 	}
-	defer f.Close()
 
-	var totalSent int64 = 0
-	err = dev.GetObject(fi.ObjectId, f, func(sent int64) error {
-		if err := progressCb(fi.Size, sent, fi.ObjectId, err); err != nil {
+	// the object travelled under a temporary name
+	if movedFi.Name != name {
+		if err := setObjectFilename(dev, objId, name); err != nil {
+			return moved, false, FileObjectError{
+				error: fmt.Errorf("the object was moved to %s but it could not be renamed to %s: %v", getFullPath(destFi.FullPath, movedFi.Name), name, err),
+			}
+		}
+	}
+
+	if existingObjectId != 0 {
+		if err := deleteFile(dev, storageId, []FileProp{{existingObjectId, ""}}); err != nil {
+			return moved, false, FileObjectError{
+				error: fmt.Errorf("the object was moved to %s but the replaced object %s couldn't be deleted: %w", getFullPath(destFi.FullPath, name), asideName, err),
+			}
+		}
+	}
+
+	return MovedObject{ObjectId: fi.ObjectId, NewObjectId: objId, FullPath: getFullPath(destFi.FullPath, name)}, false, nil
+}
+
+// check if no object in the directory [parentId] is named [filename]
+func isFilenameFree(dev *mtp.Device, storageId, parentId uint32, filename string) (bool, error) {
+	if _, err := GetObjectFromParentIdAndFilename(dev, storageId, parentId, filename); err != nil {
+		if _, ok := err.(FileNotFoundError); ok {
+			return true, nil
+		}
+
+		return false, err
+	}
+
+	return false, nil
+}
+
+// helper function to move an object to a new parent when the device does not support MoveObject
+// the object is copied to [parentId] through the host and then deleted from its source
+// directories are recreated under [parentId] and their children are moved one at a time
+func handleMoveObjectFallback(dev *mtp.Device, storageId uint32, fi *FileInfo, parentId uint32) (objectId uint32, err error) {
+	if !fi.IsDir {
+		objId, err := handleCopyFileFallback(dev, storageId, fi, parentId, false)
+		if err != nil {
+			return 0, err
+		}
+
+		if err := withCallTimeout(dev, nil, func() error {
+			return dev.DeleteObject(fi.ObjectId)
+		}); err != nil {
+			return objId, fileObjectError(err)
+		}
+
+		invalidateDeletedObject(dev, storageId, fi.ParentId, fi.ObjectId)
+
+		return objId, nil
+	}
+
+	dirId, err := handleMakeDirectory(dev, storageId, parentId, fi.Name)
+	if err != nil {
+		return 0, err
+	}
+
+	handles := mtp.Uint32Array{}
+	if err := withCallTimeout(dev, nil, func() error {
+		return dev.GetObjectHandles(storageId, mtp.GOH_ALL_ASSOCS, fi.ObjectId, &handles)
+	}); err != nil {
+		return 0, ListDirectoryError{error: err}
+	}
+
+	for _, objId := range handles.Values {
+		childFi, err := GetObjectFromObjectId(dev, objId, fi.FullPath)
+		if err != nil {
+			return 0, err
+		}
+
+		if _, err := handleMoveObjectFallback(dev, storageId, childFi, dirId); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := withCallTimeout(dev, nil, func() error {
+		return dev.DeleteObject(fi.ObjectId)
+	}); err != nil {
+		return 0, fileObjectError(err)
+	}
+
+	invalidateDeletedObject(dev, storageId, fi.ParentId, fi.ObjectId)
+
+	return dirId, nil
+}
+
+// helper function to count the files and the directories inside the directory [parentId] for [CountObjects]
+// same as [proccessWalk] but only the object formats of the children are fetched
+func proccessCount(dev *mtp.Device, storageId, parentId uint32, recursive bool) (files, directories int, err error) {
+	formats, err := listObjectFormats(dev, storageId, parentId)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for objectId, format := range formats {
+		if format != mtp.OFC_Association {
+			files += 1
+
+			continue
+		}
+
+		directories += 1
+
+		// don't traverse down the tree if [recursive] is false
+		if !recursive {
+			continue
+		}
+
+		_files, _directories, err := proccessCount(dev, storageId, objectId, recursive)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		files += _files
+		directories += _directories
+	}
+
+	return files, directories, nil
+}
+
+// list the object formats (mtp.OFC_*) of the children of [parentId] keyed by their objectId
+// if the device supports GetObjectPropList then the formats are fetched in a single transaction;
+// otherwise the OPC_ObjectFormat property is fetched for each child
+func listObjectFormats(dev *mtp.Device, storageId, parentId uint32) (map[uint32]uint16, error) {
+	supported, err := isOperationSupported(dev, mtp.OC_MTP_GetObjPropList)
+	if err != nil {
+		return nil, err
+	}
+
+	formats := map[uint32]uint16{}
+
+	if supported {
+		var list *objectPropList
+		if err := withRetry(dev, func() (err error) {
+			list, err = handleGetObjectPropList(dev, storageId, parentId, mtp.OPC_ObjectFormat)
+
 			return err
+		}); err != nil {
+			return nil, ListDirectoryError{error: err}
 		}
 
-		totalSent = sent
-		return nil
-	})
+		for _, e := range list.elements {
+			if v, ok := e.value.(uint16); ok && e.propCode == mtp.OPC_ObjectFormat {
+				formats[e.objectId] = v
+			}
+		}
+
+		return formats, nil
+	}
+
+	handles := mtp.Uint32Array{}
+	if err := withRetry(dev, func() error {
+		return withCallTimeout(dev, nil, func() error {
+			return dev.GetObjectHandles(storageId, mtp.GOH_ALL_ASSOCS, parentId, &handles)
+		})
+	}); err != nil {
+		return nil, ListDirectoryError{error: err}
+	}
+
+	for _, objectId := range handles.Values {
+		format, err := getObjectFormat(dev, objectId)
+		if err != nil {
+			return nil, err
+		}
+
+		formats[objectId] = format
+	}
+
+	return formats, nil
+}
+
+// fetch the object format (mtp.OFC_*) of [objectId] using its OPC_ObjectFormat property
+func getObjectFormat(dev *mtp.Device, objectId uint32) (uint16, error) {
+	var data []byte
+	if err := withRetry(dev, func() (err error) {
+		data, err = handleGetObjectPropValue(dev, objectId, mtp.OPC_ObjectFormat)
+
+		return err
+	}); err != nil {
+		return 0, fileObjectError(err)
+	}
+
+	value, err := decodeObjectPropValue(bytes.NewReader(data), mtp.DTC_UINT16)
 	if err != nil {
+		return 0, fileObjectError(err)
+	}
+
+	return value.(uint16), nil
+}
+
+// list the objectIds of the children of [parentId] whose OPC_Hidden property is set
+// the property is fetched only if it can be batched using GetObjectPropList, as fetching it for every object is costly;
+// a nil map is returned if the device doesn't support GetObjectPropList or the property
+func listHiddenObjects(dev *mtp.Device, storageId, parentId uint32) (map[uint32]bool, error) {
+	supported, err := isOperationSupported(dev, mtp.OC_MTP_GetObjPropList)
+	if err != nil || !supported {
+		return nil, err
+	}
+
+	var hidden map[uint32]bool
+	err = withRetry(dev, func() (err error) {
+		hidden, err = getHiddenObjects(dev, storageId, parentId)
+
 		return err
+	})
+	if err != nil {
+		if _, ok := retryCause(err).(mtp.RCError); ok {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return hidden, nil
+}
+
+// helper function to fetch the contents inside a directory
+// [ctx] is checked before processing each object and before descending into a sub directory
+// see [walkProps] for the options of the walk
+// [objectId] and [fullPath] are optional parameters
+// if [objectId] is not available then [fullPath] will be used to fetch the [objectId]
+// dont leave both [objectId] and [fullPath] empty
+// Tips: use [objectId] whenever possible to avoid traversing down the whole file tree to process and find the [objectId]
+// return:
+// [totalFiles]: total number of files
+// [totalDirectories]: total number of directories
+// [skippedCount]: total number of the objects which couldn't be read
+func proccessWalk(ctx context.Context, dev *mtp.Device, storageId uint32, fileProp FileProp, props walkProps, cb WalkCb) (totalFiles, totalDirectories, skippedCount int64, err error) {
+	fi, err := GetObjectFromObjectIdOrPath(dev, storageId, FileProp{fileProp.ObjectId, fileProp.FullPath})
+
+	if err != nil {
+		return totalFiles, totalDirectories, skippedCount, err
+	}
+
+	// reconstruct the fullPath of the directory if only the [objectId] is available
+	// so that the [FullPath] of the children is always absolute
+	fullPath := fileProp.FullPath
+	if fullPath == "" {
+		fullPath, err = ResolveObjectPath(dev, storageId, fi.ObjectId)
+		if err != nil {
+			return totalFiles, totalDirectories, skippedCount, err
+		}
+	}
+
+	return walkDirectory(ctx, dev, storageId, fi, fullPath, props, cb)
+}
+
+// helper function of [proccessWalk] to list the directory [fi] whose absolute path is [fullPath]
+// the sub directories are walked using the [FileInfo] fetched while listing their parent, so every object is fetched once
+func walkDirectory(ctx context.Context, dev *mtp.Device, storageId uint32, fi *FileInfo, fullPath string, props walkProps, cb WalkCb) (totalFiles, totalDirectories, skippedCount int64, err error) {
+	handles := mtp.Uint32Array{}
+	if err := withCallTimeout(dev, nil, func() error {
+		return dev.GetObjectHandles(storageId, mtp.GOH_ALL_ASSOCS, fi.ObjectId, &handles)
+	}); err != nil {
+		return totalFiles, totalDirectories, skippedCount, ListDirectoryError{error: err}
+	}
+
+	totalFiles = 0
+	parentId := fi.ObjectId
+
+	var hiddenObjects map[uint32]bool
+	skipDisallowed := props.skipDisallowedFiles
+	if props.skipHiddenObjects {
+		hiddenObjects, err = listHiddenObjects(dev, storageId, parentId)
+		if err != nil {
+			return totalFiles, totalDirectories, skippedCount, ListDirectoryError{error: err}
+		}
+
+		// the property isn't available; fall back to the [disallowedFiles] list
+		if hiddenObjects == nil {
+			skipDisallowed = true
+		}
+	}
+
+	for _, objId := range handles.Values {
+		// stop the walk if the [ctx] was canceled
+		if err := ctx.Err(); err != nil {
+			return totalFiles, totalDirectories, skippedCount, WalkCanceledError{error: err}
+		}
+
+		// skip the hidden object without fetching it
+		if hiddenObjects[objId] {
+			continue
+		}
+
+		fi, err := GetObjectFromObjectId(dev, objId, fullPath)
+		if err != nil {
+			skippedCount += 1
+
+			if props.skipErrors {
+				continue
+			}
+
+			// the object couldn't be read; only its location is known
+			_fi := &FileInfo{
+				ObjectId:   objId,
+				ParentId:   parentId,
+				ParentPath: fullPath,
+				Info:       &mtp.ObjectInfo{},
+			}
+			if err := cb(objId, _fi, err); err != nil {
+				return totalFiles, totalDirectories, skippedCount, err
+			}
+
+			continue
+		}
+
+		fName := (*fi).Name
+
+		// skip the object if it's a hidden file
+		if props.skipHiddenFiles && isHiddenFile(fName) {
+			continue
+		}
+
+		// if the object file name matches [disallowedFiles] list then ignore it
+		if skipDisallowed && isDisallowedFiles(props.disallowedFiles, fName) {
+			continue
+		}
+
+		if fi.IsDir {
+			totalDirectories += 1
+		} else {
+			totalFiles += 1
+		}
+
+		err = cb(objId, fi, nil)
+		if err != nil {
+			return totalFiles, totalDirectories, skippedCount, err
+		}
+
+		// don't traverse down the tree if [recursive] is false
+		if !props.recursive {
+			continue
+		}
+
+		// don't traverse down the tree if the object is not a directory
+		if !fi.IsDir {
+			continue
+		}
+
+		// stop the walk if the [ctx] was canceled before descending into the sub directory
+		if err := ctx.Err(); err != nil {
+			return totalFiles, totalDirectories, skippedCount, WalkCanceledError{error: err}
+		}
+
+		_totalFiles, _totalDirectories, _skippedCount, err := walkDirectory(ctx, dev, storageId, fi, fi.FullPath, props, cb)
+		if err != nil {
+			return totalFiles, totalDirectories, skippedCount, err
+		}
+
+		totalFiles += _totalFiles
+		totalDirectories += _totalDirectories
+		skippedCount += _skippedCount
+	}
+
+	return totalFiles, totalDirectories, skippedCount, nil
+}
+
+// returned by the callback of [findFiles] to stop the walk once enough objects were found
+var errFindLimitReached = errors.New("the limit of the matching objects was reached")
+
+// helper function to find the objects below [startPath] whose [Name] matches [namePattern]
+// the walk stops once [limit] objects were found; 0 disables the limit
+func findFiles(dev *mtp.Device, storageId uint32, startPath, namePattern string, recursive bool, limit int) ([]*FileInfo, error) {
+	// the [namePattern] is matched against a single path segment
+	if namePattern == "" || strings.Contains(namePattern, PathSep) || !isValidGlobPattern(namePattern) {
+		return nil, InvalidPathError{error: fmt.Errorf("invalid pattern: %s", namePattern)}
+	}
+
+	fi, err := GetObjectFromObjectIdOrPath(dev, storageId, FileProp{0, startPath})
+	if err != nil {
+		return nil, err
+	}
+
+	var found []*FileInfo
+
+	// [startPath] itself is matched only if it's a file
+	if !fi.IsDir {
+		if matchGlob(namePattern, fi.Name) {
+			found = append(found, fi)
+		}
+
+		return found, nil
+	}
+
+	// "**" matches the objects at any depth below [startPath]
+	if _, _, err := WalkMatch(dev, storageId, fi.ObjectId, fi.FullPath, fmt.Sprintf("**%s%s", PathSep, namePattern), recursive,
+		func(objectId uint32, fi *FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+
+			found = append(found, fi)
+			if limit > 0 && len(found) >= limit {
+				return errFindLimitReached
+			}
+
+			return nil
+		}); err != nil && err != errFindLimitReached {
+		return nil, err
+	}
+
+	return found, nil
+}
+
+// create a local directory along with its missing parents using the permissions [mode]
+// note: [newLocalDirectoryMode] is used if [mode] is 0
+func makeLocalDirectory(filename string, mode os.FileMode) error {
+	if mode == 0 {
+		mode = newLocalDirectoryMode
 	}
 
-	// fix the incorrect sent size
-	if totalSent < fi.Size {
-		if err := progressCb(fi.Size, fi.Size, fi.ObjectId, err); err != nil {
+	err := os.MkdirAll(filename, mode)
+	if err != nil {
+		switch err.(type) {
+		case *os.PathError:
+			if errors.Is(err, os.ErrPermission) {
+				return FilePermissionError{error: err}
+			}
+
+			return LocalFileError{error: err}
+
+		default:
 			return err
 		}
 	}
 
-	return err
+	return nil
 }
 
-// helper function to fetch the contents inside a directory
-// use [recursive] to fetch the whole nested tree
-// [objectId] and [fullPath] are optional parameters
-// if [objectId] is not available then [fullPath] will be used to fetch the [objectId]
-// dont leave both [objectId] and [fullPath] empty
-// Tips: use [objectId] whenever possible to avoid traversing down the whole file tree to process and find the [objectId]
-// if [skipDisallowedFiles] is true then files matching the [disallowedFiles] list will be ignored
-// if [skipHiddenFiles] is true then hidden files (unix style) will be ignored
-// return:
-// [totalFiles]: total number of files
-// [totalDirectories]: total number of directories
-func proccessWalk(dev *mtp.Device, storageId uint32, fileProp FileProp, recursive, skipDisallowedFiles, skipHiddenFiles bool, cb WalkCb) (totalFiles, totalDirectories int64, err error) {
-	fi, err := GetObjectFromObjectIdOrPath(dev, storageId, FileProp{fileProp.ObjectId, fileProp.FullPath})
+// create or truncate the local file [filename] same as [os.Create]
+// a non zero [mode] is applied to the file even if it already existed, otherwise [newLocalFileMode] less the umask is used
+func createLocalFile(filename string, mode os.FileMode) (*os.File, error) {
+	if mode == 0 {
+		return os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_TRUNC, newLocalFileMode)
+	}
 
+	f, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_TRUNC, mode)
 	if err != nil {
-		return totalFiles, totalDirectories, err
+		return nil, err
 	}
 
-	handles := mtp.Uint32Array{}
-	if err := dev.GetObjectHandles(storageId, mtp.GOH_ALL_ASSOCS, fi.ObjectId, &handles); err != nil {
-		return totalFiles, totalDirectories, ListDirectoryError{error: err}
+	// neither the umask nor the permissions of an existing file apply
+	if err := f.Chmod(mode); err != nil {
+		_ = f.Close()
+
+		return nil, err
 	}
 
-	totalFiles = 0
+	return f, nil
+}
 
-	for _, objId := range handles.Values {
-		fi, err := GetObjectFromObjectId(dev, objId, fileProp.FullPath)
-		if err != nil {
-			continue
+// an [os.FileInfo] of a symlink target which is reported with the name of the symlink
+type symlinkFileInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (fi symlinkFileInfo) Name() string {
+	return fi.name
+}
+
+// walk the local file tree rooted at [root] using [filepath.Walk]
+// if [followSymlinks] is true then the symlinks are resolved and their targets are walked as if they were located at the symlink
+// a symlink pointing to a directory which is already being walked returns a [SymlinkCycleError]
+func walkLocalTree(root string, followSymlinks bool, fn filepath.WalkFunc) error {
+	_root := filepath.Clean(root)
+
+	return walkLocalTreeVisited(_root, _root, "", followSymlinks, nil, fn)
+}
+
+// [root] is walked and reported as [walkPath]
+// [rootName] replaces the name of [root] when it is the target of a symlink
+// [visited] is the list of the directories being walked, used to detect the symlink cycles
+func walkLocalTreeVisited(root, walkPath, rootName string, followSymlinks bool, visited []os.FileInfo, fn filepath.WalkFunc) error {
+	if followSymlinks {
+		if rootInfo, err := os.Stat(root); err == nil && rootInfo.IsDir() {
+			visited = append(visited[:len(visited):len(visited)], rootInfo)
 		}
+	}
 
-		fName := (*fi).Name
+	return filepath.Walk(root, func(p string, fInfo os.FileInfo, err error) error {
+		_path := walkPath + strings.TrimPrefix(p, root)
 
-		// skip the object if it's a hidden file
-		if skipHiddenFiles && isHiddenFile(fName) {
-			continue
+		if err != nil {
+			return fn(_path, fInfo, err)
 		}
 
-		// if the object file name matches [disallowedFiles] list then ignore it
-		if skipDisallowedFiles && isDisallowedFiles(fName) {
-			continue
+		if p == root && rootName != "" {
+			fInfo = symlinkFileInfo{FileInfo: fInfo, name: rootName}
 		}
 
-		if fi.IsDir {
-			totalDirectories += 1
-		} else {
-			totalFiles += 1
+		if !followSymlinks || !isSymlinkLocal(fInfo) {
+			return fn(_path, fInfo, nil)
 		}
 
-		err = cb(objId, fi, nil)
+		target, err := filepath.EvalSymlinks(p)
 		if err != nil {
-			return totalFiles, totalDirectories, err
+			return fn(_path, fInfo, err)
 		}
 
-		// don't traverse down the tree if [recursive] is false
-		if !recursive {
-			continue
+		targetInfo, err := os.Stat(target)
+		if err != nil {
+			return fn(_path, fInfo, err)
 		}
 
-		// don't traverse down the tree if the object is not a directory
-		if !fi.IsDir {
-			continue
+		if !targetInfo.IsDir() {
+			return fn(_path, symlinkFileInfo{FileInfo: targetInfo, name: fInfo.Name()}, nil)
 		}
 
-		_totalFiles, _totalDirectories, err := proccessWalk(
-			dev, storageId, FileProp{objId, fi.FullPath}, recursive, skipDisallowedFiles, skipHiddenFiles, cb,
-		)
-		if err != nil {
-			return totalFiles, totalDirectories, err
+		for _, v := range visited {
+			if os.SameFile(v, targetInfo) {
+				return SymlinkCycleError{error: fmt.Errorf("symlink cycle found: %s -> %s", _path, target)}
+			}
 		}
 
-		totalFiles += _totalFiles
-		totalDirectories += _totalDirectories
-	}
-
-	return totalFiles, totalDirectories, nil
+		return walkLocalTreeVisited(target, _path, fInfo.Name(), followSymlinks, visited, fn)
+	})
 }
 
-// create a local directory
-func makeLocalDirectory(filename string) error {
-	err := os.MkdirAll(filename, os.FileMode(newLocalDirectoryMode))
-	if err != nil {
-		switch err.(type) {
-		case *os.PathError:
-			if errors.Is(err, os.ErrPermission) {
-				return FilePermissionError{error: err}
-			}
+// insert [file] into [files], which is sorted by size in descending order, keeping at most [limit] files
+func insertLargestFile(files []ScannedFile, file ScannedFile, limit int) []ScannedFile {
+	i := sort.Search(len(files), func(i int) bool {
+		return files[i].Size < file.Size
+	})
 
-			return LocalFileError{error: err}
+	if i >= limit {
+		return files
+	}
 
-		default:
-			return err
-		}
+	files = append(files, ScannedFile{})
+	copy(files[i+1:], files[i:])
+	files[i] = file
+
+	if len(files) > limit {
+		files = files[:limit]
 	}
 
-	return nil
+	return files
 }
 
 // walks through the local files
-func walkLocalFiles(sources []string, cb LocalWalkCb) (totalFiles, totalDirectories, totalSize int64, err error) {
+// if [followSymlinks] is false then the symlinks are skipped
+// the files matching the [disallowedFiles] patterns are skipped; see [isDisallowedFiles]
+func walkLocalFiles(sources []string, followSymlinks bool, disallowedFiles []string, cb LocalWalkCb) (totalFiles, totalDirectories, totalSize int64, err error) {
 	totalFiles = 0
 	totalDirectories = 0
 	totalSize = 0
 
 	for _, source := range sources {
 		// walk through the source
-		err := filepath.Walk(source,
+		err := walkLocalTree(source, followSymlinks,
 			func(fullPath string, fInfo os.FileInfo, err error) error {
 				if err != nil {
 					return err
@@ -418,13 +3105,17 @@ func walkLocalFiles(sources []string, cb LocalWalkCb) (totalFiles, totalDirector
 
 				name := fInfo.Name()
 
-				// don't follow symlinks
+				// skip the symlinks which are not followed
 				if isSymlinkLocal(fInfo) {
 					return nil
 				}
 
-				// filter out disallowed files
-				if isDisallowedFiles(name) {
+				// filter out disallowed files; a disallowed directory is skipped along with its contents, same as the device walks
+				if isDisallowedFiles(disallowedFiles, name) {
+					if fInfo.IsDir() {
+						return filepath.SkipDir
+					}
+
 					return nil
 				}
 
@@ -460,16 +3151,31 @@ func walkLocalFiles(sources []string, cb LocalWalkCb) (totalFiles, totalDirector
 	return totalFiles, totalDirectories, totalSize, nil
 }
 
-func processDownloadFiles(dev *mtp.Device, pInfo *ProgressInfo, fi *FileInfo, progressCb ProgressCb, dfProps *processDownloadFilesProps) (err error) {
+// the local path of the file [filename] inside [destination] for a flattened download
+// a name which was already taken by a file of the batch in [claimed] gets a numeric suffix (see [filenameWithSuffix]);
+// the names are compared case insensitively since the local filesystem may not tell them apart
+func flattenedLocalPath(destination, filename string, claimed map[string]bool) string {
+	name := filename
+	for n := 1; claimed[strings.ToLower(name)]; n++ {
+		name = filenameWithSuffix(filename, n)
+	}
+
+	claimed[strings.ToLower(name)] = true
+
+	return filepath.Join(destination, name)
+}
+
+// if [pool] is not nil then the local files are written in the background using the [pool]
+func processDownloadFiles(dev *mtp.Device, pInfo *ProgressInfo, fi *FileInfo, progressCb ProgressCb, dfProps *processDownloadFilesProps, pool *localFileWriterPool) (err error) {
 
 	// filter out disallowed files
-	if isDisallowedFiles(fi.Name) {
+	if isDisallowedFiles(dfProps.disallowedFiles, fi.Name) {
 		return nil
 	}
 
 	// if the object is a directory then create a local directory
 	if fi.IsDir {
-		err := makeLocalDirectory(dfProps.destinationFilePath)
+		err := makeLocalDirectory(dfProps.destinationFilePath, dfProps.dirMode)
 		if err != nil {
 			return err
 		}
@@ -480,7 +3186,7 @@ func processDownloadFiles(dev *mtp.Device, pInfo *ProgressInfo, fi *FileInfo, pr
 	/// if the object is a file then create one
 	// if the local parent directory does not Exists then create one
 	if !fileExistsLocal(dfProps.destinationFileParentPath) {
-		err := makeLocalDirectory(dfProps.destinationFileParentPath)
+		err := makeLocalDirectory(dfProps.destinationFileParentPath, dfProps.dirMode)
 		if err != nil {
 			return err
 		}
@@ -492,10 +3198,15 @@ func processDownloadFiles(dev *mtp.Device, pInfo *ProgressInfo, fi *FileInfo, pr
 	pInfo.LatestSentTime = time.Now()
 	pInfo.FileInfo = fi
 
+	var modTime time.Time
+	if !dfProps.skipPreserveModTime {
+		modTime = fi.ModTime
+	}
+
 	// create the local file
 	var prevSentSize int64 = 0
-	err = handleMakeLocalFile(dev, fi, dfProps.destinationFilePath,
-		func(total, sent int64, _ uint32, err error) error {
+	err = handleMakeLocalFile(dev, fi, dfProps.destinationFilePath, dfProps.fileMode, modTime, pool,
+		throttleSizeProgress(dfProps.progressInterval, dfProps.progressMinBytes, func(total, sent int64, _ uint32, err error) error {
 			if err != nil {
 				return err
 			}
@@ -510,7 +3221,10 @@ func processDownloadFiles(dev *mtp.Device, pInfo *ProgressInfo, fi *FileInfo, pr
 			pInfo.BulkFileSize.Sent = dfProps.bulkSizeSent
 			pInfo.BulkFileSize.Progress = Percent(float32(dfProps.bulkSizeSent), float32(dfProps.totalSize))
 
+			now := time.Now()
 			pInfo.Speed = transferRate(chunkSize, pInfo.LatestSentTime)
+			pInfo.BytesPerSecond = dfProps.throughput.add(now, dfProps.bulkSizeSent)
+			pInfo.Elapsed = now.Sub(pInfo.StartTime)
 			if err = progressCb(pInfo, nil); err != nil {
 				return err
 			}
@@ -519,7 +3233,7 @@ func processDownloadFiles(dev *mtp.Device, pInfo *ProgressInfo, fi *FileInfo, pr
 			prevSentSize = sent
 
 			return nil
-		})
+		}))
 	if err != nil {
 		return err
 	}
@@ -532,6 +3246,15 @@ func processDownloadFiles(dev *mtp.Device, pInfo *ProgressInfo, fi *FileInfo, pr
 
 func processDownloadFilesError(dfProps *processDownloadFilesProps, err error) (bulkFilesSent, bulkSizeSent int64, error error) {
 	if err != nil {
+		if isDeviceDisconnected(err) {
+			return dfProps.bulkFilesSent, dfProps.bulkSizeSent, deviceDisconnectedError(err)
+		}
+
+		var pausedErr PausedTransferCanceledError
+		if errors.As(err, &pausedErr) {
+			return dfProps.bulkFilesSent, dfProps.bulkSizeSent, pausedErr
+		}
+
 		switch err.(type) {
 		case InvalidPathError:
 			return dfProps.bulkFilesSent, dfProps.bulkSizeSent, err
@@ -554,3 +3277,392 @@ func processDownloadFilesError(dfProps *processDownloadFilesProps, err error) (b
 
 	return bulkFilesSent, bulkSizeSent, err
 }
+
+// check if [err] was caused by the device being unplugged or by its connection being closed after a fatal USB error
+// the errors which were formatted into the message of another error are matched using their message
+func isDeviceDisconnected(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if _, ok := err.(DeviceDisconnectedError); ok {
+		return true
+	}
+
+	var usbErr usb.Error
+	if errors.As(err, &usbErr) {
+		return usbErr == usb.ERROR_NO_DEVICE
+	}
+
+	msg := err.Error()
+
+	return strings.Contains(msg, libusbNoDeviceErrorName) || strings.Contains(msg, mtpDeviceNotOpenMessage)
+}
+
+// wrap [err] with a [DeviceDisconnectedError] unless it already is one
+func deviceDisconnectedError(err error) error {
+	if _, ok := err.(DeviceDisconnectedError); ok {
+		return err
+	}
+
+	return DeviceDisconnectedError{error: err}
+}
+
+// wrap the device error [err] with a [FileObjectError]
+// a [TransactionTimeoutError] is returned as is, so that the callers can tell that the device must be initialized again
+func fileObjectError(err error) error {
+	if _, ok := err.(TransactionTimeoutError); ok {
+		return err
+	}
+
+	return FileObjectError{error: err}
+}
+
+// invoke [batchProgressCb] with the bulk totals of [pInfo]
+func reportBatchProgress(batchProgressCb BatchProgressCb, pInfo *ProgressInfo) error {
+	if batchProgressCb == nil {
+		return nil
+	}
+
+	return batchProgressCb(pInfo.BulkFileSize.Total, pInfo.BulkFileSize.Sent, pInfo.TotalFiles, pInfo.FilesSent, pInfo.FileInfo.FullPath)
+}
+
+func uploadFilesError(err error) error {
+	if isDeviceDisconnected(err) {
+		return deviceDisconnectedError(err)
+	}
+
+	var pausedErr PausedTransferCanceledError
+	if errors.As(err, &pausedErr) {
+		return pausedErr
+	}
+
+	switch err.(type) {
+	case InvalidPathError, RelativePathNotSupportedError, ChecksumMismatchError, SymlinkCycleError, InvalidFilenameError:
+		return err
+
+	case *os.PathError:
+		if errors.Is(err, os.ErrPermission) {
+			return FilePermissionError{error: err}
+		}
+
+		if errors.Is(err, os.ErrNotExist) {
+			return InvalidPathError{error: err}
+		}
+
+		return LocalFileError{error: err}
+	default:
+		return FileTransferError{error: fmt.Errorf("an error occured while uploading files. %+v", err.Error())}
+	}
+}
+
+// create a new [hash.Hash] for the [algo]
+// an empty [algo] defaults to [HashSha256]
+func newHash(algo HashAlgo) (hash.Hash, error) {
+	switch algo {
+	case HashMd5:
+		return md5.New(), nil
+	case HashSha1:
+		return sha1.New(), nil
+	case HashSha256, "":
+		return sha256.New(), nil
+	default:
+		return nil, UnsupportedOperationError{error: fmt.Errorf("unsupported hash algorithm: %s", algo)}
+	}
+}
+
+// hex encoded hash of a local file
+func hashLocalFile(filename string, algo HashAlgo) (string, error) {
+	h, err := newHash(algo)
+	if err != nil {
+		return "", err
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	buf := transferBuffers.get()
+	defer transferBuffers.put(buf)
+
+	if _, err := io.CopyBuffer(h, f, *buf); err != nil {
+		return "", LocalFileError{error: err}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hex encoded hash of an object on the device
+// the object is streamed from the device into the hash
+func hashObject(dev *mtp.Device, objectId uint32, algo HashAlgo) (string, error) {
+	h, err := newHash(algo)
+	if err != nil {
+		return "", err
+	}
+
+	g := &callGuard{}
+	if err := withCallTimeout(dev, g, func() error {
+		return dev.GetObject(objectId, g.writer(h), mtp.EmptyProgressFunc)
+	}); err != nil {
+		return "", FileTransferError{error: err}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// compare the hash of the uploaded object [objectId] with the hash of the local file [filename]
+// if [localHash] is empty then the local file is hashed
+func verifyUploadedFile(dev *mtp.Device, objectId uint32, filename, localHash string, algo HashAlgo) error {
+	if localHash == "" {
+		h, err := hashLocalFile(filename, algo)
+		if err != nil {
+			return err
+		}
+
+		localHash = h
+	}
+
+	deviceHash, err := hashObject(dev, objectId, algo)
+	if err != nil {
+		return err
+	}
+
+	if !strings.EqualFold(localHash, deviceHash) {
+		return ChecksumMismatchError{
+			error:      fmt.Errorf("checksum mismatch: %s. local: %s, device: %s", filename, localHash, deviceHash),
+			ObjectId:   objectId,
+			LocalHash:  localHash,
+			DeviceHash: deviceHash,
+		}
+	}
+
+	return nil
+}
+
+// the reader returned by [OpenObject]
+type objectReader struct {
+	pr   *io.PipeReader
+	done chan struct{}
+}
+
+func (r *objectReader) Read(p []byte) (int, error) {
+	return r.pr.Read(p)
+}
+
+// closing the reader aborts the transfer if it wasn't read fully
+// and waits for the GetObject transaction to finish
+func (r *objectReader) Close() error {
+	err := r.pr.Close()
+	<-r.done
+
+	return err
+}
+
+// the writer returned by [CreateObjectWriter]
+// [io.Closer.Close] commits the object while [ObjectWriter.Abort] discards it
+type ObjectWriter interface {
+	io.WriteCloser
+
+	// abort the transfer and delete the incomplete object
+	// the writer can't be used afterwards; calling Abort after Close or Abort does nothing
+	Abort() error
+}
+
+// returned by the SendObject transaction of an [objectWriter] which was aborted
+var errObjectWriterAborted = errors.New("the transfer was aborted")
+
+// implements [ObjectWriter]
+// the small writes are coalesced into [buf], so that each of them doesn't end up in a separate USB transfer
+type objectWriter struct {
+	dev          *mtp.Device
+	storageId    uint32
+	objectId     uint32
+	expectedSize int64
+	written      int64
+	pw           *io.PipeWriter
+	done         chan error
+	closed       bool
+
+	// a buffer of [transferBuffers] holding the [buffered] bytes which weren't sent yet
+	buf      *[]byte
+	buffered int
+}
+
+func (w *objectWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, SendObjectError{error: io.ErrClosedPipe}
+	}
+
+	if w.written+int64(len(p)) > w.expectedSize {
+		return 0, SendObjectError{error: fmt.Errorf("write exceeds the expected size: %d", w.expectedSize)}
+	}
+
+	for n := 0; n < len(p); {
+		// a write larger than the buffer is sent as it is
+		if w.buffered == 0 && len(p)-n >= len(*w.buf) {
+			m, err := w.pw.Write(p[n:])
+			w.written += int64(m)
+
+			if err != nil {
+				return n + m, SendObjectError{error: err}
+			}
+
+			break
+		}
+
+		m := copy((*w.buf)[w.buffered:], p[n:])
+		w.buffered += m
+		w.written += int64(m)
+		n += m
+
+		if w.buffered == len(*w.buf) {
+			if err := w.flush(); err != nil {
+				return n, SendObjectError{error: err}
+			}
+		}
+	}
+
+	return len(p), nil
+}
+
+// send the buffered bytes
+// note: an empty write would block on the pipe until SendObject reads again, so nothing is written if there are no buffered bytes
+func (w *objectWriter) flush() error {
+	if w.buffered == 0 {
+		return nil
+	}
+
+	_, err := w.pw.Write((*w.buf)[:w.buffered])
+	w.buffered = 0
+
+	return err
+}
+
+// closing the writer waits for the SendObject transaction to finish
+// if fewer bytes than the expected size were written then the transfer is aborted, the incomplete object is deleted
+// and a [SendObjectError] is returned, so a short write never leaves a truncated object behind
+func (w *objectWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	var sizeErr error
+	if w.written != w.expectedSize {
+		sizeErr = SendObjectError{error: fmt.Errorf("size mismatch: %d of %d bytes were written", w.written, w.expectedSize)}
+		_ = w.pw.CloseWithError(sizeErr)
+	} else if err := w.flush(); err != nil {
+		_ = w.pw.CloseWithError(err)
+	} else {
+		_ = w.pw.Close()
+	}
+
+	err := w.wait()
+	if sizeErr == nil && err == nil {
+		return nil
+	}
+
+	_ = deleteFile(w.dev, w.storageId, []FileProp{{w.objectId, ""}})
+
+	if sizeErr != nil {
+		return sizeErr
+	}
+
+	return SendObjectError{error: err}
+}
+
+// the buffered bytes are dropped and the pipe is closed, so that the SendObject transaction fails instead of
+// committing the object; the incomplete object is deleted once the transaction has returned
+func (w *objectWriter) Abort() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	w.buffered = 0
+	_ = w.pw.CloseWithError(errObjectWriterAborted)
+
+	_ = w.wait()
+
+	return deleteFile(w.dev, w.storageId, []FileProp{{w.objectId, ""}})
+}
+
+// release the buffer and wait for the SendObject transaction to return
+func (w *objectWriter) wait() error {
+	transferBuffers.put(w.buf)
+	w.buf = nil
+
+	err := <-w.done
+	activeObjectStreams.Delete(w.dev)
+
+	return err
+}
+
+// enumerate the connected MTP devices and find the one matching the selectors of [init]
+// returns the pattern which selects the device using [mtp.SelectDeviceWithDebugging]
+func findDevicePattern(init Init) (string, error) {
+	devs, err := mtp.FindDevices(usb.NewContext())
+	if err != nil {
+		return "", MtpDetectFailedError{error: err}
+	}
+
+	var ids []string
+	var matched []mtp.UsbDeviceInfo
+
+	for _, d := range devs {
+		if err := d.Open(); err != nil {
+			d.Done()
+
+			continue
+		}
+
+		ui, err := d.GetUsbInfo()
+		id, idErr := d.ID()
+
+		_ = d.Close()
+		d.Done()
+
+		if err != nil || idErr != nil {
+			continue
+		}
+
+		if !isDeviceSelected(init, ui) {
+			continue
+		}
+
+		ids = append(ids, id)
+		matched = append(matched, *ui)
+	}
+
+	switch len(matched) {
+	case 0:
+		return "", MtpDetectFailedError{error: fmt.Errorf("no MTP devices found")}
+
+	case 1:
+		return fmt.Sprintf("^%s$", regexp.QuoteMeta(ids[0])), nil
+	}
+
+	return "", MultipleDevicesError{
+		error:   fmt.Errorf("more than 1 MTP device found: %s", strings.Join(ids, ", ")),
+		Devices: matched,
+	}
+}
+
+// check if the device [ui] matches the selectors of [init]
+func isDeviceSelected(init Init, ui *mtp.UsbDeviceInfo) bool {
+	if init.SerialNumber != "" && init.SerialNumber != ui.SerialNumber {
+		return false
+	}
+
+	if init.VendorId != 0 && init.VendorId != ui.IdVendor {
+		return false
+	}
+
+	if init.ProductId != 0 && init.ProductId != ui.IdProduct {
+		return false
+	}
+
+	return true
+}
@@ -1,8 +1,19 @@
 package mtpx
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+	"github.com/ganeshrvel/usb"
 	. "github.com/smartystreets/goconvey/convey"
+	"io"
+	"io/ioutil"
 	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -159,6 +170,36 @@ func TestGetObjectFromPath(t *testing.T) {
 		}
 	})
 
+	Convey("Testing mixed separators | GetObjectFromPath", t, func() {
+		// test the file 'mtp-test-files/mock_dir1/a.txt' using the local separator
+		fi, err := GetObjectFromPath(dev, sid, filepath.Join("mtp-test-files", "mock_dir1", "a.txt"))
+
+		So(err, ShouldBeNil)
+		So(fi.Name, ShouldEqual, "a.txt")
+		So(fi.FullPath, ShouldEqual, "/mtp-test-files/mock_dir1/a.txt")
+
+		// test the file '//mtp-test-files//a.txt/'
+		fi, err = GetObjectFromPath(dev, sid, "//mtp-test-files//a.txt/")
+
+		So(err, ShouldBeNil)
+		So(fi.FullPath, ShouldEqual, "/mtp-test-files/a.txt")
+
+	})
+
+	Convey("Testing '.' and '..' components | GetObjectFromPath | It should throw an error", t, func() {
+		for _, p := range []string{".", "..", "/mtp-test-files/./a.txt", "/mtp-test-files/mock_dir1/../a.txt"} {
+			fi, err := GetObjectFromPath(dev, sid, p)
+
+			So(err, ShouldHaveSameTypeAs, RelativePathNotSupportedError{})
+			So(fi, ShouldBeNil)
+
+			fi, err = GetObjectFromObjectIdOrPath(dev, sid, FileProp{0, p})
+
+			So(err, ShouldHaveSameTypeAs, RelativePathNotSupportedError{})
+			So(fi, ShouldBeNil)
+		}
+	})
+
 	Convey("Testing non exisiting file | GetObjectFromPath | It should throw an error", t, func() {
 		// test the file 'fake_file'
 		fi, err := GetObjectFromPath(dev, sid, "fake_file")
@@ -266,6 +307,102 @@ func TestGetObjectFromParentIdAndFilename(t *testing.T) {
 		So(fi, ShouldBeNil)
 	})
 
+	Convey("Testing exact filename match | GetObjectFromParentIdAndFilenameWithMatch", t, func() {
+		parent, err := GetObjectFromPath(dev, sid, "/mtp-test-files")
+		So(err, ShouldBeNil)
+
+		fi, err := GetObjectFromParentIdAndFilenameWithMatch(dev, sid, parent.ObjectId, "a.txt", FilenameMatchExact)
+		So(err, ShouldBeNil)
+		So(fi.Name, ShouldEqual, "a.txt")
+
+		fi, err = GetObjectFromParentIdAndFilenameWithMatch(dev, sid, parent.ObjectId, "A.TXT", FilenameMatchExact)
+		So(err, ShouldHaveSameTypeAs, FileNotFoundError{})
+		So(fi, ShouldBeNil)
+
+		fi, err = GetObjectFromPathWithMatch(dev, sid, "/mtp-test-files/A.TXT", FilenameMatchExact)
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+		So(fi, ShouldBeNil)
+
+		fi, err = GetObjectFromPathWithMatch(dev, sid, "/MTP-TEST-FILES/A.TXT", FilenameMatchCaseInsensitive)
+		So(err, ShouldBeNil)
+		So(fi.Name, ShouldEqual, "a.txt")
+	})
+
+	Convey("Testing selectFilenameMatch", t, func() {
+		names := []string{"a.txt", "B.txt", "b.TXT", "c.txt"}
+		objectIds := []uint32{1, 2, 3, 4}
+
+		i, err := selectFilenameMatch(names, objectIds, "A.TXT", FilenameMatchCaseInsensitive, false)
+		So(err, ShouldBeNil)
+		So(i, ShouldEqual, 0)
+
+		_, err = selectFilenameMatch(names, objectIds, "A.TXT", FilenameMatchExact, false)
+		So(err, ShouldHaveSameTypeAs, FileNotFoundError{})
+
+		// the exact match is preferred over the case insensitive ones
+		i, err = selectFilenameMatch(names, objectIds, "b.TXT", FilenameMatchCaseInsensitive, false)
+		So(err, ShouldBeNil)
+		So(i, ShouldEqual, 2)
+
+		_, err = selectFilenameMatch(names, objectIds, "b.txt", FilenameMatchCaseInsensitive, false)
+		So(err, ShouldHaveSameTypeAs, AmbiguousPathError{})
+		So(err.(AmbiguousPathError).Candidates, ShouldResemble, []string{"B.txt", "b.TXT"})
+
+		// the objects sharing the same name
+		names = []string{"a.txt", "b.txt", "B.TXT", "b.txt"}
+
+		_, err = selectFilenameMatch(names, objectIds, "b.txt", FilenameMatchCaseInsensitive, false)
+		So(err, ShouldHaveSameTypeAs, DuplicateObjectError{})
+		So(err.(DuplicateObjectError).Filename, ShouldEqual, "b.txt")
+		So(err.(DuplicateObjectError).ObjectIds, ShouldResemble, []uint32{2, 4})
+
+		i, err = selectFilenameMatch(names, objectIds, "b.txt", FilenameMatchCaseInsensitive, true)
+		So(err, ShouldBeNil)
+		So(i, ShouldEqual, 1)
+
+		i, err = selectFilenameMatch(names, objectIds, "B.TXT", FilenameMatchExact, false)
+		So(err, ShouldBeNil)
+		So(i, ShouldEqual, 2)
+
+		names = []string{"a.txt", "B.txt", "B.txt", "c.txt"}
+
+		_, err = selectFilenameMatch(names, objectIds, "b.txt", FilenameMatchCaseInsensitive, false)
+		So(err, ShouldHaveSameTypeAs, DuplicateObjectError{})
+		So(err.(DuplicateObjectError).ObjectIds, ShouldResemble, []uint32{2, 3})
+	})
+
+	Convey("Testing GetObjectPropList and GetObjectPropValue code paths | GetObjectFromParentIdAndFilename", t, func() {
+		supported, err := isOperationSupported(dev, mtp.OC_MTP_GetObjPropList)
+		So(err, ShouldBeNil)
+
+		if !supported {
+			return
+		}
+
+		parent, err := GetObjectFromPath(dev, sid, "/mtp-test-files")
+		So(err, ShouldBeNil)
+
+		for _, filename := range []string{"a.txt", "mock_dir1", "4mb_txt_file"} {
+			fi1, err := getObjectFromParentIdAndFilenameUsingPropList(dev, sid, parent.ObjectId, filename, FilenameMatchCaseInsensitive)
+			So(err, ShouldBeNil)
+
+			fi2, err := getObjectFromParentIdAndFilenameUsingPropValue(dev, sid, parent.ObjectId, filename, FilenameMatchCaseInsensitive)
+			So(err, ShouldBeNil)
+
+			So(fi1.ObjectId, ShouldEqual, fi2.ObjectId)
+			So(fi1.ParentId, ShouldEqual, fi2.ParentId)
+			So(fi1.Name, ShouldEqual, fi2.Name)
+			So(fi1.Size, ShouldEqual, fi2.Size)
+			So(fi1.IsDir, ShouldEqual, fi2.IsDir)
+			So(fi1.Extension, ShouldEqual, fi2.Extension)
+			So(fi1.ModTime.Unix(), ShouldEqual, fi2.ModTime.Unix())
+			So(fi1.Info.ObjectFormat, ShouldEqual, fi2.Info.ObjectFormat)
+		}
+
+		_, err = getObjectFromParentIdAndFilenameUsingPropList(dev, sid, parent.ObjectId, "fake_file", FilenameMatchCaseInsensitive)
+		So(err, ShouldHaveSameTypeAs, FileNotFoundError{})
+	})
+
 	Dispose(dev)
 }
 
@@ -742,5 +879,1021 @@ TestGetObjectFromObjectIdOrPath(t *testing.T) {
 		So(fi, ShouldBeNil)
 	})
 
+	Convey("Testing a mismatched storageId | GetObjectFromObjectIdOrPath | It should throw an error", t, func() {
+		dir, err := GetObjectFromPath(dev, sid, "/mtp-test-files")
+		So(err, ShouldBeNil)
+
+		fi, err := GetObjectFromObjectIdOrPath(dev, sid+1, FileProp{dir.ObjectId, ""})
+		So(err, ShouldHaveSameTypeAs, StorageMismatchError{})
+		So(err.(StorageMismatchError).ObjectStorageId, ShouldEqual, sid)
+		So(fi, ShouldBeNil)
+
+		// the walk fails early instead of listing nothing
+		_, _, _, err = proccessWalk(context.Background(), dev, sid+1, FileProp{dir.ObjectId, ""}, walkProps{skipErrors: true},
+			func(objectId uint32, fi *FileInfo, err error) error {
+				return nil
+			})
+		So(err, ShouldHaveSameTypeAs, StorageMismatchError{})
+
+		// the root directory belongs to every storage
+		_, err = GetObjectFromObjectIdOrPath(dev, sid+1, FileProp{ParentObjectId, ""})
+		So(err, ShouldBeNil)
+
+		_, err = GetObjectFromObjectIdOrPath(dev, mtp.GOH_ALL_STORAGE, FileProp{dir.ObjectId, ""})
+		So(err, ShouldBeNil)
+	})
+
+	Dispose(dev)
+}
+
+func TestPathExists(t *testing.T) {
+	dev, err := Initialize(Init{})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	storages, err := FetchStorages(dev)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	sid := storages[0].Sid
+
+	Convey("Testing existing files | PathExists", t, func() {
+		// test the directory '/mtp-test-files'
+		exists, fi, err := PathExists(dev, sid, "/mtp-test-files")
+		So(err, ShouldBeNil)
+		So(exists, ShouldEqual, true)
+		So(fi.IsDir, ShouldEqual, true)
+		So(fi.FullPath, ShouldEqual, "/mtp-test-files")
+
+		// test the file 'mtp-test-files/a.txt'
+		exists, fi, err = PathExists(dev, sid, "mtp-test-files/a.txt")
+		So(err, ShouldBeNil)
+		So(exists, ShouldEqual, true)
+		So(fi.IsDir, ShouldEqual, false)
+		So(fi.FullPath, ShouldEqual, "/mtp-test-files/a.txt")
+		So(fi.ParentPath, ShouldEqual, "/mtp-test-files")
+
+		// test the root directory
+		exists, fi, err = PathExists(dev, sid, "/")
+		So(err, ShouldBeNil)
+		So(exists, ShouldEqual, true)
+		So(fi.ObjectId, ShouldEqual, ParentObjectId)
+	})
+
+	Convey("Testing non existing files | PathExists", t, func() {
+		// test the directory '/fake'
+		exists, fi, err := PathExists(dev, sid, "/fake/")
+		So(err, ShouldBeNil)
+		So(exists, ShouldEqual, false)
+		So(fi, ShouldBeNil)
+
+		// test the file '/mtp-test-files/fake.txt'
+		exists, fi, err = PathExists(dev, sid, "/mtp-test-files/fake.txt")
+		So(err, ShouldBeNil)
+		So(exists, ShouldEqual, false)
+		So(fi, ShouldBeNil)
+
+		// test a path nested under a file '/mtp-test-files/a.txt/b.txt'
+		exists, fi, err = PathExists(dev, sid, "/mtp-test-files/a.txt/b.txt")
+		So(err, ShouldBeNil)
+		So(exists, ShouldEqual, false)
+		So(fi, ShouldBeNil)
+	})
+
+	Convey("Testing the paths | PathExists", t, func() {
+		// the duplicate and the trailing separators are removed
+		exists, fi, err := PathExists(dev, sid, "//mtp-test-files//a.txt/")
+		So(err, ShouldBeNil)
+		So(exists, ShouldEqual, true)
+		So(fi.FullPath, ShouldEqual, "/mtp-test-files/a.txt")
+		So(fi.ParentPath, ShouldEqual, "/mtp-test-files")
+
+		_, _, err = PathExists(dev, sid, "/mtp-test-files/../a.txt")
+		So(err, ShouldHaveSameTypeAs, RelativePathNotSupportedError{})
+	})
+
+	Dispose(dev)
+}
+
+func TestIsDir(t *testing.T) {
+	dev, err := Initialize(Init{})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	storages, err := FetchStorages(dev)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	sid := storages[0].Sid
+
+	Convey("Testing existing files | IsDir", t, func() {
+		isDir, err := IsDir(dev, sid, "/mtp-test-files")
+		So(err, ShouldBeNil)
+		So(isDir, ShouldEqual, true)
+
+		isDir, err = IsDir(dev, sid, "mtp-test-files/a.txt")
+		So(err, ShouldBeNil)
+		So(isDir, ShouldEqual, false)
+
+		isDir, err = IsDir(dev, sid, "/")
+		So(err, ShouldBeNil)
+		So(isDir, ShouldEqual, true)
+
+		// the ObjectInfo is never fetched
+		calls := countMtpRequests(dev, mtp.OC_GetObjectInfo, func() {
+			_, err = IsDir(dev, sid, "/mtp-test-files/a.txt")
+		})
+		So(err, ShouldBeNil)
+		So(calls, ShouldEqual, 0)
+	})
+
+	Convey("Testing non existing files | IsDir", t, func() {
+		_, err := IsDir(dev, sid, "/fake/")
+		So(err, ShouldHaveSameTypeAs, FileNotFoundError{})
+
+		_, err = IsDir(dev, sid, "/mtp-test-files/fake.txt")
+		So(err, ShouldHaveSameTypeAs, FileNotFoundError{})
+
+		_, err = IsDir(dev, sid, "/mtp-test-files/a.txt/b.txt")
+		So(err, ShouldHaveSameTypeAs, FileNotFoundError{})
+	})
+
+	Dispose(dev)
+}
+
+func TestGetObjectFromPathCached(t *testing.T) {
+	dev, err := Initialize(Init{})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	storages, err := FetchStorages(dev)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	sid := storages[0].Sid
+
+	Convey("Testing valid files | GetObjectFromPathCached", t, func() {
+		cache := NewPathCache()
+
+		// test the file '/mtp-test-files/a.txt'
+		fi, err := GetObjectFromPathCached(dev, sid, "/mtp-test-files/a.txt", cache)
+		So(err, ShouldBeNil)
+
+		_fi, err := GetObjectFromPath(dev, sid, "/mtp-test-files/a.txt")
+		So(err, ShouldBeNil)
+
+		So(fi.ObjectId, ShouldEqual, _fi.ObjectId)
+		So(fi.IsDir, ShouldEqual, false)
+		So(fi.FullPath, ShouldEqual, "/mtp-test-files/a.txt")
+
+		// test the directory 'mtp-test-files/mock_dir1/' using the warmed up cache
+		fi, err = GetObjectFromPathCached(dev, sid, "mtp-test-files/mock_dir1/", cache)
+		So(err, ShouldBeNil)
+		So(fi.IsDir, ShouldEqual, true)
+		So(fi.FullPath, ShouldEqual, "/mtp-test-files/mock_dir1")
+
+		// test the root directory
+		fi, err = GetObjectFromPathCached(dev, sid, "/", cache)
+		So(err, ShouldBeNil)
+		So(fi.ObjectId, ShouldEqual, ParentObjectId)
+	})
+
+	Convey("Testing invalidation | GetObjectFromPathCached", t, func() {
+		cache := NewPathCache()
+
+		// test the directory '/mtp-test-files/temp_dir/test-GetObjectFromPathCached'
+		parentPath := "/mtp-test-files/temp_dir/test-GetObjectFromPathCached"
+		parentId, err := MakeDirectory(dev, sid, parentPath)
+		So(err, ShouldBeNil)
+
+		dirName := fmt.Sprintf("%x", rand.Int31())
+		dirPath := getFullPath(parentPath, dirName)
+
+		// warm up the cache before the directory is created
+		_, err = GetObjectFromPathCached(dev, sid, dirPath, cache)
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+
+		objectId, err := MakeDirectory(dev, sid, dirPath)
+		So(err, ShouldBeNil)
+
+		cache.Invalidate(sid, parentId)
+
+		fi, err := GetObjectFromPathCached(dev, sid, dirPath, cache)
+		So(err, ShouldBeNil)
+		So(fi.ObjectId, ShouldEqual, objectId)
+
+		// a deleted object should not be returned from the cache
+		err = DeleteFile(dev, sid, []FileProp{{objectId, ""}})
+		So(err, ShouldBeNil)
+
+		_, err = GetObjectFromPathCached(dev, sid, dirPath, cache)
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+	})
+
+	Convey("Testing invalid files | GetObjectFromPathCached", t, func() {
+		cache := NewPathCache()
+
+		fi, err := GetObjectFromPathCached(dev, sid, "/mtp-test-files/fake.txt", cache)
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+		So(fi, ShouldBeNil)
+
+		fi, err = GetObjectFromPathCached(dev, sid, "", cache)
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+		So(fi, ShouldBeNil)
+	})
+
+	Dispose(dev)
+}
+
+func TestCacheInvalidator(t *testing.T) {
+	dev, err := Initialize(Init{})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	storages, err := FetchStorages(dev)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	sid := storages[0].Sid
+
+	Convey("Upload, read, delete and read again | AddCacheInvalidator", t, func() {
+		cache := NewPathCache()
+		AddCacheInvalidator(dev, cache)
+		defer RemoveCacheInvalidator(dev, cache)
+
+		// destination directories: '/mtp-test-files/temp_dir/test_CacheInvalidator/{random}'
+		destination := fmt.Sprintf("/mtp-test-files/temp_dir/test_CacheInvalidator/%x", rand.Int31())
+		filePath := getFullPath(destination, "a.txt")
+
+		_, _, _, err := UploadFilesWithOpts(dev, sid, []string{getTestMocksAsset("mock_dir1/a.txt")}, destination, UploadOpts{
+			ProgressCb: func(fi *ProgressInfo, err error) error {
+				return nil
+			},
+		})
+		So(err, ShouldBeNil)
+
+		fi, err := GetObjectFromPathCached(dev, sid, filePath, cache)
+		So(err, ShouldBeNil)
+
+		err = DeleteFile(dev, sid, []FileProp{{fi.ObjectId, ""}})
+		So(err, ShouldBeNil)
+
+		// the cached listing of [destination] was dropped by the deletion
+		_, err = GetObjectFromPathCached(dev, sid, filePath, cache)
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+	})
+
+	Convey("Testing the deleted directories | PathCache.InvalidateTree", t, func() {
+		cache := NewPathCache()
+
+		// /dir (10) -> /dir/sub (11) -> /dir/sub/a.txt (12) and /other (20)
+		cache.parents[10] = pathCacheParent{storageId: sid, parentId: ParentObjectId, filename: "dir"}
+		cache.parents[12] = pathCacheParent{storageId: sid, parentId: 11, filename: "a.txt"}
+		cache.parents[20] = pathCacheParent{storageId: sid, parentId: ParentObjectId, filename: "other"}
+		cache.entries[pathCacheKey{sid, 10}] = map[string]uint32{"sub": 11}
+		cache.entries[pathCacheKey{sid, 11}] = map[string]uint32{"a.txt": 12}
+
+		cache.InvalidateTree(sid, 10)
+
+		So(cache.parents, ShouldResemble, map[uint32]pathCacheParent{
+			20: {storageId: sid, parentId: ParentObjectId, filename: "other"},
+		})
+		So(cache.entries, ShouldBeEmpty)
+	})
+
 	Dispose(dev)
 }
+
+func TestResolveObjectPath(t *testing.T) {
+	dev, err := Initialize(Init{})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	storages, err := FetchStorages(dev)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	sid := storages[0].Sid
+
+	Convey("Testing valid objects | ResolveObjectPath", t, func() {
+		// test the file '/mtp-test-files/mock_dir1/3/2/b.txt'
+		fi, err := GetObjectFromPath(dev, sid, "/mtp-test-files/mock_dir1/3/2/b.txt")
+		So(err, ShouldBeNil)
+
+		fullPath, err := ResolveObjectPath(dev, sid, fi.ObjectId)
+		So(err, ShouldBeNil)
+		So(fullPath, ShouldEqual, "/mtp-test-files/mock_dir1/3/2/b.txt")
+
+		// test the root directory
+		fullPath, err = ResolveObjectPath(dev, sid, ParentObjectId)
+		So(err, ShouldBeNil)
+		So(fullPath, ShouldEqual, "/")
+	})
+
+	Convey("Testing the shared parents | ResolveObjectPathCached", t, func() {
+		cache := NewPathCache()
+
+		// test the directories '/mtp-test-files/mock_dir1/3' and '/mtp-test-files/mock_dir1/3/2'
+		dir, err := GetObjectFromPath(dev, sid, "/mtp-test-files/mock_dir1/3/2")
+		So(err, ShouldBeNil)
+
+		fullPath, err := ResolveObjectPathCached(dev, sid, dir.ObjectId, cache)
+		So(err, ShouldBeNil)
+		So(fullPath, ShouldEqual, "/mtp-test-files/mock_dir1/3/2")
+
+		// the parent is read from the cache
+		So(cache.parents, ShouldContainKey, dir.ParentId)
+
+		fullPath, err = ResolveObjectPathCached(dev, sid, dir.ParentId, cache)
+		So(err, ShouldBeNil)
+		So(fullPath, ShouldEqual, "/mtp-test-files/mock_dir1/3")
+
+		cache.Invalidate(sid, dir.ParentId)
+		So(cache.parents, ShouldNotContainKey, dir.ObjectId)
+	})
+
+	Convey("Testing invalid objects | ResolveObjectPath | Should throw an error", t, func() {
+		fi, err := GetObjectFromPath(dev, sid, "/mtp-test-files/a.txt")
+		So(err, ShouldBeNil)
+
+		_, err = ResolveObjectPath(dev, sid+1, fi.ObjectId)
+		So(err, ShouldHaveSameTypeAs, StorageMismatchError{})
+
+		_, err = ResolveObjectPath(dev, sid, 1234567)
+		So(err, ShouldHaveSameTypeAs, FileObjectError{})
+	})
+
+	Dispose(dev)
+}
+
+func TestVerifyObjectChain(t *testing.T) {
+	dev, err := Initialize(Init{})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	storages, err := FetchStorages(dev)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	sid := storages[0].Sid
+
+	Convey("Testing valid objects | VerifyObjectChain", t, func() {
+		fi, err := GetObjectFromPath(dev, sid, "/mtp-test-files/mock_dir1/3/2/b.txt")
+		So(err, ShouldBeNil)
+
+		fullPath, broken, err := VerifyObjectChain(dev, fi.ObjectId)
+		So(err, ShouldBeNil)
+		So(broken, ShouldBeFalse)
+		So(fullPath, ShouldEqual, "/mtp-test-files/mock_dir1/3/2/b.txt")
+
+		fullPath, broken, err = VerifyObjectChain(dev, ParentObjectId)
+		So(err, ShouldBeNil)
+		So(broken, ShouldBeFalse)
+		So(fullPath, ShouldEqual, "/")
+	})
+
+	Convey("Testing invalid objects | VerifyObjectChain | Should throw an error", t, func() {
+		_, _, err := VerifyObjectChain(dev, 1234567)
+		So(err, ShouldHaveSameTypeAs, FileObjectError{})
+	})
+
+	Convey("Testing the broken chains | verifyObjectChain", t, func() {
+		parents := map[uint32]pathCacheParent{
+			1: {parentId: 2, filename: "b.txt"},
+			2: {parentId: 3, filename: "2"},
+			4: {parentId: 5, filename: "c.txt"},
+			5: {parentId: 4, filename: "3"},
+		}
+		fetchParent := func(objectId uint32) (pathCacheParent, error) {
+			if p, ok := parents[objectId]; ok {
+				return p, nil
+			}
+
+			return pathCacheParent{}, FileObjectError{error: mtp.RCError(mtp.RC_InvalidObjectHandle)}
+		}
+
+		// the parent 3 doesn't exist
+		path, broken, err := verifyObjectChain(1, fetchParent)
+		So(err, ShouldBeNil)
+		So(broken, ShouldBeTrue)
+		So(path, ShouldEqual, "2/b.txt")
+
+		// the parents are cyclic
+		path, broken, err = verifyObjectChain(4, fetchParent)
+		So(err, ShouldBeNil)
+		So(broken, ShouldBeTrue)
+		So(path, ShouldEqual, "3/c.txt")
+	})
+
+	Dispose(dev)
+}
+
+func TestWalkLocalFiles(t *testing.T) {
+	// source directories: 'mocks-build/test_walkLocalFiles/src' with a symlink to 'mocks-build/test_walkLocalFiles/photos'
+	mocksDir := newTempMocksDir("test_walkLocalFiles", true)
+	source := filepath.Join(mocksDir, "src")
+	photos := filepath.Join(mocksDir, "photos")
+
+	if err := os.MkdirAll(filepath.Join(source, "sub"), os.ModePerm); err != nil {
+		log.Panic(err)
+	}
+	if err := os.MkdirAll(photos, os.ModePerm); err != nil {
+		log.Panic(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(source, "sub", "a.txt"), []byte("a"), os.ModePerm); err != nil {
+		log.Panic(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(photos, "b.jpg"), []byte("bb"), os.ModePerm); err != nil {
+		log.Panic(err)
+	}
+	if err := os.Symlink(photos, filepath.Join(source, "photos")); err != nil {
+		log.Panic(err)
+	}
+
+	Convey("Skip the symlinks | followSymlinks=false | walkLocalFiles", t, func() {
+		var paths []string
+		totalFiles, totalDirectories, totalSize, err := walkLocalFiles([]string{source}, false, nil,
+			func(fi *os.FileInfo, fullPath string, err error) error {
+				So(err, ShouldBeNil)
+
+				paths = append(paths, fullPath)
+
+				return nil
+			})
+
+		So(err, ShouldBeNil)
+		So(totalFiles, ShouldEqual, 1)
+		So(totalDirectories, ShouldEqual, 2)
+		So(totalSize, ShouldEqual, 1)
+		So(paths, ShouldNotContain, filepath.Join(source, "photos"))
+	})
+
+	Convey("Follow the symlinks | followSymlinks=true | walkLocalFiles", t, func() {
+		var paths []string
+		totalFiles, totalDirectories, totalSize, err := walkLocalFiles([]string{source}, true, nil,
+			func(fi *os.FileInfo, fullPath string, err error) error {
+				So(err, ShouldBeNil)
+
+				if fullPath == filepath.Join(source, "photos") {
+					So((*fi).Name(), ShouldEqual, "photos")
+					So((*fi).IsDir(), ShouldBeTrue)
+				}
+
+				paths = append(paths, fullPath)
+
+				return nil
+			})
+
+		So(err, ShouldBeNil)
+		So(totalFiles, ShouldEqual, 2)
+		So(totalDirectories, ShouldEqual, 3)
+		So(totalSize, ShouldEqual, 3)
+
+		// the target is reported under the symlink
+		So(paths, ShouldContain, filepath.Join(source, "photos", "b.jpg"))
+	})
+
+	Convey("Skip the custom disallowed files | walkLocalFiles", t, func() {
+		var paths []string
+		totalFiles, totalDirectories, _, err := walkLocalFiles([]string{source}, true, []string{"*.jpg", "su?"},
+			func(fi *os.FileInfo, fullPath string, err error) error {
+				So(err, ShouldBeNil)
+
+				paths = append(paths, fullPath)
+
+				return nil
+			})
+
+		So(err, ShouldBeNil)
+		So(totalFiles, ShouldEqual, 0)
+		So(totalDirectories, ShouldEqual, 2)
+
+		// the contents of a disallowed directory are skipped as well
+		So(paths, ShouldNotContain, filepath.Join(source, "sub", "a.txt"))
+		So(paths, ShouldNotContain, filepath.Join(source, "photos", "b.jpg"))
+
+		// an empty list disables the filtering
+		totalFiles, _, _, err = walkLocalFiles([]string{source}, true, []string{},
+			func(fi *os.FileInfo, fullPath string, err error) error {
+				return nil
+			})
+
+		So(err, ShouldBeNil)
+		So(totalFiles, ShouldEqual, 2)
+	})
+
+	Convey("Symlink cycle | followSymlinks=true | walkLocalFiles | It should throw an error", t, func() {
+		loop := filepath.Join(source, "sub", "loop")
+		err := os.Symlink(source, loop)
+		So(err, ShouldBeNil)
+
+		_, _, _, err = walkLocalFiles([]string{source}, true, nil,
+			func(fi *os.FileInfo, fullPath string, err error) error {
+				return nil
+			})
+
+		So(err, ShouldHaveSameTypeAs, SymlinkCycleError{})
+
+		// the cycle is ignored if the symlinks are not followed
+		_, _, _, err = walkLocalFiles([]string{source}, false, nil,
+			func(fi *os.FileInfo, fullPath string, err error) error {
+				return nil
+			})
+
+		So(err, ShouldBeNil)
+
+		err = os.Remove(loop)
+		So(err, ShouldBeNil)
+	})
+}
+
+func TestGetObjectProperty(t *testing.T) {
+	dev, err := Initialize(Init{})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	storages, err := FetchStorages(dev)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	sid := storages[0].Sid
+
+	Convey("Testing string and integer properties | GetObjectProperty", t, func() {
+		fi, err := GetObjectFromPath(dev, sid, "/mtp-test-files/4mb_txt_file")
+		So(err, ShouldBeNil)
+
+		name, err := GetObjectPropertyString(dev, fi.ObjectId, mtp.OPC_ObjectFileName)
+		So(err, ShouldBeNil)
+		So(name, ShouldEqual, "4mb_txt_file")
+
+		parentId, err := GetObjectProperty(dev, fi.ObjectId, mtp.OPC_ParentObject)
+		So(err, ShouldBeNil)
+		So(parentId, ShouldEqual, fi.ParentId)
+
+		_, err = GetObjectPropertyString(dev, fi.ObjectId, mtp.OPC_ParentObject)
+		So(err, ShouldHaveSameTypeAs, FileObjectError{})
+	})
+
+	Convey("Testing the supported properties | GetSupportedProps", t, func() {
+		fi, err := GetObjectFromPath(dev, sid, "/mtp-test-files/4mb_txt_file")
+		So(err, ShouldBeNil)
+
+		format, err := getObjectFormat(dev, fi.ObjectId)
+		So(err, ShouldBeNil)
+
+		props, err := GetSupportedProps(dev, format)
+		So(err, ShouldBeNil)
+		So(props, ShouldContain, mtp.OPC_ObjectFileName)
+		So(props, ShouldNotContain, mtp.OPC_Duration)
+
+		// the list is cached per format
+		calls := countMtpRequests(dev, mtp.OC_MTP_GetObjectPropsSupported, func() {
+			_, err = GetSupportedProps(dev, format)
+		})
+		So(err, ShouldBeNil)
+		So(calls, ShouldEqual, 0)
+
+		// the undeclared property isn't requested
+		calls = countMtpRequests(dev, mtp.OC_MTP_GetObjectPropDesc, func() {
+			_, err = GetObjectProperty(dev, fi.ObjectId, mtp.OPC_Duration)
+		})
+		So(err, ShouldHaveSameTypeAs, UnsupportedOperationError{})
+		So(calls, ShouldEqual, 0)
+	})
+
+	Convey("Testing decodeObjectPropValue", t, func() {
+		v, err := decodeObjectPropValue(bytes.NewReader([]byte{0x34, 0x12, 0, 0}), mtp.DTC_UINT32)
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, uint32(0x1234))
+
+		v, err = decodeObjectPropValue(bytes.NewReader([]byte{0xff}), mtp.DTC_INT8)
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, int8(-1))
+
+		v, err = decodeObjectPropValue(bytes.NewReader([]byte{3, 'h', 0, 'i', 0, 0, 0}), mtp.DTC_STR)
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, "hi")
+
+		v, err = decodeObjectPropValue(bytes.NewReader([]byte{2, 0, 0, 0, 1, 0, 2, 0}), mtp.DTC_UINT16|mtp.DTC_ARRAY_MASK)
+		So(err, ShouldBeNil)
+		So(v, ShouldResemble, []interface{}{uint16(1), uint16(2)})
+
+		_, err = decodeObjectPropValue(bytes.NewReader([]byte{9, 0, 0, 0, 1}), mtp.DTC_UINT16|mtp.DTC_ARRAY_MASK)
+		So(err, ShouldNotBeNil)
+
+		_, err = decodeObjectPropValue(bytes.NewReader([]byte{0}), mtp.DTC_UNDEF)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Testing encodeObjectPropValue", t, func() {
+		for _, f := range []struct {
+			value    interface{}
+			dataType uint16
+		}{
+			{uint32(0x1234), mtp.DTC_UINT32},
+			{int8(-1), mtp.DTC_INT8},
+			{"hi", mtp.DTC_STR},
+			{"", mtp.DTC_STR},
+			{[]interface{}{uint16(1), uint16(2)}, mtp.DTC_UINT16 | mtp.DTC_ARRAY_MASK},
+		} {
+			var buf bytes.Buffer
+			err := encodeObjectPropValue(&buf, f.value, f.dataType)
+			So(err, ShouldBeNil)
+
+			v, err := decodeObjectPropValue(&buf, f.dataType)
+			So(err, ShouldBeNil)
+			So(v, ShouldResemble, f.value)
+		}
+
+		var buf bytes.Buffer
+		err := encodeObjectPropValue(&buf, 1, mtp.DTC_UINT32)
+		So(err, ShouldHaveSameTypeAs, TypeMismatchError{})
+
+		err = encodeObjectPropValue(&buf, uint32(1), mtp.DTC_STR)
+		So(err, ShouldHaveSameTypeAs, TypeMismatchError{})
+
+		err = encodeObjectPropValue(&buf, nil, mtp.DTC_UINT8)
+		So(err, ShouldHaveSameTypeAs, TypeMismatchError{})
+
+		err = encodeObjectPropValue(&buf, []uint16{1}, mtp.DTC_UINT16|mtp.DTC_ARRAY_MASK)
+		So(err, ShouldHaveSameTypeAs, TypeMismatchError{})
+	})
+
+	Convey("Testing writable and read-only properties | SetObjectProperty", t, func() {
+		// test the directory '/mtp-test-files/temp_dir/test-SetObjectProperty/{random}'
+		directoryName := fmt.Sprintf("/mtp-test-files/temp_dir/test-SetObjectProperty/%x", rand.Int31())
+		newName := fmt.Sprintf("%x", rand.Int31())
+
+		objectId, err := MakeDirectory(dev, sid, directoryName)
+		So(err, ShouldBeNil)
+
+		err = SetObjectProperty(dev, objectId, mtp.OPC_ObjectFileName, newName)
+		So(err, ShouldBeNil)
+
+		name, err := GetObjectPropertyString(dev, objectId, mtp.OPC_ObjectFileName)
+		So(err, ShouldBeNil)
+		So(name, ShouldEqual, newName)
+
+		err = SetObjectProperty(dev, objectId, mtp.OPC_ObjectFileName, uint32(1))
+		So(err, ShouldHaveSameTypeAs, TypeMismatchError{})
+
+		err = SetObjectProperty(dev, objectId, mtp.OPC_StorageID, sid)
+		So(err, ShouldHaveSameTypeAs, ReadOnlyPropertyError{})
+	})
+
+	Dispose(dev)
+}
+
+func TestObjectReferences(t *testing.T) {
+	dev, err := Initialize(Init{})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	storages, err := FetchStorages(dev)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	sid := storages[0].Sid
+
+	Convey("Set and fetch the references of an object | GetObjectReferences | GetReferencedObjects", t, func() {
+		// test the directory '/mtp-test-files/temp_dir/test-ObjectReferences/{random}'
+		dirName := fmt.Sprintf("/mtp-test-files/temp_dir/test-ObjectReferences/%x", rand.Int31())
+
+		objectId, err := MakeDirectory(dev, sid, dirName)
+		So(err, ShouldBeNil)
+
+		fi, err := GetObjectFromPath(dev, sid, "/mtp-test-files/a.txt")
+		So(err, ShouldBeNil)
+
+		err = SetObjectReferences(dev, objectId, []uint32{fi.ObjectId})
+		So(err, ShouldBeNil)
+
+		refs, err := GetObjectReferences(dev, objectId)
+		So(err, ShouldBeNil)
+		So(refs, ShouldResemble, []uint32{fi.ObjectId})
+
+		objects, err := GetReferencedObjects(dev, objectId)
+		So(err, ShouldBeNil)
+		So(len(objects), ShouldEqual, 1)
+		So(objects[0].ObjectId, ShouldEqual, fi.ObjectId)
+		So(objects[0].FullPath, ShouldEqual, "/mtp-test-files/a.txt")
+
+		// the references to the deleted objects are skipped
+		err = SetObjectReferences(dev, objectId, []uint32{0xFFFFFFF0, fi.ObjectId})
+		if err == nil {
+			objects, err = GetReferencedObjects(dev, objectId)
+			So(err, ShouldBeNil)
+			So(len(objects), ShouldEqual, 1)
+		}
+	})
+
+	Dispose(dev)
+}
+
+// a simulated GetObjectPropList dataset of a directory [parentId] holding [count] files
+func makeTestObjectPropList(count int, parentId uint32) []byte {
+	var buf bytes.Buffer
+
+	props := []struct {
+		propCode, dataType uint16
+		value              func(i int) interface{}
+	}{
+		{mtp.OPC_StorageID, mtp.DTC_UINT32, func(i int) interface{} { return uint32(0x10001) }},
+		{mtp.OPC_ObjectFormat, mtp.DTC_UINT16, func(i int) interface{} { return uint16(mtp.OFC_EXIF_JPEG) }},
+		{mtp.OPC_ObjectSize, mtp.DTC_UINT64, func(i int) interface{} { return uint64(i * 1024) }},
+		{mtp.OPC_ObjectFileName, mtp.DTC_STR, func(i int) interface{} { return fmt.Sprintf("IMG_%05d.jpg", i) }},
+		{mtp.OPC_DateModified, mtp.DTC_STR, func(i int) interface{} { return "20210103T155855" }},
+		{mtp.OPC_ParentObject, mtp.DTC_UINT32, func(i int) interface{} { return parentId }},
+	}
+
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(count*len(props)))
+
+	for i := 0; i < count; i++ {
+		for _, p := range props {
+			_ = binary.Write(&buf, binary.LittleEndian, uint32(i+1))
+			_ = binary.Write(&buf, binary.LittleEndian, p.propCode)
+			_ = binary.Write(&buf, binary.LittleEndian, p.dataType)
+			_ = encodeObjectPropValue(&buf, p.value(i), p.dataType)
+		}
+	}
+
+	return buf.Bytes()
+}
+
+func TestObjectPropList(t *testing.T) {
+	Convey("Testing a simulated 5000 files directory | objectPropList", t, func() {
+		l := objectPropList{}
+		err := l.Decode(bytes.NewReader(makeTestObjectPropList(5000, 7)))
+		So(err, ShouldBeNil)
+
+		files := l.fileInfos("/DCIM")
+		So(len(files), ShouldEqual, 5000)
+		So(files[42].Name, ShouldEqual, "IMG_00042.jpg")
+		So(files[42].FullPath, ShouldEqual, "/DCIM/IMG_00042.jpg")
+		So(files[42].Size, ShouldEqual, 42*1024)
+		So(files[42].ParentId, ShouldEqual, 7)
+		So(files[42].IsDir, ShouldBeFalse)
+	})
+
+	Convey("Testing the root objects of the other storages | objectPropList.keepObjects", t, func() {
+		l := objectPropList{}
+		err := l.Decode(bytes.NewReader(makeTestObjectPropList(10, 0)))
+		So(err, ShouldBeNil)
+
+		l.keepObjects([]uint32{2, 5})
+
+		files := l.fileInfos("/")
+		So(len(files), ShouldEqual, 2)
+		So(files[0].ObjectId, ShouldEqual, 2)
+		So(files[1].ObjectId, ShouldEqual, 5)
+	})
+}
+
+// the host side cost of listing a 5000 files directory using a single GetObjectPropList transaction
+// the GetObjectInfo code path needs at least 5000 device round trips for the same directory
+func BenchmarkObjectPropList(b *testing.B) {
+	data := makeTestObjectPropList(5000, 7)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		l := objectPropList{}
+		if err := l.Decode(bytes.NewReader(data)); err != nil {
+			b.Fatal(err)
+		}
+
+		l.fileInfos("/DCIM")
+	}
+}
+
+// the host side cost of handing the bytes received from the device over to the [localFileWriterPool]
+// "allocating" copies every chunk into a new slice, which is how the chunks were handed over before the buffers were pooled
+func BenchmarkChunkWriter(b *testing.B) {
+	data := bytes.Repeat([]byte("a"), 16*1024)
+
+	b.Run("pooled", func(b *testing.B) {
+		buffers := newBufferPool(0)
+		chunks := make(chan localFileChunk, localFileWriterBufferSize/defaultTransferBufferSize)
+		done := make(chan struct{})
+
+		go func() {
+			for chunk := range chunks {
+				buffers.put(chunk.buf)
+			}
+			close(done)
+		}()
+
+		w := &chunkWriter{chunks: chunks, buffers: buffers}
+
+		b.ReportAllocs()
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			if _, err := w.Write(data); err != nil {
+				b.Fatal(err)
+			}
+		}
+
+		w.flush()
+		close(chunks)
+		<-done
+	})
+
+	b.Run("allocating", func(b *testing.B) {
+		chunks := make(chan []byte, localFileWriterBufferSize/defaultTransferBufferSize)
+		done := make(chan struct{})
+
+		go func() {
+			for range chunks {
+			}
+			close(done)
+		}()
+
+		b.ReportAllocs()
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			chunk := make([]byte, len(data))
+			copy(chunk, data)
+
+			chunks <- chunk
+		}
+
+		close(chunks)
+		<-done
+	})
+}
+
+func TestIsDeviceDisconnected(t *testing.T) {
+	Convey("Testing the errors of an unplugged device | isDeviceDisconnected", t, func() {
+		for _, e := range []error{
+			usb.ERROR_NO_DEVICE,
+			fmt.Errorf("send failed: %w", usb.ERROR_NO_DEVICE),
+			SendObjectError{error: fmt.Errorf("LIBUSB_ERROR_NO_DEVICE")},
+			FileTransferError{error: fmt.Errorf("an error occured while uploading files. %+v", "LIBUSB_ERROR_NO_DEVICE")},
+			fmt.Errorf("mtp: cannot run operation GetObject, device is not open"),
+			DeviceDisconnectedError{error: fmt.Errorf("unplugged")},
+		} {
+			So(isDeviceDisconnected(e), ShouldBeTrue)
+			So(isTransientError(e), ShouldBeFalse)
+		}
+
+		for _, e := range []error{
+			nil,
+			usb.ERROR_IO,
+			usb.ERROR_TIMEOUT,
+			mtp.RCError(mtp.RC_DeviceBusy),
+			SendObjectError{error: fmt.Errorf("usb: i/o error")},
+		} {
+			So(isDeviceDisconnected(e), ShouldBeFalse)
+		}
+	})
+
+	Convey("Testing the classification of the transfer errors | isDeviceDisconnected", t, func() {
+		err := uploadFilesError(SendObjectError{error: fmt.Errorf("LIBUSB_ERROR_NO_DEVICE")})
+		So(err, ShouldHaveSameTypeAs, DeviceDisconnectedError{})
+
+		disconnected := DeviceDisconnectedError{error: usb.ERROR_NO_DEVICE}
+		So(uploadFilesError(disconnected), ShouldResemble, disconnected)
+
+		_, _, err = processDownloadFilesError(&processDownloadFilesProps{}, fmt.Errorf("mtp: cannot run operation GetObject, device is not open"))
+		So(err, ShouldHaveSameTypeAs, DeviceDisconnectedError{})
+
+		_, _, err = processDownloadFilesError(&processDownloadFilesProps{}, usb.ERROR_IO)
+		So(err, ShouldHaveSameTypeAs, FileTransferError{})
+	})
+
+	Convey("Testing the retries of an unplugged device | withRetry", t, func() {
+		dev := &mtp.Device{}
+		SetRetryPolicy(dev, RetryPolicy{MaxRetries: 2})
+		defer deviceRetryPolicies.Delete(dev)
+
+		attempts := 0
+		err := withRetry(dev, func() error {
+			attempts += 1
+
+			return usb.ERROR_NO_DEVICE
+		})
+		So(err, ShouldEqual, usb.ERROR_NO_DEVICE)
+		So(attempts, ShouldEqual, 1)
+	})
+}
+
+func TestScanFilenames(t *testing.T) {
+	Convey("Testing the siblings which can't be read | scanFilenames", t, func() {
+		fetched := map[uint32]string{1: "a.txt", 3: "target.txt", 4: "TARGET.txt"}
+		fetchName := func(objectId uint32) (string, error) {
+			if name, ok := fetched[objectId]; ok {
+				return name, nil
+			}
+
+			return "", mtp.RCError(mtp.RC_InvalidObjectHandle)
+		}
+
+		names, objectIds, unreadable, err := scanFilenames([]uint32{1, 2, 3, 4}, "target.txt", fetchName)
+		So(err, ShouldBeNil)
+		So(names, ShouldResemble, []string{"target.txt", "TARGET.txt"})
+		So(objectIds, ShouldResemble, []uint32{3, 4})
+		So(unreadable, ShouldResemble, []uint32{2})
+
+		// the target file is still found
+		index, err := selectFilenameMatch(names, objectIds, "target.txt", FilenameMatchCaseInsensitive, false)
+		So(err, ShouldBeNil)
+		So(objectIds[index], ShouldEqual, 3)
+
+		_, _, unreadable, err = scanFilenames([]uint32{2, 5}, "target.txt", fetchName)
+		So(err, ShouldBeNil)
+		So(unreadable, ShouldResemble, []uint32{2, 5})
+	})
+
+	Convey("Testing an unplugged device | scanFilenames | It should throw an error", t, func() {
+		_, _, _, err := scanFilenames([]uint32{1, 2}, "target.txt", func(objectId uint32) (string, error) {
+			return "", fmt.Errorf("mtp: cannot run operation GetObjectPropValue, device is not open")
+		})
+		So(err, ShouldHaveSameTypeAs, DeviceDisconnectedError{})
+	})
+}
+
+func TestFlattenedLocalPath(t *testing.T) {
+	Convey("Testing the colliding names | flattenedLocalPath", t, func() {
+		claimed := map[string]bool{}
+
+		So(flattenedLocalPath("/tmp/dest", "a.txt", claimed), ShouldEqual, "/tmp/dest/a.txt")
+		So(flattenedLocalPath("/tmp/dest", "a.txt", claimed), ShouldEqual, "/tmp/dest/a (1).txt")
+		So(flattenedLocalPath("/tmp/dest", "A.TXT", claimed), ShouldEqual, "/tmp/dest/A (2).TXT")
+		So(flattenedLocalPath("/tmp/dest", "a (1).txt", claimed), ShouldEqual, "/tmp/dest/a (1) (1).txt")
+		So(flattenedLocalPath("/tmp/dest", "b", claimed), ShouldEqual, "/tmp/dest/b")
+	})
+}
+
+func TestHeadWriter(t *testing.T) {
+	Convey("Testing the leading bytes | headWriter", t, func() {
+		w := &headWriter{limit: 4}
+
+		n, err := w.Write([]byte("ab"))
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 2)
+
+		// the bytes past the limit are discarded without failing the write
+		n, err = w.Write([]byte("cdef"))
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 4)
+		So(string(w.buf), ShouldEqual, "abcd")
+	})
+}
+
+// fails every write once [limit] bytes were written
+type failingWriter struct {
+	limit int
+	n     int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.n+len(p) > w.limit {
+		return 0, fmt.Errorf("the writer is full")
+	}
+
+	w.n += len(p)
+
+	return len(p), nil
+}
+
+func TestFanOutWriter(t *testing.T) {
+	Convey("Testing the failed writer | fanOutWriter", t, func() {
+		var a, b bytes.Buffer
+		w := &fanOutWriter{writers: []io.Writer{&a, &failingWriter{limit: 3}, &b}}
+
+		n, err := w.Write([]byte("ab"))
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 2)
+		So(w.err, ShouldBeNil)
+
+		// the remaining bytes are discarded without failing the write
+		n, err = w.Write([]byte("cd"))
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 2)
+		So(w.err, ShouldHaveSameTypeAs, WriterError{})
+		So(w.err.(WriterError).Index, ShouldEqual, 1)
+
+		_, err = w.Write([]byte("ef"))
+		So(err, ShouldBeNil)
+		So(a.String(), ShouldEqual, "abcd")
+		So(b.String(), ShouldEqual, "ab")
+	})
+}
@@ -3,7 +3,9 @@ package mtpx
 import (
 	"github.com/ganeshrvel/go-mtpfs/mtp"
 	. "github.com/smartystreets/goconvey/convey"
+	"math"
 	"testing"
+	"time"
 )
 
 func TestMtpInitialize(t *testing.T) {
@@ -18,6 +20,24 @@ func TestMtpInitialize(t *testing.T) {
 		So(d.Timeout, ShouldBeGreaterThan, 1)
 	})
 
+	Convey("Testing Initialize | non matching serial number | It should throw an error", t, func() {
+		d, err := Initialize(Init{SerialNumber: "fake-serial-number"})
+
+		So(err, ShouldHaveSameTypeAs, MtpDetectFailedError{})
+		So(d, ShouldBeNil)
+	})
+
+	Convey("Testing isDeviceSelected", t, func() {
+		ui := &mtp.UsbDeviceInfo{IdVendor: 0x18d1, IdProduct: 0x4ee1, SerialNumber: "abc123"}
+
+		So(isDeviceSelected(Init{}, ui), ShouldBeTrue)
+		So(isDeviceSelected(Init{SerialNumber: "abc123"}, ui), ShouldBeTrue)
+		So(isDeviceSelected(Init{VendorId: 0x18d1, ProductId: 0x4ee1}, ui), ShouldBeTrue)
+		So(isDeviceSelected(Init{SerialNumber: "abc123", VendorId: 0x04e8}, ui), ShouldBeFalse)
+		So(isDeviceSelected(Init{ProductId: 0x0001}, ui), ShouldBeFalse)
+		So(isDeviceSelected(Init{SerialNumber: "xyz"}, ui), ShouldBeFalse)
+	})
+
 	Convey("Testing FetchDeviceInfo", t, func() {
 		info, err := FetchDeviceInfo(dev)
 
@@ -25,6 +45,41 @@ func TestMtpInitialize(t *testing.T) {
 		So(info, ShouldNotBeNil)
 	})
 
+	Convey("Testing FetchDeviceDetails", t, func() {
+		details, err := FetchDeviceDetails(dev)
+
+		So(err, ShouldBeNil)
+		So(details.Manufacturer, ShouldNotBeEmpty)
+		So(details.Model, ShouldNotBeEmpty)
+
+		info, err := FetchDeviceInfo(dev)
+		So(err, ShouldBeNil)
+		So(details.MTPVendorExtensionID, ShouldEqual, info.MTPVendorExtensionID)
+		So(details.MTPVendorExtension, ShouldEqual, info.MTPExtension)
+
+		_, err = FetchDeviceDetails(nil)
+		So(err, ShouldHaveSameTypeAs, DeviceInfoError{})
+	})
+
+	Convey("Testing GetDeviceCapabilities", t, func() {
+		c, err := GetDeviceCapabilities(dev)
+
+		So(err, ShouldBeNil)
+		So(c, ShouldNotBeNil)
+		So(len(c.Operations), ShouldBeGreaterThan, 0)
+		So(c.SupportsOperation(mtp.OC_GetObject), ShouldBeTrue)
+		So(c.SupportsOperation(0xFFFF), ShouldBeFalse)
+
+		info, err := FetchDeviceInfo(dev)
+		So(err, ShouldBeNil)
+		So(c.Operations, ShouldResemble, info.OperationsSupported)
+
+		// the capabilities are cached
+		c2, err := GetDeviceCapabilities(dev)
+		So(err, ShouldBeNil)
+		So(c2, ShouldEqual, c)
+	})
+
 	Convey("Testing FetchStorages", t, func() {
 		storages, err := FetchStorages(dev)
 
@@ -32,7 +87,74 @@ func TestMtpInitialize(t *testing.T) {
 
 		So(err, ShouldBeNil)
 		So(sid, ShouldEqual, 0x10001)
+
+		for _, s := range storages {
+			So(s.Sid, ShouldBeGreaterThan, 0)
+			So(s.Ready, ShouldEqual, s.Info.MaxCapability > 0)
+
+			if s.Ready {
+				So(s.Info.FreeSpaceInBytes, ShouldBeLessThanOrEqualTo, s.Info.MaxCapability)
+			}
+		}
 	})
 
-	Dispose(dev)
+	Convey("Testing WaitForStorage", t, func() {
+		err := WaitForStorage(dev, sid, 5*time.Second)
+		So(err, ShouldBeNil)
+
+		start := time.Now()
+		err = WaitForStorage(dev, 0xFFFFFFFF, 500*time.Millisecond)
+		So(err, ShouldHaveSameTypeAs, StorageNotReadyError{})
+		So(time.Since(start), ShouldBeGreaterThanOrEqualTo, 500*time.Millisecond)
+	})
+
+	Convey("Testing CheckFreeSpace", t, func() {
+		err := CheckFreeSpace(dev, sid, 1)
+		So(err, ShouldBeNil)
+
+		err = CheckFreeSpace(dev, sid, math.MaxInt64)
+		So(err, ShouldHaveSameTypeAs, InsufficientSpaceError{})
+	})
+
+	Convey("Testing SelectStorageForUpload", t, func() {
+		storageId, err := SelectStorageForUpload(dev, 1)
+		So(err, ShouldBeNil)
+		So(CheckFreeSpace(dev, storageId, 1), ShouldBeNil)
+
+		_, err = SelectStorageForUpload(dev, math.MaxInt64)
+		So(err, ShouldHaveSameTypeAs, InsufficientSpaceError{})
+	})
+
+	Convey("Testing CountObjectsForStorage", t, func() {
+		count, err := CountObjectsForStorage(dev, sid)
+		So(err, ShouldBeNil)
+
+		// the storage holds at least the test directory '/mtp-test-files/mock_dir1' and its 9 descendants
+		So(count, ShouldBeGreaterThanOrEqualTo, 10)
+
+		_, err = CountObjectsForStorage(dev, 0xFFFFFFFE)
+		So(err, ShouldHaveSameTypeAs, StorageInfoError{})
+	})
+
+	Convey("Testing IsStorageWritable", t, func() {
+		writable, err := IsStorageWritable(dev, sid)
+		So(err, ShouldBeNil)
+		So(writable, ShouldBeTrue)
+
+		// the writable storage passes the check
+		SetCheckStorageWritable(dev, true)
+		defer SetCheckStorageWritable(dev, false)
+
+		So(checkStorageWritable(dev, sid, false), ShouldBeNil)
+
+		_, err = MakeDirectory(dev, sid, "/mtp-test-files/temp_dir/test-IsStorageWritable")
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Testing Dispose", t, func() {
+		So(Dispose(dev), ShouldBeNil)
+
+		// disposing the device again is a no-op
+		So(Dispose(dev), ShouldBeNil)
+	})
 }
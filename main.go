@@ -1,11 +1,18 @@
 package mtpx
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"github.com/ganeshrvel/go-mtpfs/mtp"
+	"io"
+	"math"
+	"net/http"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 )
@@ -14,9 +21,17 @@ import (
 // todo: hotplug
 
 // initialize the mtp device
-// returns mtp device
+// the connected MTP devices are enumerated and the one matching [init.SerialNumber], [init.VendorId] and [init.ProductId] is selected;
+// the empty selectors match any device
+// a [MultipleDevicesError] listing the matching devices is returned if more than one device matches
+// returns mtp device with an open session; use [Dispose] to release it
 func Initialize(init Init) (*mtp.Device, error) {
-	dev, err := mtp.SelectDeviceWithDebugging("", init.DebugMode)
+	pattern, err := findDevicePattern(init)
+	if err != nil {
+		return nil, err
+	}
+
+	dev, err := mtp.SelectDeviceWithDebugging(pattern, init.DebugMode)
 
 	if err != nil {
 		return nil, MtpDetectFailedError{error: err}
@@ -32,18 +47,49 @@ func Initialize(init Init) (*mtp.Device, error) {
 		return nil, ConfigureError{error: err}
 	}
 
+	SetRetryPolicy(dev, init.RetryPolicy)
+	SetFilenamePolicy(dev, init.FilenamePolicy)
+	SetPreferFirstDuplicate(dev, init.PreferFirstDuplicate)
+	SetFilenameNormalizer(dev, init.FilenameNormalizer)
+	SetCheckStorageWritable(dev, init.CheckStorageWritable)
+	SetPerCallTimeout(dev, init.PerCallTimeout)
+	initializedDevices.Store(dev, true)
+
 	return dev, nil
 }
 
 // close the mtp device
-func Dispose(dev *mtp.Device) {
-	dev.Close()
+// the session is closed and the USB interface is released
+// the libusb reference of the device is released only if it was created by [Initialize],
+// so [Dispose] may be called more than once
+func Dispose(dev *mtp.Device) error {
+	deviceCapabilitiesCache.Delete(dev)
+	deviceRetryPolicies.Delete(dev)
+	deviceFilenamePolicies.Delete(dev)
+	devicePreferFirstDuplicate.Delete(dev)
+	deviceFilenameNormalizers.Delete(dev)
+	deviceCheckStorageWritable.Delete(dev)
+	deviceWritableObjectProps.Delete(dev)
+	devicePerCallTimeouts.Delete(dev)
+	deviceStalledTransactions.Delete(dev)
+	deviceCacheInvalidators.Delete(dev)
+	deviceSupportedObjectProps.Delete(dev)
+
+	err := dev.Close()
+
+	if _, ok := initializedDevices.LoadAndDelete(dev); ok {
+		dev.Done()
+	}
+
+	return err
 }
 
 // fetch device Info
 func FetchDeviceInfo(dev *mtp.Device) (*mtp.DeviceInfo, error) {
 	info := mtp.DeviceInfo{}
-	err := dev.GetDeviceInfo(&info)
+	err := withCallTimeout(dev, nil, func() error {
+		return dev.GetDeviceInfo(&info)
+	})
 
 	if err != nil {
 		return nil, DeviceInfoError{error: err}
@@ -52,10 +98,37 @@ func FetchDeviceInfo(dev *mtp.Device) (*mtp.DeviceInfo, error) {
 	return &info, nil
 }
 
+// fetch the manufacturer, model, serial number and the vendor extension of the device
+// it can be called right after [Initialize], before any file operation
+// a [DeviceInfoError] is returned if [dev] is nil or the device didn't respond to GetDeviceInfo
+func FetchDeviceDetails(dev *mtp.Device) (*DeviceDetails, error) {
+	if dev == nil {
+		return nil, DeviceInfoError{error: fmt.Errorf("the device is not initialized")}
+	}
+
+	info, err := FetchDeviceInfo(dev)
+	if err != nil {
+		return nil, DeviceInfoError{error: fmt.Errorf("the device handshake has not completed: %v", err)}
+	}
+
+	return &DeviceDetails{
+		Manufacturer:         strings.TrimSpace(info.Manufacturer),
+		Model:                strings.TrimSpace(info.Model),
+		SerialNumber:         strings.TrimSpace(info.SerialNumber),
+		DeviceVersion:        strings.TrimSpace(info.DeviceVersion),
+		MTPVendorExtensionID: info.MTPVendorExtensionID,
+		MTPVendorExtension:   info.MTPExtension,
+	}, nil
+}
+
 // fetch storages
+// all the storages of the device (eg: internal storage and SD card) are listed along with their [mtp.StorageInfo]
+// the storages which report 0 capacity are included with [StorageData.Ready] set to false
 func FetchStorages(dev *mtp.Device) ([]StorageData, error) {
 	sids := mtp.Uint32Array{}
-	if err := dev.GetStorageIDs(&sids); err != nil {
+	if err := withCallTimeout(dev, nil, func() error {
+		return dev.GetStorageIDs(&sids)
+	}); err != nil {
 		return nil, StorageInfoError{error: err}
 	}
 
@@ -67,33 +140,198 @@ func FetchStorages(dev *mtp.Device) ([]StorageData, error) {
 
 	for _, sid := range sids.Values {
 		var info mtp.StorageInfo
-		if err := dev.GetStorageInfo(sid, &info); err != nil {
+		if err := withCallTimeout(dev, nil, func() error {
+			return dev.GetStorageInfo(sid, &info)
+		}); err != nil {
 			return nil, StorageInfoError{error: err}
 		}
 
 		result = append(result, StorageData{
-			Sid:  sid,
-			Info: info,
+			Sid:   sid,
+			Info:  info,
+			Ready: info.MaxCapability > 0,
 		})
 	}
 
 	return result, nil
 }
 
-// create a new directory recursively using [fullPath]
-// The path will be created if it does not Exists
+// block until the storage [storageId] reports a non zero capacity or the [timeout] elapses
+// the storages of a freshly connected device report 0 capacity until the filesystem is mounted
+// the errors of GetStorageInfo are treated as not ready as the storage may not be available yet
+// returns a [StorageNotReadyError] on timeout
+func WaitForStorage(dev *mtp.Device, storageId uint32, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		var info mtp.StorageInfo
+		err := withCallTimeout(dev, nil, func() error {
+			return dev.GetStorageInfo(storageId, &info)
+		})
+		if err == nil && info.MaxCapability > 0 {
+			return nil
+		}
+
+		if !time.Now().Before(deadline) {
+			if err != nil {
+				return StorageNotReadyError{error: fmt.Errorf("storage %d is not ready after %v: %v", storageId, timeout, err)}
+			}
+
+			return StorageNotReadyError{error: fmt.Errorf("storage %d is not ready after %v", storageId, timeout)}
+		}
+
+		time.Sleep(storageReadyPollInterval)
+	}
+}
+
+// check if the storage [storageId] has at least [requiredBytes] of free space
+// returns an [InsufficientSpaceError] if the free space is less than [requiredBytes]
+func CheckFreeSpace(dev *mtp.Device, storageId uint32, requiredBytes int64) error {
+	var info mtp.StorageInfo
+	if err := withCallTimeout(dev, nil, func() error {
+		return dev.GetStorageInfo(storageId, &info)
+	}); err != nil {
+		return StorageInfoError{error: err}
+	}
+
+	if requiredBytes > 0 && uint64(requiredBytes) > info.FreeSpaceInBytes {
+		return InsufficientSpaceError{
+			error: fmt.Errorf("insufficient space on the storage. required: %d bytes, available: %d bytes", requiredBytes, info.FreeSpaceInBytes),
+		}
+	}
+
+	return nil
+}
+
+// check if the objects of the storage [storageId] can be created, modified and deleted using its AccessCapability
+func IsStorageWritable(dev *mtp.Device, storageId uint32) (bool, error) {
+	var info mtp.StorageInfo
+	if err := withCallTimeout(dev, nil, func() error {
+		return dev.GetStorageInfo(storageId, &info)
+	}); err != nil {
+		return false, StorageInfoError{error: err}
+	}
+
+	return info.AccessCapability == mtp.AC_ReadWrite, nil
+}
+
+// pick the writable storage which can hold [requiredBytes], preferring the one with the most free space
+// the read-only storages and the ones which aren't ready (see [StorageData.Ready]) are skipped
+// returns an [InsufficientSpaceError] if no single storage has at least [requiredBytes] of free space
+func SelectStorageForUpload(dev *mtp.Device, requiredBytes int64) (uint32, error) {
+	storages, err := FetchStorages(dev)
+	if err != nil {
+		return 0, err
+	}
+
+	var storageId uint32
+	var freeSpace uint64
+	found := false
+
+	for _, s := range storages {
+		if !s.Ready || s.Info.AccessCapability != mtp.AC_ReadWrite {
+			continue
+		}
+
+		if requiredBytes > 0 && uint64(requiredBytes) > s.Info.FreeSpaceInBytes {
+			continue
+		}
+
+		if !found || s.Info.FreeSpaceInBytes > freeSpace {
+			storageId = s.Sid
+			freeSpace = s.Info.FreeSpaceInBytes
+			found = true
+		}
+	}
+
+	if !found {
+		return 0, InsufficientSpaceError{
+			error: fmt.Errorf("insufficient space on the storages. no writable storage has %d bytes available", requiredBytes),
+		}
+	}
+
+	return storageId, nil
+}
+
+// count all the objects (files and directories, recursively) of the storage [storageId] without walking it
+// GetNumObjects is used if the device supports it, otherwise the handles of all the objects are listed using GetObjectHandles
+// note: the count isn't a part of [FetchStorages] as it may take a while on a large storage
+func CountObjectsForStorage(dev *mtp.Device, storageId uint32) (int64, error) {
+	supported, err := isOperationSupported(dev, mtp.OC_GetNumObjects)
+	if err != nil {
+		return 0, err
+	}
+
+	// a parent of 0 selects the objects of the whole storage
+	const allObjects = 0
+
+	if supported {
+		var count uint32
+		if err := withRetry(dev, func() (err error) {
+			return withCallTimeout(dev, nil, func() (err error) {
+				count, err = dev.GetNumObjects(storageId, mtp.GOH_ALL_FORMATS, allObjects)
+
+				return err
+			})
+		}); err != nil {
+			return 0, StorageInfoError{error: err}
+		}
+
+		return int64(count), nil
+	}
+
+	handles := mtp.Uint32Array{}
+	if err := withRetry(dev, func() error {
+		return withCallTimeout(dev, nil, func() error {
+			return dev.GetObjectHandles(storageId, mtp.GOH_ALL_FORMATS, allObjects, &handles)
+		})
+	}); err != nil {
+		return 0, StorageInfoError{error: err}
+	}
+
+	return int64(len(handles.Values)), nil
+}
+
+// create a new directory recursively using [fullPath] (mkdir -p)
+// The path will be created if it does not Exists; the missing intermediate directories are created and the existing ones are reused
+// returns the objectId of the last directory in the [fullPath]
+// if a path component exists but is a file then an [InvalidPathError] is returned
+// the path components are checked against the [FilenamePolicy] of the device
 func MakeDirectory(dev *mtp.Device, storageId uint32, fullPath string) (objectId uint32, err error) {
-	_fullPath := fixSlash(fullPath)
+	if err := checkStorageWritable(dev, storageId, false); err != nil {
+		return 0, err
+	}
+
+	return makeDirectory(dev, storageId, fullPath)
+}
+
+// helper function of [MakeDirectory]; the storage isn't checked using [checkStorageWritable]
+func makeDirectory(dev *mtp.Device, storageId uint32, fullPath string) (objectId uint32, err error) {
+	_fullPath, err := NormalizePath(fullPath)
+	if err != nil {
+		return 0, err
+	}
 
 	if _fullPath == PathSep {
 		return ParentObjectId, nil
 	}
+
 	splittedFullPath := strings.Split(_fullPath, PathSep)
 
 	objectId = uint32(ParentObjectId)
 	const skipIndex = 1
 
+	// path of the current component
+	currentPath := PathSep
+
 	for _, fName := range splittedFullPath[skipIndex:] {
+		fName, err := checkFilename(dev, fName)
+		if err != nil {
+			return 0, err
+		}
+
+		currentPath = getFullPath(currentPath, fName)
+
 		// fetch the parent object and
 		fi, err := GetObjectFromParentIdAndFilename(dev, storageId, objectId, fName)
 
@@ -116,7 +354,7 @@ func MakeDirectory(dev *mtp.Device, storageId uint32, fullPath string) (objectId
 
 		// if the object Exists but if it's a file then throw an error
 		if !fi.IsDir {
-			return 0, InvalidPathError{error: fmt.Errorf("invalid path: %s. The object is not a directory", fName)}
+			return 0, InvalidPathError{error: fmt.Errorf("invalid path: %s. The object %s is a file, not a directory", _fullPath, currentPath)}
 		}
 
 		objectId = fi.ObjectId
@@ -126,27 +364,56 @@ func MakeDirectory(dev *mtp.Device, storageId uint32, fullPath string) (objectId
 }
 
 // List the contents in a directory
+// [ctx] can be used to cancel a long running walk; a canceled or expired [ctx] returns a [WalkCanceledError]
 // use [recursive] to fetch the whole nested tree
 // Tip: use [objectId] whenever possible to avoid traversing down the whole file tree to process and find the [objectId]
 // if [skipDisallowedFiles] is true then files matching the [disallowedFiles] list will be ignored
+// the objects with the OPC_Hidden property set are listed; use [WalkWithOpts] to ignore them
 // if [skipHiddenFiles] is true then hidden files (unix style) will be ignored
+// the objects which couldn't be read are skipped; use [WalkWithOpts] to handle them
 // return:
 // [objectId]: objectId of the file/diectory
 // [totalFiles]: total number of files
 // [totalDirectories]: total number of directories
-func Walk(dev *mtp.Device, storageId uint32, fullPath string, recursive, skipDisallowedFiles,
+func Walk(ctx context.Context, dev *mtp.Device, storageId uint32, fullPath string, recursive, skipDisallowedFiles,
 	skipHiddenFiles bool, cb WalkCb) (objectId uint32, totalFiles, totalDirectories int64, err error) {
+	objectId, totalFiles, totalDirectories, _, err = WalkWithOpts(ctx, dev, storageId, fullPath, WalkOpts{
+		Recursive:           recursive,
+		SkipDisallowedFiles: skipDisallowedFiles,
+		SkipHiddenFiles:     skipHiddenFiles,
+		IncludeHidden:       true,
+	}, cb)
+
+	return objectId, totalFiles, totalDirectories, err
+}
+
+// List the contents in a directory
+// same as [Walk] but the behaviour is controlled using [opts]
+// the objects with the OPC_Hidden property set are ignored unless [opts.IncludeHidden] is true
+// if [opts.ReportErrors] is true then [cb] is invoked with the error of an object which couldn't be read
+// and the walk is aborted if [cb] returns an error; the [FileInfo] of such an object only has the [ObjectId], [ParentId] and [ParentPath]
+// return:
+// [objectId]: objectId of the file/diectory
+// [totalFiles]: total number of files
+// [totalDirectories]: total number of directories
+// [skippedCount]: total number of the objects which couldn't be read
+func WalkWithOpts(ctx context.Context, dev *mtp.Device, storageId uint32, fullPath string, opts WalkOpts, cb WalkCb) (objectId uint32, totalFiles, totalDirectories, skippedCount int64, err error) {
+	// return early if the [ctx] is already canceled or has expired
+	if err := ctx.Err(); err != nil {
+		return 0, totalFiles, totalDirectories, skippedCount, WalkCanceledError{error: err}
+	}
+
 	// fetch the objectId from [objectId] and/or [fullPath] parameters
 	fi, err := GetObjectFromPath(dev, storageId, fullPath)
 	if err != nil {
-		return 0, totalFiles, totalDirectories, err
+		return 0, totalFiles, totalDirectories, skippedCount, err
 	}
 
 	// if the object file name matches [disallowedFiles] list then return an error
-	if skipDisallowedFiles {
+	if opts.SkipDisallowedFiles {
 		fName := (*fi).Name
-		if ok := isDisallowedFiles(fName); ok {
-			return 0, totalFiles, totalDirectories, InvalidPathError{error: fmt.Errorf("disallowed file %v", fName)}
+		if ok := isDisallowedFiles(opts.DisallowedFiles, fName); ok {
+			return 0, totalFiles, totalDirectories, skippedCount, InvalidPathError{error: fmt.Errorf("disallowed file %v", fName)}
 		}
 	}
 
@@ -154,549 +421,2649 @@ func Walk(dev *mtp.Device, storageId uint32, fullPath string, recursive, skipDis
 	if !fi.IsDir {
 		err := cb(fi.ObjectId, fi, nil)
 		if err != nil {
-			return 0, totalFiles, totalDirectories, err
+			return 0, totalFiles, totalDirectories, skippedCount, err
 		}
 
 		totalFiles += 1
 
-		return fi.ObjectId, 1, totalDirectories, nil
+		return fi.ObjectId, 1, totalDirectories, skippedCount, nil
 	}
 
-	totalFiles, totalDirectories, err = proccessWalk(dev, storageId, FileProp{fi.ObjectId, fullPath}, recursive, skipDisallowedFiles, skipHiddenFiles, cb)
+	totalFiles, totalDirectories, skippedCount, err = proccessWalk(
+		ctx, dev, storageId, FileProp{fi.ObjectId, fullPath}, walkProps{
+			recursive:           opts.Recursive,
+			skipDisallowedFiles: opts.SkipDisallowedFiles,
+			skipHiddenFiles:     opts.SkipHiddenFiles,
+			skipHiddenObjects:   !opts.IncludeHidden,
+			skipErrors:          !opts.ReportErrors,
+			disallowedFiles:     opts.DisallowedFiles,
+		}, cb,
+	)
 	if err != nil {
-		return 0, totalFiles, totalDirectories, err
+		return 0, totalFiles, totalDirectories, skippedCount, err
 	}
 
-	return fi.ObjectId, totalFiles, totalDirectories, nil
+	return fi.ObjectId, totalFiles, totalDirectories, skippedCount, nil
 }
 
-// check if a file Exists
-// returns Exists: bool, isDir: bool, objectId: uint32
-// Since the [parentPath] is unavailable here the [fullPath] property of the resulting object [FileInfo] may not be valid.
-func FileExists(dev *mtp.Device, storageId uint32, fileProps []FileProp) (fc []FileExistsContainer, err error) {
-	for _, fileProp := range fileProps {
-		fi, err := GetObjectFromObjectIdOrPath(dev, storageId, fileProp)
+// List the contents in a directory
+// same as [WalkWithOpts] but the totals are returned as a [WalkStats] along with the nesting levels of the walked objects
+// the objects which couldn't be read are counted in [WalkStats.SkippedCount] only
+func WalkWithStats(ctx context.Context, dev *mtp.Device, storageId uint32, fullPath string, opts WalkOpts, cb WalkCb) (objectId uint32, stats WalkStats, err error) {
+	_fullPath, err := NormalizePath(fullPath)
+	if err != nil {
+		return 0, stats, err
+	}
 
-		c := FileExistsContainer{}
-		if err != nil {
-			switch v := err.(type) {
-			case InvalidPathError:
-				c.Exists = false
+	rootDepth := pathDepth(_fullPath)
 
-			case FileObjectError:
-				switch v1 := v.error.(type) {
-				case mtp.RCError:
-					if v1 == 0x2009 {
-						c.Exists = false
-					}
+	objectId, stats.TotalFiles, stats.TotalDirectories, stats.SkippedCount, err = WalkWithOpts(ctx, dev, storageId, _fullPath, opts,
+		func(objectId uint32, fi *FileInfo, err error) error {
+			if err == nil {
+				depth := pathDepth(fi.ParentPath) - rootDepth + 1
+				if depth < 0 {
+					depth = 0
 				}
 
-			default:
-				return []FileExistsContainer{}, nil
-			}
+				for len(stats.DepthCounts) <= depth {
+					stats.DepthCounts = append(stats.DepthCounts, 0)
+				}
 
-		} else {
-			c.Exists = true
-			c.FileInfo = fi
-		}
+				stats.DepthCounts[depth] += 1
+				if depth > stats.MaxDepth {
+					stats.MaxDepth = depth
+				}
+			}
 
-		fc = append(fc, c)
-	}
+			return cb(objectId, fi, err)
+		})
 
-	return fc, nil
+	return objectId, stats, err
 }
 
-// Delete a file/directory
-// [objectId] and [fullPath] are optional parameters
-// if [objectId] is not available then [fullPath] will be used to fetch the [objectId]
-// dont leave both [objectId] and [fullPath] empty
+// List the contents in a directory whose object format (mtp.OFC_*) is one of [formats] (eg: mtp.OFC_EXIF_JPEG, mtp.OFC_MTP_MP4)
+// all the directories are traversed (if [recursive] is true) regardless of the [formats] so that the nested objects are found;
+// the directories are passed to [cb] only if mtp.OFC_Association is one of [formats]
+// files matching the [disallowedFiles] list are ignored
 // Tip: use [objectId] whenever possible to avoid traversing down the whole file tree to process and find the [objectId]
-func DeleteFile(dev *mtp.Device, storageId uint32, fileProps []FileProp) error {
-	for _, fileProp := range fileProps {
-		fc, err := FileExists(dev, storageId, []FileProp{fileProp})
+// return:
+// [totalFiles]: total number of matching files
+// [totalDirectories]: total number of matching directories
+func WalkByFormat(dev *mtp.Device, storageId, objectId uint32, fullPath string, formats []uint16, recursive bool, cb WalkCb) (totalFiles, totalDirectories int64, err error) {
+	if len(formats) < 1 {
+		return totalFiles, totalDirectories, InvalidPathError{error: fmt.Errorf("invalid formats: at least one object format is required")}
+	}
+
+	formatSet := map[uint16]bool{}
+	for _, f := range formats {
+		formatSet[f] = true
+	}
+
+	fi, err := GetObjectFromObjectIdOrPath(dev, storageId, FileProp{objectId, fullPath})
+	if err != nil {
+		return totalFiles, totalDirectories, err
+	}
+
+	// the [FullPath] of [fi] isn't valid if only the [objectId] is available
+	if fullPath == "" {
+		fi.FullPath, err = ResolveObjectPath(dev, storageId, fi.ObjectId)
 		if err != nil {
-			return nil
+			return totalFiles, totalDirectories, err
 		}
+	}
 
-		if !fc[0].Exists {
+	formatCb := func(objectId uint32, fi *FileInfo, err error) error {
+		if err != nil {
+			return cb(objectId, fi, err)
+		}
+
+		if !formatSet[fi.Info.ObjectFormat] {
 			return nil
 		}
 
-		if err := dev.DeleteObject(fc[0].FileInfo.ObjectId); err != nil {
-			return FileObjectError{error: err}
+		if fi.IsDir {
+			totalDirectories += 1
+		} else {
+			totalFiles += 1
+		}
+
+		return cb(objectId, fi, nil)
+	}
+
+	// if the object is a file then match it against the [formats]
+	if !fi.IsDir {
+		if err := formatCb(fi.ObjectId, fi, nil); err != nil {
+			return totalFiles, totalDirectories, err
 		}
+
+		return totalFiles, totalDirectories, nil
 	}
 
-	return nil
+	if _, _, _, err = proccessWalk(context.Background(), dev, storageId, FileProp{fi.ObjectId, fi.FullPath}, walkProps{recursive: recursive, skipDisallowedFiles: true, skipErrors: true}, formatCb); err != nil {
+		return totalFiles, totalDirectories, err
+	}
+
+	return totalFiles, totalDirectories, nil
 }
 
-// Rename a file/directory
-// [objectId] and [fullPath] are optional parameters
-// if [objectId] is not available then [fullPath] will be used to fetch the [objectId]
-// dont leave both [objectId] and [fullPath] empty
+// Calculate the total size of the files inside a directory, recursively
+// files matching the [disallowedFiles] list are ignored, same as [Walk]
+// if the object is a file then its own size is returned
 // Tip: use [objectId] whenever possible to avoid traversing down the whole file tree to process and find the [objectId]
-// return
-// [objectId]: objectId of the file/diectory
-func RenameFile(dev *mtp.Device, storageId uint32, fileProp FileProp, newFileName string) (objectId uint32, err error) {
-	fc, err := FileExists(dev, storageId, []FileProp{fileProp})
+// return:
+// [totalBytes]: total size of the files
+// [fileCount]: total number of files (directory count not included)
+func DirectorySize(dev *mtp.Device, storageId, objectId uint32, fullPath string) (totalBytes int64, fileCount int, err error) {
+	fi, err := GetObjectFromObjectIdOrPath(dev, storageId, FileProp{objectId, fullPath})
 	if err != nil {
-		return 0, err
+		return 0, 0, err
 	}
 
-	if !fc[0].Exists {
-		return 0, InvalidPathError{error: fmt.Errorf("file not found: %s", fileProp.FullPath)}
+	if !fi.IsDir {
+		if isDisallowedFiles(nil, fi.Name) {
+			return 0, 0, nil
+		}
+
+		return fi.Size, 1, nil
 	}
 
-	fi := fc[0].FileInfo
+	// the sizes are fetched by [GetObjectFromObjectId] using [GetFileSize] so that the files larger than 4GB are handled
+	totalFiles, _, _, err := proccessWalk(context.Background(), dev, storageId, FileProp{fi.ObjectId, fullPath}, walkProps{recursive: true, skipDisallowedFiles: true, skipErrors: true},
+		func(objectId uint32, fi *FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
 
-	if err := dev.SetObjectPropValue(fi.ObjectId, mtp.OPC_ObjectFileName, &mtp.StringValue{Value: newFileName}); err != nil {
-		switch v := err.(type) {
-		case mtp.RCError:
-			if v == 0x2002 {
-				return fi.ObjectId, nil
+			if !fi.IsDir {
+				totalBytes += fi.Size
 			}
-		}
 
-		return 0, FileObjectError{error: err}
+			return nil
+		},
+	)
+	if err != nil {
+		return 0, 0, err
 	}
 
-	return fi.ObjectId, nil
+	return totalBytes, int(totalFiles), nil
 }
 
-// Transfer files from the local disk to the device
-// sources: can be the list of files/directories that are to be sent to the device
-// destination: fullPath to the destination directory
-// preprocessFiles: if enabled, will fetch the total file size and count of the source. Use this will caution as it may take a few seconds to minutes to procress the files.
-// return:
-// [destinationObjectId]: objectId of [destination] directory
-// [bulkFilesSent]: total transferred files (directory count not included)
-// [bulkSizeSent]: total size of the uploaded files
-func UploadFiles(dev *mtp.Device, storageId uint32, sources []string, destination string, preprocessFiles bool, preprocessCb LocalPreprocessCb, progressCb ProgressCb) (destinationObjectId uint32, bulkFilesSent int64, bulkSizeSent int64, err error) {
-	_destination := fixSlash(destination)
+// Count the files and the directories inside the directory [objectId]
+// only the object handles and the object format of the children are fetched instead of their whole object info,
+// so it is much cheaper than a [Walk] when only the counts are needed
+// use [recursive] to count the whole nested tree
+// if the object is a file then it is counted as a single file
+// note: unlike [Walk], the [disallowedFiles] list isn't applied as the filenames aren't fetched
+func CountObjects(dev *mtp.Device, storageId, objectId uint32, recursive bool) (files int, directories int, err error) {
+	objectId = fixParentId(objectId)
+
+	if objectId != ParentObjectId {
+		format, err := getObjectFormat(dev, objectId)
+		if err != nil {
+			return 0, 0, err
+		}
 
-	pInfo := ProgressInfo{
-		FileInfo:          &FileInfo{},
-		StartTime:         time.Now(),
-		LatestSentTime:    time.Now(),
-		Speed:             0,
-		TotalFiles:        0,
-		TotalDirectories:  0,
-		FilesSent:         0,
-		FilesSentProgress: 0,
-		ActiveFileSize:    &TransferSizeInfo{},
-		BulkFileSize:      &TransferSizeInfo{},
-		Status:            InProgress,
+		if format != mtp.OFC_Association {
+			return 1, 0, nil
+		}
 	}
 
-	// if [preprocessFiles] is true then fetch the total number of files from the file tree
-	// total number of files in the current upload session
-	// if [preprocessFiles] is false then [totalFiles] is 0
-	var totalFiles int64 = 0
-
-	// if [preprocessFiles] is true then fetch the total number of files from the file tree
-	// total number of directories in the current upload session
-	// if [preprocessFiles] is false then [totalDirectories] is 0
-	var totalDirectories int64 = 0
-
-	// if [preprocessFiles] is true then fetch the total number of files from the file tree
-	// 	// total size of all the files combined in the current upload session
-	// if [preprocessFiles] is false then [totalDirectories] is 0
-	var totalSize int64 = 0
+	return proccessCount(dev, storageId, objectId, recursive)
+}
 
-	// keep track of [bulkSizeSent]
-	bulkSizeSent = 0
+// List the objectIds of the immediate children of the directory [parentId] without fetching their object info
+// use [ParentObjectId] (or 0) to list the root directory of the storage
+// the objectIds are returned in the order listed by the device; the [disallowedFiles] list isn't applied
+func ListHandles(dev *mtp.Device, storageId, parentId uint32) ([]uint32, error) {
+	return ListHandlesByFormat(dev, storageId, parentId, mtp.GOH_ALL_FORMATS)
+}
 
-	if preprocessFiles {
-		_totalFiles, _totalDirectories, _totalSize, err := walkLocalFiles(sources, func(fi *os.FileInfo, fullPath string, err error) error {
-			if err != nil {
-				return err
-			}
+// List the objectIds of the immediate children of the directory [parentId] whose object format (mtp.OFC_*) is [format]
+// same as [ListHandles] but the children are filtered by the device;
+// if the device doesn't support filtering by the format then the format of each child is fetched and the objectIds are sorted
+func ListHandlesByFormat(dev *mtp.Device, storageId, parentId uint32, format uint16) ([]uint32, error) {
+	parentId = fixParentId(parentId)
 
-			if (*fi).IsDir() {
-				return nil
-			}
+	handles := mtp.Uint32Array{}
+	err := withRetry(dev, func() error {
+		return withCallTimeout(dev, nil, func() error {
+			return dev.GetObjectHandles(storageId, uint32(format), parentId, &handles)
+		})
+	})
+	if err == nil {
+		return handles.Values, nil
+	}
 
-			if err = preprocessCb(fi, fullPath, nil); err != nil {
-				return err
-			}
+	if e, ok := retryCause(err).(mtp.RCError); !ok || e != mtp.RC_SpecificationByFormatUnsupported || format == mtp.GOH_ALL_FORMATS {
+		return nil, ListDirectoryError{error: err}
+	}
 
-			return nil
-		})
+	formats, err := listObjectFormats(dev, storageId, parentId)
+	if err != nil {
+		return nil, err
+	}
 
-		if err != nil {
-			return 0, bulkFilesSent, bulkSizeSent, err
+	var objectIds []uint32
+	for objectId, f := range formats {
+		if f == format {
+			objectIds = append(objectIds, objectId)
 		}
-
-		totalFiles = _totalFiles
-		totalDirectories = _totalDirectories
-		totalSize = _totalSize
 	}
+	sortUint32s(objectIds)
 
-	destParentId, err := MakeDirectory(dev, storageId, _destination)
+	return objectIds, nil
+}
+
+// List the immediate children of the directory [objectId] or [fullPath]
+// the children are sorted with the directories first and then by their filename
+// files matching the [disallowedFiles] list are ignored
+// Tip: use [objectId] whenever possible to avoid traversing down the whole file tree to process and find the [objectId]
+func ReadDir(dev *mtp.Device, storageId, objectId uint32, fullPath string) ([]*FileInfo, error) {
+	fi, err := GetObjectFromObjectIdOrPath(dev, storageId, FileProp{objectId, fullPath})
 	if err != nil {
-		return 0, bulkFilesSent, bulkSizeSent, err
+		return nil, err
+	}
+
+	if !fi.IsDir {
+		return nil, InvalidPathError{error: fmt.Errorf("invalid path: %s. not a directory", fi.FullPath)}
+	}
+
+	// the [FullPath] of [fi] isn't valid if only the [objectId] is available
+	if fullPath == "" {
+		fi.FullPath, err = ResolveObjectPath(dev, storageId, fi.ObjectId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	children, err := listDir(dev, storageId, fi.ObjectId, fi.FullPath)
+	if err != nil {
+		return nil, err
+	}
+
+	sortDirEntries(children)
+
+	return children, nil
+}
+
+// List a page of the immediate children of the directory [objectId] or [fullPath] sorted by [sortBy]
+// only the sort keys of the children are fetched for the whole directory; the [FileInfo] is fetched only for the children of the page
+// the ties are broken by the filename; files matching the [disallowedFiles] list are ignored
+// if [limit] is less than 1 then all the children after [offset] are returned
+// Tip: use [objectId] whenever possible to avoid traversing down the whole file tree to process and find the [objectId]
+// return:
+// [totalCount]: total number of the children in the directory
+func ReadDirPage(dev *mtp.Device, storageId, objectId uint32, fullPath string, offset, limit int, sortBy SortField) (page []*FileInfo, totalCount int, err error) {
+	if offset < 0 {
+		return nil, 0, InvalidPathError{error: fmt.Errorf("invalid offset: %d", offset)}
+	}
+
+	less, err := dirPageEntryLess(sortBy)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	fi, err := GetObjectFromObjectIdOrPath(dev, storageId, FileProp{objectId, fullPath})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if !fi.IsDir {
+		return nil, 0, InvalidPathError{error: fmt.Errorf("invalid path: %s. not a directory", fi.FullPath)}
+	}
+
+	// the [FullPath] of [fi] isn't valid if only the [objectId] is available
+	if fullPath == "" {
+		fi.FullPath, err = ResolveObjectPath(dev, storageId, fi.ObjectId)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	entries, err := listDirPageEntries(dev, storageId, fi.ObjectId, fi.FullPath, sortBy)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return less(&entries[i], &entries[j])
+	})
+
+	totalCount = len(entries)
+	if offset >= totalCount {
+		return []*FileInfo{}, totalCount, nil
+	}
+
+	end := totalCount
+	if limit > 0 && offset+limit < totalCount {
+		end = offset + limit
+	}
+
+	page = make([]*FileInfo, 0, end-offset)
+	for _, e := range entries[offset:end] {
+		if e.fi == nil {
+			if err := withRetry(dev, func() (err error) {
+				e.fi, err = GetObjectFromObjectId(dev, e.objectId, fi.FullPath)
+
+				return err
+			}); err != nil {
+				return nil, totalCount, err
+			}
+		}
+
+		page = append(page, e.fi)
+	}
+
+	return page, totalCount, nil
+}
+
+// List the contents in a directory which match a doublestar style glob [pattern] (eg: /DCIM/**/*.jpg)
+// the [pattern] is matched against the [FullPath] of the objects; "**" matches across the directories
+// a [pattern] which doesn't start with "/" is matched relative to the directory being walked (eg: **/*.mp4)
+// all the directories are traversed (if [recursive] is true) regardless of the match so that the nested matches are found
+// [cb] is invoked only for the matching objects; files matching the [disallowedFiles] list are ignored
+// Tip: use [objectId] whenever possible to avoid traversing down the whole file tree to process and find the [objectId]
+// return:
+// [totalFiles]: total number of matching files
+// [totalDirectories]: total number of matching directories
+func WalkMatch(dev *mtp.Device, storageId, objectId uint32, fullPath string, pattern string, recursive bool, cb WalkCb) (totalFiles, totalDirectories int64, err error) {
+	if pattern == "" || !isValidGlobPattern(pattern) {
+		return totalFiles, totalDirectories, InvalidPathError{error: fmt.Errorf("invalid pattern: %s", pattern)}
+	}
+
+	fi, err := GetObjectFromObjectIdOrPath(dev, storageId, FileProp{objectId, fullPath})
+	if err != nil {
+		return totalFiles, totalDirectories, err
+	}
+
+	// the [FullPath] of [fi] isn't valid if only the [objectId] is available
+	if fullPath == "" {
+		fi.FullPath, err = ResolveObjectPath(dev, storageId, fi.ObjectId)
+		if err != nil {
+			return totalFiles, totalDirectories, err
+		}
+	}
+
+	_pattern := pattern
+	if !strings.HasPrefix(_pattern, PathSep) {
+		_pattern = getFullPath(fi.FullPath, _pattern)
+	}
+
+	matchCb := func(objectId uint32, fi *FileInfo, err error) error {
+		if err != nil {
+			return cb(objectId, fi, err)
+		}
+
+		if !matchGlob(_pattern, fi.FullPath) {
+			return nil
+		}
+
+		if fi.IsDir {
+			totalDirectories += 1
+		} else {
+			totalFiles += 1
+		}
+
+		return cb(objectId, fi, nil)
+	}
+
+	// if the object is a file then match it against the [pattern]
+	if !fi.IsDir {
+		if err := matchCb(fi.ObjectId, fi, nil); err != nil {
+			return totalFiles, totalDirectories, err
+		}
+
+		return totalFiles, totalDirectories, nil
+	}
+
+	if _, _, _, err = proccessWalk(context.Background(), dev, storageId, FileProp{fi.ObjectId, fi.FullPath}, walkProps{recursive: recursive, skipDisallowedFiles: true, skipErrors: true}, matchCb); err != nil {
+		return totalFiles, totalDirectories, err
+	}
+
+	return totalFiles, totalDirectories, nil
+}
+
+// Find the objects whose [Name] matches the glob [namePattern] (eg: *.srt) anywhere below [startPath]
+// the [namePattern] is matched against the filename using the glob rules of [WalkMatch]; [startPath] defaults to the root of the storage
+// the sub directories are searched only if [recursive] is true; the objects which can't be read and the files matching
+// the [disallowedFiles] list are skipped
+func FindFiles(dev *mtp.Device, storageId uint32, startPath, namePattern string, recursive bool) ([]*FileInfo, error) {
+	if startPath == "" {
+		startPath = PathSep
+	}
+
+	return findFiles(dev, storageId, startPath, namePattern, recursive, 0)
+}
+
+// Find the first object whose [Name] matches the glob [namePattern] below [startPath]; see [FindFiles]
+// the walk stops at the first match; a [FileNotFoundError] is returned if none of the objects match
+func FindFirst(dev *mtp.Device, storageId uint32, startPath, namePattern string, recursive bool) (*FileInfo, error) {
+	if startPath == "" {
+		startPath = PathSep
+	}
+
+	found, err := findFiles(dev, storageId, startPath, namePattern, recursive, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(found) < 1 {
+		return nil, FileNotFoundError{error: fmt.Errorf("no object matching %s was found in %s", namePattern, startPath)}
+	}
+
+	return found[0], nil
+}
+
+// check if a file Exists
+// returns Exists: bool, isDir: bool, objectId: uint32
+// Since the [parentPath] is unavailable here the [fullPath] property of the resulting object [FileInfo] may not be valid.
+func FileExists(dev *mtp.Device, storageId uint32, fileProps []FileProp) (fc []FileExistsContainer, err error) {
+	for _, fileProp := range fileProps {
+		fi, err := GetObjectFromObjectIdOrPath(dev, storageId, fileProp)
+
+		c := FileExistsContainer{}
+		if err != nil {
+			switch v := err.(type) {
+			case InvalidPathError:
+				c.Exists = false
+
+			case FileObjectError:
+				switch v1 := v.error.(type) {
+				case mtp.RCError:
+					if v1 == 0x2009 {
+						c.Exists = false
+					}
+				}
+
+			default:
+				return []FileExistsContainer{}, nil
+			}
+
+		} else {
+			c.Exists = true
+			c.FileInfo = fi
+		}
+
+		fc = append(fc, c)
+	}
+
+	return fc, nil
+}
+
+// check if an object exists at [fullPath]
+// unlike [FileExists] a missing path is not treated as an error
+// return:
+// (true, [FileInfo], nil) if the object was found
+// (false, nil, nil) if the path does not exist
+// (false, nil, err) if the device returned an error or [fullPath] is invalid (see [NormalizePath])
+func PathExists(dev *mtp.Device, storageId uint32, fullPath string) (bool, *FileInfo, error) {
+	if fullPath == "" {
+		return false, nil, nil
+	}
+
+	_filePath, err := NormalizePath(fullPath)
+	if err != nil {
+		return false, nil, err
+	}
+
+	if _filePath == PathSep {
+		fi, err := GetObjectFromObjectId(dev, ParentObjectId, "")
+		if err != nil {
+			return false, nil, err
+		}
+
+		return true, fi, nil
+	}
+
+	splittedFilePath := strings.Split(_filePath, PathSep)
+
+	var objectId = uint32(ParentObjectId)
+	var fi *FileInfo
+	const skipIndex = 1
+
+	for i, fName := range splittedFilePath[skipIndex:] {
+		_fi, err := GetObjectFromParentIdAndFilename(dev, storageId, objectId, fName)
+		if err != nil {
+			switch err.(type) {
+			case FileNotFoundError:
+				return false, nil, nil
+
+			default:
+				return false, nil, err
+			}
+		}
+
+		// a file cannot have children
+		if !_fi.IsDir && indexExists(splittedFilePath, i+1+skipIndex) {
+			return false, nil, nil
+		}
+
+		fi = _fi
+		objectId = _fi.ObjectId
+	}
+
+	if fi == nil {
+		return false, nil, nil
+	}
+
+	fi.FullPath = _filePath
+	fi.ParentPath = path.Dir(_filePath)
+
+	return true, fi, nil
+}
+
+// check if the object at [fullPath] is a directory
+// only the handles along the path are looked up, which is cheaper than fetching the whole ObjectInfo using [GetObjectFromPath]:
+// the format of each object is part of the GetObjectPropList listings, or else the OPC_ObjectFormat of the final object alone is fetched
+// a [FileNotFoundError] is returned if the path does not exist
+func IsDir(dev *mtp.Device, storageId uint32, fullPath string) (bool, error) {
+	if fullPath == "" {
+		return false, FileNotFoundError{error: fmt.Errorf("path does not Exists. path: %s", fullPath)}
+	}
+
+	_filePath, err := NormalizePath(fullPath)
+	if err != nil {
+		return false, err
+	}
+
+	if _filePath == PathSep {
+		return true, nil
+	}
+
+	supported, err := isOperationSupported(dev, mtp.OC_MTP_GetObjPropList)
+	if err != nil {
+		return false, err
+	}
+
+	splittedFilePath := strings.Split(_filePath, PathSep)
+
+	var objectId = uint32(ParentObjectId)
+	var isDir bool
+	const skipIndex = 1
+
+	for i, fName := range splittedFilePath[skipIndex:] {
+		// a file cannot have children
+		if i > 0 && supported && !isDir {
+			return false, FileNotFoundError{error: fmt.Errorf("path not found: %s", fullPath)}
+		}
+
+		if supported {
+			var fi *FileInfo
+			fi, err = getObjectFromParentIdAndFilenameUsingPropList(dev, storageId, objectId, fName, FilenameMatchCaseInsensitive)
+			if err == nil {
+				objectId = fi.ObjectId
+				isDir = fi.IsDir
+			}
+		} else {
+			objectId, err = getObjectIdFromParentIdAndFilenameUsingPropValue(dev, storageId, objectId, fName, FilenameMatchCaseInsensitive)
+		}
+
+		if err != nil {
+			// the handles of a file along the path can't be listed
+			if _, ok := err.(FileNotFoundError); ok || (i > 0 && isInvalidObjectError(err)) {
+				return false, FileNotFoundError{error: fmt.Errorf("path not found: %s\nreason: %v", fullPath, err.Error())}
+			}
+
+			return false, err
+		}
+	}
+
+	if supported {
+		return isDir, nil
+	}
+
+	format, err := getObjectFormat(dev, objectId)
+	if err != nil {
+		return false, err
+	}
+
+	return format == mtp.OFC_Association, nil
+}
+
+// Delete a file/directory
+// [objectId] and [fullPath] are optional parameters
+// if [objectId] is not available then [fullPath] will be used to fetch the [objectId]
+// dont leave both [objectId] and [fullPath] empty
+// Tip: use [objectId] whenever possible to avoid traversing down the whole file tree to process and find the [objectId]
+func DeleteFile(dev *mtp.Device, storageId uint32, fileProps []FileProp) error {
+	if err := checkStorageWritable(dev, storageId, true); err != nil {
+		return err
+	}
+
+	return deleteFile(dev, storageId, fileProps)
+}
+
+// helper function of [DeleteFile]; the storage isn't checked using [checkStorageWritable]
+func deleteFile(dev *mtp.Device, storageId uint32, fileProps []FileProp) error {
+	for _, fileProp := range fileProps {
+		fc, err := FileExists(dev, storageId, []FileProp{fileProp})
+		if err != nil {
+			return nil
+		}
+
+		if !fc[0].Exists {
+			return nil
+		}
+
+		if err := withCallTimeout(dev, nil, func() error {
+			return dev.DeleteObject(fc[0].FileInfo.ObjectId)
+		}); err != nil {
+			return fileObjectError(err)
+		}
+
+		invalidateDeletedObject(dev, storageId, fc[0].FileInfo.ParentId, fc[0].FileInfo.ObjectId)
+	}
+
+	return nil
+}
+
+// Delete a file/directory along with all of its contents
+// [objectId] and [fullPath] are optional parameters
+// if [objectId] is not available then [fullPath] will be used to fetch the [objectId]
+// dont leave both [objectId] and [fullPath] empty
+// The children are deleted before their parents, so devices which refuse to delete a non empty directory are supported
+// A non existing object is not treated as an error, same as [DeleteFile]
+// return
+// [deletedCount]: total number of deleted objects. On error it is the number of objects which were removed before the failure
+func DeleteFileRecursive(dev *mtp.Device, storageId, objectId uint32, fullPath string) (deletedCount int, err error) {
+	return DeleteFileRecursiveWithOpts(dev, storageId, objectId, fullPath, DeleteOpts{})
+}
+
+// Delete a file/directory along with all of its contents
+// same as [DeleteFileRecursive] but the behaviour is controlled using [opts]
+// if [opts.DryRun] is true then the objects are reported to [opts.DryRunCb] in the order of their deletion and nothing is deleted
+// return
+// [deletedCount]: total number of deleted objects. On error it is the number of objects which were removed before the failure
+func DeleteFileRecursiveWithOpts(dev *mtp.Device, storageId, objectId uint32, fullPath string, opts DeleteOpts) (deletedCount int, err error) {
+	if err := checkStorageWritable(dev, storageId, true); err != nil {
+		return 0, err
+	}
+
+	return deleteFileRecursive(dev, storageId, objectId, fullPath, opts)
+}
+
+// helper function of [DeleteFileRecursiveWithOpts]; the storage isn't checked using [checkStorageWritable]
+func deleteFileRecursive(dev *mtp.Device, storageId, objectId uint32, fullPath string, opts DeleteOpts) (deletedCount int, err error) {
+	fc, err := FileExists(dev, storageId, []FileProp{{objectId, fullPath}})
+	if err != nil {
+		return 0, err
+	}
+
+	if len(fc) < 1 || !fc[0].Exists {
+		return 0, nil
+	}
+
+	fi := fc[0].FileInfo
+
+	if fi.ObjectId == ParentObjectId {
+		return 0, InvalidPathError{error: fmt.Errorf("invalid path: %s. the root directory cannot be deleted", fullPath)}
+	}
+
+	var objects []*FileInfo
+
+	if fi.IsDir {
+		_, _, _, err = proccessWalk(context.Background(), dev, storageId, FileProp{fi.ObjectId, fi.FullPath}, walkProps{recursive: true, skipErrors: true},
+			func(objectId uint32, fi *FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+
+				objects = append(objects, fi)
+
+				return nil
+			})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if opts.DryRun {
+		return planDeleteObjects(dev, storageId, fi, objects, opts.DryRunCb)
+	}
+
+	// the walk lists the parents before their children, so delete the objects in the reverse order
+	for i := len(objects) - 1; i >= 0; i-- {
+		if err := withCallTimeout(dev, nil, func() error {
+			return dev.DeleteObject(objects[i].ObjectId)
+		}); err != nil {
+			return deletedCount, FileObjectError{
+				error: fmt.Errorf("%d object(s) were deleted before the deletion of objectId %d failed: %v", deletedCount, objects[i].ObjectId, err),
+			}
+		}
+
+		invalidateDeletedObject(dev, storageId, objects[i].ParentId, objects[i].ObjectId)
+
+		deletedCount += 1
+	}
+
+	if err := withCallTimeout(dev, nil, func() error {
+		return dev.DeleteObject(fi.ObjectId)
+	}); err != nil {
+		return deletedCount, FileObjectError{
+			error: fmt.Errorf("%d object(s) were deleted before the deletion of objectId %d failed: %v", deletedCount, fi.ObjectId, err),
+		}
+	}
+
+	invalidateDeletedObject(dev, storageId, fi.ParentId, fi.ObjectId)
+
+	deletedCount += 1
+
+	return deletedCount, nil
+}
+
+// Delete the files/directories at [paths]
+// the paths are resolved using a shared [PathCache] and the children are deleted before their parents;
+// a directory is deleted along with its contents by the device, same as [DeleteFile]
+// a non existing path is reported in [DeleteReport.NotFound] and is not treated as an error
+// the deletion stops at the first failure unless [opts.ContinueOnError] is true, in which case a [BatchError] listing
+// the failed paths is returned once all the paths were processed
+// if [opts.DryRun] is true then the resolved paths are reported to [opts.DryRunCb] and nothing is deleted
+func DeleteFiles(dev *mtp.Device, storageId uint32, paths []string, opts DeleteOpts) (*DeleteReport, error) {
+	if err := checkStorageWritable(dev, storageId, true); err != nil {
+		return nil, err
+	}
+
+	report := &DeleteReport{}
+	cache := NewPathCache()
+
+	fail := func(fullPath string, err error) error {
+		report.Failed = append(report.Failed, FileFailure{FullPath: fullPath, Err: err})
+		if opts.ContinueOnError {
+			return nil
+		}
+
+		return err
+	}
+
+	type deleteTarget struct {
+		fullPath string
+		fi       *FileInfo
+	}
+
+	var targets []deleteTarget
+	seen := map[uint32]bool{}
+
+	for _, p := range paths {
+		fi, err := GetObjectFromPathCached(dev, storageId, p, cache)
+		if err != nil {
+			// a missing path is reported as an [InvalidPathError], same as [FileExists]
+			if _, ok := err.(InvalidPathError); ok {
+				report.NotFound = append(report.NotFound, p)
+
+				continue
+			}
+
+			if err := fail(p, err); err != nil {
+				return report, err
+			}
+
+			continue
+		}
+
+		if fi.ObjectId == ParentObjectId {
+			if err := fail(p, InvalidPathError{error: fmt.Errorf("invalid path: %s. the root directory cannot be deleted", p)}); err != nil {
+				return report, err
+			}
+
+			continue
+		}
+
+		if seen[fi.ObjectId] {
+			continue
+		}
+		seen[fi.ObjectId] = true
+
+		targets = append(targets, deleteTarget{fullPath: p, fi: fi})
+	}
+
+	// the deeper paths first, so that a selected child is deleted before its selected parent
+	sort.SliceStable(targets, func(i, j int) bool {
+		return strings.Count(targets[i].fi.FullPath, PathSep) > strings.Count(targets[j].fi.FullPath, PathSep)
+	})
+
+	for _, t := range targets {
+		if opts.DryRun {
+			if opts.DryRunCb != nil {
+				if err := opts.DryRunCb(DryRunDelete, t.fi.FullPath, t.fi.Size); err != nil {
+					return report, err
+				}
+			}
+
+			report.Deleted = append(report.Deleted, t.fullPath)
+
+			continue
+		}
+
+		if err := withCallTimeout(dev, nil, func() error {
+			return dev.DeleteObject(t.fi.ObjectId)
+		}); err != nil {
+			if err := fail(t.fullPath, fileObjectError(err)); err != nil {
+				return report, err
+			}
+
+			continue
+		}
+
+		invalidateDeletedObject(dev, storageId, t.fi.ParentId, t.fi.ObjectId)
+
+		report.Deleted = append(report.Deleted, t.fullPath)
+	}
+
+	if len(report.Failed) > 0 {
+		return report, BatchError{Failures: report.Failed}
+	}
+
+	return report, nil
+}
+
+// Rename a file/directory
+// [objectId] and [fullPath] are optional parameters
+// if [objectId] is not available then [fullPath] will be used to fetch the [objectId]
+// dont leave both [objectId] and [fullPath] empty
+// Tip: use [objectId] whenever possible to avoid traversing down the whole file tree to process and find the [objectId]
+// [newFileName] should not contain any path separators; it is checked against the [FilenamePolicy] of the device
+// a [FileAlreadyExistsError] is returned if another object named [newFileName] already exists in the same directory
+// return
+// [objectId]: objectId of the file/diectory
+func RenameFile(dev *mtp.Device, storageId uint32, fileProp FileProp, newFileName string) (objectId uint32, err error) {
+	if newFileName == "" || strings.ContainsAny(newFileName, "/\\") {
+		return 0, InvalidPathError{error: fmt.Errorf("invalid file name: %s", newFileName)}
+	}
+
+	newFileName, err = checkFilename(dev, newFileName)
+	if err != nil {
+		return 0, err
+	}
+
+	fc, err := FileExists(dev, storageId, []FileProp{fileProp})
+	if err != nil {
+		return 0, err
+	}
+
+	if !fc[0].Exists {
+		return 0, InvalidPathError{error: fmt.Errorf("file not found: %s", fileProp.FullPath)}
+	}
+
+	fi := fc[0].FileInfo
+
+	// check whether [newFileName] is already taken by another object in the same directory
+	existingFi, err := GetObjectFromParentIdAndFilename(dev, storageId, fixParentId(fi.ParentId), newFileName)
+	if err == nil {
+		if existingFi.ObjectId != fi.ObjectId {
+			return 0, FileAlreadyExistsError{error: fmt.Errorf("file already exists: %s", newFileName)}
+		}
+	} else {
+		switch err.(type) {
+		case FileNotFoundError:
+
+		default:
+			return 0, err
+		}
+	}
+
+	// the device may apply the rename even if it reports an error
+	defer invalidateCaches(dev, storageId, fi.ParentId)
+
+	if err := withCallTimeout(dev, nil, func() error {
+		return dev.SetObjectPropValue(fi.ObjectId, mtp.OPC_ObjectFileName, &mtp.StringValue{Value: newFileName})
+	}); err != nil {
+		switch v := err.(type) {
+		case mtp.RCError:
+			if v == 0x2002 {
+				return fi.ObjectId, nil
+			}
+		}
+
+		return 0, fileObjectError(err)
+	}
+
+	return fi.ObjectId, nil
+}
+
+// Move the file/directory [objectId] into the directory [newParentId] using the MTP MoveObject operation
+// unlike [MoveFile] no path is resolved and there is no fallback; the object keeps its objectId and its name
+// [newParentId] may be the root directory ([ParentObjectId] or 0)
+// an [InvalidPathError] is returned if [newParentId] isn't a directory
+// and an [UnsupportedOperationError] if the device doesn't support MoveObject
+func ReparentObject(dev *mtp.Device, objectId, newParentId uint32) error {
+	supported, err := isOperationSupported(dev, mtp.OC_MoveObject)
+	if err != nil {
+		return err
+	}
+
+	if !supported {
+		return UnsupportedOperationError{error: fmt.Errorf("unable to reparent the object %d. MoveObject is not supported by the device", objectId)}
+	}
+
+	if isRootObjectId(objectId) {
+		return InvalidPathError{error: fmt.Errorf("invalid objectId: %d. the root directory cannot be moved", objectId)}
+	}
+
+	fi, err := GetObjectFromObjectId(dev, objectId, "")
+	if err != nil {
+		return err
+	}
+
+	newParentId = fixParentId(newParentId)
+	storageId := fi.Info.StorageID
+
+	if newParentId != ParentObjectId {
+		parentFi, err := GetObjectFromObjectId(dev, newParentId, "")
+		if err != nil {
+			return err
+		}
+
+		if !parentFi.IsDir {
+			return InvalidPathError{error: fmt.Errorf("invalid parent: %d. the object is not a directory", newParentId)}
+		}
+
+		storageId = parentFi.Info.StorageID
+	}
+
+	if fixParentId(fi.ParentId) == newParentId {
+		return nil
+	}
+
+	if err := checkDestinationOutsideSource(dev, objectId, newParentId); err != nil {
+		return err
+	}
+
+	defer invalidateCaches(dev, fi.Info.StorageID, fi.ParentId)
+	defer invalidateCaches(dev, storageId, newParentId)
+
+	return handleMoveObject(dev, storageId, objectId, newParentId)
+}
+
+// Move a file/directory to another directory
+// [objectId] and [sourcePath] are optional parameters
+// if [objectId] is not available then [sourcePath] will be used to fetch the [objectId]
+// dont leave both [objectId] and [sourcePath] empty
+// [destParentPath]: fullPath to the destination directory
+// The MTP MoveObject operation is used when the device supports it. Otherwise the object is downloaded,
+// uploaded into [destParentPath] and then deleted from its source; any error in this fallback is returned as an [UnsupportedOperationError]
+// return
+// [objectId]: objectId of the moved file/directory. It will be a new objectId if the fallback was used
+func MoveFile(dev *mtp.Device, storageId, objectId uint32, sourcePath, destParentPath string) (uint32, error) {
+	fi, err := GetObjectFromObjectIdOrPath(dev, storageId, FileProp{objectId, sourcePath})
+	if err != nil {
+		return 0, err
+	}
+
+	if fi.ObjectId == ParentObjectId {
+		return 0, InvalidPathError{error: fmt.Errorf("invalid path: %s. the root directory cannot be moved", sourcePath)}
+	}
+
+	destFi, err := GetObjectFromPath(dev, storageId, destParentPath)
+	if err != nil {
+		return 0, err
+	}
+
+	if !destFi.IsDir {
+		return 0, InvalidPathError{error: fmt.Errorf("invalid path: %s. The object is not a directory", destParentPath)}
+	}
+
+	// the object is already inside [destParentPath]
+	if fixParentId(fi.ParentId) == destFi.ObjectId {
+		return fi.ObjectId, nil
+	}
+
+	if err := checkDestinationOutsideSource(dev, fi.ObjectId, destFi.ObjectId); err != nil {
+		return 0, err
+	}
+
+	// make sure that an object with the same name does not exist in the destination directory
+	if _, err := GetObjectFromParentIdAndFilename(dev, storageId, destFi.ObjectId, fi.Name); err == nil {
+		return 0, InvalidPathError{error: fmt.Errorf("file already exists: %s", getFullPath(destFi.FullPath, fi.Name))}
+	} else {
+		switch err.(type) {
+		case FileNotFoundError:
+
+		default:
+			return 0, err
+		}
+	}
+
+	return handleMoveFile(dev, storageId, fi, destFi.ObjectId)
+}
+
+// Move the objects [objectIds] into the directory [destParentPath]
+// [destParentPath] is resolved once and every object is moved the same way as [MoveFile], including its fallback
+// an object with the same name inside [destParentPath] is resolved using [opts.ConflictPolicy]:
+// the skipped objects are left in place, the overwritten files are deleted before the move and the renamed objects
+// are moved and then renamed with a suffix. a directory is never overwritten; the conflict fails with a [FileAlreadyExistsError]
+// an object which is already inside [destParentPath] is reported as moved with its objectId unchanged
+// the move stops at the first failure unless [opts.ContinueOnError] is true, in which case a [BatchError] listing
+// the failed objects is returned once all the objects were processed
+func MoveFiles(dev *mtp.Device, storageId uint32, objectIds []uint32, destParentPath string, opts MoveOpts) (*MoveReport, error) {
+	report := &MoveReport{}
+
+	if err := checkConflictPolicy(opts.ConflictPolicy); err != nil {
+		return report, err
+	}
+
+	destFi, err := GetObjectFromPath(dev, storageId, destParentPath)
+	if err != nil {
+		return report, err
+	}
+
+	if !destFi.IsDir {
+		return report, InvalidPathError{error: fmt.Errorf("invalid path: %s. The object is not a directory", destParentPath)}
+	}
+
+	cache := NewPathCache()
+	var failures []FileFailure
+
+	fail := func(objectId uint32, err error) error {
+		report.Failed = append(report.Failed, MoveFailure{ObjectId: objectId, Err: err})
+
+		fullPath, pathErr := ResolveObjectPathCached(dev, storageId, objectId, cache)
+		if pathErr != nil {
+			fullPath = fmt.Sprintf("objectId %d", objectId)
+		}
+		failures = append(failures, FileFailure{FullPath: fullPath, Err: err})
+
+		if opts.ContinueOnError {
+			return nil
+		}
+
+		return err
+	}
+
+	for _, objectId := range objectIds {
+		moved, skip, err := moveObjectInto(dev, storageId, objectId, destFi, opts.ConflictPolicy)
+		if err != nil {
+			if err := fail(objectId, err); err != nil {
+				return report, err
+			}
+
+			continue
+		}
+
+		if skip {
+			report.Skipped = append(report.Skipped, objectId)
+
+			continue
+		}
+
+		report.Moved = append(report.Moved, moved)
+	}
+
+	if len(failures) > 0 {
+		return report, BatchError{Failures: failures}
+	}
+
+	return report, nil
+}
+
+// Copy a file/directory into another directory
+// [destParentPath]: fullPath to the destination directory
+// if [overwriteExisting] is false and an object with the same name exists in [destParentPath] then the objectId of the existing object is returned
+// if [overwriteExisting] is true then the existing object is deleted before copying
+// The MTP CopyObject operation is used when the device supports it. Otherwise the object is streamed through the host
+// return
+// [objectId]: objectId of the newly copied file/directory
+func CopyFile(dev *mtp.Device, storageId, objectId uint32, destParentPath string, overwriteExisting bool) (uint32, error) {
+	if err := checkStorageWritable(dev, storageId, false); err != nil {
+		return 0, err
+	}
+
+	fi, err := GetObjectFromObjectId(dev, objectId, "")
+	if err != nil {
+		return 0, err
+	}
+
+	if fi.ObjectId == ParentObjectId {
+		return 0, InvalidPathError{error: fmt.Errorf("invalid objectId: %d. the root directory cannot be copied", objectId)}
+	}
+
+	destFi, err := GetObjectFromPath(dev, storageId, destParentPath)
+	if err != nil {
+		return 0, err
+	}
+
+	if !destFi.IsDir {
+		return 0, InvalidPathError{error: fmt.Errorf("invalid path: %s. The object is not a directory", destParentPath)}
+	}
+
+	if fixParentId(fi.ParentId) == destFi.ObjectId {
+		return 0, InvalidPathError{error: fmt.Errorf("invalid path: %s. the source and destination directories are the same", destParentPath)}
+	}
+
+	if err := checkDestinationOutsideSource(dev, fi.ObjectId, destFi.ObjectId); err != nil {
+		return 0, err
+	}
+
+	existingFi, err := GetObjectFromParentIdAndFilename(dev, storageId, destFi.ObjectId, fi.Name)
+
+	// file Exists
+	if err == nil {
+		// if [overwriteExisting] is false then just return existing [objectId] of the exisiting file
+		if !overwriteExisting {
+			return existingFi.ObjectId, nil
+		}
+
+		// if [overwriteExisting] is true then delete the existing file
+		if err := deleteFile(dev, storageId, []FileProp{{existingFi.ObjectId, ""}}); err != nil {
+			return 0, err
+		}
+	} else {
+		switch err.(type) {
+		// if the file does not Exists then do nothing
+		case FileNotFoundError:
+
+		default:
+			return 0, err
+		}
+	}
+
+	supported, err := isOperationSupported(dev, mtp.OC_CopyObject)
+	if err != nil {
+		return 0, err
+	}
+
+	if supported {
+		return handleCopyObject(dev, storageId, fi.ObjectId, destFi.ObjectId)
+	}
+
+	return handleCopyObjectFallback(dev, storageId, fi, destFi.ObjectId, overwriteExisting)
+}
+
+// Scan the local files which are to be uploaded
+// the counts match the files processed by [UploadFiles]; the disallowed files and the symlinks are skipped
+// use it to estimate the transfer time and to warn about the huge files before the upload starts
+// return:
+// [ScanResult]: total number of files, directories, their total size and the largest files
+func PreScanLocal(sources []string) (*ScanResult, error) {
+	result := &ScanResult{}
+
+	totalFiles, totalDirectories, totalSize, err := walkLocalFiles(sources, false, nil, func(fi *os.FileInfo, fullPath string, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if (*fi).IsDir() {
+			return nil
+		}
+
+		result.LargestFiles = insertLargestFile(result.LargestFiles, ScannedFile{FullPath: fullPath, Size: (*fi).Size()}, preScanLargestFilesCount)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result.TotalFiles = totalFiles
+	result.TotalDirectories = totalDirectories
+	result.TotalSize = totalSize
+
+	return result, nil
+}
+
+// Transfer files from the local disk to the device
+// sources: can be the list of files/directories that are to be sent to the device
+// destination: fullPath to the destination directory
+// preprocessFiles: if enabled, will fetch the total file size and count of the source. Use this will caution as it may take a few seconds to minutes to procress the files.
+// return:
+// [destinationObjectId]: objectId of [destination] directory
+// [bulkFilesSent]: total transferred files (directory count not included)
+// [bulkSizeSent]: total size of the uploaded files
+func UploadFiles(dev *mtp.Device, storageId uint32, sources []string, destination string, preprocessFiles bool, preprocessCb LocalPreprocessCb, progressCb ProgressCb) (destinationObjectId uint32, bulkFilesSent int64, bulkSizeSent int64, err error) {
+	return UploadFilesWithOpts(dev, storageId, sources, destination, UploadOpts{
+		PreprocessFiles:   preprocessFiles,
+		PreprocessCb:      preprocessCb,
+		ProgressCb:        progressCb,
+		StopOnError:       true,
+		OverwriteExisting: true,
+	})
+}
+
+// Transfer files from the local disk to the device
+// same as [UploadFiles] but the behaviour is controlled using [opts]
+// if [opts.StopOnError] is false then the files which fail to transfer are skipped and a [BatchError] listing them is returned at the end
+// if [opts.PreprocessFiles] is true then an [InsufficientSpaceError] is returned before the transfer starts if the files don't fit in the storage
+// if [opts.VerifyUpload] is true then every uploaded file is compared with the local file and a mismatch returns a [ChecksumMismatchError]
+// if [opts.DryRun] is true then nothing is created on the device; [destinationObjectId] is 0 if the [destination] doesn't exist yet
+// every local directory is created on the device as it is walked, so the empty directories are kept as well
+// sources: can be the list of files/directories that are to be sent to the device
+// destination: fullPath to the destination directory
+// return:
+// [destinationObjectId]: objectId of [destination] directory
+// [bulkFilesSent]: total transferred files (directory count not included)
+// [bulkSizeSent]: total size of the uploaded files
+func UploadFilesWithOpts(dev *mtp.Device, storageId uint32, sources []string, destination string, opts UploadOpts) (destinationObjectId uint32, bulkFilesSent int64, bulkSizeSent int64, err error) {
+	if err := checkStorageWritable(dev, storageId, false); err != nil {
+		return 0, bulkFilesSent, bulkSizeSent, err
+	}
+
+	return uploadFiles(dev, storageId, sources, destination, opts)
+}
+
+// helper function of [UploadFilesWithOpts]; the storage isn't checked using [checkStorageWritable]
+func uploadFiles(dev *mtp.Device, storageId uint32, sources []string, destination string, opts UploadOpts) (destinationObjectId uint32, bulkFilesSent int64, bulkSizeSent int64, err error) {
+	_destination, err := NormalizePath(destination)
+	if err != nil {
+		return 0, bulkFilesSent, bulkSizeSent, err
+	}
+
+	// fail early if the [opts.HashAlgo] is not supported
+	if opts.VerifyUpload {
+		if _, err := newHash(opts.HashAlgo); err != nil {
+			return 0, bulkFilesSent, bulkSizeSent, err
+		}
+	}
+
+	conflictPolicy := opts.ConflictPolicy
+	if opts.OverwriteExisting && conflictPolicy == ConflictSkip {
+		conflictPolicy = ConflictOverwrite
+	}
+
+	// fail early if the [conflictPolicy] is not supported
+	if err := checkConflictPolicy(conflictPolicy); err != nil {
+		return 0, bulkFilesSent, bulkSizeSent, err
+	}
+
+	pInfo := ProgressInfo{
+		FileInfo:          &FileInfo{},
+		StartTime:         time.Now(),
+		LatestSentTime:    time.Now(),
+		Speed:             0,
+		TotalFiles:        0,
+		TotalDirectories:  0,
+		FilesSent:         0,
+		FilesSentProgress: 0,
+		ActiveFileSize:    &TransferSizeInfo{},
+		BulkFileSize:      &TransferSizeInfo{},
+		Status:            InProgress,
+	}
+
+	// if [preprocessFiles] is true then fetch the total number of files from the file tree
+	// total number of files in the current upload session
+	// if [preprocessFiles] is false then [totalFiles] is 0
+	var totalFiles int64 = 0
+
+	// if [preprocessFiles] is true then fetch the total number of files from the file tree
+	// total number of directories in the current upload session
+	// if [preprocessFiles] is false then [totalDirectories] is 0
+	var totalDirectories int64 = 0
+
+	// if [preprocessFiles] is true then fetch the total number of files from the file tree
+	// 	// total size of all the files combined in the current upload session
+	// if [preprocessFiles] is false then [totalDirectories] is 0
+	var totalSize int64 = 0
+
+	// keep track of [bulkSizeSent]
+	bulkSizeSent = 0
+
+	throughput := newThroughputMeter(opts.ThroughputWindow, pInfo.StartTime)
+
+	// the transfer buffers shared by all the files of the batch
+	buffers := newBufferPool(opts.BufferSize)
+
+	// the files which failed to transfer; used only if [opts.StopOnError] is false
+	var failures []FileFailure
+
+	// an error returned by [opts.PreprocessCb], [opts.ProgressCb] or [opts.BatchProgressCb] always aborts the transfer
+	// except a [PauseSignal], which blocks the transfer until it's resumed
+	canceled := false
+	pausableProgressCb := pausableProgress(opts.ProgressCb)
+	progressCb := func(pInfo *ProgressInfo, err error) error {
+		if err := pausableProgressCb(pInfo, err); err != nil {
+			canceled = true
+
+			return err
+		}
+
+		if err := reportBatchProgress(opts.BatchProgressCb, pInfo); err != nil {
+			canceled = true
+
+			return err
+		}
+
+		return nil
+	}
+
+	// record the failure of [path] and continue with the next file unless the transfer has to be aborted
+	fail := func(path string, err error) error {
+		// the remaining files can't be transferred either
+		if opts.StopOnError || canceled || isDeviceDisconnected(err) {
+			return err
+		}
+
+		failures = append(failures, FileFailure{FullPath: path, Err: uploadFilesError(err)})
+
+		return nil
+	}
+
+	// the planned actions are reported to [dryRunCb]; it is nil unless [opts.DryRun] is true
+	// an error returned by [opts.DryRunCb] always aborts the dry run
+	var dryRunCb DryRunCb
+	if opts.DryRun {
+		dryRunCb = func(action DryRunAction, fullPath string, size int64) error {
+			if opts.DryRunCb == nil {
+				return nil
+			}
+
+			if err := opts.DryRunCb(action, fullPath, size); err != nil {
+				canceled = true
+
+				return err
+			}
+
+			return nil
+		}
+	}
+
+	// [opts.BatchProgressCb] needs the totals, so the files are pre-processed for it as well
+	if opts.PreprocessFiles || opts.BatchProgressCb != nil {
+		_totalFiles, _totalDirectories, _totalSize, err := walkLocalFiles(sources, opts.FollowSymlinks, opts.DisallowedFiles, func(fi *os.FileInfo, fullPath string, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if (*fi).IsDir() {
+				return nil
+			}
+
+			if opts.PreprocessCb != nil {
+				if err = opts.PreprocessCb(fi, fullPath, nil); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			return 0, bulkFilesSent, bulkSizeSent, err
+		}
+
+		totalFiles = _totalFiles
+		totalDirectories = _totalDirectories
+		totalSize = _totalSize
+
+		// make sure that the files fit in the storage before any bytes are sent
+		if !opts.SkipFreeSpaceCheck {
+			if err := CheckFreeSpace(dev, storageId, totalSize); err != nil {
+				return 0, bulkFilesSent, bulkSizeSent, err
+			}
+		}
+	}
+
+	// directories (fullPath -> objectId) created or found on the device during the upload session
+	// seeded with the [destination] so that it is never resolved again
+	destinationDirs := map[string]uint32{}
+
+	destParentId, err := makeDirectoryCached(dev, storageId, destinationDirs, _destination, dryRunCb)
+	if err != nil {
+		return 0, bulkFilesSent, bulkSizeSent, err
+	}
+
+	pInfo.TotalFiles = totalFiles
+	pInfo.TotalDirectories = totalDirectories
+	pInfo.BulkFileSize.Total = totalSize
+
+	for _, source := range sources {
+		_source := fixSlash(source)
+		sourceParentPath := filepath.Dir(_source)
+
+		// walk through the source
+		err = walkLocalTree(_source, opts.FollowSymlinks,
+			func(path string, fInfo os.FileInfo, err error) error {
+				if err != nil {
+					return fail(fixSlash(path), err)
+				}
+
+				name := fInfo.Name()
+
+				// skip the symlinks which are not followed
+				if isSymlinkLocal(fInfo) {
+					return nil
+				}
+
+				// filter out disallowed files; a disallowed directory is skipped along with its contents
+				if isDisallowedFiles(opts.DisallowedFiles, name) {
+					if fInfo.IsDir() {
+						return filepath.SkipDir
+					}
+
+					return nil
+				}
+
+				sourceFilePath := fixSlash(path)
+
+				// map the local files path to the mtp files path
+				// only the local separators are converted; a backslash in a device filename is kept as is
+				destinationParentPath, destinationFilePath := mapSourcePathToDestinationPath(
+					toPathSep(sourceFilePath), toPathSep(sourceParentPath), _destination,
+				)
+
+				size := fInfo.Size()
+				isDir := fInfo.IsDir()
+
+				// if the object is a directory then create a directory
+				if isDir {
+					if _, err := makeDirectoryCached(dev, storageId, destinationDirs, destinationFilePath, dryRunCb); err != nil {
+						if err := fail(sourceFilePath, err); err != nil {
+							return err
+						}
+
+						// skip the contents of the directory which couldn't be created
+						return filepath.SkipDir
+					}
+
+					return nil
+				}
+
+				/// if the object is a file then create a file
+				// the reported paths use the names sanitized by the [FilenamePolicy] of the device
+				destinationParentPath, err = checkPath(dev, destinationParentPath)
+				if err != nil {
+					return fail(sourceFilePath, err)
+				}
+
+				name, err = checkFilename(dev, name)
+				if err != nil {
+					return fail(sourceFilePath, err)
+				}
+				destinationFilePath = getFullPath(destinationParentPath, name)
+
+				// the parent directory is usually created while walking it; it is created here only if it was missing
+				fileParentId, err := makeDirectoryCached(dev, storageId, destinationDirs, destinationParentPath, dryRunCb)
+				if err != nil {
+					return fail(sourceFilePath, err)
+				}
+
+				// plan the upload without sending the file
+				if opts.DryRun {
+					action, name, err := planMakeFile(dev, storageId, fileParentId, name, size, fInfo.ModTime(), conflictPolicy)
+					if err != nil {
+						return fail(sourceFilePath, err)
+					}
+
+					bulkFilesSent += 1
+					pInfo.FilesSent = bulkFilesSent
+					pInfo.FilesSentProgress = Percent(float32(bulkFilesSent), float32(totalFiles))
+
+					// the existing file is left untouched
+					if action == "" {
+						return nil
+					}
+
+					if err := dryRunCb(action, getFullPath(destinationParentPath, name), size); err != nil {
+						return err
+					}
+
+					bulkSizeSent += size
+					pInfo.BulkFileSize.Sent = bulkSizeSent
+					pInfo.BulkFileSize.Progress = Percent(float32(bulkSizeSent), float32(totalSize))
+
+					return nil
+				}
+
+				// read the local file
+				fileBuf, err := os.Open(sourceFilePath)
+				if err != nil {
+					return fail(sourceFilePath, InvalidPathError{error: err})
+				}
+				defer fileBuf.Close()
+
+				var compressedSize uint32
+
+				// assign compressedSize of the file
+				if size > 0xFFFFFFFF {
+					compressedSize = 0xFFFFFFFF
+				} else {
+					compressedSize = uint32(size)
+				}
+
+				format := opts.ObjectFormat
+				if format == 0 {
+					format = objectFormat(name)
+				}
+
+				fObj := mtp.ObjectInfo{
+					StorageID:        storageId,
+					ObjectFormat:     format,
+					ParentObject:     fileParentId,
+					Filename:         name,
+					CompressedSize:   compressedSize,
+					ModificationDate: time.Now(),
+				}
+
+				if opts.PreserveModTime {
+					fObj.ModificationDate = fInfo.ModTime()
+				}
+
+				// keep track of [bulkFilesSent]
+				bulkFilesSent += 1
+
+				pInfo.FileInfo = &FileInfo{
+					Info:       &fObj,
+					Size:       size,
+					IsDir:      isDir,
+					ModTime:    fObj.ModificationDate,
+					Name:       fObj.Filename,
+					FullPath:   destinationFilePath,
+					ParentPath: destinationParentPath,
+					Extension:  extension(fObj.Filename, isDir),
+					ParentId:   fObj.ParentObject,
+				}
+				pInfo.LatestSentTime = time.Now()
+
+				// create file
+				var prevSentSize int64 = 0
+				objId, err := handleMakeFile(
+					dev, storageId, &fObj, &fInfo, fileBuf,
+					conflictPolicy, opts.ReuseHandleOnOverwrite, opts.PreserveModTime, opts.KeepPartialObjects, opts.Atomic, buffers,
+					throttleSizeProgress(opts.ProgressInterval, opts.ProgressMinBytes, func(total, sent int64, objId uint32, err error) error {
+						if err != nil {
+							return err
+						}
+
+						// the file may have been renamed by [ConflictRenameWithSuffix]
+						if pInfo.FileInfo.Name != fObj.Filename {
+							pInfo.FileInfo.Name = fObj.Filename
+							pInfo.FileInfo.FullPath = getFullPath(destinationParentPath, fObj.Filename)
+						}
+
+						pInfo.FileInfo.ObjectId = objId
+						pInfo.ActiveFileSize.Total = total
+						pInfo.ActiveFileSize.Sent = sent
+						pInfo.ActiveFileSize.Progress = Percent(float32(sent), float32(total))
+
+						// a retried transfer, or a new object replacing a failed rewrite, starts over from 0
+						if sent < prevSentSize {
+							bulkSizeSent -= prevSentSize
+							prevSentSize = 0
+						}
+
+						chunkSize := sent - prevSentSize
+						bulkSizeSent += chunkSize
+
+						pInfo.BulkFileSize.Sent = bulkSizeSent
+						pInfo.BulkFileSize.Progress = Percent(float32(bulkSizeSent), float32(totalSize))
+
+						now := time.Now()
+						pInfo.Speed = transferRate(chunkSize, pInfo.LatestSentTime)
+						pInfo.BytesPerSecond = throughput.add(now, bulkSizeSent)
+						pInfo.Elapsed = now.Sub(pInfo.StartTime)
+						if err = progressCb(&pInfo, nil); err != nil {
+							return err
+						}
+
+						pInfo.LatestSentTime = time.Now()
+						prevSentSize = sent
+
+						return nil
+					}),
+				)
+
+				// compare the uploaded object with the local file
+				if err == nil && opts.VerifyUpload {
+					err = verifyUploadedFile(dev, objId, sourceFilePath, opts.LocalHashes[sourceFilePath], opts.HashAlgo)
+				}
+
+				if err != nil {
+					if err := fail(sourceFilePath, err); err != nil {
+						return err
+					}
+
+					// the failed files are not counted
+					bulkFilesSent -= 1
+
+					return nil
+				}
+
+				pInfo.FilesSent = bulkFilesSent
+				pInfo.FilesSentProgress = Percent(float32(bulkFilesSent), float32(totalFiles))
+
+				pInfo.FileInfo.ObjectId = objId
+
+				return nil
+			},
+		)
+
+		if err != nil {
+			return destParentId, bulkFilesSent, bulkSizeSent, uploadFilesError(err)
+		}
+	}
+
+	pInfo.Status = Completed
+	if err := progressCb(&pInfo, nil); err != nil {
+		return destParentId, bulkFilesSent, bulkSizeSent, err
+	}
+
+	if len(failures) > 0 {
+		return destParentId, bulkFilesSent, bulkSizeSent, BatchError{Failures: failures}
+	}
+
+	return destParentId, bulkFilesSent, bulkSizeSent, nil
+}
+
+// Transfer files from the device to the local disk
+// sources: can be the list of files/directories that are to be sent to the local disk
+// destination: fullPath to the destination directory
+// return:
+// [totalFiles]: total transferred files (directory count not included)
+// [totalSize]: total size of the uploaded files
+func DownloadFiles(dev *mtp.Device, storageId uint32, sources []string, destination string,
+	preprocessFiles bool, preprocessCb MtpPreprocessCb, progressCb ProgressCb) (bulkFilesSent int64, bulkSizeSent int64, err error) {
+	progressCb = pausableProgress(progressCb)
+	_destination := fixSlash(destination)
+
+	pInfo := ProgressInfo{
+		FileInfo:          &FileInfo{},
+		StartTime:         time.Now(),
+		LatestSentTime:    time.Now(),
+		Speed:             0,
+		TotalFiles:        0,
+		TotalDirectories:  0,
+		FilesSent:         0,
+		FilesSentProgress: 0,
+		ActiveFileSize:    &TransferSizeInfo{},
+		BulkFileSize:      &TransferSizeInfo{},
+		Status:            InProgress,
+	}
+
+	// if [preprocessFiles] is true then fetch the total number of files from the file tree
+	// total number of files in the current download session
+	// if [preprocessFiles] is false then [totalFiles] is 0
+	var totalFiles int64 = 0
+
+	// if [preprocessFiles] is true then fetch the total number of files from the file tree
+	// total number of directories in the current download session
+	// if [preprocessFiles] is false then [totalDirectories] is 0
+	var totalDirectories int64 = 0
+
+	// if [preprocessFiles] is true then fetch the total number of files from the file tree
+	// 	// total size of all the files combined in the current download session
+	// if [preprocessFiles] is false then [totalDirectories] is 0
+	var totalSize int64 = 0
+
+	var cache = downloadFilesObjectCache{}
+	if preprocessFiles {
+		for _, source := range sources {
+			_source := fixSlash(source)
+
+			_, _totalFiles, _totalDirectories, err := Walk(context.Background(), dev, storageId, _source, true, false, false,
+				func(objectId uint32, fi *FileInfo, err error) error {
+					if err != nil {
+						return err
+					}
+
+					sourceParentPath := path.Dir(_source)
+					destinationFileParentPath, destinationFilePath := mapSourcePathToDestinationPath(
+						fi.FullPath, sourceParentPath, _destination,
+					)
+
+					cache[destinationFilePath] = downloadFilesObjectCacheContainer{
+						fileInfo:                  fi,
+						sourceParentPath:          sourceParentPath,
+						destinationFileParentPath: destinationFileParentPath,
+						destinationFilePath:       destinationFilePath,
+					}
+
+					if fi.IsDir {
+						return nil
+					}
+
+					// filter out disallowed files
+					if isDisallowedFiles(nil, fi.Name) {
+						return nil
+					}
+
+					if err = preprocessCb(fi, nil); err != nil {
+						return err
+					}
+
+					totalSize += fi.Size
+
+					return nil
+				})
+
+			if err != nil {
+				return bulkFilesSent, bulkSizeSent, err
+			}
+
+			totalFiles += _totalFiles
+			totalDirectories += _totalDirectories
+		}
 	}
 
 	pInfo.TotalFiles = totalFiles
 	pInfo.TotalDirectories = totalDirectories
 	pInfo.BulkFileSize.Total = totalSize
 
-	for _, source := range sources {
-		_source := fixSlash(source)
-		sourceParentPath := filepath.Dir(_source)
+	dfProps := &processDownloadFilesProps{
+		bulkFilesSent: bulkFilesSent,
+		bulkSizeSent:  bulkSizeSent,
+		totalFiles:    totalFiles,
+		totalSize:     totalSize,
+		throughput:    newThroughputMeter(defaultThroughputWindow, pInfo.StartTime),
+	}
+
+	if len(cache) > 0 {
+		for _, c := range cache {
+			dfProps.sourceParentPath = c.sourceParentPath
+			dfProps.destinationFileParentPath = c.destinationFileParentPath
+			dfProps.destinationFilePath = c.destinationFilePath
+
+			err := processDownloadFiles(dev, &pInfo, c.fileInfo, progressCb, dfProps, nil)
+
+			if err != nil {
+				return processDownloadFilesError(dfProps, err)
+			}
+		}
+	} else {
+		for _, source := range sources {
+			_source := fixSlash(source)
+
+			_, err := GetObjectFromPath(dev, storageId, _source)
+			if err != nil {
+				return dfProps.bulkFilesSent, dfProps.bulkSizeSent, err
+			}
+
+			_, _, _, wErr := Walk(context.Background(), dev, storageId, _source, true, false, false,
+				func(objectId uint32, fi *FileInfo, err error) error {
+					if err != nil {
+						return err
+					}
+
+					sourceParentPath := path.Dir(_source)
+					destinationFileParentPath, destinationFilePath := mapSourcePathToDestinationPath(
+						fi.FullPath, sourceParentPath, _destination,
+					)
+					dfProps.sourceParentPath = sourceParentPath
+					dfProps.destinationFileParentPath = destinationFileParentPath
+					dfProps.destinationFilePath = destinationFilePath
+
+					return processDownloadFiles(dev, &pInfo, fi, progressCb, dfProps, nil)
+				})
+
+			if wErr != nil {
+				return processDownloadFilesError(dfProps, wErr)
+			}
+		}
+	}
+
+	pInfo.Status = Completed
+	if err := progressCb(&pInfo, nil); err != nil {
+		return dfProps.bulkFilesSent, dfProps.bulkSizeSent, err
+	}
+
+	return dfProps.bulkFilesSent, dfProps.bulkSizeSent, nil
+}
+
+// Transfer files from the device to the local disk
+// same as [DownloadFiles] but the local disk writes are pipelined with the device transfers
+// the files are always pre-processed, so the totals in [ProgressInfo] are available from the first callback
+// if [opts.StopOnError] is false then the files which fail to transfer are skipped and a [BatchError] listing them is returned at the end
+// sources: can be the list of files/directories that are to be sent to the local disk
+// destination: fullPath to the destination directory
+// return:
+// [bulkFilesSent]: total transferred files (directory count not included)
+// [bulkSizeSent]: total size of the downloaded files
+func DownloadFilesWithOpts(dev *mtp.Device, storageId uint32, sources []string, destination string,
+	opts DownloadOpts) (bulkFilesSent int64, bulkSizeSent int64, err error) {
+	_destination := fixSlash(destination)
+
+	pInfo := ProgressInfo{
+		FileInfo:          &FileInfo{},
+		StartTime:         time.Now(),
+		LatestSentTime:    time.Now(),
+		Speed:             0,
+		TotalFiles:        0,
+		TotalDirectories:  0,
+		FilesSent:         0,
+		FilesSentProgress: 0,
+		ActiveFileSize:    &TransferSizeInfo{},
+		BulkFileSize:      &TransferSizeInfo{},
+		Status:            InProgress,
+	}
+
+	var totalFiles int64 = 0
+	var totalDirectories int64 = 0
+	var totalSize int64 = 0
+
+	// list of objects to download in the walk order so that the parent directories are created before their children
+	var objects []downloadFilesObjectCacheContainer
+
+	// the local paths taken by the files of a flattened download
+	flattenedPaths := map[string]bool{}
+
+	// the files which failed to transfer; used only if [opts.StopOnError] is false
+	var failures []FileFailure
+
+	// an error returned by [opts.PreprocessCb], [opts.ProgressCb] or [opts.BatchProgressCb] always aborts the transfer
+	// except a [PauseSignal], which blocks the transfer until it's resumed
+	canceled := false
+	pausableProgressCb := pausableProgress(opts.ProgressCb)
+	progressCb := func(pInfo *ProgressInfo, err error) error {
+		if err := pausableProgressCb(pInfo, err); err != nil {
+			canceled = true
 
-		destinationFilesDict := map[string]uint32{
-			_destination: destParentId,
+			return err
 		}
 
-		// walk through the source
-		err = filepath.Walk(_source,
-			func(path string, fInfo os.FileInfo, err error) error {
+		if err := reportBatchProgress(opts.BatchProgressCb, pInfo); err != nil {
+			canceled = true
+
+			return err
+		}
+
+		return nil
+	}
+
+	for _, source := range sources {
+		_source := fixSlash(source)
+
+		_, _totalFiles, _totalDirectories, err := Walk(context.Background(), dev, storageId, _source, true, false, false,
+			func(objectId uint32, fi *FileInfo, err error) error {
 				if err != nil {
 					return err
 				}
 
-				name := fInfo.Name()
-
-				// don't follow symlinks
-				if isSymlinkLocal(fInfo) {
+				// filter out disallowed files
+				if isDisallowedFiles(opts.DisallowedFiles, fi.Name) {
 					return nil
 				}
 
-				// filter out disallowed files
-				if isDisallowedFiles(name) {
+				// the directories aren't recreated
+				if opts.Flatten && fi.IsDir {
 					return nil
 				}
 
-				sourceFilePath := fixSlash(path)
-
-				// map the local files path to the mtp files path
-				destinationParentPath, destinationFilePath := mapSourcePathToDestinationPath(
-					sourceFilePath, sourceParentPath, _destination,
+				sourceParentPath := path.Dir(_source)
+				destinationFileParentPath, destinationFilePath := mapSourcePathToDestinationPath(
+					fi.FullPath, sourceParentPath, _destination,
 				)
 
-				size := fInfo.Size()
-				isDir := fInfo.IsDir()
+				if opts.Flatten {
+					destinationFileParentPath = _destination
+					destinationFilePath = flattenedLocalPath(_destination, fi.Name, flattenedPaths)
+				}
 
-				// if the object is a directory then create a directory using [MakeDirectory] or [MakeDirectory]
-				if isDir {
-					// if the parent path Exists within the [destinationFilesDict] then fetch the [parentId] (value) and make the destination directory
-					if _, ok := destinationFilesDict[destinationParentPath]; ok {
-						objId, err := MakeDirectory(dev, storageId, destinationFilePath)
-						if err != nil {
-							return err
-						}
+				objects = append(objects, downloadFilesObjectCacheContainer{
+					fileInfo:                  fi,
+					sourceParentPath:          sourceParentPath,
+					destinationFileParentPath: destinationFileParentPath,
+					destinationFilePath:       destinationFilePath,
+				})
 
-						// append the current objectId to [destinationFilesDict]
-						destinationFilesDict[destinationFilePath] = objId
+				if fi.IsDir {
+					return nil
+				}
 
-						// if the parent path DOES NOT Exists within the [destinationFilesDict] create a new directory using costlier [MakeDirectory] method
-						// this is a fallback situation
-					} else {
-						objId, err := MakeDirectory(dev, storageId, _destination)
-						if err != nil {
-							return err
-						}
+				if opts.PreprocessCb != nil {
+					if err = opts.PreprocessCb(fi, nil); err != nil {
+						canceled = true
 
-						// append the current objectId to [destinationFilesDict]
-						destinationFilesDict[destinationFilePath] = objId
+						return err
 					}
+				}
+
+				totalSize += fi.Size
+
+				return nil
+			})
+
+		if err != nil {
+			if isDeviceDisconnected(err) {
+				return bulkFilesSent, bulkSizeSent, deviceDisconnectedError(err)
+			}
+
+			if opts.StopOnError || canceled {
+				return bulkFilesSent, bulkSizeSent, err
+			}
+
+			failures = append(failures, FileFailure{FullPath: _source, Err: err})
+		}
+
+		totalFiles += _totalFiles
+		totalDirectories += _totalDirectories
+	}
+
+	pInfo.TotalFiles = totalFiles
+	pInfo.TotalDirectories = totalDirectories
+	pInfo.BulkFileSize.Total = totalSize
+
+	dfProps := &processDownloadFilesProps{
+		bulkFilesSent:       bulkFilesSent,
+		bulkSizeSent:        bulkSizeSent,
+		totalFiles:          totalFiles,
+		totalSize:           totalSize,
+		throughput:          newThroughputMeter(opts.ThroughputWindow, pInfo.StartTime),
+		disallowedFiles:     opts.DisallowedFiles,
+		progressInterval:    opts.ProgressInterval,
+		progressMinBytes:    opts.ProgressMinBytes,
+		dirMode:             opts.DirMode,
+		fileMode:            opts.FileMode,
+		skipPreserveModTime: opts.SkipPreserveModTime,
+	}
+
+	pool := newLocalFileWriterPool(opts.Concurrency, opts.BufferSize)
+
+	for _, c := range objects {
+		dfProps.sourceParentPath = c.sourceParentPath
+		dfProps.destinationFileParentPath = c.destinationFileParentPath
+		dfProps.destinationFilePath = c.destinationFilePath
+
+		filesSent := dfProps.bulkFilesSent
+
+		err := processDownloadFiles(dev, &pInfo, c.fileInfo, progressCb, dfProps, pool)
+
+		// stop early if any of the background writes have failed
+		if err == nil && opts.StopOnError {
+			err = pool.firstErr()
+		}
+
+		if err != nil {
+			// the remaining files can't be transferred either
+			if opts.StopOnError || canceled || isDeviceDisconnected(err) {
+				_ = pool.wait()
+
+				return processDownloadFilesError(dfProps, err)
+			}
+
+			// the failed files are not counted
+			dfProps.bulkFilesSent = filesSent
+
+			_, _, err = processDownloadFilesError(dfProps, err)
+			failures = append(failures, FileFailure{FullPath: c.fileInfo.FullPath, Err: err})
+
+			continue
+		}
+
+		if opts.WriteSidecar && !c.fileInfo.IsDir {
+			if err := writeSidecar(dev, c.fileInfo, c.destinationFilePath, opts.SidecarProps); err != nil {
+				if opts.StopOnError || isDeviceDisconnected(err) {
+					_ = pool.wait()
+
+					return dfProps.bulkFilesSent, dfProps.bulkSizeSent, err
+				}
+
+				failures = append(failures, FileFailure{FullPath: c.fileInfo.FullPath, Err: err})
+			}
+		}
+	}
+
+	if err := pool.wait(); err != nil {
+		if opts.StopOnError {
+			return processDownloadFilesError(dfProps, err)
+		}
+
+		for _, f := range pool.writeFailures() {
+			_, _, err = processDownloadFilesError(dfProps, f.Err)
+			failures = append(failures, FileFailure{FullPath: f.FullPath, Err: err})
+		}
+	}
+
+	pInfo.Status = Completed
+	if err := progressCb(&pInfo, nil); err != nil {
+		return dfProps.bulkFilesSent, dfProps.bulkSizeSent, err
+	}
+
+	if len(failures) > 0 {
+		return dfProps.bulkFilesSent, dfProps.bulkSizeSent, BatchError{Failures: failures}
+	}
+
+	return dfProps.bulkFilesSent, dfProps.bulkSizeSent, nil
+}
+
+// Resume an interrupted download of the file [objectId] into the local file [destination]
+// if [destination] exists and is smaller than the object then only the remaining bytes are fetched using GetPartialObject and appended to it
+// the whole object is downloaded again if the device doesn't support GetPartialObject
+// or if [destination] is larger than the object (corrupted)
+func DownloadFileResume(dev *mtp.Device, objectId uint32, destination string) error {
+	fi, err := GetObjectFromObjectId(dev, objectId, "")
+	if err != nil {
+		return err
+	}
+
+	if fi.IsDir {
+		return InvalidPathError{error: fmt.Errorf("invalid object: %d. The object is a directory", objectId)}
+	}
+
+	var offset int64 = 0
+
+	lfi, err := os.Stat(destination)
+	if err == nil {
+		if lfi.IsDir() {
+			return InvalidPathError{error: fmt.Errorf("invalid path: %s. The destination is a directory", destination)}
+		}
+
+		offset = lfi.Size()
+	} else if !os.IsNotExist(err) {
+		return LocalFileError{error: err}
+	}
+
+	// the local file is already complete
+	if offset == fi.Size {
+		return nil
+	}
+
+	// the local file is larger than the object; restart the download
+	if offset > fi.Size {
+		offset = 0
+	}
+
+	var opCode uint16
+	if offset > 0 {
+		opCode, err = partialObjectOpCode(dev, fi.Size)
+		if err != nil {
+			return err
+		}
+
+		// fallback to a full download
+		if opCode == 0 {
+			offset = 0
+		}
+	}
+
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if offset > 0 {
+		flag = os.O_WRONLY | os.O_APPEND
+	}
+
+	f, err := os.OpenFile(destination, flag, 0666)
+	if err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			return FilePermissionError{error: err}
+		}
+
+		return LocalFileError{error: err}
+	}
+	defer f.Close()
+
+	if offset == 0 {
+		g := &callGuard{}
+		if err := withCallTimeout(dev, g, func() error {
+			return dev.GetObject(objectId, g.writer(f), mtp.EmptyProgressFunc)
+		}); err != nil {
+			return FileTransferError{error: err}
+		}
+
+		return nil
+	}
+
+	for offset < fi.Size {
+		size := fi.Size - offset
+		if size > math.MaxUint32 {
+			size = math.MaxUint32
+		}
+
+		if err := handleGetPartialObject(dev, opCode, objectId, f, offset, uint32(size)); err != nil {
+			return err
+		}
+
+		offset += size
+	}
+
+	return nil
+}
+
+// Resume an interrupted upload of the local file [localPath] into the directory [parentId]
+// the file is appended in chunks to the object ".{name}.{size}-{mtime}.mtpx-partial" using the Android edit extension (SendPartialObject),
+// which is renamed to the name of [localPath] once it is complete; an existing file with that name is replaced.
+// if the incomplete object of an earlier attempt exists and isn't larger than the local file then only the remaining bytes are sent;
+// the name of the object holds the size and the modification time of the local file, so a modified file is uploaded from the start
+// the whole file is sent using SendObject if the device doesn't support the extension (see [Capabilities.SupportsEditObject])
+// return:
+// [objectId]: objectId of the uploaded file
+func UploadFileResume(dev *mtp.Device, storageId, parentId uint32, localPath string) (uint32, error) {
+	lfi, err := os.Stat(localPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, InvalidPathError{error: fmt.Errorf("invalid path: %s. The file does not exist", localPath)}
+		}
+
+		return 0, LocalFileError{error: err}
+	}
+
+	if lfi.IsDir() {
+		return 0, InvalidPathError{error: fmt.Errorf("invalid path: %s. The file is a directory", localPath)}
+	}
+
+	filename, err := checkFilename(dev, lfi.Name())
+	if err != nil {
+		return 0, err
+	}
+
+	if err := checkStorageWritable(dev, storageId, false); err != nil {
+		return 0, err
+	}
+
+	f, err := os.Open(localPath)
+	if err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			return 0, FilePermissionError{error: err}
+		}
+
+		return 0, LocalFileError{error: err}
+	}
+	defer f.Close()
+
+	c, err := GetDeviceCapabilities(dev)
+	if err != nil {
+		return 0, err
+	}
+
+	size := lfi.Size()
+
+	// fallback to a full upload; the object is still sent under a temporary name if the device can rename it
+	if !c.SupportsEditObject() || !c.SupportsOperation(mtp.OC_MTP_SetObjectPropValue) {
+		var compressedSize uint32
+		if size > 0xFFFFFFFF {
+			compressedSize = 0xFFFFFFFF
+		} else {
+			compressedSize = uint32(size)
+		}
+
+		obj := mtp.ObjectInfo{
+			StorageID:        storageId,
+			ObjectFormat:     objectFormat(filename),
+			ParentObject:     parentId,
+			Filename:         filename,
+			CompressedSize:   compressedSize,
+			ModificationDate: lfi.ModTime(),
+		}
+
+		return handleMakeFile(dev, storageId, &obj, &lfi, f, ConflictOverwrite, false, false, false, c.SupportsOperation(mtp.OC_MTP_SetObjectPropValue), transferBuffers,
+			func(total, sent int64, objectId uint32, err error) error {
+				return err
+			})
+	}
+
+	tmpName := resumableUploadFilename(dev, filename, size, lfi.ModTime())
+
+	var objectId uint32
+	var offset int64
+
+	partialFi, err := GetObjectFromParentIdAndFilename(dev, storageId, parentId, tmpName)
+	if err == nil {
+		if !partialFi.IsDir && partialFi.Size <= size {
+			objectId = partialFi.ObjectId
+			offset = partialFi.Size
+		} else {
+			// the incomplete object doesn't belong to this file; restart the upload
+			if err := deleteFile(dev, storageId, []FileProp{{partialFi.ObjectId, ""}}); err != nil {
+				return 0, err
+			}
+		}
+	} else if _, ok := err.(FileNotFoundError); !ok {
+		return 0, err
+	}
+
+	// create an empty object which the chunks are appended to
+	if objectId == 0 {
+		w, _objectId, err := createObjectWriter(dev, storageId, parentId, tmpName, objectFormat(filename), 0)
+		if err != nil {
+			return 0, err
+		}
+
+		if err := w.Close(); err != nil {
+			return 0, err
+		}
+
+		objectId = _objectId
+	}
+
+	for offset < size {
+		chunk := size - offset
+		if chunk > resumableUploadChunkSize {
+			chunk = resumableUploadChunkSize
+		}
+
+		if err := handleAppendPartialObject(dev, objectId, f, offset, chunk); err != nil {
+			return objectId, err
+		}
+
+		offset += chunk
+	}
+
+	var existingObjectId uint32
+	existingFi, err := GetObjectFromParentIdAndFilename(dev, storageId, parentId, filename)
+	if err == nil {
+		if existingFi.IsDir {
+			return objectId, FileAlreadyExistsError{error: fmt.Errorf("a directory with the name %s already exists", filename)}
+		}
+
+		existingObjectId = existingFi.ObjectId
+	} else if _, ok := err.(FileNotFoundError); !ok {
+		return objectId, err
+	}
+
+	defer invalidateCaches(dev, storageId, parentId)
+
+	if err := commitAtomicUpload(dev, storageId, parentId, objectId, existingObjectId, filename); err != nil {
+		return objectId, err
+	}
+
+	return objectId, nil
+}
+
+// Fetch the thumbnail (usually a JPEG) of the object [objectId] without downloading the object
+// the MTP GetThumb operation is used; the OPC_RepresentativeSampleData property is read if GetThumb isn't supported or has no thumbnail
+// a [ThumbnailUnavailableError] is returned if neither of them is available for the object
+func GetThumbnail(dev *mtp.Device, objectId uint32) ([]byte, error) {
+	c, err := GetDeviceCapabilities(dev)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.SupportsOperation(mtp.OC_GetThumb) {
+		data, err := handleGetThumb(dev, objectId)
+		if err != nil && !isThumbnailUnavailable(err) {
+			return nil, fileObjectError(err)
+		}
+
+		if len(data) > 0 {
+			return data, nil
+		}
+	}
+
+	if c.SupportsOperation(mtp.OC_MTP_GetObjectPropValue) {
+		data, err := handleGetRepresentativeSampleData(dev, objectId)
+		if err != nil && !isThumbnailUnavailable(err) {
+			return nil, fileObjectError(err)
+		}
+
+		if len(data) > 0 {
+			return data, nil
+		}
+	}
+
+	return nil, ThumbnailUnavailableError{error: fmt.Errorf("thumbnail is not available for the objectId: %d", objectId)}
+}
+
+// Detect the content type (eg: "image/jpeg") of the file [objectId] from its leading bytes using [http.DetectContentType]
+// useful for the files whose extension is missing or wrong; see [FileInfo.MimeType]
+// the first 512 bytes are read using GetPartialObject; if the device doesn't support it, the object is read using GetObject
+// and only its first 512 bytes are kept. the objects smaller than 512 bytes are sniffed as a whole
+// an [UnsupportedOperationError] is returned if the device supports neither GetPartialObject nor GetObject
+func DetectContentType(dev *mtp.Device, objectId uint32) (string, error) {
+	fi, err := GetObjectFromObjectId(dev, objectId, "")
+	if err != nil {
+		return "", err
+	}
+
+	if fi.IsDir {
+		return "", InvalidPathError{error: fmt.Errorf("invalid object: %d. The object is a directory", objectId)}
+	}
+
+	head, err := readObjectHead(dev, fi, contentSniffLength)
+	if err != nil {
+		return "", err
+	}
+
+	return http.DetectContentType(head), nil
+}
+
+// Fetch the value of the object property [propCode] (mtp.OPC_*) of the object [objectId]
+// the value is decoded using the datatype from the property description of the object format:
+// int8 ... uint64 for the integers, [16]byte for the 128-bit integers, string for the strings and []interface{} for the arrays
+// an [UnsupportedOperationError] is returned if the device doesn't support the property for the object;
+// the properties which aren't listed by [GetSupportedProps] for the object format are rejected without requesting them
+func GetObjectProperty(dev *mtp.Device, objectId uint32, propCode uint16) (interface{}, error) {
+	obj := mtp.ObjectInfo{}
+	if err := withCallTimeout(dev, nil, func() error {
+		return dev.GetObjectInfo(objectId, &obj)
+	}); err != nil {
+		return nil, fileObjectError(err)
+	}
+
+	return getObjectProperty(dev, objectId, obj.ObjectFormat, propCode)
+}
+
+// helper function of [GetObjectProperty] for the object [objectId] of the object format [format]
+func getObjectProperty(dev *mtp.Device, objectId uint32, format, propCode uint16) (interface{}, error) {
+	supported, err := isObjectPropSupported(dev, format, propCode)
+	if err != nil {
+		return nil, err
+	}
+
+	if !supported {
+		return nil, UnsupportedOperationError{error: fmt.Errorf("object property 0x%04x is not supported for the object format 0x%04x", propCode, format)}
+	}
+
+	dataType, _, err := handleGetObjectPropDesc(dev, propCode, format)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := handleGetObjectPropValue(dev, objectId, propCode)
+	if err != nil {
+		return nil, fileObjectError(err)
+	}
+
+	value, err := decodeObjectPropValue(bytes.NewReader(data), dataType)
+	if err != nil {
+		return nil, FileObjectError{error: fmt.Errorf("unable to decode the object property 0x%04x: %v", propCode, err)}
+	}
+
+	return value, nil
+}
+
+// Fetch the value of the string object property [propCode] (mtp.OPC_*) of the object [objectId]
+// see [GetObjectProperty]
+func GetObjectPropertyString(dev *mtp.Device, objectId uint32, propCode uint16) (string, error) {
+	value, err := GetObjectProperty(dev, objectId, propCode)
+	if err != nil {
+		return "", err
+	}
+
+	str, ok := value.(string)
+	if !ok {
+		return "", FileObjectError{error: fmt.Errorf("object property 0x%04x is not a string: %T", propCode, value)}
+	}
+
+	return str, nil
+}
+
+// Set the value of the object property [propCode] (mtp.OPC_*) of the object [objectId]
+// the [value] is encoded using the datatype from the property description of the object format, so its type should match
+// the one returned by [GetObjectProperty]; a [TypeMismatchError] is returned otherwise
+// a [ReadOnlyPropertyError] is returned if the device doesn't allow writing the property
+func SetObjectProperty(dev *mtp.Device, objectId uint32, propCode uint16, value interface{}) error {
+	obj := mtp.ObjectInfo{}
+	if err := withCallTimeout(dev, nil, func() error {
+		return dev.GetObjectInfo(objectId, &obj)
+	}); err != nil {
+		return fileObjectError(err)
+	}
 
-					return nil
-				}
+	dataType, writable, err := handleGetObjectPropDesc(dev, propCode, obj.ObjectFormat)
+	if err != nil {
+		return err
+	}
 
-				/// if the object is a file then create a file
-				var fileParentId uint32
+	if !writable {
+		return ReadOnlyPropertyError{error: fmt.Errorf("object property 0x%04x is read-only for the object format 0x%04x", propCode, obj.ObjectFormat)}
+	}
 
-				_parentId, ok := destinationFilesDict[destinationParentPath]
-				if ok {
-					// if [destinationParentPath] Exists within [destinationFilesDict] then use the value of the [destinationFilesDict] item as [parentId]
-					fileParentId = _parentId
+	var buf bytes.Buffer
+	if err := encodeObjectPropValue(&buf, value, dataType); err != nil {
+		return err
+	}
 
-				} else {
-					// if [destinationParentPath] DOES NOT Exists within [destinationFilesDict] then create the parent directory using [MakeDirectory] and use the resulting objId as [parentId]
-					objId, err := MakeDirectory(dev, storageId, destinationParentPath)
+	if err := handleSetObjectPropValue(dev, objectId, propCode, buf.Bytes()); err != nil {
+		return fileObjectError(err)
+	}
 
-					if err != nil {
-						return err
-					}
+	return nil
+}
 
-					// append the current objectId to [destinationFilesDict]
-					destinationFilesDict[destinationFilePath] = objId
+// Fetch the objectIds referenced by the object [objectId] in their order (eg: the tracks of a playlist or an album)
+// an [UnsupportedOperationError] is returned if the device doesn't support GetObjectReferences
+func GetObjectReferences(dev *mtp.Device, objectId uint32) ([]uint32, error) {
+	supported, err := isOperationSupported(dev, mtp.OC_MTP_GetObjectReferences)
+	if err != nil {
+		return nil, err
+	}
 
-					fileParentId = objId
-				}
+	if !supported {
+		return nil, UnsupportedOperationError{error: fmt.Errorf("GetObjectReferences is not supported by the device")}
+	}
 
-				// read the local file
-				fileBuf, err := os.Open(sourceFilePath)
-				if err != nil {
-					return InvalidPathError{error: err}
-				}
-				defer fileBuf.Close()
+	refs := mtp.Uint32Array{}
+	if err := withCallTimeout(dev, nil, func() error {
+		return handleGetObjectReferences(dev, objectId, &refs)
+	}); err != nil {
+		if _, ok := err.(TransactionTimeoutError); ok {
+			return nil, err
+		}
 
-				var compressedSize uint32
+		return nil, fileObjectError(err)
+	}
 
-				// assign compressedSize of the file
-				if size > 0xFFFFFFFF {
-					compressedSize = 0xFFFFFFFF
-				} else {
-					compressedSize = uint32(size)
-				}
+	return refs.Values, nil
+}
 
-				fObj := mtp.ObjectInfo{
-					StorageID:        storageId,
-					ObjectFormat:     mtp.OFC_Undefined,
-					ParentObject:     fileParentId,
-					Filename:         name,
-					CompressedSize:   compressedSize,
-					ModificationDate: time.Now(),
-				}
+// Replace the references of the object [objectId] with [refs]; their order is kept
+// an [UnsupportedOperationError] is returned if the device doesn't support SetObjectReferences
+func SetObjectReferences(dev *mtp.Device, objectId uint32, refs []uint32) error {
+	supported, err := isOperationSupported(dev, mtp.OC_MTP_SetObjectReferences)
+	if err != nil {
+		return err
+	}
 
-				// keep track of [bulkFilesSent]
-				bulkFilesSent += 1
+	if !supported {
+		return UnsupportedOperationError{error: fmt.Errorf("SetObjectReferences is not supported by the device")}
+	}
 
-				pInfo.FileInfo = &FileInfo{
-					Info:       &fObj,
-					Size:       size,
-					IsDir:      isDir,
-					ModTime:    fObj.ModificationDate,
-					Name:       fObj.Filename,
-					FullPath:   destinationFilePath,
-					ParentPath: destinationParentPath,
-					Extension:  extension(fObj.Filename, isDir),
-					ParentId:   fObj.ParentObject,
-				}
-				pInfo.LatestSentTime = time.Now()
+	if err := withCallTimeout(dev, nil, func() error {
+		return handleSetObjectReferences(dev, objectId, refs)
+	}); err != nil {
+		if _, ok := err.(TransactionTimeoutError); ok {
+			return err
+		}
 
-				// create file
-				var prevSentSize int64 = 0
-				objId, err := handleMakeFile(
-					dev, storageId, &fObj, &fInfo, fileBuf,
-					true,
-					func(total, sent int64, objId uint32, err error) error {
-						if err != nil {
-							return err
-						}
+		return fileObjectError(err)
+	}
 
-						pInfo.FileInfo.ObjectId = objId
-						pInfo.ActiveFileSize.Total = total
-						pInfo.ActiveFileSize.Sent = sent
-						pInfo.ActiveFileSize.Progress = Percent(float32(sent), float32(total))
+	return nil
+}
 
-						chunkSize := sent - prevSentSize
-						bulkSizeSent += chunkSize
+// Fetch the objects referenced by the object [objectId] (eg: a playlist) in their order; see [GetObjectReferences]
+// the references to the objects which no longer exist are skipped
+// the full paths are resolved using a shared [PathCache]; the referenced objects may belong to different storages
+// (eg: a playlist on the internal storage referencing the tracks of an SD card) and each of them is resolved on its own storage
+func GetReferencedObjects(dev *mtp.Device, objectId uint32) ([]*FileInfo, error) {
+	refs, err := GetObjectReferences(dev, objectId)
+	if err != nil {
+		return nil, err
+	}
 
-						pInfo.BulkFileSize.Sent = bulkSizeSent
-						pInfo.BulkFileSize.Progress = Percent(float32(bulkSizeSent), float32(totalSize))
+	cache := NewPathCache()
+	result := make([]*FileInfo, 0, len(refs))
 
-						pInfo.Speed = transferRate(chunkSize, pInfo.LatestSentTime)
-						if err = progressCb(&pInfo, nil); err != nil {
-							return err
-						}
+	for _, ref := range refs {
+		fullPath, err := ResolveObjectPathCached(dev, mtp.GOH_ALL_STORAGE, ref, cache)
+		if err != nil {
+			if isInvalidObjectError(err) {
+				continue
+			}
 
-						pInfo.LatestSentTime = time.Now()
-						prevSentSize = sent
+			return nil, err
+		}
 
-						return nil
-					},
-				)
+		fi, err := GetObjectFromObjectId(dev, ref, path.Dir(fullPath))
+		if err != nil {
+			if isInvalidObjectError(err) {
+				continue
+			}
 
-				if err != nil {
-					return err
-				}
+			return nil, err
+		}
 
-				pInfo.FilesSent = bulkFilesSent
-				pInfo.FilesSentProgress = Percent(float32(bulkFilesSent), float32(totalFiles))
+		result = append(result, fi)
+	}
 
-				pInfo.FileInfo.ObjectId = objId
+	return result, nil
+}
 
-				// append the current objectId to [destinationFilesDict]
-				destinationFilesDict[destinationFilePath] = objId
+// Download the file [objectId] to all of [writers] using a single GetObject (eg: a local file and a [hash.Hash])
+// once a writer fails the rest of the object is still read from the device but no longer written, and a [WriterError]
+// holding the position of the failed writer is returned; the other writers may have received a part of the object
+func DownloadObjectTo(dev *mtp.Device, objectId uint32, writers ...io.Writer) error {
+	if len(writers) < 1 {
+		return FileTransferError{error: fmt.Errorf("unable to download the object %d. no writer was given", objectId)}
+	}
 
-				return nil
-			},
-		)
+	fi, err := GetObjectFromObjectId(dev, objectId, "")
+	if err != nil {
+		return err
+	}
 
-		if err != nil {
-			switch err.(type) {
-			case InvalidPathError:
-				return destParentId, bulkFilesSent, bulkSizeSent, err
+	if fi.IsDir {
+		return InvalidPathError{error: fmt.Errorf("invalid object: %d. The object is a directory", objectId)}
+	}
 
-			case *os.PathError:
-				if errors.Is(err, os.ErrPermission) {
-					return destParentId, bulkFilesSent, bulkSizeSent, FilePermissionError{error: err}
-				}
+	w := &fanOutWriter{writers: writers}
 
-				if errors.Is(err, os.ErrNotExist) {
-					return destParentId, bulkFilesSent, bulkSizeSent, InvalidPathError{error: err}
-				}
+	g := &callGuard{}
+	if err := withCallTimeout(dev, g, func() error {
+		return dev.GetObject(objectId, g.writer(w), mtp.EmptyProgressFunc)
+	}); err != nil {
+		if _, ok := err.(TransactionTimeoutError); ok {
+			return err
+		}
 
-				return destParentId, bulkFilesSent, bulkSizeSent, LocalFileError{error: err}
-			default:
-				return destParentId, bulkFilesSent, bulkSizeSent,
-					FileTransferError{error: fmt.Errorf("an error occured while uploading files. %+v", err.Error())}
-			}
+		if isDeviceDisconnected(err) {
+			return DeviceDisconnectedError{error: err}
 		}
-	}
 
-	pInfo.Status = Completed
-	if err := progressCb(&pInfo, nil); err != nil {
-		return destParentId, bulkFilesSent, bulkSizeSent, err
+		return FileTransferError{error: err}
 	}
 
-	return destParentId, bulkFilesSent, bulkSizeSent, nil
+	return w.err
 }
 
-// Transfer files from the device to the local disk
-// sources: can be the list of files/directories that are to be sent to the local disk
-// destination: fullPath to the destination directory
-// return:
-// [totalFiles]: total transferred files (directory count not included)
-// [totalSize]: total size of the uploaded files
-func DownloadFiles(dev *mtp.Device, storageId uint32, sources []string, destination string,
-	preprocessFiles bool, preprocessCb MtpPreprocessCb, progressCb ProgressCb) (bulkFilesSent int64, bulkSizeSent int64, err error) {
-	_destination := fixSlash(destination)
+// Stream the file [objectId] from the device without writing it to the local disk
+// the object is fetched using GetObject in the background and the bytes are read from the returned reader;
+// a device error is returned by the final Read
+// note: an [mtp.Device] is not concurrency safe; only one stream may be active per device at a time
+// and opening a second one returns a [DeviceBusyError]. The device is released once the object was read fully or the reader is closed.
+// Always close the reader.
+func OpenObject(dev *mtp.Device, objectId uint32) (io.ReadCloser, error) {
+	fi, err := GetObjectFromObjectId(dev, objectId, "")
+	if err != nil {
+		return nil, err
+	}
 
-	pInfo := ProgressInfo{
-		FileInfo:          &FileInfo{},
-		StartTime:         time.Now(),
-		LatestSentTime:    time.Now(),
-		Speed:             0,
-		TotalFiles:        0,
-		TotalDirectories:  0,
-		FilesSent:         0,
-		FilesSentProgress: 0,
-		ActiveFileSize:    &TransferSizeInfo{},
-		BulkFileSize:      &TransferSizeInfo{},
-		Status:            InProgress,
+	if fi.IsDir {
+		return nil, InvalidPathError{error: fmt.Errorf("invalid object: %d. The object is a directory", objectId)}
 	}
 
-	// if [preprocessFiles] is true then fetch the total number of files from the file tree
-	// total number of files in the current download session
-	// if [preprocessFiles] is false then [totalFiles] is 0
-	var totalFiles int64 = 0
+	if _, busy := activeObjectStreams.LoadOrStore(dev, objectId); busy {
+		return nil, DeviceBusyError{error: fmt.Errorf("unable to open the object: %d. another object stream is active on the device", objectId)}
+	}
 
-	// if [preprocessFiles] is true then fetch the total number of files from the file tree
-	// total number of directories in the current download session
-	// if [preprocessFiles] is false then [totalDirectories] is 0
-	var totalDirectories int64 = 0
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
 
-	// if [preprocessFiles] is true then fetch the total number of files from the file tree
-	// 	// total size of all the files combined in the current download session
-	// if [preprocessFiles] is false then [totalDirectories] is 0
-	var totalSize int64 = 0
+	go func() {
+		defer close(done)
 
-	var cache = downloadFilesObjectCache{}
-	if preprocessFiles {
-		for _, source := range sources {
-			_source := fixSlash(source)
+		err := dev.GetObject(objectId, pw, mtp.EmptyProgressFunc)
 
-			_, _totalFiles, _totalDirectories, err := Walk(dev, storageId, _source, true, false, false,
-				func(objectId uint32, fi *FileInfo, err error) error {
-					if err != nil {
-						return err
-					}
+		// release the device before the reader sees the end of the stream
+		activeObjectStreams.Delete(dev)
 
-					sourceParentPath := filepath.Dir(_source)
-					destinationFileParentPath, destinationFilePath := mapSourcePathToDestinationPath(
-						fi.FullPath, sourceParentPath, _destination,
-					)
+		if err != nil {
+			_ = pw.CloseWithError(FileTransferError{error: err})
 
-					cache[destinationFilePath] = downloadFilesObjectCacheContainer{
-						fileInfo:                  fi,
-						sourceParentPath:          sourceParentPath,
-						destinationFileParentPath: destinationFileParentPath,
-						destinationFilePath:       destinationFilePath,
-					}
+			return
+		}
 
-					if fi.IsDir {
-						return nil
-					}
+		_ = pw.Close()
+	}()
 
-					// filter out disallowed files
-					if isDisallowedFiles(fi.Name) {
-						return nil
-					}
+	return &objectReader{pr: pr, done: done}, nil
+}
 
-					if err = preprocessCb(fi, nil); err != nil {
-						return err
-					}
+// Create the file [filename] inside the directory [parentId] and stream its content through the returned writer
+// MTP requires the size of an object before its content is sent, so exactly [expectedSize] bytes must be written;
+// writing more bytes fails and closing the writer after fewer bytes returns a [SendObjectError] and removes the incomplete object
+// a [FileAlreadyExistsError] is returned if [filename] already exists in the directory
+// [filename] is checked against the [FilenamePolicy] of the device
+// call [ObjectWriter.Abort] instead of Close to give up on the upload; the incomplete object is deleted
+// note: same as [OpenObject], only one stream may be active per device at a time. Always close or abort the writer.
+// return:
+// [objectId]: objectId of the new file
+func CreateObjectWriter(dev *mtp.Device, storageId, parentId uint32, filename string, expectedSize int64) (w ObjectWriter, objectId uint32, err error) {
+	if err := checkStorageWritable(dev, storageId, false); err != nil {
+		return nil, 0, err
+	}
 
-					totalSize += fi.Size
+	return createObjectWriter(dev, storageId, parentId, filename, objectFormat(filename), expectedSize)
+}
 
-					return nil
-				})
+// helper function of [CreateObjectWriter] which creates the object using the object format [format] (mtp.OFC_*)
+// the storage isn't checked using [checkStorageWritable]
+func createObjectWriter(dev *mtp.Device, storageId, parentId uint32, filename string, format uint16, expectedSize int64) (w ObjectWriter, objectId uint32, err error) {
+	if expectedSize < 0 {
+		return nil, 0, SendObjectError{error: fmt.Errorf("invalid size: %d", expectedSize)}
+	}
 
-			if err != nil {
-				return bulkFilesSent, bulkSizeSent, err
-			}
+	if filename == "" || strings.Contains(filename, PathSep) {
+		return nil, 0, InvalidPathError{error: fmt.Errorf("invalid filename: %s", filename)}
+	}
 
-			totalFiles += _totalFiles
-			totalDirectories += _totalDirectories
-		}
+	filename, err = checkFilename(dev, filename)
+	if err != nil {
+		return nil, 0, err
 	}
 
-	pInfo.TotalFiles = totalFiles
-	pInfo.TotalDirectories = totalDirectories
-	pInfo.BulkFileSize.Total = totalSize
+	parentId = fixParentId(parentId)
 
-	dfProps := &processDownloadFilesProps{
-		bulkFilesSent: bulkFilesSent,
-		bulkSizeSent:  bulkSizeSent,
-		totalFiles:    totalFiles,
-		totalSize:     totalSize,
+	_, err = GetObjectFromParentIdAndFilename(dev, storageId, parentId, filename)
+	if err == nil {
+		return nil, 0, FileAlreadyExistsError{error: fmt.Errorf("file already exists: %s", filename)}
 	}
 
-	if len(cache) > 0 {
-		for _, c := range cache {
-			dfProps.sourceParentPath = c.sourceParentPath
-			dfProps.destinationFileParentPath = c.destinationFileParentPath
-			dfProps.destinationFilePath = c.destinationFilePath
+	switch err.(type) {
+	case FileNotFoundError:
 
-			err := processDownloadFiles(dev, &pInfo, c.fileInfo, progressCb, dfProps)
+	default:
+		return nil, 0, err
+	}
 
-			if err != nil {
-				return processDownloadFilesError(dfProps, err)
-			}
-		}
-	} else {
-		for _, source := range sources {
-			_source := fixSlash(source)
+	if _, busy := activeObjectStreams.LoadOrStore(dev, parentId); busy {
+		return nil, 0, DeviceBusyError{error: fmt.Errorf("unable to create the object: %s. another object stream is active on the device", filename)}
+	}
 
-			_, err := GetObjectFromPath(dev, storageId, _source)
-			if err != nil {
-				return dfProps.bulkFilesSent, dfProps.bulkSizeSent, err
-			}
+	var compressedSize uint32
+	if expectedSize > 0xFFFFFFFF {
+		compressedSize = 0xFFFFFFFF
+	} else {
+		compressedSize = uint32(expectedSize)
+	}
 
-			_, _, _, wErr := Walk(dev, storageId, _source, true, false, false,
-				func(objectId uint32, fi *FileInfo, err error) error {
-					if err != nil {
-						return err
-					}
+	obj := mtp.ObjectInfo{
+		StorageID:        storageId,
+		ObjectFormat:     format,
+		ParentObject:     parentId,
+		Filename:         filename,
+		CompressedSize:   compressedSize,
+		ModificationDate: time.Now(),
+	}
 
-					sourceParentPath := filepath.Dir(_source)
-					destinationFileParentPath, destinationFilePath := mapSourcePathToDestinationPath(
-						fi.FullPath, sourceParentPath, _destination,
-					)
-					dfProps.sourceParentPath = sourceParentPath
-					dfProps.destinationFileParentPath = destinationFileParentPath
-					dfProps.destinationFilePath = destinationFilePath
+	err = withCallTimeout(dev, nil, func() (err error) {
+		_, _, objectId, err = dev.SendObjectInfo(storageId, parentId, &obj)
 
-					return processDownloadFiles(dev, &pInfo, fi, progressCb, dfProps)
-				})
+		return err
+	})
+	if err != nil {
+		activeObjectStreams.Delete(dev)
 
-			if wErr != nil {
-				return processDownloadFilesError(dfProps, wErr)
-			}
-		}
+		return nil, 0, SendObjectError{error: err}
 	}
 
-	pInfo.Status = Completed
-	if err := progressCb(&pInfo, nil); err != nil {
-		return dfProps.bulkFilesSent, dfProps.bulkSizeSent, err
+	invalidateCaches(dev, storageId, parentId)
+
+	pr, pw := io.Pipe()
+	ow := &objectWriter{
+		dev:          dev,
+		storageId:    storageId,
+		objectId:     objectId,
+		expectedSize: expectedSize,
+		pw:           pw,
+		done:         make(chan error, 1),
+		buf:          transferBuffers.get(),
 	}
 
-	return dfProps.bulkFilesSent, dfProps.bulkSizeSent, nil
+	go func() {
+		err := dev.SendObject(pr, expectedSize, mtp.EmptyProgressFunc)
+
+		// stop the writes if the transaction failed
+		_ = pr.CloseWithError(err)
+
+		ow.done <- err
+	}()
+
+	return ow, objectId, nil
 }
 
 func main() {}
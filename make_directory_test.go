@@ -74,6 +74,32 @@ func TestMakeDirectory(t *testing.T) {
 		So(fi.IsDir, ShouldEqual, true)
 	})
 
+	Convey("Creating the missing parents | MakeDirectory", t, func() {
+		// test the directory '/mtp-test-files/temp_dir/test-MakeDirectory/{random}/2024/January'
+		parentPath := fmt.Sprintf("/mtp-test-files/temp_dir/test-MakeDirectory/%x", rand.Int31())
+		fullpath := getFullPath(parentPath, "2024/January")
+
+		objectId, err := MakeDirectory(dev, sid, fullpath)
+		So(err, ShouldBeNil)
+		So(objectId, ShouldBeGreaterThan, 0)
+
+		for _, p := range []string{parentPath, getFullPath(parentPath, "2024")} {
+			fi, err := GetObjectFromPath(dev, sid, p)
+			So(err, ShouldBeNil)
+			So(fi.IsDir, ShouldEqual, true)
+		}
+
+		fi, err := GetObjectFromPath(dev, sid, fullpath)
+		So(err, ShouldBeNil)
+		So(fi.ObjectId, ShouldEqual, objectId)
+		So(fi.ParentPath, ShouldEqual, getFullPath(parentPath, "2024"))
+
+		// the existing directories are reused
+		objectId2, err := MakeDirectory(dev, sid, fullpath)
+		So(err, ShouldBeNil)
+		So(objectId2, ShouldEqual, objectId)
+	})
+
 	Convey("filename in the path | 1 | MakeDirectory | It should throw an error", t, func() {
 		// test the directory '/mtp-test-files/a.txt/folder'
 		objectId, err := MakeDirectory(dev, sid, "/mtp-test-files/a.txt/folder")
@@ -81,6 +107,7 @@ func TestMakeDirectory(t *testing.T) {
 		So(err, ShouldBeError)
 		So(objectId, ShouldEqual, 0)
 		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+		So(err.Error(), ShouldContainSubstring, "/mtp-test-files/a.txt")
 	})
 
 	Convey("filename in the path | 2 | MakeDirectory | It should throw an error", t, func() {
@@ -92,5 +119,70 @@ func TestMakeDirectory(t *testing.T) {
 		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
 	})
 
+	Convey("Memoize the created directories | makeDirectoryCached", t, func() {
+		// test the directory '/mtp-test-files/temp_dir/test-makeDirectoryCached/{random}/1/2'
+		parentPath := fmt.Sprintf("/mtp-test-files/temp_dir/test-makeDirectoryCached/%x", rand.Int31())
+		fullpath := getFullPath(parentPath, "1/2")
+
+		// the directory existed before the upload session
+		existingId, err := MakeDirectory(dev, sid, getFullPath(parentPath, "1"))
+		So(err, ShouldBeNil)
+
+		dirs := map[string]uint32{}
+		objectId, err := makeDirectoryCached(dev, sid, dirs, fullpath, nil)
+		So(err, ShouldBeNil)
+		So(objectId, ShouldBeGreaterThan, 0)
+
+		// the existing directory is reused and all the parents are cached
+		So(dirs[getFullPath(parentPath, "1")], ShouldEqual, existingId)
+		So(dirs[fullpath], ShouldEqual, objectId)
+		So(dirs, ShouldContainKey, parentPath)
+
+		fi, err := GetObjectFromPath(dev, sid, fullpath)
+		So(err, ShouldBeNil)
+		So(fi.ObjectId, ShouldEqual, objectId)
+
+		// the cached objectId is returned without creating the directory again
+		objectId2, err := makeDirectoryCached(dev, sid, dirs, fullpath, nil)
+		So(err, ShouldBeNil)
+		So(objectId2, ShouldEqual, objectId)
+	})
+
+	Convey("filename in the path | makeDirectoryCached | It should throw an error", t, func() {
+		objectId, err := makeDirectoryCached(dev, sid, map[string]uint32{}, "/mtp-test-files/a.txt/folder", nil)
+
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+		So(objectId, ShouldEqual, 0)
+	})
+
+	Convey("Testing the FilenamePolicy | MakeDirectory", t, func() {
+		defer SetFilenamePolicy(dev, FilenamePolicy{})
+
+		// test the directory '/mtp-test-files/temp_dir/test-MakeDirectory/{random}'
+		dirName := fmt.Sprintf("/mtp-test-files/temp_dir/test-MakeDirectory/%x", rand.Int31())
+
+		SetFilenamePolicy(dev, FatFilenamePolicy(false))
+
+		objectId, err := MakeDirectory(dev, sid, getFullPath(dirName, "a?b"))
+		So(err, ShouldHaveSameTypeAs, InvalidFilenameError{})
+		So(err.(InvalidFilenameError).Filename, ShouldEqual, "a?b")
+		So(objectId, ShouldEqual, 0)
+
+		SetFilenamePolicy(dev, FatFilenamePolicy(true))
+
+		objectId, err = MakeDirectory(dev, sid, getFullPath(dirName, "a?b"))
+		So(err, ShouldBeNil)
+		So(objectId, ShouldBeGreaterThan, 0)
+
+		fi, err := GetObjectFromPath(dev, sid, getFullPath(dirName, "a_b"))
+		So(err, ShouldBeNil)
+		So(fi.ObjectId, ShouldEqual, objectId)
+
+		// the sanitized directory is reused
+		objectId2, err := MakeDirectory(dev, sid, getFullPath(dirName, "a?b"))
+		So(err, ShouldBeNil)
+		So(objectId2, ShouldEqual, objectId)
+	})
+
 	Dispose(dev)
 }
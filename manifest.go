@@ -0,0 +1,144 @@
+package mtpx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+	"io"
+	"sort"
+)
+
+// Export a snapshot of all the files and directories of the storage [storageId] to [w]
+// the snapshot is a JSON array of [ManifestEntry] which is written while the storage is walked,
+// so that the whole tree is never held in the memory
+// all the objects are listed, including the hidden ones; the objects which couldn't be read are skipped
+// the root directory isn't listed
+// return:
+// [count]: total number of the exported objects
+func ExportManifest(dev *mtp.Device, storageId uint32, w io.Writer) (count int, err error) {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return 0, LocalFileError{error: err}
+	}
+
+	enc := json.NewEncoder(w)
+
+	_, _, _, _, err = WalkWithOpts(context.Background(), dev, storageId, PathSep, WalkOpts{
+		Recursive:     true,
+		IncludeHidden: true,
+	}, func(objectId uint32, fi *FileInfo, err error) error {
+		if count > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return LocalFileError{error: err}
+			}
+		}
+
+		if err := enc.Encode(newManifestEntry(fi)); err != nil {
+			return LocalFileError{error: err}
+		}
+
+		count += 1
+
+		return nil
+	})
+	if err != nil {
+		return count, err
+	}
+
+	if _, err := io.WriteString(w, "]\n"); err != nil {
+		return count, LocalFileError{error: err}
+	}
+
+	return count, nil
+}
+
+// Compare a manifest exported by [ExportManifest] and read from [r] against the current tree of the storage [storageId]
+// an object is matched by its [ManifestEntry.FullPath]; a matched object has changed if its size, modification time or type differs
+// an [InvalidManifestError] is returned if [r] isn't a valid manifest
+// the entries of the [ManifestDiff] are sorted by their [ManifestEntry.FullPath]
+func DiffManifest(dev *mtp.Device, storageId uint32, r io.Reader) (*ManifestDiff, error) {
+	previous, err := readManifest(r)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &ManifestDiff{}
+
+	_, _, _, _, err = WalkWithOpts(context.Background(), dev, storageId, PathSep, WalkOpts{
+		Recursive:     true,
+		IncludeHidden: true,
+	}, func(objectId uint32, fi *FileInfo, err error) error {
+		entry := newManifestEntry(fi)
+
+		prev, ok := previous[entry.FullPath]
+		if !ok {
+			diff.Added = append(diff.Added, entry)
+
+			return nil
+		}
+
+		delete(previous, entry.FullPath)
+
+		if prev.Size != entry.Size || prev.IsDir != entry.IsDir || !prev.ModTime.Equal(entry.ModTime) {
+			diff.Changed = append(diff.Changed, entry)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the entries which weren't found in the current tree
+	for _, entry := range previous {
+		diff.Removed = append(diff.Removed, entry)
+	}
+
+	sortManifestEntries(diff.Added)
+	sortManifestEntries(diff.Removed)
+	sortManifestEntries(diff.Changed)
+
+	return diff, nil
+}
+
+func newManifestEntry(fi *FileInfo) ManifestEntry {
+	return ManifestEntry{
+		FullPath:  fi.FullPath,
+		ObjectId:  fi.ObjectId,
+		Size:      fi.Size,
+		IsDir:     fi.IsDir,
+		ModTime:   fi.ModTime,
+		Extension: fi.Extension,
+	}
+}
+
+// decode the entries of the manifest [r] one at a time and key them by their [ManifestEntry.FullPath]
+func readManifest(r io.Reader) (map[string]ManifestEntry, error) {
+	dec := json.NewDecoder(r)
+
+	if t, err := dec.Token(); err != nil || t != json.Delim('[') {
+		return nil, InvalidManifestError{error: fmt.Errorf("invalid manifest: expected a JSON array")}
+	}
+
+	entries := map[string]ManifestEntry{}
+	for dec.More() {
+		var entry ManifestEntry
+		if err := dec.Decode(&entry); err != nil {
+			return nil, InvalidManifestError{error: fmt.Errorf("invalid manifest entry: %w", err)}
+		}
+
+		entries[entry.FullPath] = entry
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return nil, InvalidManifestError{error: fmt.Errorf("invalid manifest: %w", err)}
+	}
+
+	return entries, nil
+}
+
+func sortManifestEntries(entries []ManifestEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].FullPath < entries[j].FullPath
+	})
+}
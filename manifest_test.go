@@ -0,0 +1,97 @@
+package mtpx
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"log"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestManifest(t *testing.T) {
+	Convey("Testing an invalid manifest | readManifest", t, func() {
+		_, err := readManifest(strings.NewReader(`{"FullPath": "/a.txt"}`))
+		So(err, ShouldHaveSameTypeAs, InvalidManifestError{})
+
+		_, err = readManifest(strings.NewReader(`[{"FullPath": 1}]`))
+		So(err, ShouldHaveSameTypeAs, InvalidManifestError{})
+
+		_, err = readManifest(strings.NewReader(`[{"FullPath": "/a.txt"}`))
+		So(err, ShouldHaveSameTypeAs, InvalidManifestError{})
+
+		entries, err := readManifest(strings.NewReader(`[{"FullPath": "/a.txt", "Size": 3},{"FullPath": "/b"}]`))
+		So(err, ShouldBeNil)
+		So(len(entries), ShouldEqual, 2)
+		So(entries["/a.txt"].Size, ShouldEqual, 3)
+	})
+
+	dev, err := Initialize(Init{})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	storages, err := FetchStorages(dev)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	sid := storages[0].Sid
+
+	Convey("Testing ExportManifest and DiffManifest", t, func() {
+		var buf bytes.Buffer
+		count, err := ExportManifest(dev, sid, &buf)
+		So(err, ShouldBeNil)
+		So(count, ShouldBeGreaterThan, 0)
+
+		var entries []ManifestEntry
+		So(json.Unmarshal(buf.Bytes(), &entries), ShouldBeNil)
+		So(len(entries), ShouldEqual, count)
+
+		// the root isn't exported and the directories have no size
+		for _, e := range entries {
+			So(e.ObjectId, ShouldNotEqual, ParentObjectId)
+			So(e.FullPath, ShouldNotEqual, PathSep)
+
+			if e.IsDir {
+				So(e.Size, ShouldEqual, 0)
+			}
+		}
+
+		// nothing has changed
+		diff, err := DiffManifest(dev, sid, bytes.NewReader(buf.Bytes()))
+		So(err, ShouldBeNil)
+		So(diff.Added, ShouldBeEmpty)
+		So(diff.Removed, ShouldBeEmpty)
+		So(diff.Changed, ShouldBeEmpty)
+
+		// a new directory is added and an entry of the manifest no longer exists
+		dirPath := fmt.Sprintf("/mtp-test-files/temp_dir/test_ExportManifest/%x", rand.Int31())
+		objectId, err := MakeDirectory(dev, sid, dirPath)
+		So(err, ShouldBeNil)
+
+		entries = append(entries, ManifestEntry{FullPath: "/mtp-test-files/temp_dir/test_ExportManifest/removed.txt", Size: 1})
+
+		manifest, err := json.Marshal(entries)
+		So(err, ShouldBeNil)
+
+		diff, err = DiffManifest(dev, sid, bytes.NewReader(manifest))
+		So(err, ShouldBeNil)
+		So(diff.Changed, ShouldBeEmpty)
+		So(len(diff.Removed), ShouldEqual, 1)
+		So(diff.Removed[0].FullPath, ShouldEqual, "/mtp-test-files/temp_dir/test_ExportManifest/removed.txt")
+
+		var added []string
+		for _, e := range diff.Added {
+			added = append(added, e.FullPath)
+
+			if e.FullPath == dirPath {
+				So(e.ObjectId, ShouldEqual, objectId)
+				So(e.IsDir, ShouldBeTrue)
+			}
+		}
+		So(added, ShouldContain, dirPath)
+	})
+}
@@ -0,0 +1,289 @@
+package mtpx
+
+import (
+	"fmt"
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+	. "github.com/smartystreets/goconvey/convey"
+	"log"
+	"math/rand"
+	"testing"
+)
+
+func TestMoveFile(t *testing.T) {
+	dev, err := Initialize(Init{})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	storages, err := FetchStorages(dev)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	sid := storages[0].Sid
+
+	Convey("Move an existing object | using objectId | MoveFile", t, func() {
+		// create a random source and destination directory
+		// test the directory '/mtp-test-files/temp_dir/test-MoveFile/{random}'
+		dirName := fmt.Sprintf("%x", rand.Int31())
+		sourcePath := fmt.Sprintf("/mtp-test-files/temp_dir/test-MoveFile/%s", dirName)
+		destParentPath := fmt.Sprintf("/mtp-test-files/temp_dir/test-MoveFile/dest-%x", rand.Int31())
+
+		objectId, err := MakeDirectory(dev, sid, sourcePath)
+		So(err, ShouldBeNil)
+		So(objectId, ShouldBeGreaterThan, 0)
+
+		destObjectId, err := MakeDirectory(dev, sid, destParentPath)
+		So(err, ShouldBeNil)
+
+		// move the object using objectId
+		objId, err := MoveFile(dev, sid, objectId, "", destParentPath)
+		So(err, ShouldBeNil)
+		So(objId, ShouldBeGreaterThan, 0)
+
+		fi, err := GetObjectFromPath(dev, sid, getFullPath(destParentPath, dirName))
+		So(err, ShouldBeNil)
+		So(fi.ObjectId, ShouldEqual, objId)
+		So(fi.ParentId, ShouldEqual, destObjectId)
+
+		// the source should not exist anymore
+		_, err = GetObjectFromPath(dev, sid, sourcePath)
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+	})
+
+	Convey("Move an existing object | using fullPath | MoveFile", t, func() {
+		// test the directory '/mtp-test-files/temp_dir/test-MoveFile/{random}'
+		dirName := fmt.Sprintf("%x", rand.Int31())
+		sourcePath := fmt.Sprintf("/mtp-test-files/temp_dir/test-MoveFile/%s", dirName)
+		destParentPath := fmt.Sprintf("/mtp-test-files/temp_dir/test-MoveFile/dest-%x", rand.Int31())
+
+		_, err := MakeDirectory(dev, sid, sourcePath)
+		So(err, ShouldBeNil)
+
+		_, err = MakeDirectory(dev, sid, destParentPath)
+		So(err, ShouldBeNil)
+
+		// move the object using fullPath
+		objId, err := MoveFile(dev, sid, 0, sourcePath, destParentPath)
+		So(err, ShouldBeNil)
+		So(objId, ShouldBeGreaterThan, 0)
+
+		fi, err := GetObjectFromPath(dev, sid, getFullPath(destParentPath, dirName))
+		So(err, ShouldBeNil)
+		So(fi.ObjectId, ShouldEqual, objId)
+	})
+
+	Convey("Move an object into a file | MoveFile | Should throw an error", t, func() {
+		// test the directory '/mtp-test-files/temp_dir/test-MoveFile/{random}'
+		sourcePath := fmt.Sprintf("/mtp-test-files/temp_dir/test-MoveFile/%x", rand.Int31())
+
+		_, err := MakeDirectory(dev, sid, sourcePath)
+		So(err, ShouldBeNil)
+
+		objId, err := MoveFile(dev, sid, 0, sourcePath, "/mtp-test-files/a.txt")
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+		So(objId, ShouldEqual, 0)
+	})
+
+	Convey("Move a directory into its own subdirectory | MoveFile | Should throw an error", t, func() {
+		// test the directory '/mtp-test-files/temp_dir/test-MoveFile/{random}'
+		sourcePath := fmt.Sprintf("/mtp-test-files/temp_dir/test-MoveFile/%x", rand.Int31())
+		destParentPath := getFullPath(sourcePath, "child")
+
+		_, err := MakeDirectory(dev, sid, destParentPath)
+		So(err, ShouldBeNil)
+
+		objId, err := MoveFile(dev, sid, 0, sourcePath, destParentPath)
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+		So(objId, ShouldEqual, 0)
+
+		// the source should be left untouched
+		_, err = GetObjectFromPath(dev, sid, destParentPath)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Move an non existing object | MoveFile | Should throw an error", t, func() {
+		// test the directory '/mtp-test-files/temp_dir/test-MoveFile/{random}'
+		sourcePath := fmt.Sprintf("/mtp-test-files/temp_dir/test-MoveFile/%x", rand.Int31())
+
+		objId, err := MoveFile(dev, sid, 0, sourcePath, "/mtp-test-files/temp_dir")
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+		So(objId, ShouldEqual, 0)
+	})
+
+	Dispose(dev)
+}
+
+func TestMoveFiles(t *testing.T) {
+	dev, err := Initialize(Init{})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	storages, err := FetchStorages(dev)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	sid := storages[0].Sid
+
+	Convey("Move many objects | ConflictRenameWithSuffix | MoveFiles", t, func() {
+		// test the directory '/mtp-test-files/temp_dir/test-MoveFiles/{random}'
+		dirName := fmt.Sprintf("/mtp-test-files/temp_dir/test-MoveFiles/%x", rand.Int31())
+		destParentPath := getFullPath(dirName, "dest")
+
+		aId, err := MakeDirectory(dev, sid, getFullPath(dirName, "src/a"))
+		So(err, ShouldBeNil)
+
+		bId, err := MakeDirectory(dev, sid, getFullPath(dirName, "src/b"))
+		So(err, ShouldBeNil)
+
+		existingId, err := MakeDirectory(dev, sid, getFullPath(destParentPath, "a"))
+		So(err, ShouldBeNil)
+
+		report, err := MoveFiles(dev, sid, []uint32{aId, bId}, destParentPath, MoveOpts{ConflictPolicy: ConflictRenameWithSuffix})
+		So(err, ShouldBeNil)
+		So(len(report.Moved), ShouldEqual, 2)
+		So(report.Moved[0].ObjectId, ShouldEqual, aId)
+		So(report.Moved[0].FullPath, ShouldEqual, getFullPath(destParentPath, "a (1)"))
+		So(report.Moved[1].FullPath, ShouldEqual, getFullPath(destParentPath, "b"))
+
+		fi, err := GetObjectFromPath(dev, sid, getFullPath(destParentPath, "a (1)"))
+		So(err, ShouldBeNil)
+		So(fi.ObjectId, ShouldEqual, report.Moved[0].NewObjectId)
+
+		// the existing object is left untouched
+		fi, err = GetObjectFromPath(dev, sid, getFullPath(destParentPath, "a"))
+		So(err, ShouldBeNil)
+		So(fi.ObjectId, ShouldEqual, existingId)
+
+		_, err = GetObjectFromPath(dev, sid, getFullPath(dirName, "src/b"))
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+	})
+
+	Convey("Move a file over an existing file | ConflictOverwrite | MoveFiles", t, func() {
+		// test the directory '/mtp-test-files/temp_dir/test-MoveFiles/{random}'
+		dirName := fmt.Sprintf("/mtp-test-files/temp_dir/test-MoveFiles/%x", rand.Int31())
+		destParentPath := getFullPath(dirName, "dest")
+		source := getTestMocksAsset("mock_dir1/a.txt")
+
+		upload := func(destination string) *FileInfo {
+			_, _, _, err := UploadFilesWithOpts(dev, sid, []string{source}, destination, UploadOpts{
+				ProgressCb: func(fi *ProgressInfo, err error) error {
+					return nil
+				},
+				StopOnError: true,
+			})
+			So(err, ShouldBeNil)
+
+			fi, err := GetObjectFromPath(dev, sid, getFullPath(destination, "a.txt"))
+			So(err, ShouldBeNil)
+
+			return fi
+		}
+
+		srcFi := upload(getFullPath(dirName, "src"))
+		existingFi := upload(destParentPath)
+
+		report, err := MoveFiles(dev, sid, []uint32{srcFi.ObjectId}, destParentPath, MoveOpts{ConflictPolicy: ConflictOverwrite})
+		So(err, ShouldBeNil)
+		So(len(report.Moved), ShouldEqual, 1)
+		So(report.Moved[0].FullPath, ShouldEqual, getFullPath(destParentPath, "a.txt"))
+
+		fi, err := GetObjectFromPath(dev, sid, getFullPath(destParentPath, "a.txt"))
+		So(err, ShouldBeNil)
+		So(fi.ObjectId, ShouldEqual, report.Moved[0].NewObjectId)
+		So(fi.ObjectId, ShouldNotEqual, existingFi.ObjectId)
+
+		// the replaced file, which was renamed aside, was deleted
+		_, err = GetObjectFromPath(dev, sid, getFullPath(destParentPath, ".a.txt.mtpx-old"))
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+	})
+
+	Convey("Move many objects | ConflictSkip | ContinueOnError | MoveFiles", t, func() {
+		// test the directory '/mtp-test-files/temp_dir/test-MoveFiles/{random}'
+		dirName := fmt.Sprintf("/mtp-test-files/temp_dir/test-MoveFiles/%x", rand.Int31())
+		destParentPath := getFullPath(dirName, "dest")
+
+		aId, err := MakeDirectory(dev, sid, getFullPath(dirName, "src/a"))
+		So(err, ShouldBeNil)
+
+		_, err = MakeDirectory(dev, sid, getFullPath(destParentPath, "a"))
+		So(err, ShouldBeNil)
+
+		report, err := MoveFiles(dev, sid, []uint32{aId, ParentObjectId}, destParentPath, MoveOpts{ContinueOnError: true})
+		So(err, ShouldHaveSameTypeAs, BatchError{})
+		So(report.Moved, ShouldBeEmpty)
+		So(report.Skipped, ShouldResemble, []uint32{aId})
+		So(len(report.Failed), ShouldEqual, 1)
+		So(report.Failed[0].ObjectId, ShouldEqual, ParentObjectId)
+		So(report.Failed[0].Err, ShouldHaveSameTypeAs, InvalidPathError{})
+
+		// the skipped object is left in place
+		fi, err := GetObjectFromPath(dev, sid, getFullPath(dirName, "src/a"))
+		So(err, ShouldBeNil)
+		So(fi.ObjectId, ShouldEqual, aId)
+	})
+
+	Convey("Move into a file | MoveFiles | Should throw an error", t, func() {
+		_, err := MoveFiles(dev, sid, []uint32{}, "/mtp-test-files/a.txt", MoveOpts{})
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+	})
+
+	Dispose(dev)
+}
+
+func TestReparentObject(t *testing.T) {
+	dev, err := Initialize(Init{})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	storages, err := FetchStorages(dev)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	sid := storages[0].Sid
+
+	Convey("Reparent a directory | ReparentObject", t, func() {
+		// test the directory '/mtp-test-files/temp_dir/test-ReparentObject/{random}'
+		dirName := fmt.Sprintf("/mtp-test-files/temp_dir/test-ReparentObject/%x", rand.Int31())
+
+		srcId, err := MakeDirectory(dev, sid, getFullPath(dirName, "src/a"))
+		So(err, ShouldBeNil)
+
+		destId, err := MakeDirectory(dev, sid, getFullPath(dirName, "dest"))
+		So(err, ShouldBeNil)
+
+		c, err := GetDeviceCapabilities(dev)
+		So(err, ShouldBeNil)
+
+		err = ReparentObject(dev, srcId, destId)
+		if !c.SupportsOperation(mtp.OC_MoveObject) {
+			So(err, ShouldHaveSameTypeAs, UnsupportedOperationError{})
+
+			return
+		}
+		So(err, ShouldBeNil)
+
+		fi, err := GetObjectFromPath(dev, sid, getFullPath(dirName, "dest/a"))
+		So(err, ShouldBeNil)
+		So(fi.ObjectId, ShouldEqual, srcId)
+
+		// the new parent is a file
+		w, fileId, err := CreateObjectWriter(dev, sid, destId, "file.txt", 1)
+		So(err, ShouldBeNil)
+		_, err = w.Write([]byte("a"))
+		So(err, ShouldBeNil)
+		So(w.Close(), ShouldBeNil)
+
+		err = ReparentObject(dev, srcId, fileId)
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+
+		err = ReparentObject(dev, ParentObjectId, destId)
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+	})
+
+	Dispose(dev)
+}
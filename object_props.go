@@ -0,0 +1,536 @@
+package mtpx
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// all the properties of an object
+const allObjectProps = 0xFFFFFFFF
+
+// the object properties declared by a device for each of the object formats; see [GetSupportedProps]
+type supportedObjectProps struct {
+	mu      sync.Mutex
+	formats map[uint16][]uint16
+}
+
+// whether the object properties are writable, keyed by the property (mtp.OPC_*) and the object format (mtp.OFC_*); see [isObjectPropWritable]
+type writableObjectProps struct {
+	mu    sync.Mutex
+	props map[[2]uint16]bool
+}
+
+// List the object properties (mtp.OPC_*) which the device declares for the objects of the [format] (mtp.OFC_*)
+// the list is fetched using GetObjectPropsSupported once per format and cached until [Dispose] is called
+// an [UnsupportedOperationError] is returned if the device doesn't support GetObjectPropsSupported
+func GetSupportedProps(dev *mtp.Device, format uint16) ([]uint16, error) {
+	supported, err := isOperationSupported(dev, mtp.OC_MTP_GetObjectPropsSupported)
+	if err != nil {
+		return nil, err
+	}
+
+	if !supported {
+		return nil, UnsupportedOperationError{error: fmt.Errorf("GetObjectPropsSupported is not supported by the device")}
+	}
+
+	v, _ := deviceSupportedObjectProps.LoadOrStore(dev, &supportedObjectProps{formats: map[uint16][]uint16{}})
+	s := v.(*supportedObjectProps)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	props, ok := s.formats[format]
+	if !ok {
+		var list mtp.Uint16Array
+		if err := withRetry(dev, func() error {
+			return withCallTimeout(dev, nil, func() error {
+				return dev.GetObjectPropsSupported(format, &list)
+			})
+		}); err != nil {
+			return nil, fileObjectError(err)
+		}
+
+		props = list.Values
+		s.formats[format] = props
+	}
+
+	return append([]uint16(nil), props...), nil
+}
+
+// check if the device allows writing the property [propCode] of the objects of the [format] using SetObjectPropValue
+// the GetSet flag of the descriptor returned by GetObjectPropDesc is checked; the result is cached per format until [Dispose] is called
+// a device which rejects the property as unsupported (see [isObjectPropUnsupported]) doesn't allow writing it;
+// any other failure is returned without being cached, so that a busy or a timed out device is asked again the next time
+func isObjectPropWritable(dev *mtp.Device, format, propCode uint16) (bool, error) {
+	v, _ := deviceWritableObjectProps.LoadOrStore(dev, &writableObjectProps{props: map[[2]uint16]bool{}})
+	w := v.(*writableObjectProps)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	key := [2]uint16{propCode, format}
+	if writable, ok := w.props[key]; ok {
+		return writable, nil
+	}
+
+	c, err := GetDeviceCapabilities(dev)
+	if err != nil {
+		return false, err
+	}
+
+	writable := false
+	if c.SupportsOperation(mtp.OC_MTP_SetObjectPropValue) && c.SupportsOperation(mtp.OC_MTP_GetObjectPropDesc) {
+		desc := mtp.ObjectPropDesc{}
+
+		err := withRetry(dev, func() error {
+			return withCallTimeout(dev, nil, func() error {
+				return dev.GetObjectPropDesc(propCode, format, &desc)
+			})
+		})
+
+		switch {
+		case err == nil:
+			writable = desc.GetSet == mtp.DPGS_GetSet
+
+		// the devices which don't support the property reject the request
+		case isObjectPropUnsupported(err):
+
+		case isDeviceDisconnected(err):
+			return false, deviceDisconnectedError(err)
+
+		default:
+			return false, fileObjectError(err)
+		}
+	}
+
+	w.props[key] = writable
+
+	return writable, nil
+}
+
+// check if the device declares the property [propCode] for the objects of the [format]
+// the property is assumed to be supported if the device can't list its supported properties
+func isObjectPropSupported(dev *mtp.Device, format, propCode uint16) (bool, error) {
+	props, err := GetSupportedProps(dev, format)
+	if err != nil {
+		if isDeviceDisconnected(err) {
+			return false, deviceDisconnectedError(err)
+		}
+
+		return true, nil
+	}
+
+	for _, p := range props {
+		if p == propCode {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+type objectPropListElement struct {
+	objectId uint32
+	propCode uint16
+	dataType uint16
+	value    interface{}
+}
+
+// dataset returned by the MTP GetObjectPropList operation
+type objectPropList struct {
+	elements []objectPropListElement
+}
+
+// implements [mtp.Decoder]
+func (l *objectPropList) Decode(r io.Reader) error {
+	var count uint32
+	if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+		return err
+	}
+
+	l.elements = make([]objectPropListElement, 0, count)
+
+	for i := uint32(0); i < count; i++ {
+		e := objectPropListElement{}
+
+		if err := binary.Read(r, binary.LittleEndian, &e.objectId); err != nil {
+			return err
+		}
+		if err := binary.Read(r, binary.LittleEndian, &e.propCode); err != nil {
+			return err
+		}
+		if err := binary.Read(r, binary.LittleEndian, &e.dataType); err != nil {
+			return err
+		}
+
+		value, err := decodeObjectPropValue(r, e.dataType)
+		if err != nil {
+			return err
+		}
+		e.value = value
+
+		l.elements = append(l.elements, e)
+	}
+
+	return nil
+}
+
+// decode a single property value of type [dataType]
+func decodeObjectPropValue(r io.Reader, dataType uint16) (interface{}, error) {
+	if dataType != mtp.DTC_STR && dataType&mtp.DTC_ARRAY_MASK != 0 {
+		var count uint32
+		if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+			return nil, err
+		}
+
+		values := make([]interface{}, 0, count)
+		for i := uint32(0); i < count; i++ {
+			v, err := decodeObjectPropValue(r, dataType&^mtp.DTC_ARRAY_MASK)
+			if err != nil {
+				return nil, err
+			}
+
+			values = append(values, v)
+		}
+
+		return values, nil
+	}
+
+	var value interface{}
+
+	switch dataType {
+	case mtp.DTC_INT8:
+		var v int8
+		value = &v
+	case mtp.DTC_UINT8:
+		var v uint8
+		value = &v
+	case mtp.DTC_INT16:
+		var v int16
+		value = &v
+	case mtp.DTC_UINT16:
+		var v uint16
+		value = &v
+	case mtp.DTC_INT32:
+		var v int32
+		value = &v
+	case mtp.DTC_UINT32:
+		var v uint32
+		value = &v
+	case mtp.DTC_INT64:
+		var v int64
+		value = &v
+	case mtp.DTC_UINT64:
+		var v uint64
+		value = &v
+	case mtp.DTC_INT128, mtp.DTC_UINT128:
+		var v [16]byte
+		value = &v
+	case mtp.DTC_STR:
+		var v mtp.StringValue
+		if err := mtp.Decode(r, &v); err != nil {
+			return nil, err
+		}
+
+		return v.Value, nil
+	default:
+		return nil, fmt.Errorf("unknown data type 0x%x", dataType)
+	}
+
+	if err := binary.Read(r, binary.LittleEndian, value); err != nil {
+		return nil, err
+	}
+
+	switch v := value.(type) {
+	case *int8:
+		return *v, nil
+	case *uint8:
+		return *v, nil
+	case *int16:
+		return *v, nil
+	case *uint16:
+		return *v, nil
+	case *int32:
+		return *v, nil
+	case *uint32:
+		return *v, nil
+	case *int64:
+		return *v, nil
+	case *uint64:
+		return *v, nil
+	case *[16]byte:
+		return *v, nil
+	}
+
+	return value, nil
+}
+
+// encode the [value] as a single property value of type [dataType]
+// the type of the [value] should match the one returned by [decodeObjectPropValue]; a [TypeMismatchError] is returned otherwise
+func encodeObjectPropValue(w io.Writer, value interface{}, dataType uint16) error {
+	if dataType != mtp.DTC_STR && dataType&mtp.DTC_ARRAY_MASK != 0 {
+		values, ok := value.([]interface{})
+		if !ok {
+			return TypeMismatchError{error: fmt.Errorf("data type 0x%x needs a []interface{}, got %T", dataType, value)}
+		}
+
+		if err := binary.Write(w, binary.LittleEndian, uint32(len(values))); err != nil {
+			return err
+		}
+
+		for _, v := range values {
+			if err := encodeObjectPropValue(w, v, dataType&^mtp.DTC_ARRAY_MASK); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if dataType == mtp.DTC_STR {
+		str, ok := value.(string)
+		if !ok {
+			return TypeMismatchError{error: fmt.Errorf("data type 0x%x needs a string, got %T", dataType, value)}
+		}
+
+		// an MTP string holds at most 254 characters including the null terminator
+		if utf8.RuneCountInString(str) > 253 {
+			return TypeMismatchError{error: fmt.Errorf("string of %d characters is too long", utf8.RuneCountInString(str))}
+		}
+
+		return mtp.Encode(w, &mtp.StringValue{Value: str})
+	}
+
+	t, ok := propDataTypes[dataType]
+	if !ok {
+		return UnsupportedOperationError{error: fmt.Errorf("unknown data type 0x%x", dataType)}
+	}
+
+	if reflect.TypeOf(value) != t {
+		return TypeMismatchError{error: fmt.Errorf("data type 0x%x needs a %s, got %T", dataType, t, value)}
+	}
+
+	return binary.Write(w, binary.LittleEndian, value)
+}
+
+// fetch the properties of all the children of [parentId] in a single MTP transaction
+// returns the list of [FileInfo] in the order the device returned the objects
+func getObjectPropList(dev *mtp.Device, storageId, parentId uint32, parentPath string) ([]*FileInfo, error) {
+	list, err := handleGetObjectPropList(dev, storageId, parentId, allObjectProps)
+	if err != nil {
+		return nil, fileObjectError(err)
+	}
+
+	return list.fileInfos(parentPath), nil
+}
+
+// fetch the objectIds of the children of [parentId] whose OPC_Hidden property is set in a single MTP transaction
+func getHiddenObjects(dev *mtp.Device, storageId, parentId uint32) (map[uint32]bool, error) {
+	list, err := handleGetObjectPropList(dev, storageId, parentId, mtp.OPC_Hidden)
+	if err != nil {
+		return nil, err
+	}
+
+	hidden := map[uint32]bool{}
+	for _, e := range list.elements {
+		if v, ok := e.value.(uint16); ok && e.propCode == mtp.OPC_Hidden && v != 0 {
+			hidden[e.objectId] = true
+		}
+	}
+
+	return hidden, nil
+}
+
+// helper function to fetch the property [propCode] of the children of [parentId] using GetObjectPropList
+// use [allObjectProps] to fetch all the properties
+func handleGetObjectPropList(dev *mtp.Device, storageId, parentId uint32, propCode uint32) (*objectPropList, error) {
+	// the root directory is addressed as 0x00000000 by GetObjectPropList
+	handle := parentId
+	if handle == ParentObjectId {
+		handle = 0
+	}
+
+	var req mtp.Container
+	req.Code = mtp.OC_MTP_GetObjPropList
+	req.Param = []uint32{handle, 0, propCode, 0, 1}
+
+	list := objectPropList{}
+	if err := withCallTimeout(dev, nil, func() error {
+		return dev.GetData(&req, &list)
+	}); err != nil {
+		return nil, err
+	}
+
+	// the root objects of all the storages are returned for the root directory; keep the ones of [storageId]
+	if handle == 0 {
+		handles := mtp.Uint32Array{}
+		if err := withCallTimeout(dev, nil, func() error {
+			return dev.GetObjectHandles(storageId, mtp.GOH_ALL_ASSOCS, ParentObjectId, &handles)
+		}); err != nil {
+			return nil, err
+		}
+
+		list.keepObjects(handles.Values)
+	}
+
+	return &list, nil
+}
+
+// drop the elements of the objects other than [objectIds]
+func (l *objectPropList) keepObjects(objectIds []uint32) {
+	keep := make(map[uint32]bool, len(objectIds))
+	for _, objectId := range objectIds {
+		keep[objectId] = true
+	}
+
+	n := 0
+	for _, e := range l.elements {
+		if keep[e.objectId] {
+			l.elements[n] = e
+			n += 1
+		}
+	}
+
+	l.elements = l.elements[:n]
+}
+
+// helper function to fetch all the properties of the object [objectId] using GetObjectPropList
+func handleGetObjectProps(dev *mtp.Device, objectId uint32) (*objectPropList, error) {
+	var req mtp.Container
+	req.Code = mtp.OC_MTP_GetObjPropList
+	req.Param = []uint32{objectId, 0, allObjectProps, 0, 0}
+
+	list := objectPropList{}
+	if err := withCallTimeout(dev, nil, func() error {
+		return dev.GetData(&req, &list)
+	}); err != nil {
+		return nil, err
+	}
+
+	return &list, nil
+}
+
+// assemble the [FileInfo] of the objects in the [l] in the order the device returned them
+// [parentPath] is the fullPath of the directory which was listed
+func (l *objectPropList) fileInfos(parentPath string) []*FileInfo {
+	var order []uint32
+	objects := map[uint32]*mtp.ObjectInfo{}
+	sizes := map[uint32]int64{}
+
+	for _, e := range l.elements {
+		obj, ok := objects[e.objectId]
+		if !ok {
+			obj = &mtp.ObjectInfo{}
+			objects[e.objectId] = obj
+			order = append(order, e.objectId)
+		}
+
+		switch e.propCode {
+		case mtp.OPC_StorageID:
+			if v, ok := e.value.(uint32); ok {
+				obj.StorageID = v
+			}
+		case mtp.OPC_ObjectFormat:
+			if v, ok := e.value.(uint16); ok {
+				obj.ObjectFormat = v
+			}
+		case mtp.OPC_ProtectionStatus:
+			if v, ok := e.value.(uint16); ok {
+				obj.ProtectionStatus = v
+			}
+		case mtp.OPC_ObjectSize:
+			if v, ok := e.value.(uint64); ok {
+				sizes[e.objectId] = int64(v)
+
+				if v > 0xFFFFFFFF {
+					obj.CompressedSize = 0xFFFFFFFF
+				} else {
+					obj.CompressedSize = uint32(v)
+				}
+			}
+		case mtp.OPC_ObjectFileName:
+			if v, ok := e.value.(string); ok {
+				obj.Filename = v
+			}
+		case mtp.OPC_DateCreated:
+			if v, ok := e.value.(string); ok {
+				obj.CaptureDate = parseMtpTime(v)
+			}
+		case mtp.OPC_DateModified:
+			if v, ok := e.value.(string); ok {
+				obj.ModificationDate = parseMtpTime(v)
+			}
+		case mtp.OPC_ParentObject:
+			if v, ok := e.value.(uint32); ok {
+				obj.ParentObject = v
+			}
+		}
+	}
+
+	_parentPath := fixSlash(parentPath)
+
+	result := make([]*FileInfo, 0, len(order))
+	for _, objectId := range order {
+		obj := objects[objectId]
+		isDir := isObjectADir(obj)
+
+		var size int64
+		if !isDir {
+			size = sizes[objectId]
+		}
+
+		result = append(result, &FileInfo{
+			Info:       obj,
+			Size:       size,
+			IsDir:      isDir,
+			ModTime:    localDeviceTime(obj.ModificationDate),
+			Name:       obj.Filename,
+			FullPath:   getFullPath(_parentPath, obj.Filename),
+			ParentPath: _parentPath,
+			Extension:  extension(obj.Filename, isDir),
+			ParentId:   obj.ParentObject,
+			ObjectId:   objectId,
+		})
+	}
+
+	return result
+}
+
+// parse the MTP date string
+// a date without a timezone is the local time of the device, see [localDeviceTime]
+// an invalid or empty date returns a zero [time.Time]
+func parseMtpTime(s string) time.Time {
+	// Samsung has trailing dots and Jolla Sailfish has trailing "Z".
+	s = strings.TrimRight(strings.TrimRight(s, "."), "Z")
+	if s == "" {
+		return time.Time{}
+	}
+
+	if t, err := time.ParseInLocation(dateModifiedFormat, s, time.Local); err == nil {
+		return t
+	}
+
+	if t, err := time.Parse("20060102T150405-0700", s); err == nil {
+		return t
+	}
+
+	return time.Time{}
+}
+
+// reinterpret the date [t] decoded by the mtp package in the local timezone
+// the MTP dates usually carry no timezone and are the local time of the device, but the mtp package decodes them as UTC;
+// the dates with a timezone are kept
+func localDeviceTime(t time.Time) time.Time {
+	if t.IsZero() || t.Location() != time.UTC {
+		return t
+	}
+
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.Local)
+}
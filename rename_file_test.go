@@ -88,5 +88,88 @@ func TestRenameFile(t *testing.T) {
 		So(objId, ShouldEqual, 0)
 	})
 
+	Convey("Rename a file and re-fetch it | RenameFile", t, func() {
+		// create a random directory with a file
+		// test the directory '/mtp-test-files/temp_dir/test-RenameFile/{random}'
+		dirName := fmt.Sprintf("/mtp-test-files/temp_dir/test-RenameFile/%x", rand.Int31())
+
+		_, err := MakeDirectory(dev, sid, dirName)
+		So(err, ShouldBeNil)
+
+		source, err := GetObjectFromPath(dev, sid, "/mtp-test-files/a.txt")
+		So(err, ShouldBeNil)
+
+		objectId, err := CopyFile(dev, sid, source.ObjectId, dirName, false)
+		So(err, ShouldBeNil)
+
+		objId, err := RenameFile(dev, sid, FileProp{objectId, ""}, "renamed.tar.gz")
+		So(err, ShouldBeNil)
+		So(objId, ShouldEqual, objectId)
+
+		fi, err := GetObjectFromObjectId(dev, objectId, dirName)
+		So(err, ShouldBeNil)
+		So(fi.Name, ShouldEqual, "renamed.tar.gz")
+		So(fi.Extension, ShouldEqual, "tar.gz")
+		So(fi.FullPath, ShouldEqual, getFullPath(dirName, "renamed.tar.gz"))
+	})
+
+	Convey("Rename an object to an existing name | RenameFile | Should throw an error", t, func() {
+		// test the directory '/mtp-test-files/temp_dir/test-RenameFile/{random}'
+		dirName := fmt.Sprintf("/mtp-test-files/temp_dir/test-RenameFile/%x", rand.Int31())
+
+		objectId, err := MakeDirectory(dev, sid, getFullPath(dirName, "1"))
+		So(err, ShouldBeNil)
+
+		_, err = MakeDirectory(dev, sid, getFullPath(dirName, "2"))
+		So(err, ShouldBeNil)
+
+		objId, err := RenameFile(dev, sid, FileProp{objectId, ""}, "2")
+		So(err, ShouldHaveSameTypeAs, FileAlreadyExistsError{})
+		So(objId, ShouldEqual, 0)
+	})
+
+	Convey("Rename an object to an invalid name | RenameFile | Should throw an error", t, func() {
+		// test the directory '/mtp-test-files/temp_dir/test-RenameFile/{random}'
+		dirName := fmt.Sprintf("/mtp-test-files/temp_dir/test-RenameFile/%x", rand.Int31())
+
+		objectId, err := MakeDirectory(dev, sid, dirName)
+		So(err, ShouldBeNil)
+
+		objId, err := RenameFile(dev, sid, FileProp{objectId, ""}, "a/b")
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+		So(objId, ShouldEqual, 0)
+
+		objId, err = RenameFile(dev, sid, FileProp{objectId, ""}, "")
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+		So(objId, ShouldEqual, 0)
+	})
+
+	Convey("Rename an object using the FilenamePolicy | RenameFile", t, func() {
+		defer SetFilenamePolicy(dev, FilenamePolicy{})
+
+		// test the directory '/mtp-test-files/temp_dir/test-RenameFile/{random}'
+		dirName := fmt.Sprintf("/mtp-test-files/temp_dir/test-RenameFile/%x", rand.Int31())
+
+		objectId, err := MakeDirectory(dev, sid, dirName)
+		So(err, ShouldBeNil)
+
+		SetFilenamePolicy(dev, FatFilenamePolicy(false))
+
+		objId, err := RenameFile(dev, sid, FileProp{objectId, ""}, "a:b")
+		So(err, ShouldHaveSameTypeAs, InvalidFilenameError{})
+		So(err.(InvalidFilenameError).Filename, ShouldEqual, "a:b")
+		So(objId, ShouldEqual, 0)
+
+		SetFilenamePolicy(dev, FatFilenamePolicy(true))
+
+		objId, err = RenameFile(dev, sid, FileProp{objectId, ""}, "a:b")
+		So(err, ShouldBeNil)
+		So(objId, ShouldEqual, objectId)
+
+		fi, err := GetObjectFromObjectId(dev, objectId, "")
+		So(err, ShouldBeNil)
+		So(fi.Name, ShouldEqual, "a_b")
+	})
+
 	Dispose(dev)
 }
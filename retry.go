@@ -0,0 +1,120 @@
+package mtpx
+
+import (
+	"errors"
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+	"github.com/ganeshrvel/usb"
+	"time"
+)
+
+// RetryPolicy controls how the transient failures of the device transactions are retried
+// the zero value disables the retries
+type RetryPolicy struct {
+	// number of retries after the first failed attempt
+	MaxRetries int
+
+	// delay before the first retry; it is doubled after every retry
+	Backoff time.Duration
+}
+
+// set the [RetryPolicy] used by the device transactions of [dev]
+// the policy is kept until [Dispose] is called
+func SetRetryPolicy(dev *mtp.Device, policy RetryPolicy) {
+	deviceRetryPolicies.Store(dev, policy)
+}
+
+// the [RetryPolicy] of [dev]
+func getRetryPolicy(dev *mtp.Device) RetryPolicy {
+	if p, ok := deviceRetryPolicies.Load(dev); ok {
+		return p.(RetryPolicy)
+	}
+
+	return RetryPolicy{}
+}
+
+// an error which must not be retried; it is unwrapped by [withRetry]
+type permanentError struct {
+	error
+}
+
+// run [fn] and retry it using the [RetryPolicy] of [dev] as long as it fails with a transient error
+// if [fn] was retried and still failed with a transient error then the final error is wrapped with the attempt count ([RetryError]);
+// an error which isn't retried is returned as is, so that its type can be matched
+func withRetry(dev *mtp.Device, fn func() error) error {
+	policy := getRetryPolicy(dev)
+	backoff := policy.Backoff
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+
+		if p, ok := err.(permanentError); ok {
+			return p.error
+		}
+
+		if !isTransientError(err) {
+			return err
+		}
+
+		if attempt > policy.MaxRetries {
+			if attempt == 1 {
+				return err
+			}
+
+			return RetryError{error: err, Attempts: attempt}
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// the error of the last attempt if [err] is a [RetryError], otherwise [err]
+// the type switches which match the cause of an error returned by [withRetry] must unwrap it first
+func retryCause(err error) error {
+	if e, ok := err.(RetryError); ok {
+		return e.error
+	}
+
+	return err
+}
+
+// check if [err] is a transient failure of the device transaction which may succeed when retried
+// only the busy and incomplete transfer MTP response codes and the USB transfer errors in [transientUsbErrors] are transient;
+// the errors raised by this package and anything else are not
+func isTransientError(err error) bool {
+	switch e := err.(type) {
+	case nil:
+		return false
+
+	case FileNotFoundError, InvalidPathError, FilePermissionError, LocalFileError,
+		FileAlreadyExistsError, InsufficientSpaceError, UnsupportedOperationError, WalkCanceledError,
+		RelativePathNotSupportedError, ThumbnailUnavailableError, ReadOnlyPropertyError, ReadOnlyStorageError, TypeMismatchError, StorageNotReadyError,
+		InvalidFilenameError, DuplicateObjectError, DeviceDisconnectedError, InvalidManifestError, StorageMismatchError,
+		TransactionTimeoutError, WriterError, PauseSignal, PausedTransferCanceledError, RetryError:
+		return false
+
+	case FileObjectError:
+		return isTransientError(e.error)
+
+	case SendObjectError:
+		return isTransientError(e.error)
+
+	case FileTransferError:
+		return isTransientError(e.error)
+	}
+
+	var rcErr mtp.RCError
+	if errors.As(err, &rcErr) {
+		return rcErr == mtp.RC_DeviceBusy || rcErr == mtp.RC_IncompleteTransfer
+	}
+
+	var usbErr usb.Error
+	if errors.As(err, &usbErr) {
+		return transientUsbErrors[usbErr]
+	}
+
+	return false
+}
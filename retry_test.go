@@ -0,0 +1,90 @@
+package mtpx
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+	"github.com/ganeshrvel/usb"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestWithRetry(t *testing.T) {
+	dev := &mtp.Device{}
+
+	Convey("Testing the transient errors | withRetry", t, func() {
+		SetRetryPolicy(dev, RetryPolicy{MaxRetries: 2})
+		defer deviceRetryPolicies.Delete(dev)
+
+		attempts := 0
+		err := withRetry(dev, func() error {
+			attempts += 1
+			if attempts < 3 {
+				return mtp.RCError(mtp.RC_DeviceBusy)
+			}
+
+			return nil
+		})
+		So(err, ShouldBeNil)
+		So(attempts, ShouldEqual, 3)
+
+		attempts = 0
+		ioErr := fmt.Errorf("send failed: %w", usb.ERROR_IO)
+		err = withRetry(dev, func() error {
+			attempts += 1
+
+			return ioErr
+		})
+		So(attempts, ShouldEqual, 3)
+		So(err, ShouldHaveSameTypeAs, RetryError{})
+		So(err.(RetryError).Attempts, ShouldEqual, 3)
+		So(err.Error(), ShouldContainSubstring, "failed after 3 attempts")
+		So(errors.Is(err, ioErr), ShouldBeTrue)
+		So(retryCause(err), ShouldEqual, ioErr)
+		So(isTransientError(err), ShouldBeFalse)
+
+		attempts = 0
+		err = withRetry(dev, func() error {
+			attempts += 1
+
+			return FileObjectError{error: mtp.RCError(mtp.RC_DeviceBusy)}
+		})
+		So(attempts, ShouldEqual, 3)
+		So(retryCause(err), ShouldHaveSameTypeAs, FileObjectError{})
+	})
+
+	Convey("Testing the permanent errors | withRetry", t, func() {
+		SetRetryPolicy(dev, RetryPolicy{MaxRetries: 2})
+		defer deviceRetryPolicies.Delete(dev)
+
+		for _, e := range []error{
+			FileNotFoundError{error: fmt.Errorf("file not found")},
+			InvalidPathError{error: fmt.Errorf("invalid path")},
+			mtp.RCError(mtp.RC_InvalidObjectHandle),
+			usb.ERROR_NOT_SUPPORTED,
+			fmt.Errorf("usb: i/o error"),
+			permanentError{fmt.Errorf("canceled")},
+		} {
+			attempts := 0
+			err := withRetry(dev, func() error {
+				attempts += 1
+
+				return e
+			})
+			So(attempts, ShouldEqual, 1)
+			So(err, ShouldNotHaveSameTypeAs, permanentError{})
+			So(err.Error(), ShouldNotContainSubstring, "attempts")
+		}
+	})
+
+	Convey("Testing the default policy | withRetry", t, func() {
+		attempts := 0
+		err := withRetry(dev, func() error {
+			attempts += 1
+
+			return mtp.RCError(mtp.RC_DeviceBusy)
+		})
+		So(attempts, ShouldEqual, 1)
+		So(err, ShouldEqual, mtp.RCError(mtp.RC_DeviceBusy))
+	})
+}
@@ -0,0 +1,128 @@
+package mtpx
+
+import (
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+)
+
+// Session bundles a device and one of its storages along with a [PathCache] which is shared by all of its operations
+// the session is registered as a [CacheInvalidator] of the device, so the cached entries are dropped whenever this package
+// changes a directory; call [PathCache.InvalidateAll] on [Session.Cache] if the storage was modified by another application
+// the package level functions remain available for one-off operations
+type Session struct {
+	dev       *mtp.Device
+	storageId uint32
+	cache     *PathCache
+}
+
+// create a new [Session] for the storage [storageId] of [dev]
+// the session is kept registered until [Session.Close] or [Dispose] is called
+func NewSession(dev *mtp.Device, storageId uint32) *Session {
+	s := &Session{
+		dev:       dev,
+		storageId: storageId,
+		cache:     NewPathCache(),
+	}
+
+	AddCacheInvalidator(dev, s)
+
+	return s
+}
+
+// unregister the session from the device
+func (s *Session) Close() {
+	RemoveCacheInvalidator(s.dev, s)
+}
+
+// implements [CacheInvalidator]
+func (s *Session) Invalidate(storageId, parentId uint32) {
+	s.cache.Invalidate(storageId, parentId)
+}
+
+// implements [CacheInvalidator]
+func (s *Session) InvalidateTree(storageId, objectId uint32) {
+	s.cache.InvalidateTree(storageId, objectId)
+}
+
+func (s *Session) Device() *mtp.Device {
+	return s.dev
+}
+
+func (s *Session) StorageId() uint32 {
+	return s.storageId
+}
+
+// the [PathCache] of the session; it can be passed to the *Cached functions
+func (s *Session) Cache() *PathCache {
+	return s.cache
+}
+
+// the capabilities of the device; see [GetDeviceCapabilities]
+func (s *Session) Capabilities() (*Capabilities, error) {
+	return GetDeviceCapabilities(s.dev)
+}
+
+// fetch the file/directory at [fullPath]
+// a missing path returns an [InvalidPathError]
+func (s *Session) Stat(fullPath string) (*FileInfo, error) {
+	return GetObjectFromPathCached(s.dev, s.storageId, fullPath, s.cache)
+}
+
+// list the immediate children of the directory [fullPath]; see [ReadDir]
+func (s *Session) ReadDir(fullPath string) ([]*FileInfo, error) {
+	fi, err := s.Stat(fullPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return ReadDir(s.dev, s.storageId, fi.ObjectId, fi.FullPath)
+}
+
+// create the directory [fullPath] along with its missing parents; see [MakeDirectory]
+func (s *Session) MakeDirectory(fullPath string) (uint32, error) {
+	return MakeDirectory(s.dev, s.storageId, fullPath)
+}
+
+// delete the file/directory [fullPath]; see [DeleteFile]
+func (s *Session) Delete(fullPath string) error {
+	fi, err := s.Stat(fullPath)
+	if err != nil {
+		return err
+	}
+
+	return DeleteFile(s.dev, s.storageId, []FileProp{{ObjectId: fi.ObjectId, FullPath: fi.FullPath}})
+}
+
+// rename the file/directory [fullPath] to [newFileName]; see [RenameFile]
+func (s *Session) Rename(fullPath, newFileName string) (uint32, error) {
+	fi, err := s.Stat(fullPath)
+	if err != nil {
+		return 0, err
+	}
+
+	return RenameFile(s.dev, s.storageId, FileProp{ObjectId: fi.ObjectId, FullPath: fi.FullPath}, newFileName)
+}
+
+// move the file/directory [fullPath] into the directory [destParentPath]; see [MoveFile]
+func (s *Session) Move(fullPath, destParentPath string) (uint32, error) {
+	fi, err := s.Stat(fullPath)
+	if err != nil {
+		return 0, err
+	}
+
+	destFi, err := s.Stat(destParentPath)
+	if err != nil {
+		return 0, err
+	}
+
+	return MoveFile(s.dev, s.storageId, fi.ObjectId, fi.FullPath, destFi.FullPath)
+}
+
+// transfer the local files/directories [sources] into the directory [destination]; see [UploadFilesWithOpts]
+func (s *Session) Upload(sources []string, destination string, opts UploadOpts) (destinationObjectId uint32, bulkFilesSent int64, bulkSizeSent int64, err error) {
+	return UploadFilesWithOpts(s.dev, s.storageId, sources, destination, opts)
+}
+
+// transfer the files/directories [sources] into the local directory [destination]; see [DownloadFilesWithOpts]
+func (s *Session) Download(sources []string, destination string, opts DownloadOpts) (bulkFilesSent int64, bulkSizeSent int64, err error) {
+	return DownloadFilesWithOpts(s.dev, s.storageId, sources, destination, opts)
+}
@@ -0,0 +1,68 @@
+package mtpx
+
+import (
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"log"
+	"math/rand"
+	"testing"
+)
+
+func TestSession(t *testing.T) {
+	dev, err := Initialize(Init{})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	storages, err := FetchStorages(dev)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	sid := storages[0].Sid
+
+	Convey("Mutate a directory through a session | Session", t, func() {
+		s := NewSession(dev, sid)
+
+		// test the directory '/mtp-test-files/temp_dir/test-Session/{random}'
+		dirName := fmt.Sprintf("/mtp-test-files/temp_dir/test-Session/%x", rand.Int31())
+
+		_, err := s.MakeDirectory(dirName)
+		So(err, ShouldBeNil)
+
+		// the listing of [dirName] is cached
+		_, err = s.Stat(getFullPath(dirName, "a"))
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+
+		aId, err := s.MakeDirectory(getFullPath(dirName, "a"))
+		So(err, ShouldBeNil)
+
+		fi, err := s.Stat(getFullPath(dirName, "a"))
+		So(err, ShouldBeNil)
+		So(fi.ObjectId, ShouldEqual, aId)
+
+		_, err = s.Rename(getFullPath(dirName, "a"), "b")
+		So(err, ShouldBeNil)
+
+		_, err = s.Stat(getFullPath(dirName, "a"))
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+
+		_, err = s.MakeDirectory(getFullPath(dirName, "dest"))
+		So(err, ShouldBeNil)
+
+		_, err = s.Move(getFullPath(dirName, "b"), getFullPath(dirName, "dest"))
+		So(err, ShouldBeNil)
+
+		children, err := s.ReadDir(getFullPath(dirName, "dest"))
+		So(err, ShouldBeNil)
+		So(len(children), ShouldEqual, 1)
+		So(children[0].Name, ShouldEqual, "b")
+
+		So(s.Delete(getFullPath(dirName, "dest")), ShouldBeNil)
+
+		_, err = s.Stat(getFullPath(dirName, "dest/b"))
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+	})
+
+	Dispose(dev)
+}
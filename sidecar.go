@@ -0,0 +1,150 @@
+package mtpx
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+	"io/ioutil"
+)
+
+// the object properties written to the sidecar files by default (see [DownloadOpts.WriteSidecar])
+func DefaultSidecarProps() []uint16 {
+	return []uint16{
+		mtp.OPC_ObjectFormat,
+		mtp.OPC_ObjectSize,
+		mtp.OPC_DateCreated,
+		mtp.OPC_DateModified,
+		mtp.OPC_Width,
+		mtp.OPC_Height,
+		mtp.OPC_Duration,
+	}
+}
+
+// write the sidecar file of the downloaded object [fi] next to its local file [destination]
+// the properties [propCodes] (nil means [DefaultSidecarProps]) which the device returns are written as an [ObjectSidecar];
+// the unsupported properties are left out and no sidecar is written if none of them could be read
+func writeSidecar(dev *mtp.Device, fi *FileInfo, destination string, propCodes []uint16) error {
+	if propCodes == nil {
+		propCodes = DefaultSidecarProps()
+	}
+
+	values, err := readSidecarProps(dev, fi.ObjectId, propCodes)
+	if err != nil {
+		return err
+	}
+
+	if len(values) < 1 {
+		return nil
+	}
+
+	sidecar := newObjectSidecar(fi, values)
+
+	data, err := json.MarshalIndent(sidecar, "", "  ")
+	if err != nil {
+		return LocalFileError{error: err}
+	}
+
+	if err := ioutil.WriteFile(destination+sidecarExtension, data, 0644); err != nil {
+		return LocalFileError{error: err}
+	}
+
+	return nil
+}
+
+// fetch the properties [propCodes] of the object [objectId]
+// all the properties are fetched in a single GetObjectPropList transaction if the device supports it,
+// otherwise they are fetched one at a time and the ones which can't be read are skipped;
+// the properties which the device doesn't declare for the object format (see [GetSupportedProps]) aren't requested
+func readSidecarProps(dev *mtp.Device, objectId uint32, propCodes []uint16) (map[uint16]interface{}, error) {
+	supported, err := isOperationSupported(dev, mtp.OC_MTP_GetObjPropList)
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[uint16]interface{}{}
+
+	if supported {
+		var list *objectPropList
+		if err := withCallTimeout(dev, nil, func() (err error) {
+			list, err = handleGetObjectProps(dev, objectId)
+
+			return err
+		}); err != nil {
+			if isDeviceDisconnected(err) {
+				return nil, deviceDisconnectedError(err)
+			}
+
+			if _, ok := err.(TransactionTimeoutError); ok {
+				return nil, err
+			}
+
+			// the properties of the object can't be read
+			return values, nil
+		}
+
+		wanted := map[uint16]bool{}
+		for _, code := range propCodes {
+			wanted[code] = true
+		}
+
+		for _, e := range list.elements {
+			if e.objectId == objectId && wanted[e.propCode] {
+				values[e.propCode] = e.value
+			}
+		}
+
+		return values, nil
+	}
+
+	obj := mtp.ObjectInfo{}
+	if err := withCallTimeout(dev, nil, func() error {
+		return dev.GetObjectInfo(objectId, &obj)
+	}); err != nil {
+		if isDeviceDisconnected(err) {
+			return nil, deviceDisconnectedError(err)
+		}
+
+		if _, ok := err.(TransactionTimeoutError); ok {
+			return nil, err
+		}
+
+		// the properties of the object can't be read
+		return values, nil
+	}
+
+	for _, code := range propCodes {
+		v, err := getObjectProperty(dev, objectId, obj.ObjectFormat, code)
+		if err != nil {
+			if isDeviceDisconnected(err) {
+				return nil, deviceDisconnectedError(err)
+			}
+
+			continue
+		}
+
+		values[code] = v
+	}
+
+	return values, nil
+}
+
+// assemble the [ObjectSidecar] of [fi] from the property [values] keyed by their codes
+// the properties are named after [mtp.OPC_names]; the unknown ones are named by their hex code (eg: "0xDC87")
+func newObjectSidecar(fi *FileInfo, values map[uint16]interface{}) ObjectSidecar {
+	props := make(map[string]interface{}, len(values))
+
+	for code, v := range values {
+		name, ok := mtp.OPC_names[int(code)]
+		if !ok {
+			name = fmt.Sprintf("0x%04X", code)
+		}
+
+		props[name] = v
+	}
+
+	return ObjectSidecar{
+		ObjectId:   fi.ObjectId,
+		FullPath:   fi.FullPath,
+		Properties: props,
+	}
+}
@@ -0,0 +1,27 @@
+package mtpx
+
+import (
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestNewObjectSidecar(t *testing.T) {
+	Convey("Testing the property names | newObjectSidecar", t, func() {
+		fi := &FileInfo{ObjectId: 7, FullPath: "/DCIM/a.jpg"}
+
+		sidecar := newObjectSidecar(fi, map[uint16]interface{}{
+			mtp.OPC_Width:  uint32(4000),
+			mtp.OPC_Height: uint32(3000),
+			0xDEAD:         "unknown",
+		})
+
+		So(sidecar.ObjectId, ShouldEqual, 7)
+		So(sidecar.FullPath, ShouldEqual, "/DCIM/a.jpg")
+		So(sidecar.Properties, ShouldResemble, map[string]interface{}{
+			"Width":  uint32(4000),
+			"Height": uint32(3000),
+			"0xDEAD": "unknown",
+		})
+	})
+}
@@ -10,11 +10,51 @@ type allowedSecondExtMap map[string]string
 
 type Init struct {
 	DebugMode bool
+
+	// select the device with the USB serial number [SerialNumber]
+	SerialNumber string
+
+	// select the device with the USB vendor id [VendorId] and/or product id [ProductId]
+	VendorId  uint16
+	ProductId uint16
+
+	// retry policy for the transient failures of the device transactions; see [SetRetryPolicy]
+	RetryPolicy RetryPolicy
+
+	// validation of the names of the created and renamed objects; see [SetFilenamePolicy]
+	FilenamePolicy FilenamePolicy
+
+	// pick the first of the objects sharing a filename in a directory instead of returning a [DuplicateObjectError]; see [SetPreferFirstDuplicate]
+	PreferFirstDuplicate bool
+
+	// normalization applied to the filenames while resolving the paths (eg: norm.NFC.String); see [SetFilenameNormalizer]
+	FilenameNormalizer func(string) string
+
+	// return a [ReadOnlyStorageError] before uploading, creating or deleting the objects of a read-only storage; see [SetCheckStorageWritable]
+	CheckStorageWritable bool
+
+	// limit of a single device transaction; 0 disables it. see [SetPerCallTimeout]
+	PerCallTimeout time.Duration
+}
+
+// the identity of the device reported in its DeviceInfo
+type DeviceDetails struct {
+	Manufacturer  string
+	Model         string
+	SerialNumber  string
+	DeviceVersion string
+
+	// vendor extension id and the vendor extension descriptions (eg: "microsoft.com: 1.0; android.com: 1.0;")
+	MTPVendorExtensionID uint32
+	MTPVendorExtension   string
 }
 
 type StorageData struct {
 	Sid  uint32
 	Info mtp.StorageInfo
+
+	// false if the storage is mounted but reports 0 capacity (eg: an SD card which isn't ready yet)
+	Ready bool
 }
 
 type FileInfo struct {
@@ -57,6 +97,13 @@ type ProgressInfo struct {
 	// transfer rate (in MB/s)
 	Speed float64
 
+	// transfer rate (in bytes per second) of the session averaged over the recent [UploadOpts.ThroughputWindow] or [DownloadOpts.ThroughputWindow]
+	// use it along with [BulkFileSize] to estimate the remaining time
+	BytesPerSecond float64
+
+	// time elapsed since [StartTime]
+	Elapsed time.Duration
+
 	// total files to transfer
 	// note: the value will be 0 if pre-processing was not allowed
 	TotalFiles int64
@@ -84,20 +131,488 @@ type SizeProgressCb func(total, sent int64, objectId uint32, err error) error
 
 type LocalWalkCb func(fi *os.FileInfo, fullPath string, err error) error
 
+// an error returned by the callback aborts the transfer; a [PauseSignal] pauses it until it's resumed instead
 type ProgressCb func(fi *ProgressInfo, err error) error
 
+// reports the aggregate progress of a batch transfer
+// [currentPath] is the fullPath of the file on the device which is being transferred
+type BatchProgressCb func(totalBytes, sentBytes, totalFiles, completedFiles int64, currentPath string) error
+
+// describes an action which a dry run would have performed on the device object [fullPath]
+// [size] is the size of the uploaded, overwritten or the deleted file; 0 for the directories
+type DryRunCb func(action DryRunAction, fullPath string, size int64) error
+
+type Event struct {
+	Type EventType
+
+	// MTP event code (mtp.EC_*) of the change; eg: mtp.EC_StoreAdded or mtp.EC_StoreRemoved for [EventStorageChanged]
+	Code uint16
+
+	StorageId uint32
+
+	// objectId of the added or the removed object; 0 for [EventStorageChanged]
+	ObjectId uint32
+}
+
+type EventCb func(e Event) error
+
+// a sample of the space of a storage reported by [WatchStorage]
+type StorageUsage struct {
+	Sid uint32
+
+	// the time at which the storage was polled
+	Time time.Time
+
+	CapacityInBytes  uint64
+	FreeSpaceInBytes uint64
+	UsedSpaceInBytes uint64
+}
+
+// [err] is set if the storage couldn't be polled; [usage] only holds the storageId and the time in that case
+type StorageWatchCb func(usage StorageUsage, err error) error
+
+// an object of the storage in a manifest exported by [ExportManifest]
+type ManifestEntry struct {
+	FullPath  string
+	ObjectId  uint32
+	Size      int64
+	IsDir     bool
+	ModTime   time.Time
+	Extension string
+}
+
+type ManifestDiff struct {
+	// the objects which aren't listed in the manifest
+	Added []ManifestEntry
+
+	// the objects of the manifest which no longer exist
+	Removed []ManifestEntry
+
+	// the current entries of the objects whose size, modification time or type differs from the manifest
+	Changed []ManifestEntry
+}
+
 type LocalPreprocessCb func(fi *os.FileInfo, fullPath string, err error) error
 
 type MtpPreprocessCb func(fi *FileInfo, err error) error
 
+type UploadOpts struct {
+	// if true, will fetch the total file size and count of the sources before the transfer starts
+	// use this with caution as it may take a few seconds to minutes to process the files
+	PreprocessFiles bool
+
+	// called for every file while pre-processing
+	PreprocessCb LocalPreprocessCb
+
+	// if true, the symlinks are resolved and their targets are uploaded as if they were located at the symlink
+	// a symlink cycle returns a [SymlinkCycleError]
+	// if false, the symlinks are skipped
+	FollowSymlinks bool
+
+	// resolution of the conflicts with the existing files on the device
+	// note: defaults to [ConflictSkip]
+	ConflictPolicy ConflictPolicy
+
+	// Deprecated: use [ConflictPolicy] instead
+	// if true and [ConflictPolicy] is [ConflictSkip], the existing files on the device are replaced
+	OverwriteExisting bool
+
+	// if true, an existing file which is overwritten is truncated and rewritten in place, so that its objectId
+	// and the references to it (eg: playlists) are kept
+	// it requires the Android edit extension (see [Capabilities.SupportsEditObject]); on the other devices, for an existing
+	// directory and if the rewrite fails, the existing object is deleted and a new object is created
+	ReuseHandleOnOverwrite bool
+
+	// object format (mtp.OFC_*) of the uploaded files; the devices use it to pick the app showing a file
+	// note: defaults to the format derived from the extension of each file (eg: mtp.OFC_MP3 for ".mp3"), or mtp.OFC_Undefined
+	ObjectFormat uint16
+
+	// if true, the modification time of the local files is written to the OPC_DateModified property of the uploaded objects
+	// it is skipped silently if the device doesn't allow writing the property
+	PreserveModTime bool
+
+	// duration of the sliding window over which [ProgressInfo.BytesPerSecond] is averaged
+	// use a longer window for the devices with a bursty USB throughput
+	// note: defaults to [defaultThroughputWindow]
+	ThroughputWindow time.Duration
+
+	// minimum duration and minimum bytes sent between two [ProgressCb] calls of a file; the progress in between is coalesced
+	// the first and the final progress of every file are always reported
+	// note: 0 reports every chunk
+	ProgressInterval time.Duration
+	ProgressMinBytes int64
+
+	// size (in bytes) of the reusable buffers through which the local files are read; the buffers are shared by all the files of the batch
+	// use a multiple of the USB packet size of the device (512 bytes for USB 2.0 and 1024 bytes for USB 3.0)
+	// note: defaults to [defaultTransferBufferSize]
+	BufferSize int
+
+	// if true, the partial object of a file which failed to transfer (or whose transfer was canceled) is left on the device
+	// by default it is deleted, so that it isn't mistaken for a complete file
+	KeepPartialObjects bool
+
+	// if true, each file is sent under a temporary name (eg: .name.ext.mtpx-tmp) and renamed to its final name once it is complete,
+	// so that an interrupted upload never leaves a partial file under the final name
+	// an existing file which is overwritten is renamed aside (eg: .name.ext.mtpx-old) and deleted only after the new file
+	// took its name; [ReuseHandleOnOverwrite] is ignored
+	// it costs one rename per file (two for an overwrite) and requires a device which allows writing the OPC_ObjectFileName
+	// property of the objects of the uploaded format
+	Atomic bool
+
+	// skip the free space check which runs after pre-processing
+	// use it for the devices which misreport their free space
+	SkipFreeSpaceCheck bool
+
+	// filename patterns ([path.Match] syntax, eg: "~*") of the files which are skipped
+	// note: defaults to [DefaultDisallowedFiles] if nil; use an empty list to transfer all the files
+	DisallowedFiles []string
+
+	// called whenever a chunk of a file is sent and once the transfer is completed
+	// note: it can be nil
+	ProgressCb ProgressCb
+
+	// called along with [ProgressCb] with the cumulative progress of the whole batch
+	// the sources are always pre-processed when it is set so that the totals are available
+	// note: it can be nil
+	BatchProgressCb BatchProgressCb
+
+	// if true, every uploaded file is downloaded again and its hash is compared with the hash of the local file
+	// a mismatch returns a [ChecksumMismatchError]
+	// note: this doubles the transfer time
+	VerifyUpload bool
+
+	// hash algorithm used by [VerifyUpload]
+	// note: defaults to [HashSha256]
+	HashAlgo HashAlgo
+
+	// pre-computed hex encoded hashes of the local files (hashed using [HashAlgo]) keyed by their full path
+	// the local files which are missing here are hashed before the upload is verified
+	// note: it can be nil
+	LocalHashes map[string]string
+
+	// if false, the files which fail to transfer are skipped and a [BatchError] listing them is returned at the end
+	// if true, the transfer is aborted on the first failure
+	// note: an error returned by [ProgressCb] or [PreprocessCb] always aborts the transfer
+	StopOnError bool
+
+	// if true, the sources are walked and the destination is resolved without creating any objects on the device
+	// every planned action is reported to [DryRunCb] and the same totals as a real upload are returned
+	// [ProgressCb] is called only once the planning is completed
+	DryRun bool
+
+	// called for every action planned by [DryRun]
+	// note: it can be nil
+	DryRunCb DryRunCb
+}
+
+type PollEventsOpts struct {
+	// interval between the listings of the objects which are compared
+	// note: defaults to [defaultEventPollInterval]
+	Interval time.Duration
+
+	// the storages whose objects are listed; the other storages aren't reported
+	// note: all the storages are listed if it's empty
+	StorageIds []uint32
+}
+
+type DeleteOpts struct {
+	// if true, the objects are listed without deleting them
+	// every object which would be deleted is reported to [DryRunCb] and the same count as a real deletion is returned
+	DryRun bool
+
+	// called for every object listed by [DryRun]
+	// note: it can be nil
+	DryRunCb DryRunCb
+
+	// if true, [DeleteFiles] deletes the remaining paths after a path fails and returns a [BatchError] listing the failures at the end
+	ContinueOnError bool
+}
+
+// the outcome of [DeleteFiles] for each of the paths
+type DeleteReport struct {
+	Deleted []string
+
+	// the paths which didn't exist on the device
+	NotFound []string
+
+	Failed []FileFailure
+}
+
+type MoveOpts struct {
+	// resolution of an object with the same name inside the destination directory
+	// note: defaults to [ConflictSkip], which leaves the object in place
+	ConflictPolicy ConflictPolicy
+
+	// if true, [MoveFiles] moves the remaining objects after an object fails and returns a [BatchError] listing the failures at the end
+	ContinueOnError bool
+}
+
+// an object moved by [MoveFiles]
+type MovedObject struct {
+	ObjectId uint32
+
+	// objectId of the object inside the destination directory; it differs from [ObjectId] if the fallback move was used
+	NewObjectId uint32
+
+	// full path of the object inside the destination directory
+	FullPath string
+}
+
+type MoveFailure struct {
+	ObjectId uint32
+	Err      error
+}
+
+// the outcome of [MoveFiles] for each of the objects
+type MoveReport struct {
+	Moved []MovedObject
+
+	// the objects which were left in place by [MoveOpts.ConflictPolicy]
+	Skipped []uint32
+
+	Failed []MoveFailure
+}
+
+// an object moved into the trash by [TrashFile]
+type TrashEntry struct {
+	// objectId of the object inside the trash directory; MoveObject keeps the objectId of the object
+	ObjectId uint32
+
+	// name of the object inside the trash directory; it differs from the original name if the trash already held an object with the same name
+	Name string
+
+	OriginalPath string
+	TrashedAt    time.Time
+}
+
+// the options of [SyncToDevice] and [SyncFromDevice]
+// the source is the local directory for [SyncToDevice] and the device directory for [SyncFromDevice]
+type SyncOpts struct {
+	// if true, the files and directories which exist only at the destination are deleted
+	Mirror bool
+
+	// resolution of the source files which were modified since they were synchronized to the destination
+	// note: defaults to [ConflictSkip], which transfers them again if they are newer than the destination files; use [ConflictOverwrite] to transfer them regardless
+	ConflictPolicy ConflictPolicy
+
+	// if true, the modified source files are left untouched at the destination ([SyncSkip]) regardless of [ConflictPolicy]
+	KeepModified bool
+
+	// if true, the local symlinks are resolved and their targets are synchronized
+	FollowSymlinks bool
+
+	// if true, the modification time of the source files is written to the transferred files
+	PreserveModTime bool
+
+	// filename patterns ([path.Match] syntax, eg: "~*") of the files which are skipped on both sides
+	// note: defaults to [DefaultDisallowedFiles] if nil; use an empty list to synchronize all the files
+	DisallowedFiles []string
+
+	// called whenever a chunk of a file is sent and once the transfer is completed
+	// note: it can be nil
+	ProgressCb ProgressCb
+}
+
+type SyncAction struct {
+	Type SyncActionType
+
+	// destination path of the object; a device path for [SyncToDevice] and a local path for [SyncFromDevice]
+	// note: a file uploaded by [ConflictRenameWithSuffix] is reported at the path of the existing file
+	FullPath string
+
+	Size int64
+}
+
+type SyncReport struct {
+	CreatedDirectories int
+
+	// the source files which didn't exist at the destination
+	Uploaded   int
+	Downloaded int
+
+	// the modified source files which were transferred again
+	Updated int
+
+	// the destination only objects deleted by [SyncOpts.Mirror]; a directory is counted once along with its contents
+	Deleted int
+
+	Unchanged int
+	Skipped   int
+
+	// the actions in the order they were taken
+	Actions []SyncAction
+}
+
+type WalkOpts struct {
+	// fetch the whole nested tree
+	Recursive bool
+
+	// ignore the files matching the [DisallowedFiles] list
+	SkipDisallowedFiles bool
+
+	// filename patterns ([path.Match] syntax, eg: "~*") of the files ignored by [SkipDisallowedFiles]
+	// note: defaults to [DefaultDisallowedFiles] if nil
+	DisallowedFiles []string
+
+	// ignore the hidden files (unix style)
+	SkipHiddenFiles bool
+
+	// include the objects with the OPC_Hidden property set (eg: the system databases), which are ignored by default
+	// note: the property is read only if the device supports GetObjectPropList; otherwise the [disallowedFiles] list is ignored instead
+	IncludeHidden bool
+
+	// invoke [WalkCb] with the error of an object which couldn't be read; the walk is aborted if the callback returns an error
+	// by default such objects are skipped and counted in the skippedCount returned by [WalkWithOpts]; [Walk] always skips them
+	ReportErrors bool
+}
+
+// the totals of a walk returned by [WalkWithStats]
+type WalkStats struct {
+	TotalFiles       int64
+	TotalDirectories int64
+	SkippedCount     int64
+
+	// nesting level of the deepest object; the immediate children of the walked directory are at depth 1
+	MaxDepth int
+
+	// number of the walked objects at each depth, indexed by the depth (index 0 is only used when a file is walked)
+	DepthCounts []int64
+}
+
+type DownloadOpts struct {
+	// number of files which are written to the local disk concurrently while the next files are being fetched from the device
+	// the MTP transfers themselves are always serialized as a device can only run one transaction at a time
+	// note: values less than 1 are treated as 1
+	Concurrency int
+
+	// called for every file before the transfer starts
+	// note: it can be nil
+	PreprocessCb MtpPreprocessCb
+
+	// called whenever a chunk of a file is received and once the transfer is completed
+	// note: it can be nil
+	ProgressCb ProgressCb
+
+	// duration of the sliding window over which [ProgressInfo.BytesPerSecond] is averaged
+	// note: defaults to [defaultThroughputWindow]
+	ThroughputWindow time.Duration
+
+	// minimum duration and minimum bytes received between two [ProgressCb] calls of a file; the progress in between is coalesced
+	// the first and the final progress of every file are always reported
+	// note: 0 reports every chunk
+	ProgressInterval time.Duration
+	ProgressMinBytes int64
+
+	// size (in bytes) of the reusable buffers in which the received bytes are collected before they are written to the local files
+	// the buffers are shared by all the files of the batch
+	// note: defaults to [defaultTransferBufferSize]
+	BufferSize int
+
+	// called along with [ProgressCb] with the cumulative progress of the whole batch
+	// note: it can be nil
+	BatchProgressCb BatchProgressCb
+
+	// if false, the files which fail to transfer are skipped and a [BatchError] listing them is returned at the end
+	// if true, the transfer is aborted on the first failure
+	// note: an error returned by [ProgressCb] or [PreprocessCb] always aborts the transfer
+	StopOnError bool
+
+	// filename patterns ([path.Match] syntax, eg: "~*") of the files which are skipped
+	// note: defaults to [DefaultDisallowedFiles] if nil; use an empty list to transfer all the files
+	DisallowedFiles []string
+
+	// if true, every file is written directly into the destination directory instead of recreating the directory tree
+	// the files of the batch with the same name are renamed as "name (1).ext", "name (2).ext" and so on
+	Flatten bool
+
+	// if true, the MTP properties of every downloaded file are written as an [ObjectSidecar] to "{file}.json" next to it
+	// the files whose properties can't be read are downloaded without a sidecar
+	WriteSidecar bool
+
+	// the properties (mtp.OPC_*) written to the sidecars
+	// note: defaults to [DefaultSidecarProps] if nil
+	SidecarProps []uint16
+
+	// permissions of the local directories created by the download (eg: 0700 for a private backup)
+	// the umask applies; the existing directories are left untouched
+	// note: defaults to 0755 if 0
+	DirMode os.FileMode
+
+	// permissions of the downloaded files; they are applied to the files which already existed as well
+	// note: defaults to 0666 less the umask if 0, same as [os.Create]
+	FileMode os.FileMode
+
+	// the modification time of the device files is written to the downloaded files, so that they sort chronologically
+	// the files whose ModTime isn't set by the device keep the time of the download
+	// if true, all the downloaded files keep the time of the download
+	SkipPreserveModTime bool
+}
+
+// the contents of a sidecar file written by [DownloadOpts.WriteSidecar]
+type ObjectSidecar struct {
+	ObjectId uint32
+	FullPath string
+
+	// the property values keyed by their names (eg: "Width"); see [GetObjectProperty] for their types
+	Properties map[string]interface{}
+}
+
 type FileProp struct {
 	ObjectId uint32
 	FullPath string
 }
 
+// the options of [proccessWalk]
+type walkProps struct {
+	// fetch the whole nested tree
+	recursive bool
+
+	// ignore the files matching the [disallowedFiles] patterns; see [isDisallowedFiles]
+	skipDisallowedFiles bool
+	disallowedFiles     []string
+
+	// ignore the hidden files (unix style)
+	skipHiddenFiles bool
+
+	// ignore the objects with the OPC_Hidden property set; see [listHiddenObjects]
+	skipHiddenObjects bool
+
+	// skip the objects which couldn't be read; otherwise the callback is invoked with the error
+	// and the walk is aborted if the callback returns an error
+	skipErrors bool
+}
+
 type processDownloadFilesProps struct {
 	destinationFileParentPath, destinationFilePath, sourceParentPath string
 	bulkFilesSent, bulkSizeSent, totalFiles, totalSize               int64
+	throughput                                                       *throughputMeter
+	disallowedFiles                                                  []string
+	progressInterval                                                 time.Duration
+	progressMinBytes                                                 int64
+	dirMode, fileMode                                                os.FileMode
+	skipPreserveModTime                                              bool
+}
+
+// a progress sample of [throughputMeter]
+type throughputSample struct {
+	at   time.Time
+	sent int64
+}
+
+// measures the transfer rate over a sliding window of the recent progress samples
+type throughputMeter struct {
+	window  time.Duration
+	samples []throughputSample
+}
+
+// the sort keys of a child listed by [ReadDirPage]
+// [fi] is nil until the child is resolved
+type dirPageEntry struct {
+	objectId uint32
+	name     string
+	size     int64
+	modTime  time.Time
+	fi       *FileInfo
 }
 
 type downloadFilesObjectCache map[string]downloadFilesObjectCacheContainer
@@ -107,6 +622,20 @@ type downloadFilesObjectCacheContainer struct {
 	destinationFileParentPath, destinationFilePath, sourceParentPath string
 }
 
+type ScannedFile struct {
+	FullPath string
+	Size     int64
+}
+
+type ScanResult struct {
+	TotalFiles       int64
+	TotalDirectories int64
+	TotalSize        int64
+
+	// the largest files sorted by size in descending order
+	LargestFiles []ScannedFile
+}
+
 type FileExistsContainer struct {
 	Exists   bool
 	FileInfo *FileInfo
@@ -0,0 +1,667 @@
+package mtpx
+
+import (
+	"context"
+	"fmt"
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Synchronize the contents of the local directory [localDir] to the directory [remoteDir] on the device
+// the files are matched by their path relative to [localDir] and [remoteDir], normalized and case insensitively like [GetObjectFromParentIdAndFilename]:
+// a local file which doesn't exist on the device is uploaded ([SyncUpload]);
+// a local file whose size differs from the device file or which was modified after it is resolved using [opts.ConflictPolicy] ([SyncUpdate] or [SyncSkip]);
+// the other files are left untouched
+// a local file and a device directory (or vice versa) at the same path are left untouched and reported as [SyncSkip]
+// if [opts.Mirror] is true then the files and directories which exist only on the device are deleted ([SyncDelete]);
+// nothing is deleted and a [ListDirectoryError] is returned if some of the device objects couldn't be read
+// [remoteDir] is created if it doesn't exist; files matching the [disallowedFiles] list are ignored on both sides
+// on error the returned [SyncReport] lists the actions which were taken before the failure
+func SyncToDevice(dev *mtp.Device, storageId uint32, localDir, remoteDir string, opts SyncOpts) (*SyncReport, error) {
+	report := &SyncReport{}
+
+	_remoteDir, err := NormalizePath(remoteDir)
+	if err != nil {
+		return report, err
+	}
+
+	if err := checkConflictPolicy(opts.ConflictPolicy); err != nil {
+		return report, err
+	}
+
+	if err := checkStorageWritable(dev, storageId, false); err != nil {
+		return report, err
+	}
+
+	_localDir := fixSlash(localDir)
+
+	lInfo, err := os.Stat(_localDir)
+	if err != nil {
+		return report, InvalidPathError{error: err}
+	}
+
+	if !lInfo.IsDir() {
+		return report, InvalidPathError{error: fmt.Errorf("local path is not a directory: %s", _localDir)}
+	}
+
+	remoteObjects, unreadable, err := listSyncRemoteObjects(dev, storageId, _remoteDir, opts.DisallowedFiles)
+	if err != nil {
+		return report, err
+	}
+
+	// the keys of the device objects which exist locally; see [syncPathKey]
+	seen := map[string]bool{}
+
+	// the keys of the device directories which conflict with a local file
+	conflictingDirs := map[string]bool{}
+
+	// the device paths of the directories keyed by their [syncPathKey]; the existing device directories keep their names
+	remotePaths := map[string]string{".": _remoteDir}
+
+	// the local files to upload grouped by the device directory they are uploaded into
+	var uploadDirs []string
+	uploads := map[string][]syncUpload{}
+
+	_, _, _, err = walkLocalFiles([]string{_localDir}, opts.FollowSymlinks, opts.DisallowedFiles, func(fi *os.FileInfo, fullPath string, err error) error {
+		if err != nil {
+			return err
+		}
+
+		_rel, err := filepath.Rel(_localDir, fullPath)
+		if err != nil {
+			return LocalFileError{error: err}
+		}
+		// the map keys use the device separator
+		rel := toPathSep(_rel)
+
+		// the [localDir] itself
+		if rel == "." {
+			return nil
+		}
+
+		// the local file is matched against the name it is uploaded with; see [FilenamePolicy]
+		rel, err = checkPath(dev, rel)
+		if err != nil {
+			return err
+		}
+
+		key := syncPathKey(dev, rel)
+		remotePath := getFullPath(remotePaths[path.Dir(key)], path.Base(rel))
+		remote, exists := remoteObjects[key]
+		if exists {
+			seen[key] = true
+			remotePath = remote.FullPath
+		}
+
+		if (*fi).IsDir() {
+			remotePaths[key] = remotePath
+
+			if !exists {
+				if _, err := makeDirectory(dev, storageId, remotePath); err != nil {
+					return err
+				}
+
+				report.addAction(SyncCreateDir, remotePath, 0)
+
+				return nil
+			}
+
+			// the contents of the directory can't be synchronized into a device file
+			if !remote.IsDir {
+				report.addAction(SyncSkip, remotePath, 0)
+
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		size := (*fi).Size()
+
+		action := SyncUpload
+		if exists {
+			switch {
+			case remote.IsDir:
+				conflictingDirs[key] = true
+				report.addAction(SyncSkip, remotePath, size)
+
+				return nil
+
+			case !isSyncFileModified(size, (*fi).ModTime(), remote.Size, remote.ModTime):
+				report.Unchanged += 1
+
+				return nil
+
+			case opts.KeepModified, !syncConflictTransfers(opts.ConflictPolicy, size, (*fi).ModTime(), remote.Size, remote.ModTime):
+				report.addAction(SyncSkip, remotePath, size)
+
+				return nil
+			}
+
+			action = SyncUpdate
+		}
+
+		parentPath := path.Dir(remotePath)
+		if _, ok := uploads[parentPath]; !ok {
+			uploadDirs = append(uploadDirs, parentPath)
+		}
+		uploads[parentPath] = append(uploads[parentPath], syncUpload{action, fullPath, remotePath, size})
+
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	progressCb := opts.ProgressCb
+	if progressCb == nil {
+		progressCb = func(pInfo *ProgressInfo, err error) error {
+			return err
+		}
+	}
+
+	for _, parentPath := range uploadDirs {
+		files := uploads[parentPath]
+
+		sources := make([]string, 0, len(files))
+		for _, f := range files {
+			sources = append(sources, f.source)
+		}
+
+		// the files whose conflicts were resolved above are uploaded using the same [opts.ConflictPolicy];
+		// the files to update by the default [ConflictSkip] are overwritten
+		conflictPolicy := opts.ConflictPolicy
+		if conflictPolicy == ConflictSkip {
+			conflictPolicy = ConflictOverwrite
+		}
+
+		if _, _, _, err := uploadFiles(dev, storageId, sources, parentPath, UploadOpts{
+			ConflictPolicy:  conflictPolicy,
+			PreserveModTime: opts.PreserveModTime,
+			DisallowedFiles: opts.DisallowedFiles,
+			ProgressCb:      progressCb,
+			StopOnError:     true,
+		}); err != nil {
+			return report, err
+		}
+
+		for _, f := range files {
+			report.addAction(f.action, f.destination, f.size)
+		}
+	}
+
+	if !opts.Mirror {
+		return report, nil
+	}
+
+	if unreadable > 0 {
+		return report, ListDirectoryError{error: fmt.Errorf("unable to read %d objects inside %s; the device only objects weren't deleted", unreadable, _remoteDir)}
+	}
+
+	// the device only objects; the nested objects of a deleted or a skipped directory are left to their parent
+	var rels []string
+	for rel := range remoteObjects {
+		rels = append(rels, rel)
+	}
+	sort.Strings(rels)
+
+	var covered []string
+	for _, rel := range rels {
+		if isSyncPathCovered(rel, covered) {
+			continue
+		}
+
+		// the device directory which conflicts with a local file is left untouched along with its contents
+		if conflictingDirs[rel] {
+			covered = append(covered, rel)
+
+			continue
+		}
+
+		if seen[rel] {
+			continue
+		}
+
+		fi := remoteObjects[rel]
+
+		if fi.IsDir {
+			if _, err := deleteFileRecursive(dev, storageId, fi.ObjectId, fi.FullPath, DeleteOpts{}); err != nil {
+				return report, err
+			}
+
+			covered = append(covered, rel)
+		} else if err := deleteFile(dev, storageId, []FileProp{{fi.ObjectId, ""}}); err != nil {
+			return report, err
+		}
+
+		report.addAction(SyncDelete, fi.FullPath, fi.Size)
+	}
+
+	return report, nil
+}
+
+// Synchronize the contents of the device directory [remoteDir] to the local directory [localDir]
+// the reverse of [SyncToDevice]: a device file which doesn't exist locally is downloaded ([SyncDownload]);
+// a device file whose size differs from the local file or which was modified after it is resolved using [opts.ConflictPolicy] ([SyncUpdate] or [SyncSkip])
+// the files are matched like [SyncToDevice]; an existing local file keeps its name
+// the modification times within [syncModTimeTolerance] are treated as equal, so that the coarser timestamps of the device don't cause a download on every run
+// if [opts.PreserveModTime] is true then the modification time of the device files is written to the downloaded files
+// if [opts.Mirror] is true then the local files and directories which don't exist on the device are deleted ([SyncDelete]);
+// nothing is deleted and a [ListDirectoryError] is returned if some of the device objects couldn't be read
+// [localDir] is created if it doesn't exist
+// on error the returned [SyncReport] lists the actions which were taken before the failure
+func SyncFromDevice(dev *mtp.Device, storageId uint32, remoteDir, localDir string, opts SyncOpts) (*SyncReport, error) {
+	report := &SyncReport{}
+
+	_remoteDir, err := NormalizePath(remoteDir)
+	if err != nil {
+		return report, err
+	}
+
+	if err := checkConflictPolicy(opts.ConflictPolicy); err != nil {
+		return report, err
+	}
+
+	// [remoteDir] must exist
+	rInfo, err := GetObjectFromPath(dev, storageId, _remoteDir)
+	if err != nil {
+		return report, err
+	}
+
+	if !rInfo.IsDir {
+		return report, InvalidPathError{error: fmt.Errorf("device path is not a directory: %s", _remoteDir)}
+	}
+
+	_localDir := fixSlash(localDir)
+
+	if lInfo, err := os.Stat(_localDir); err == nil && !lInfo.IsDir() {
+		return report, InvalidPathError{error: fmt.Errorf("local path is not a directory: %s", _localDir)}
+	}
+
+	if err := makeLocalDirectory(_localDir, 0); err != nil {
+		return report, err
+	}
+
+	remoteObjects, unreadable, err := listSyncRemoteObjects(dev, storageId, _remoteDir, opts.DisallowedFiles)
+	if err != nil {
+		return report, err
+	}
+
+	// the local files keyed by their [syncPathKey]
+	localFiles := map[string]syncLocalFile{}
+	_, _, _, err = walkLocalFiles([]string{_localDir}, opts.FollowSymlinks, opts.DisallowedFiles, func(fi *os.FileInfo, fullPath string, err error) error {
+		if err != nil {
+			return err
+		}
+
+		_rel, err := filepath.Rel(_localDir, fullPath)
+		if err != nil {
+			return LocalFileError{error: err}
+		}
+		// the map keys use the device separator
+		rel := toPathSep(_rel)
+
+		if rel != "." {
+			localFiles[syncPathKey(dev, rel)] = syncLocalFile{*fi, fullPath}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	var rels []string
+	for rel := range remoteObjects {
+		rels = append(rels, rel)
+	}
+	sort.Strings(rels)
+
+	// the local directories which conflict with a device file and the device directories which conflict with a local file;
+	// they are left untouched along with their contents
+	var conflictingDirs []string
+
+	var downloads []syncDownload
+	var totalSize int64
+
+	// the local paths of the directories keyed by their [syncPathKey]
+	localPaths := map[string]string{".": _localDir}
+
+	for _, rel := range rels {
+		if isSyncPathCovered(rel, conflictingDirs) {
+			continue
+		}
+
+		fi := remoteObjects[rel]
+		localPath := filepath.Join(localPaths[path.Dir(rel)], fi.Name)
+		local, exists := localFiles[rel]
+		lInfo := local.fi
+		if exists {
+			localPath = local.fullPath
+		}
+
+		if fi.IsDir {
+			localPaths[rel] = localPath
+
+			if !exists {
+				if err := makeLocalDirectory(localPath, 0); err != nil {
+					return report, err
+				}
+
+				report.addAction(SyncCreateDir, localPath, 0)
+			} else if !lInfo.IsDir() {
+				conflictingDirs = append(conflictingDirs, rel)
+				report.addAction(SyncSkip, localPath, 0)
+			}
+
+			continue
+		}
+
+		action := SyncDownload
+		if exists {
+			switch {
+			case lInfo.IsDir():
+				conflictingDirs = append(conflictingDirs, rel)
+				report.addAction(SyncSkip, localPath, fi.Size)
+
+				continue
+
+			case !isSyncFileModified(fi.Size, fi.ModTime, lInfo.Size(), lInfo.ModTime()):
+				report.Unchanged += 1
+
+				continue
+
+			case opts.KeepModified, !syncConflictTransfers(opts.ConflictPolicy, fi.Size, fi.ModTime, lInfo.Size(), lInfo.ModTime()):
+				report.addAction(SyncSkip, localPath, fi.Size)
+
+				continue
+			}
+
+			action = SyncUpdate
+
+			// keep the local file and download the device file next to it
+			if opts.ConflictPolicy == ConflictRenameWithSuffix {
+				for n := 1; ; n++ {
+					name := filepath.Join(filepath.Dir(localPath), filenameWithSuffix(filepath.Base(localPath), n))
+					if !fileExistsLocal(name) {
+						localPath = name
+
+						break
+					}
+				}
+			}
+		}
+
+		downloads = append(downloads, syncDownload{action, fi, localPath})
+		totalSize += fi.Size
+	}
+
+	if err := downloadSyncFiles(dev, downloads, totalSize, opts, report); err != nil {
+		return report, err
+	}
+
+	if !opts.Mirror {
+		return report, nil
+	}
+
+	if unreadable > 0 {
+		return report, ListDirectoryError{error: fmt.Errorf("unable to read %d objects inside %s; the local only files weren't deleted", unreadable, _remoteDir)}
+	}
+
+	// the local only files; the nested files of a deleted directory are removed along with it
+	rels = rels[:0]
+	for rel := range localFiles {
+		if _, ok := remoteObjects[rel]; !ok {
+			rels = append(rels, rel)
+		}
+	}
+	sort.Strings(rels)
+
+	var deletedDirs []string
+	for _, rel := range rels {
+		if isSyncPathCovered(rel, conflictingDirs) || isSyncPathCovered(rel, deletedDirs) {
+			continue
+		}
+
+		lInfo := localFiles[rel].fi
+		localPath := localFiles[rel].fullPath
+
+		if err := os.RemoveAll(localPath); err != nil {
+			return report, LocalFileError{error: err}
+		}
+
+		var size int64
+		if lInfo.IsDir() {
+			deletedDirs = append(deletedDirs, rel)
+		} else {
+			size = lInfo.Size()
+		}
+
+		report.addAction(SyncDelete, localPath, size)
+	}
+
+	return report, nil
+}
+
+// a device file which is downloaded by [SyncFromDevice]
+type syncDownload struct {
+	action      SyncActionType
+	fi          *FileInfo
+	destination string
+}
+
+// download the [downloads] of [SyncFromDevice] and record them in the [report]
+// [totalSize] is the combined size of the [downloads]
+func downloadSyncFiles(dev *mtp.Device, downloads []syncDownload, totalSize int64, opts SyncOpts, report *SyncReport) error {
+	if len(downloads) == 0 {
+		return nil
+	}
+
+	progressCb := pausableProgress(opts.ProgressCb)
+
+	pInfo := ProgressInfo{
+		FileInfo:       &FileInfo{},
+		StartTime:      time.Now(),
+		LatestSentTime: time.Now(),
+		TotalFiles:     int64(len(downloads)),
+		ActiveFileSize: &TransferSizeInfo{},
+		BulkFileSize:   &TransferSizeInfo{Total: totalSize},
+		Status:         InProgress,
+	}
+	throughput := newThroughputMeter(defaultThroughputWindow, pInfo.StartTime)
+
+	var bulkSizeSent int64
+	for i, d := range downloads {
+		pInfo.FileInfo = d.fi
+		pInfo.LatestSentTime = time.Now()
+
+		var prevSentSize int64
+		var modTime time.Time
+		if opts.PreserveModTime {
+			modTime = d.fi.ModTime
+		}
+
+		err := handleMakeLocalFile(dev, d.fi, d.destination, 0, modTime, nil, func(total, sent int64, _ uint32, err error) error {
+			if err != nil {
+				return err
+			}
+
+			pInfo.ActiveFileSize.Total = total
+			pInfo.ActiveFileSize.Sent = sent
+			pInfo.ActiveFileSize.Progress = Percent(float32(sent), float32(total))
+
+			chunkSize := sent - prevSentSize
+			bulkSizeSent += chunkSize
+
+			pInfo.BulkFileSize.Sent = bulkSizeSent
+			pInfo.BulkFileSize.Progress = Percent(float32(bulkSizeSent), float32(totalSize))
+
+			now := time.Now()
+			pInfo.Speed = transferRate(chunkSize, pInfo.LatestSentTime)
+			pInfo.BytesPerSecond = throughput.add(now, bulkSizeSent)
+			pInfo.Elapsed = now.Sub(pInfo.StartTime)
+			if err := progressCb(&pInfo, nil); err != nil {
+				return err
+			}
+
+			pInfo.LatestSentTime = time.Now()
+			prevSentSize = sent
+
+			return nil
+		})
+		if err != nil {
+			if isDeviceDisconnected(err) {
+				return deviceDisconnectedError(err)
+			}
+
+			switch err.(type) {
+			case *os.PathError:
+				return LocalFileError{error: err}
+			}
+
+			return err
+		}
+
+		pInfo.FilesSent = int64(i + 1)
+		pInfo.FilesSentProgress = Percent(float32(pInfo.FilesSent), float32(pInfo.TotalFiles))
+
+		report.addAction(d.action, d.destination, d.fi.Size)
+	}
+
+	pInfo.Status = Completed
+
+	return progressCb(&pInfo, nil)
+}
+
+// a local file which is compared by [SyncFromDevice]
+type syncLocalFile struct {
+	fi       os.FileInfo
+	fullPath string
+}
+
+// a local file which is uploaded by [SyncToDevice]
+type syncUpload struct {
+	action      SyncActionType
+	source      string
+	destination string
+	size        int64
+}
+
+func (r *SyncReport) addAction(action SyncActionType, fullPath string, size int64) {
+	switch action {
+	case SyncCreateDir:
+		r.CreatedDirectories += 1
+	case SyncUpload:
+		r.Uploaded += 1
+	case SyncDownload:
+		r.Downloaded += 1
+	case SyncUpdate:
+		r.Updated += 1
+	case SyncDelete:
+		r.Deleted += 1
+	case SyncSkip:
+		r.Skipped += 1
+	}
+
+	r.Actions = append(r.Actions, SyncAction{Type: action, FullPath: fullPath, Size: size})
+}
+
+// list the objects inside the device directory [remoteDir], recursively, keyed by the [syncPathKey] of their path relative to [remoteDir]
+// there are no objects if [remoteDir] doesn't exist
+// return:
+// [unreadable]: the number of objects which couldn't be read and are missing from [objects]
+func listSyncRemoteObjects(dev *mtp.Device, storageId uint32, remoteDir string, disallowedFiles []string) (objects map[string]*FileInfo, unreadable int, err error) {
+	objects = map[string]*FileInfo{}
+
+	fi, err := GetObjectFromPath(dev, storageId, remoteDir)
+	if err != nil {
+		switch err.(type) {
+		case InvalidPathError:
+			return objects, 0, nil
+
+		default:
+			return nil, 0, err
+		}
+	}
+
+	if !fi.IsDir {
+		return nil, 0, InvalidPathError{error: fmt.Errorf("device path is not a directory: %s", remoteDir)}
+	}
+
+	_, _, _, err = proccessWalk(context.Background(), dev, storageId, FileProp{fi.ObjectId, remoteDir}, walkProps{recursive: true, skipDisallowedFiles: true, skipHiddenObjects: true, disallowedFiles: disallowedFiles},
+		func(objectId uint32, fi *FileInfo, err error) error {
+			if err != nil {
+				if isDeviceDisconnected(err) {
+					return deviceDisconnectedError(err)
+				}
+
+				unreadable += 1
+
+				return nil
+			}
+
+			rel := strings.TrimPrefix(strings.TrimPrefix(fi.FullPath, remoteDir), PathSep)
+			objects[syncPathKey(dev, rel)] = fi
+
+			return nil
+		})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return objects, unreadable, nil
+}
+
+// the key of the relative path [rel] in the maps of [SyncToDevice] and [SyncFromDevice]
+// the paths are normalized and matched case insensitively, same as [GetObjectFromParentIdAndFilename]
+func syncPathKey(dev *mtp.Device, rel string) string {
+	return strings.ToLower(normalizeFilename(dev, rel))
+}
+
+// check if the source file of [srcSize] and [srcModTime] differs from the destination file of [dstSize] and [dstModTime]
+// the source is modified if the sizes differ or if it is newer than the destination by more than [syncModTimeTolerance],
+// since the devices and some local filesystems (eg: FAT) store the modification times at a coarser resolution
+func isSyncFileModified(srcSize int64, srcModTime time.Time, dstSize int64, dstModTime time.Time) bool {
+	if srcSize != dstSize {
+		return true
+	}
+
+	return srcModTime.Sub(dstModTime) > syncModTimeTolerance
+}
+
+// check if the modified source file is transferred over the destination file by the [conflictPolicy]
+// it matches the resolution of [resolveFileConflict], except for the default [ConflictSkip] which transfers the source file
+// if it was modified after the destination file by more than [syncModTimeTolerance]; see [SyncOpts.KeepModified]
+func syncConflictTransfers(conflictPolicy ConflictPolicy, srcSize int64, srcModTime time.Time, dstSize int64, dstModTime time.Time) bool {
+	switch conflictPolicy {
+	case ConflictSkip:
+		return srcModTime.Sub(dstModTime) > syncModTimeTolerance
+
+	case ConflictOverwrite, ConflictRenameWithSuffix:
+		return true
+
+	case ConflictOverwriteIfNewer:
+		return srcModTime.After(dstModTime)
+
+	case ConflictOverwriteIfDifferentSize:
+		return srcSize != dstSize
+	}
+
+	return false
+}
+
+// check if the relative path [rel] is nested inside one of the relative paths [dirs]
+func isSyncPathCovered(rel string, dirs []string) bool {
+	for _, d := range dirs {
+		if strings.HasPrefix(rel, d+PathSep) {
+			return true
+		}
+	}
+
+	return false
+}
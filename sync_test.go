@@ -0,0 +1,244 @@
+package mtpx
+
+import (
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSyncToDevice(t *testing.T) {
+	Convey("Testing the modified files | isSyncFileModified", t, func() {
+		modTime := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+
+		So(isSyncFileModified(1, modTime, 1, modTime), ShouldBeFalse)
+		So(isSyncFileModified(2, modTime, 1, modTime), ShouldBeTrue)
+
+		// the coarser timestamps of the destination
+		So(isSyncFileModified(1, modTime.Add(1500*time.Millisecond), 1, modTime), ShouldBeFalse)
+		So(isSyncFileModified(1, modTime.Add(2*time.Second), 1, modTime), ShouldBeFalse)
+		So(isSyncFileModified(1, modTime.Add(3*time.Second), 1, modTime), ShouldBeTrue)
+
+		// the destination is newer
+		So(isSyncFileModified(1, modTime, 1, modTime.Add(time.Hour)), ShouldBeFalse)
+	})
+
+	Convey("Testing the default conflict policy | syncConflictTransfers", t, func() {
+		modTime := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+
+		// the modified source file is transferred if it is newer than the destination
+		So(syncConflictTransfers(ConflictSkip, 2, modTime.Add(time.Hour), 1, modTime), ShouldBeTrue)
+		So(syncConflictTransfers(ConflictSkip, 2, modTime, 1, modTime.Add(time.Hour)), ShouldBeFalse)
+		So(syncConflictTransfers(ConflictSkip, 2, modTime.Add(time.Second), 1, modTime), ShouldBeFalse)
+	})
+
+	dev, err := Initialize(Init{})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	storages, err := FetchStorages(dev)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	sid := storages[0].Sid
+
+	Convey("Testing the keys of the relative paths | syncPathKey", t, func() {
+		So(syncPathKey(dev, "Sub/A.txt"), ShouldEqual, syncPathKey(dev, "sub/a.txt"))
+		So(syncPathKey(dev, "sub/a.txt"), ShouldNotEqual, syncPathKey(dev, "sub/b.txt"))
+	})
+
+	writeFile := func(path, content string) {
+		if err := ioutil.WriteFile(path, []byte(content), os.ModePerm); err != nil {
+			log.Panic(err)
+		}
+	}
+
+	Convey("Testing SyncToDevice", t, func() {
+		// source directories: 'mocks-build/test_SyncToDevice/src/{a.txt,sub/b.txt,empty}'
+		// destination directories: '/mtp-test-files/temp_dir/test_SyncToDevice/{random}'
+		source := filepath.Join(newTempMocksDir("test_SyncToDevice", true), "src")
+		if err := os.MkdirAll(filepath.Join(source, "sub"), os.ModePerm); err != nil {
+			log.Panic(err)
+		}
+		if err := os.MkdirAll(filepath.Join(source, "empty"), os.ModePerm); err != nil {
+			log.Panic(err)
+		}
+		writeFile(filepath.Join(source, "a.txt"), "a")
+		writeFile(filepath.Join(source, "sub", "b.txt"), "bb")
+
+		destination := fmt.Sprintf("/mtp-test-files/temp_dir/test_SyncToDevice/%x", rand.Int31())
+
+		sync := func(opts SyncOpts) *SyncReport {
+			report, err := SyncToDevice(dev, sid, source, destination, opts)
+			So(err, ShouldBeNil)
+
+			return report
+		}
+		remoteSize := func(rel string) int64 {
+			fi, err := GetObjectFromPath(dev, sid, getFullPath(destination, rel))
+			So(err, ShouldBeNil)
+
+			return fi.Size
+		}
+
+		// the destination doesn't exist yet
+		report := sync(SyncOpts{ConflictPolicy: ConflictOverwrite, Mirror: true})
+		So(report.CreatedDirectories, ShouldEqual, 2)
+		So(report.Uploaded, ShouldEqual, 2)
+		So(report.Deleted, ShouldEqual, 0)
+		So(len(report.Actions), ShouldEqual, 4)
+		So(remoteSize("sub/b.txt"), ShouldEqual, 2)
+
+		// nothing has changed
+		report = sync(SyncOpts{ConflictPolicy: ConflictOverwrite, Mirror: true})
+		So(report.Unchanged, ShouldEqual, 2)
+		So(report.Actions, ShouldBeEmpty)
+
+		// a file is modified, a file is added and the other local file and directory are removed
+		writeFile(filepath.Join(source, "a.txt"), "aaa")
+		writeFile(filepath.Join(source, "c.txt"), "c")
+		if err := os.Remove(filepath.Join(source, "sub", "b.txt")); err != nil {
+			log.Panic(err)
+		}
+		if err := os.Remove(filepath.Join(source, "empty")); err != nil {
+			log.Panic(err)
+		}
+
+		// the device only objects are kept without [SyncOpts.Mirror]
+		report = sync(SyncOpts{ConflictPolicy: ConflictOverwrite})
+		So(report.Updated, ShouldEqual, 1)
+		So(report.Uploaded, ShouldEqual, 1)
+		So(report.Deleted, ShouldEqual, 0)
+		So(remoteSize("a.txt"), ShouldEqual, 3)
+		So(remoteSize("sub/b.txt"), ShouldEqual, 2)
+
+		report = sync(SyncOpts{ConflictPolicy: ConflictOverwrite, Mirror: true})
+		So(report.Deleted, ShouldEqual, 2)
+		So(report.Unchanged, ShouldEqual, 2)
+
+		_, err := GetObjectFromPath(dev, sid, getFullPath(destination, "sub/b.txt"))
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+
+		_, err = GetObjectFromPath(dev, sid, getFullPath(destination, "empty"))
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+
+		// the modified file is left untouched by [SyncOpts.KeepModified]
+		writeFile(filepath.Join(source, "a.txt"), "aaaa")
+		newer := time.Now().Add(time.Hour)
+		if err := os.Chtimes(filepath.Join(source, "a.txt"), newer, newer); err != nil {
+			log.Panic(err)
+		}
+
+		report = sync(SyncOpts{KeepModified: true})
+		So(report.Skipped, ShouldEqual, 1)
+		So(report.Actions, ShouldResemble, []SyncAction{{Type: SyncSkip, FullPath: getFullPath(destination, "a.txt"), Size: 4}})
+		So(remoteSize("a.txt"), ShouldEqual, 3)
+
+		// the newer file is transferred by the default [ConflictSkip]
+		report = sync(SyncOpts{})
+		So(report.Updated, ShouldEqual, 1)
+		So(remoteSize("a.txt"), ShouldEqual, 4)
+
+		// the local path must be a directory
+		_, err = SyncToDevice(dev, sid, filepath.Join(source, "a.txt"), destination, SyncOpts{})
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+	})
+
+	Convey("Testing a nested destination which doesn't exist | SyncToDevice", t, func() {
+		// source directories: 'mocks-build/test_SyncToDevice_nested/src/{a.txt,sub/b.txt}'
+		// destination directories: '/mtp-test-files/temp_dir/test_SyncToDevice/{random}/nested/dir'
+		source := filepath.Join(newTempMocksDir("test_SyncToDevice_nested", true), "src")
+		if err := os.MkdirAll(filepath.Join(source, "sub"), os.ModePerm); err != nil {
+			log.Panic(err)
+		}
+		writeFile(filepath.Join(source, "a.txt"), "a")
+		writeFile(filepath.Join(source, "sub", "b.txt"), "bb")
+
+		destination := fmt.Sprintf("/mtp-test-files/temp_dir/test_SyncToDevice/%x/nested/dir", rand.Int31())
+
+		report, err := SyncToDevice(dev, sid, source, destination, SyncOpts{Mirror: true})
+		So(err, ShouldBeNil)
+		So(report.CreatedDirectories, ShouldEqual, 1)
+		So(report.Uploaded, ShouldEqual, 2)
+
+		fi, err := GetObjectFromPath(dev, sid, getFullPath(destination, "sub/b.txt"))
+		So(err, ShouldBeNil)
+		So(fi.Size, ShouldEqual, 2)
+	})
+
+	Convey("Testing SyncFromDevice", t, func() {
+		// source directories: '/mtp-test-files/temp_dir/test_SyncFromDevice/{random}' which is synchronized from 'mocks-build/test_SyncFromDevice/src/{a.txt,sub/b.txt}'
+		// destination directories: 'mocks-build/test_SyncFromDevice/dest'
+		mocksDir := newTempMocksDir("test_SyncFromDevice", true)
+		source := filepath.Join(mocksDir, "src")
+		destination := filepath.Join(mocksDir, "dest")
+		if err := os.MkdirAll(filepath.Join(source, "sub"), os.ModePerm); err != nil {
+			log.Panic(err)
+		}
+		writeFile(filepath.Join(source, "a.txt"), "a")
+		writeFile(filepath.Join(source, "sub", "b.txt"), "bb")
+
+		remoteDir := fmt.Sprintf("/mtp-test-files/temp_dir/test_SyncFromDevice/%x", rand.Int31())
+		_, err := SyncToDevice(dev, sid, source, remoteDir, SyncOpts{ConflictPolicy: ConflictOverwrite})
+		So(err, ShouldBeNil)
+
+		sync := func(opts SyncOpts) *SyncReport {
+			report, err := SyncFromDevice(dev, sid, remoteDir, destination, opts)
+			So(err, ShouldBeNil)
+
+			return report
+		}
+
+		// the destination doesn't exist yet
+		report := sync(SyncOpts{ConflictPolicy: ConflictOverwrite, PreserveModTime: true})
+		So(report.CreatedDirectories, ShouldEqual, 1)
+		So(report.Downloaded, ShouldEqual, 2)
+
+		fi, err := GetObjectFromPath(dev, sid, getFullPath(remoteDir, "a.txt"))
+		So(err, ShouldBeNil)
+
+		lInfo, err := os.Stat(filepath.Join(destination, "a.txt"))
+		So(err, ShouldBeNil)
+		So(lInfo.Size(), ShouldEqual, 1)
+		So(lInfo.ModTime().Equal(fi.ModTime), ShouldBeTrue)
+
+		// nothing has changed
+		report = sync(SyncOpts{ConflictPolicy: ConflictOverwrite, Mirror: true})
+		So(report.Unchanged, ShouldEqual, 2)
+		So(report.Actions, ShouldBeEmpty)
+
+		// a device file is modified and a local only file is added
+		writeFile(filepath.Join(source, "a.txt"), "aaa")
+		_, err = SyncToDevice(dev, sid, source, remoteDir, SyncOpts{ConflictPolicy: ConflictOverwrite})
+		So(err, ShouldBeNil)
+
+		writeFile(filepath.Join(destination, "sub", "c.txt"), "c")
+
+		// the modified file is left untouched by [SyncOpts.KeepModified]
+		report = sync(SyncOpts{KeepModified: true})
+		So(report.Skipped, ShouldEqual, 1)
+		So(report.Deleted, ShouldEqual, 0)
+
+		report = sync(SyncOpts{ConflictPolicy: ConflictOverwrite, Mirror: true})
+		So(report.Updated, ShouldEqual, 1)
+		So(report.Deleted, ShouldEqual, 1)
+
+		lInfo, err = os.Stat(filepath.Join(destination, "a.txt"))
+		So(err, ShouldBeNil)
+		So(lInfo.Size(), ShouldEqual, 3)
+		So(fileExistsLocal(filepath.Join(destination, "sub", "c.txt")), ShouldBeFalse)
+
+		// the device path must exist
+		_, err = SyncFromDevice(dev, sid, getFullPath(remoteDir, "missing"), destination, SyncOpts{})
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+	})
+
+	Dispose(dev)
+}
@@ -0,0 +1,210 @@
+package mtpx
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+	"io"
+	"sync"
+	"time"
+)
+
+// set the idle limit of a single device transaction of [dev]
+// a transaction which makes no progress for [timeout] fails with a [TransactionTimeoutError]; 0 disables the limit
+// every chunk sent or received by a transfer (SendObject, GetObject) resets the limit, so large files don't time out
+// the limit is kept until [Dispose] is called
+// the streams of [OpenObject] and [CreateObjectWriter] aren't limited since they are paced by the caller
+//
+// note: a timed out transaction can't be aborted; its goroutine keeps running until libusb returns (see [devTimeout]),
+// and the transactions of [dev] fail with a [TransactionTimeoutError] until then.
+// the session of the device is no longer in a known state after a timeout, so [Dispose] the device and [Initialize] it again
+func SetPerCallTimeout(dev *mtp.Device, timeout time.Duration) {
+	devicePerCallTimeouts.Store(dev, timeout)
+}
+
+// the per call timeout of [dev]
+func getPerCallTimeout(dev *mtp.Device) time.Duration {
+	if t, ok := devicePerCallTimeouts.Load(dev); ok {
+		return t.(time.Duration)
+	}
+
+	return 0
+}
+
+// returned by the readers, writers and progress callbacks of a [callGuard] once its transaction timed out
+var errCallAbandoned = errors.New("the transaction was abandoned after a timeout")
+
+// stops a timed out transaction which is still running in the background from using the buffers, files
+// and callbacks of the caller once [withCallTimeout] has returned
+// a nil [callGuard] doesn't guard anything
+type callGuard struct {
+	mu         sync.Mutex
+	abandoned  bool
+	lastActive time.Time
+
+	// the number of the running progress callbacks; the transaction isn't idle while the caller handles the progress,
+	// eg: while the transfer is paused by a [PauseSignal] (see [pausableProgress])
+	callbacks int
+}
+
+// run [fn] unless the transaction was abandoned
+// every completed [fn] counts as progress of the transaction (see [callGuard.abandonIfIdle])
+func (g *callGuard) do(fn func() error) error {
+	if g == nil {
+		return fn()
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.abandoned {
+		return errCallAbandoned
+	}
+
+	err := fn()
+	g.lastActive = time.Now()
+
+	return err
+}
+
+// abandon the transaction started at [start] if it made no progress for [timeout]
+// otherwise the time left until it would be idle for [timeout] is returned
+// a nil [callGuard] is always abandoned
+func (g *callGuard) abandonIfIdle(start time.Time, timeout time.Duration) time.Duration {
+	if g == nil {
+		return 0
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	// the deadline is suspended until the callbacks return
+	if g.callbacks > 0 {
+		return timeout
+	}
+
+	last := g.lastActive
+	if last.Before(start) {
+		last = start
+	}
+
+	if idle := time.Since(last); idle < timeout {
+		return timeout - idle
+	}
+
+	g.abandoned = true
+
+	return 0
+}
+
+func (g *callGuard) reader(r io.Reader) io.Reader {
+	return &guardedReader{g: g, r: r}
+}
+
+func (g *callGuard) writer(w io.Writer) io.Writer {
+	return &guardedWriter{g: g, w: w}
+}
+
+// the callback [cb] runs without holding the guard, so the transaction can't be abandoned while [cb] is running
+// and the time spent in [cb] doesn't count as idle time (see [callGuard.abandonIfIdle])
+func (g *callGuard) progress(cb mtp.ProgressFunc) mtp.ProgressFunc {
+	return func(sent int64) error {
+		if g == nil {
+			return cb(sent)
+		}
+
+		g.mu.Lock()
+		if g.abandoned {
+			g.mu.Unlock()
+
+			return errCallAbandoned
+		}
+		g.callbacks += 1
+		g.mu.Unlock()
+
+		err := cb(sent)
+
+		g.mu.Lock()
+		g.callbacks -= 1
+		g.lastActive = time.Now()
+		g.mu.Unlock()
+
+		return err
+	}
+}
+
+type guardedReader struct {
+	g *callGuard
+	r io.Reader
+}
+
+func (gr *guardedReader) Read(p []byte) (n int, err error) {
+	err = gr.g.do(func() error {
+		n, err = gr.r.Read(p)
+
+		return err
+	})
+
+	return n, err
+}
+
+type guardedWriter struct {
+	g *callGuard
+	w io.Writer
+}
+
+func (gw *guardedWriter) Write(p []byte) (n int, err error) {
+	err = gw.g.do(func() error {
+		n, err = gw.w.Write(p)
+
+		return err
+	})
+
+	return n, err
+}
+
+// run the device transaction [fn] within the per call timeout of [dev] (see [SetPerCallTimeout])
+// the readers, writers and callbacks passed to the transaction must be wrapped by [g], which may be nil if [fn] only decodes
+// into the values of the caller; those values must not be used if a [TransactionTimeoutError] is returned
+// the timeout restarts whenever the transaction reads, writes or reports progress through [g]
+func withCallTimeout(dev *mtp.Device, g *callGuard, fn func() error) error {
+	timeout := getPerCallTimeout(dev)
+	if timeout <= 0 {
+		return fn()
+	}
+
+	if _, ok := deviceStalledTransactions.Load(dev); ok {
+		return TransactionTimeoutError{error: fmt.Errorf("a timed out transaction of the device is still running")}
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+
+	start := time.Now()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case err := <-done:
+			return err
+
+		case <-timer.C:
+			if left := g.abandonIfIdle(start, timeout); left > 0 {
+				timer.Reset(left)
+
+				continue
+			}
+
+			deviceStalledTransactions.Store(dev, true)
+			go func() {
+				<-done
+				deviceStalledTransactions.Delete(dev)
+			}()
+
+			return TransactionTimeoutError{error: fmt.Errorf("the transaction made no progress for %v", timeout)}
+		}
+	}
+}
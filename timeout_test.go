@@ -0,0 +1,112 @@
+package mtpx
+
+import (
+	"bytes"
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestWithCallTimeout(t *testing.T) {
+	dev := &mtp.Device{}
+
+	Convey("Testing the disabled timeout | withCallTimeout", t, func() {
+		err := withCallTimeout(dev, nil, func() error {
+			time.Sleep(10 * time.Millisecond)
+
+			return mtp.RCError(mtp.RC_DeviceBusy)
+		})
+		So(err, ShouldEqual, mtp.RCError(mtp.RC_DeviceBusy))
+	})
+
+	Convey("Testing the timed out transactions | withCallTimeout", t, func() {
+		SetPerCallTimeout(dev, 20*time.Millisecond)
+		defer devicePerCallTimeouts.Delete(dev)
+
+		err := withCallTimeout(dev, nil, func() error {
+			return nil
+		})
+		So(err, ShouldBeNil)
+
+		release := make(chan struct{})
+		var buf bytes.Buffer
+		g := &callGuard{}
+		w := g.writer(&buf)
+
+		err = withCallTimeout(dev, g, func() error {
+			<-release
+
+			_, err := w.Write([]byte("late"))
+
+			return err
+		})
+		So(err, ShouldHaveSameTypeAs, TransactionTimeoutError{})
+		So(isTransientError(err), ShouldBeFalse)
+
+		// the device is still busy with the timed out transaction
+		err = withCallTimeout(dev, nil, func() error {
+			return nil
+		})
+		So(err, ShouldHaveSameTypeAs, TransactionTimeoutError{})
+
+		close(release)
+		for i := 0; i < 100; i++ {
+			if _, ok := deviceStalledTransactions.Load(dev); !ok {
+				break
+			}
+
+			time.Sleep(5 * time.Millisecond)
+		}
+
+		// the writes of the timed out transaction are dropped
+		So(buf.Len(), ShouldEqual, 0)
+
+		err = withCallTimeout(dev, nil, func() error {
+			return nil
+		})
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Testing the transactions which keep making progress | withCallTimeout", t, func() {
+		SetPerCallTimeout(dev, 30*time.Millisecond)
+		defer devicePerCallTimeouts.Delete(dev)
+
+		var buf bytes.Buffer
+		g := &callGuard{}
+		w := g.writer(&buf)
+
+		// the transaction takes longer than the timeout but it is never idle for that long
+		err := withCallTimeout(dev, g, func() error {
+			for i := 0; i < 6; i++ {
+				time.Sleep(10 * time.Millisecond)
+
+				if _, err := w.Write([]byte("chunk")); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+		So(err, ShouldBeNil)
+		So(buf.Len(), ShouldEqual, 30)
+	})
+
+	Convey("Testing the paused transactions | withCallTimeout", t, func() {
+		SetPerCallTimeout(dev, 20*time.Millisecond)
+		defer devicePerCallTimeouts.Delete(dev)
+
+		g := &callGuard{}
+		progress := g.progress(func(sent int64) error {
+			// the progress callback blocks for longer than the timeout, eg: a paused transfer
+			time.Sleep(60 * time.Millisecond)
+
+			return nil
+		})
+
+		err := withCallTimeout(dev, g, func() error {
+			return progress(0)
+		})
+		So(err, ShouldBeNil)
+	})
+}
@@ -0,0 +1,307 @@
+package mtpx
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+	"path"
+	"strings"
+	"time"
+)
+
+// the directory of a storage holding the objects moved by [TrashFile]
+const TrashDirPath = "/.Trash"
+
+// name of the file inside [TrashDirPath] which records the original paths of the trashed objects
+const trashManifestFilename = ".mtpx-trash.json"
+
+// name under which a new manifest is written before it replaces [trashManifestFilename]
+const trashManifestTmpFilename = trashManifestFilename + atomicUploadSuffix
+
+// Move the file/directory [objectId] into the trash directory [TrashDirPath] of the storage [storageId] instead of deleting it
+// the trash directory is created if needed and the original path of the object is recorded in its manifest, so that it can be
+// put back using [RestoreFromTrash]; the object is renamed with a suffix if the trash already holds an object with the same name
+// the object keeps its objectId
+// an [UnsupportedOperationError] is returned if the device doesn't support MoveObject; use [DeleteFile] instead
+func TrashFile(dev *mtp.Device, storageId, objectId uint32) error {
+	if err := checkTrashSupported(dev); err != nil {
+		return err
+	}
+
+	if err := checkStorageWritable(dev, storageId, false); err != nil {
+		return err
+	}
+
+	fi, err := GetObjectFromObjectIdOrPath(dev, storageId, FileProp{ObjectId: objectId})
+	if err != nil {
+		return err
+	}
+
+	if fi.ObjectId == ParentObjectId {
+		return InvalidPathError{error: fmt.Errorf("invalid objectId: %d. the root directory cannot be trashed", objectId)}
+	}
+
+	originalPath, err := ResolveObjectPath(dev, storageId, fi.ObjectId)
+	if err != nil {
+		return err
+	}
+
+	if isTrashPath(originalPath) {
+		return InvalidPathError{error: fmt.Errorf("invalid path: %s. the object is already in the trash", originalPath)}
+	}
+
+	trashId, err := makeDirectory(dev, storageId, TrashDirPath)
+	if err != nil {
+		return err
+	}
+
+	trashFi, err := GetObjectFromObjectId(dev, trashId, path.Dir(TrashDirPath))
+	if err != nil {
+		return err
+	}
+
+	entries, manifestId, err := readTrashManifest(dev, storageId, trashId)
+	if err != nil {
+		return err
+	}
+
+	moved, _, err := moveFileInto(dev, storageId, fi, trashFi, fi.Name, ConflictRenameWithSuffix)
+	if err != nil {
+		return err
+	}
+
+	entries = append(entries, TrashEntry{
+		ObjectId:     moved.NewObjectId,
+		Name:         path.Base(moved.FullPath),
+		OriginalPath: originalPath,
+		TrashedAt:    time.Now(),
+	})
+
+	if err := writeTrashManifest(dev, storageId, trashId, manifestId, entries); err != nil {
+		return fmt.Errorf("the object was moved to %s but the trash manifest could not be updated: %w", moved.FullPath, err)
+	}
+
+	return nil
+}
+
+// Move the object [objectId] trashed by [TrashFile] back to its original path
+// the missing parent directories are created; the object is renamed with a suffix if its original path was taken meanwhile
+// a [FileNotFoundError] is returned if the object isn't listed in the trash
+// return:
+// [fullPath]: the path of the restored object
+func RestoreFromTrash(dev *mtp.Device, storageId, objectId uint32) (fullPath string, err error) {
+	if err := checkTrashSupported(dev); err != nil {
+		return "", err
+	}
+
+	if err := checkStorageWritable(dev, storageId, false); err != nil {
+		return "", err
+	}
+
+	trashFi, err := GetObjectFromPath(dev, storageId, TrashDirPath)
+	if err != nil {
+		if _, ok := err.(InvalidPathError); ok {
+			return "", FileNotFoundError{error: fmt.Errorf("the object %d is not in the trash", objectId)}
+		}
+
+		return "", err
+	}
+
+	entries, manifestId, err := readTrashManifest(dev, storageId, trashFi.ObjectId)
+	if err != nil {
+		return "", err
+	}
+
+	index := -1
+	for i, e := range entries {
+		if e.ObjectId == objectId {
+			index = i
+
+			break
+		}
+	}
+
+	if index < 0 {
+		return "", FileNotFoundError{error: fmt.Errorf("the object %d is not in the trash", objectId)}
+	}
+
+	entry := entries[index]
+
+	fi, err := GetObjectFromObjectIdOrPath(dev, storageId, FileProp{ObjectId: objectId})
+	if err != nil {
+		return "", err
+	}
+
+	parentPath := path.Dir(entry.OriginalPath)
+
+	parentId, err := makeDirectory(dev, storageId, parentPath)
+	if err != nil {
+		return "", err
+	}
+
+	parentFi, err := GetObjectFromObjectId(dev, parentId, path.Dir(parentPath))
+	if err != nil {
+		return "", err
+	}
+
+	moved, _, err := moveFileInto(dev, storageId, fi, parentFi, path.Base(entry.OriginalPath), ConflictRenameWithSuffix)
+	if err != nil {
+		return "", err
+	}
+
+	entries = append(entries[:index], entries[index+1:]...)
+
+	if err := writeTrashManifest(dev, storageId, trashFi.ObjectId, manifestId, entries); err != nil {
+		return moved.FullPath, fmt.Errorf("the object was restored to %s but the trash manifest could not be updated: %w", moved.FullPath, err)
+	}
+
+	return moved.FullPath, nil
+}
+
+// List the objects trashed by [TrashFile] in the storage [storageId]
+// an empty list is returned if the storage has no trash directory
+func ListTrash(dev *mtp.Device, storageId uint32) ([]TrashEntry, error) {
+	trashFi, err := GetObjectFromPath(dev, storageId, TrashDirPath)
+	if err != nil {
+		if _, ok := err.(InvalidPathError); ok {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	entries, _, err := readTrashManifest(dev, storageId, trashFi.ObjectId)
+
+	return entries, err
+}
+
+// the trash relies on MoveObject, as copying the objects through the host would neither be cheap nor keep their objectIds
+func checkTrashSupported(dev *mtp.Device) error {
+	supported, err := isOperationSupported(dev, mtp.OC_MoveObject)
+	if err != nil {
+		return err
+	}
+
+	if !supported {
+		return UnsupportedOperationError{error: fmt.Errorf("the device has no usable trash. MoveObject is not supported by the device")}
+	}
+
+	return nil
+}
+
+// check if [fullPath] is the trash directory or one of its children
+func isTrashPath(fullPath string) bool {
+	p := strings.ToLower(fullPath)
+	trash := strings.ToLower(TrashDirPath)
+
+	return p == trash || strings.HasPrefix(p, trash+PathSep)
+}
+
+// read the manifest of the trash directory [trashId]
+// the new manifest of an interrupted [writeTrashManifest] is read if the manifest itself is missing
+// a missing manifest is treated as an empty one; [manifestId] is 0 in that case
+func readTrashManifest(dev *mtp.Device, storageId, trashId uint32) (entries []TrashEntry, manifestId uint32, err error) {
+	fi, err := GetObjectFromParentIdAndFilename(dev, storageId, trashId, trashManifestFilename)
+	if _, ok := err.(FileNotFoundError); ok {
+		fi, err = GetObjectFromParentIdAndFilename(dev, storageId, trashId, trashManifestTmpFilename)
+	}
+	if err != nil {
+		if _, ok := err.(FileNotFoundError); ok {
+			return nil, 0, nil
+		}
+
+		return nil, 0, err
+	}
+
+	var buf bytes.Buffer
+	g := &callGuard{}
+	if err := withCallTimeout(dev, g, func() error {
+		return dev.GetObject(fi.ObjectId, g.writer(&buf), mtp.EmptyProgressFunc)
+	}); err != nil {
+		if _, ok := err.(TransactionTimeoutError); ok {
+			return nil, 0, err
+		}
+
+		return nil, 0, fileObjectError(err)
+	}
+
+	if err := json.Unmarshal(buf.Bytes(), &entries); err != nil {
+		return nil, 0, InvalidManifestError{error: fmt.Errorf("invalid trash manifest: %v", err)}
+	}
+
+	return entries, fi.ObjectId, nil
+}
+
+// replace the manifest [manifestId] of the trash directory [trashId] with [entries]
+// the new manifest is written as [trashManifestTmpFilename] and renamed once the old one was deleted, so that a failure
+// never leaves the trash without a complete manifest; the manifest is removed once the trash is empty
+func writeTrashManifest(dev *mtp.Device, storageId, trashId, manifestId uint32, entries []TrashEntry) error {
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// the manifest which was read is the new manifest of an interrupted write, so the final name is free
+	recovered := false
+
+	// a leftover of an interrupted write which isn't the manifest which was read is deleted
+	tmpFi, err := GetObjectFromParentIdAndFilename(dev, storageId, trashId, trashManifestTmpFilename)
+	if err == nil {
+		recovered = tmpFi.ObjectId == manifestId
+
+		if !recovered {
+			if err := deleteFile(dev, storageId, []FileProp{{tmpFi.ObjectId, ""}}); err != nil {
+				return err
+			}
+		}
+	} else if _, ok := err.(FileNotFoundError); !ok {
+		return err
+	}
+
+	if len(entries) < 1 {
+		if manifestId != 0 {
+			return deleteFile(dev, storageId, []FileProp{{manifestId, ""}})
+		}
+
+		return nil
+	}
+
+	name := trashManifestTmpFilename
+	if recovered {
+		name = trashManifestFilename
+	}
+
+	w, objectId, err := createObjectWriter(dev, storageId, trashId, name, objectFormat(trashManifestFilename), int64(len(data)))
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(data); err != nil {
+		_ = w.Abort()
+
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	if manifestId != 0 {
+		if err := deleteFile(dev, storageId, []FileProp{{manifestId, ""}}); err != nil {
+			return err
+		}
+	}
+
+	if recovered {
+		return nil
+	}
+
+	defer invalidateCaches(dev, storageId, trashId)
+
+	if err := setObjectFilename(dev, objectId, trashManifestFilename); err != nil {
+		return fileObjectError(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package mtpx
+
+import (
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"log"
+	"math/rand"
+	"testing"
+)
+
+func TestTrashFile(t *testing.T) {
+	dev, err := Initialize(Init{})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	storages, err := FetchStorages(dev)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	sid := storages[0].Sid
+
+	Convey("Trash and restore a directory | TrashFile | RestoreFromTrash", t, func() {
+		// test the directory '/mtp-test-files/temp_dir/test-TrashFile/{random}'
+		dirName := fmt.Sprintf("/mtp-test-files/temp_dir/test-TrashFile/%x", rand.Int31())
+		fullPath := getFullPath(dirName, "trashed")
+
+		objectId, err := MakeDirectory(dev, sid, getFullPath(fullPath, "child"))
+		So(err, ShouldBeNil)
+
+		fi, err := GetObjectFromPath(dev, sid, fullPath)
+		So(err, ShouldBeNil)
+
+		err = TrashFile(dev, sid, fi.ObjectId)
+		So(err, ShouldBeNil)
+
+		_, err = GetObjectFromPath(dev, sid, fullPath)
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+
+		entries, err := ListTrash(dev, sid)
+		So(err, ShouldBeNil)
+
+		var entry *TrashEntry
+		for i, e := range entries {
+			if e.ObjectId == fi.ObjectId {
+				entry = &entries[i]
+			}
+		}
+		So(entry, ShouldNotBeNil)
+		So(entry.OriginalPath, ShouldEqual, fullPath)
+
+		trashedFi, err := GetObjectFromPath(dev, sid, getFullPath(TrashDirPath, entry.Name))
+		So(err, ShouldBeNil)
+		So(trashedFi.ObjectId, ShouldEqual, fi.ObjectId)
+
+		// the trashed object can't be trashed again
+		err = TrashFile(dev, sid, fi.ObjectId)
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+
+		restoredPath, err := RestoreFromTrash(dev, sid, fi.ObjectId)
+		So(err, ShouldBeNil)
+		So(restoredPath, ShouldEqual, fullPath)
+
+		childFi, err := GetObjectFromPath(dev, sid, getFullPath(fullPath, "child"))
+		So(err, ShouldBeNil)
+		So(childFi.ObjectId, ShouldEqual, objectId)
+
+		_, err = RestoreFromTrash(dev, sid, fi.ObjectId)
+		So(err, ShouldHaveSameTypeAs, FileNotFoundError{})
+	})
+
+	Convey("Testing the trash paths | isTrashPath", t, func() {
+		So(isTrashPath("/.Trash"), ShouldBeTrue)
+		So(isTrashPath("/.trash/a.txt"), ShouldBeTrue)
+		So(isTrashPath("/.Trash-1000"), ShouldBeFalse)
+		So(isTrashPath("/DCIM/.Trash"), ShouldBeFalse)
+	})
+
+	Dispose(dev)
+}
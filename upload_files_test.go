@@ -1,13 +1,18 @@
 package mtpx
 
 import (
+	"context"
 	"fmt"
+	"github.com/ganeshrvel/go-mtpfs/mtp"
 	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
 	"log"
 	"math/rand"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestUploadFiles(t *testing.T) {
@@ -215,7 +220,7 @@ func TestUploadFiles(t *testing.T) {
 			"/mock_dir1/3/b.txt",
 			"/mock_dir1/a.txt"}
 
-		objectId, totalListFiles, totalDirectories, err := Walk(dev, sid, destination, true, true, false, func(objectId uint32, fi *FileInfo, err error) error {
+		objectId, totalListFiles, totalDirectories, err := Walk(context.Background(), dev, sid, destination, true, true, false, func(objectId uint32, fi *FileInfo, err error) error {
 			So(err, ShouldBeNil)
 
 			contains, index := StringContains(dirList1, strings.TrimPrefix(fi.FullPath, destination))
@@ -348,7 +353,7 @@ func TestUploadFiles(t *testing.T) {
 			"/mock_dir2/a.txt",
 		}
 
-		objectId, totalListFiles, totalDirectories, err := Walk(dev, sid, destination, true, true, false, func(objectId uint32, fi *FileInfo, err error) error {
+		objectId, totalListFiles, totalDirectories, err := Walk(context.Background(), dev, sid, destination, true, true, false, func(objectId uint32, fi *FileInfo, err error) error {
 			So(err, ShouldBeNil)
 
 			contains, index := StringContains(dirList1, strings.TrimPrefix(fi.FullPath, destination))
@@ -474,7 +479,7 @@ func TestUploadFiles(t *testing.T) {
 			"/mock_dir1/a.txt",
 		}
 
-		objectId, totalListFiles, totalDirectories, err := Walk(dev, sid, destination, true, true, false, func(objectId uint32, fi *FileInfo, err error) error {
+		objectId, totalListFiles, totalDirectories, err := Walk(context.Background(), dev, sid, destination, true, true, false, func(objectId uint32, fi *FileInfo, err error) error {
 			So(err, ShouldBeNil)
 
 			contains, index := StringContains(dirList1, strings.TrimPrefix(fi.FullPath, destination))
@@ -1070,7 +1075,7 @@ func TestUploadFiles(t *testing.T) {
 			"/4mb_txt_file",
 		}
 
-		objectId, totalListFiles, totalDirectories, err := Walk(dev, sid, destination, true, true, false, func(objectId uint32, fi *FileInfo, err error) error {
+		objectId, totalListFiles, totalDirectories, err := Walk(context.Background(), dev, sid, destination, true, true, false, func(objectId uint32, fi *FileInfo, err error) error {
 			So(err, ShouldBeNil)
 
 			contains, index := StringContains(dirList1, strings.TrimPrefix(fi.FullPath, destination))
@@ -1201,7 +1206,7 @@ func TestUploadFiles(t *testing.T) {
 			"/4mb_txt_file_2",
 		}
 
-		objectId, totalListFiles, totalDirectories, err := Walk(dev, sid, destination, true, true, false, func(objectId uint32, fi *FileInfo, err error) error {
+		objectId, totalListFiles, totalDirectories, err := Walk(context.Background(), dev, sid, destination, true, true, false, func(objectId uint32, fi *FileInfo, err error) error {
 			So(err, ShouldBeNil)
 
 			contains, index := StringContains(dirList1, strings.TrimPrefix(fi.FullPath, destination))
@@ -1356,7 +1361,7 @@ func TestUploadFiles(t *testing.T) {
 			"/mock_dir1/a.txt",
 		}
 
-		objectId, totalListFiles, totalDirectories, err := Walk(dev, sid, destination, true, true, false, func(objectId uint32, fi *FileInfo, err error) error {
+		objectId, totalListFiles, totalDirectories, err := Walk(context.Background(), dev, sid, destination, true, true, false, func(objectId uint32, fi *FileInfo, err error) error {
 			So(err, ShouldBeNil)
 
 			contains, index := StringContains(dirList1, strings.TrimPrefix(fi.FullPath, destination))
@@ -1496,7 +1501,7 @@ func TestUploadFiles(t *testing.T) {
 			"/mock_dir1/3/b.txt",
 			"/mock_dir1/a.txt"}
 
-		objectId, totalListFiles, totalDirectories, err := Walk(dev, sid, destination, true, true, false, func(objectId uint32, fi *FileInfo, err error) error {
+		objectId, totalListFiles, totalDirectories, err := Walk(context.Background(), dev, sid, destination, true, true, false, func(objectId uint32, fi *FileInfo, err error) error {
 			So(err, ShouldBeNil)
 
 			contains, index := StringContains(dirList1, strings.TrimPrefix(fi.FullPath, destination))
@@ -1656,7 +1661,7 @@ func TestUploadFiles(t *testing.T) {
 			"/mock_dir1/a.txt",
 		}
 
-		objectId, totalListFiles, totalDirectories, err := Walk(dev, sid, destination, true, true, false, func(objectId uint32, fi *FileInfo, err error) error {
+		objectId, totalListFiles, totalDirectories, err := Walk(context.Background(), dev, sid, destination, true, true, false, func(objectId uint32, fi *FileInfo, err error) error {
 			So(err, ShouldBeNil)
 
 			contains, index := StringContains(dirList1, strings.TrimPrefix(fi.FullPath, destination))
@@ -1919,3 +1924,1015 @@ func TestUploadFiles(t *testing.T) {
 	})
 	Dispose(dev)
 }
+
+func TestUploadFilesWithOpts(t *testing.T) {
+	dev, err := Initialize(Init{})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	storages, err := FetchStorages(dev)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	sid := storages[0].Sid
+
+	Convey("Invalid source along with a valid source | StopOnError=false | UploadFilesWithOpts | It should return a BatchError", t, func() {
+		// destination directories: '/mtp-test-files/temp_dir/test_UploadFilesWithOpts/{random}'
+		// source files: 'fake.txt', 'mock_dir1/a.txt'
+		fakeSource := newTestMocksAsset("fake.txt")
+		sources := []string{fakeSource, getTestMocksAsset("mock_dir1/a.txt")}
+		destination := fmt.Sprintf("/mtp-test-files/temp_dir/test_UploadFilesWithOpts/%x", rand.Int31())
+
+		var completed bool
+		objectIdDest, totalFiles, totalSize, err := UploadFilesWithOpts(dev, sid,
+			sources,
+			destination,
+			UploadOpts{
+				ProgressCb: func(fi *ProgressInfo, err error) error {
+					if fi.Status == Completed {
+						completed = true
+					}
+
+					return nil
+				},
+			},
+		)
+
+		So(err, ShouldHaveSameTypeAs, BatchError{})
+		So(completed, ShouldBeTrue)
+		So(objectIdDest, ShouldBeGreaterThan, 0)
+		So(totalFiles, ShouldEqual, 1)
+		So(totalSize, ShouldBeGreaterThan, 0)
+
+		failures := err.(BatchError).Failures
+		So(len(failures), ShouldEqual, 1)
+		So(failures[0].FullPath, ShouldEqual, fixSlash(fakeSource))
+		So(failures[0].Err, ShouldHaveSameTypeAs, InvalidPathError{})
+
+		_, err = GetObjectFromPath(dev, sid, getFullPath(destination, "a.txt"))
+		So(err, ShouldBeNil)
+	})
+
+	Convey("'.' and '..' in the destination | UploadFilesWithOpts | It should throw an error", t, func() {
+		sources := []string{getTestMocksAsset("mock_dir1/a.txt")}
+
+		for _, destination := range []string{"/mtp-test-files/temp_dir/./test_UploadFilesWithOpts", "/mtp-test-files/temp_dir/../test_UploadFilesWithOpts"} {
+			objectIdDest, totalFiles, _, err := UploadFilesWithOpts(dev, sid,
+				sources,
+				destination,
+				UploadOpts{
+					ProgressCb: func(fi *ProgressInfo, err error) error {
+						return nil
+					},
+				},
+			)
+
+			So(err, ShouldHaveSameTypeAs, RelativePathNotSupportedError{})
+			So(objectIdDest, ShouldEqual, 0)
+			So(totalFiles, ShouldEqual, 0)
+		}
+	})
+
+	Convey("Invalid source along with a valid source | StopOnError=true | UploadFilesWithOpts | It should throw an error", t, func() {
+		// destination directories: '/mtp-test-files/temp_dir/test_UploadFilesWithOpts/{random}'
+		// source files: 'fake.txt', 'mock_dir1/a.txt'
+		sources := []string{newTestMocksAsset("fake.txt"), getTestMocksAsset("mock_dir1/a.txt")}
+		destination := fmt.Sprintf("/mtp-test-files/temp_dir/test_UploadFilesWithOpts/%x", rand.Int31())
+
+		_, totalFiles, totalSize, err := UploadFilesWithOpts(dev, sid,
+			sources,
+			destination,
+			UploadOpts{
+				ProgressCb: func(fi *ProgressInfo, err error) error {
+					return nil
+				},
+				StopOnError: true,
+			},
+		)
+
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+		So(totalFiles, ShouldEqual, 0)
+		So(totalSize, ShouldEqual, 0)
+	})
+
+	Convey("Verify the uploaded files | VerifyUpload=true | UploadFilesWithOpts", t, func() {
+		// destination directories: '/mtp-test-files/temp_dir/test_UploadFilesWithOpts/{random}'
+		// source directories: 'mock_dir1'
+		sources := []string{getTestMocksAsset("mock_dir1")}
+		destination := fmt.Sprintf("/mtp-test-files/temp_dir/test_UploadFilesWithOpts/%x", rand.Int31())
+
+		for _, algo := range []HashAlgo{HashMd5, HashSha1, HashSha256, ""} {
+			_, totalFiles, _, err := UploadFilesWithOpts(dev, sid,
+				sources,
+				destination,
+				UploadOpts{
+					ProgressCb: func(fi *ProgressInfo, err error) error {
+						return nil
+					},
+					StopOnError:  true,
+					VerifyUpload: true,
+					HashAlgo:     algo,
+				},
+			)
+
+			So(err, ShouldBeNil)
+			So(totalFiles, ShouldEqual, 5)
+		}
+	})
+
+	Convey("Verify the uploaded files | pre-computed local hash mismatch | UploadFilesWithOpts | It should throw an error", t, func() {
+		// destination directories: '/mtp-test-files/temp_dir/test_UploadFilesWithOpts/{random}'
+		// source files: 'mock_dir1/a.txt'
+		source := getTestMocksAsset("mock_dir1/a.txt")
+		destination := fmt.Sprintf("/mtp-test-files/temp_dir/test_UploadFilesWithOpts/%x", rand.Int31())
+
+		_, _, _, err := UploadFilesWithOpts(dev, sid,
+			[]string{source},
+			destination,
+			UploadOpts{
+				ProgressCb: func(fi *ProgressInfo, err error) error {
+					return nil
+				},
+				StopOnError:  true,
+				VerifyUpload: true,
+				HashAlgo:     HashMd5,
+				LocalHashes: map[string]string{
+					fixSlash(source): "00000000000000000000000000000000",
+				},
+			},
+		)
+
+		So(err, ShouldHaveSameTypeAs, ChecksumMismatchError{})
+
+		e := err.(ChecksumMismatchError)
+		So(e.ObjectId, ShouldBeGreaterThan, 0)
+		So(e.LocalHash, ShouldEqual, "00000000000000000000000000000000")
+		So(e.DeviceHash, ShouldNotEqual, e.LocalHash)
+
+		fi, err := GetObjectFromPath(dev, sid, getFullPath(destination, "a.txt"))
+		So(err, ShouldBeNil)
+		So(fi.ObjectId, ShouldEqual, e.ObjectId)
+	})
+
+	Convey("Verify the uploaded files | invalid HashAlgo | UploadFilesWithOpts | It should throw an error", t, func() {
+		_, _, _, err := UploadFilesWithOpts(dev, sid,
+			[]string{getTestMocksAsset("mock_dir1/a.txt")},
+			"/mtp-test-files/temp_dir/test_UploadFilesWithOpts",
+			UploadOpts{
+				ProgressCb: func(fi *ProgressInfo, err error) error {
+					return nil
+				},
+				VerifyUpload: true,
+				HashAlgo:     "crc32",
+			},
+		)
+
+		So(err, ShouldHaveSameTypeAs, UnsupportedOperationError{})
+	})
+
+	Convey("Batch progress | UploadFilesWithOpts", t, func() {
+		// destination directories: '/mtp-test-files/temp_dir/test_UploadFilesWithOpts/{random}'
+		// source directories: 'mock_dir1'
+		sources := []string{getTestMocksAsset("mock_dir1")}
+		destination := fmt.Sprintf("/mtp-test-files/temp_dir/test_UploadFilesWithOpts/%x", rand.Int31())
+
+		var pTotalBytes, pSentBytes, pTotalFiles, pCompletedFiles int64
+		_, totalFiles, totalSize, err := UploadFilesWithOpts(dev, sid,
+			sources,
+			destination,
+			UploadOpts{
+				ProgressCb: func(fi *ProgressInfo, err error) error {
+					return nil
+				},
+				BatchProgressCb: func(totalBytes, sentBytes, totalFiles, completedFiles int64, currentPath string) error {
+					So(totalBytes, ShouldBeGreaterThan, 0)
+					So(totalFiles, ShouldEqual, 5)
+					So(sentBytes, ShouldBeGreaterThanOrEqualTo, pSentBytes)
+					So(completedFiles, ShouldBeGreaterThanOrEqualTo, pCompletedFiles)
+					So(currentPath, ShouldStartWith, destination)
+
+					pTotalBytes = totalBytes
+					pSentBytes = sentBytes
+					pTotalFiles = totalFiles
+					pCompletedFiles = completedFiles
+
+					return nil
+				},
+				StopOnError: true,
+			},
+		)
+
+		So(err, ShouldBeNil)
+		So(totalFiles, ShouldEqual, 5)
+		So(pTotalFiles, ShouldEqual, totalFiles)
+		So(pCompletedFiles, ShouldEqual, totalFiles)
+		So(pTotalBytes, ShouldEqual, totalSize)
+		So(pSentBytes, ShouldEqual, totalSize)
+	})
+
+	Convey("Batch progress | cancel | UploadFilesWithOpts | It should throw an error", t, func() {
+		// destination directories: '/mtp-test-files/temp_dir/test_UploadFilesWithOpts/{random}'
+		// source directories: 'mock_dir1'
+		sources := []string{getTestMocksAsset("mock_dir1")}
+		destination := fmt.Sprintf("/mtp-test-files/temp_dir/test_UploadFilesWithOpts/%x", rand.Int31())
+
+		calls := 0
+		_, totalFiles, _, err := UploadFilesWithOpts(dev, sid,
+			sources,
+			destination,
+			UploadOpts{
+				ProgressCb: func(fi *ProgressInfo, err error) error {
+					return nil
+				},
+				BatchProgressCb: func(totalBytes, sentBytes, totalFiles, completedFiles int64, currentPath string) error {
+					calls += 1
+
+					return fmt.Errorf("canceled")
+				},
+			},
+		)
+
+		So(err, ShouldHaveSameTypeAs, FileTransferError{})
+		So(calls, ShouldEqual, 1)
+		So(totalFiles, ShouldEqual, 1)
+	})
+
+	Convey("Pause and resume a transfer | UploadFilesWithOpts", t, func() {
+		// destination directories: '/mtp-test-files/temp_dir/test_UploadFilesWithOpts/{random}'
+		// source directories: 'mock_dir1'
+		sources := []string{getTestMocksAsset("mock_dir1")}
+		destination := fmt.Sprintf("/mtp-test-files/temp_dir/test_UploadFilesWithOpts/%x", rand.Int31())
+
+		paused := false
+		start := time.Now()
+		_, totalFiles, _, err := UploadFilesWithOpts(dev, sid,
+			sources,
+			destination,
+			UploadOpts{
+				ProgressCb: func(fi *ProgressInfo, err error) error {
+					if paused {
+						return nil
+					}
+					paused = true
+
+					resume := make(chan error)
+					go func() {
+						time.Sleep(100 * time.Millisecond)
+						close(resume)
+					}()
+
+					return PauseSignal{Resume: resume}
+				},
+			},
+		)
+
+		So(err, ShouldBeNil)
+		So(totalFiles, ShouldEqual, 5)
+		So(time.Since(start), ShouldBeGreaterThanOrEqualTo, 100*time.Millisecond)
+	})
+
+	Convey("Cancel a paused transfer | UploadFilesWithOpts | It should throw an error", t, func() {
+		// destination directories: '/mtp-test-files/temp_dir/test_UploadFilesWithOpts/{random}'
+		// source directories: 'mock_dir1'
+		sources := []string{getTestMocksAsset("mock_dir1")}
+		destination := fmt.Sprintf("/mtp-test-files/temp_dir/test_UploadFilesWithOpts/%x", rand.Int31())
+
+		_, _, _, err := UploadFilesWithOpts(dev, sid,
+			sources,
+			destination,
+			UploadOpts{
+				ProgressCb: func(fi *ProgressInfo, err error) error {
+					resume := make(chan error, 1)
+					resume <- fmt.Errorf("canceled")
+
+					return PauseSignal{Resume: resume}
+				},
+			},
+		)
+
+		So(err, ShouldHaveSameTypeAs, PausedTransferCanceledError{})
+	})
+
+	Convey("Cancel a transfer | KeepPartialObjects | UploadFilesWithOpts | It should throw an error", t, func() {
+		// destination directories: '/mtp-test-files/temp_dir/test_UploadFilesWithOpts/{random}'
+		// source files: 'mock_dir1/a.txt'
+		sources := []string{getTestMocksAsset("mock_dir1/a.txt")}
+
+		upload := func(keepPartialObjects bool) string {
+			destination := fmt.Sprintf("/mtp-test-files/temp_dir/test_UploadFilesWithOpts/%x", rand.Int31())
+
+			// the transfer fails after SendObjectInfo has created the object
+			_, _, _, err := UploadFilesWithOpts(dev, sid,
+				sources,
+				destination,
+				UploadOpts{
+					ProgressCb: func(fi *ProgressInfo, err error) error {
+						if fi.Status == InProgress && fi.FileInfo.ObjectId != 0 {
+							return fmt.Errorf("canceled")
+						}
+
+						return nil
+					},
+					StopOnError:        true,
+					KeepPartialObjects: keepPartialObjects,
+				},
+			)
+			So(err, ShouldHaveSameTypeAs, FileTransferError{})
+
+			return getFullPath(destination, "a.txt")
+		}
+
+		// the partial object is deleted
+		_, err := GetObjectFromPath(dev, sid, upload(false))
+		So(err, ShouldHaveSameTypeAs, FileNotFoundError{})
+
+		_, err = GetObjectFromPath(dev, sid, upload(true))
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Upload an existing file | OverwriteExisting | UploadFilesWithOpts", t, func() {
+		// destination directories: '/mtp-test-files/temp_dir/test_UploadFilesWithOpts/{random}'
+		// source files: 'mock_dir1/a.txt'
+		sources := []string{getTestMocksAsset("mock_dir1/a.txt")}
+		destination := fmt.Sprintf("/mtp-test-files/temp_dir/test_UploadFilesWithOpts/%x", rand.Int31())
+
+		upload := func(overwriteExisting bool) uint32 {
+			_, _, _, err := UploadFilesWithOpts(dev, sid,
+				sources,
+				destination,
+				UploadOpts{
+					ProgressCb: func(fi *ProgressInfo, err error) error {
+						return nil
+					},
+					StopOnError:       true,
+					OverwriteExisting: overwriteExisting,
+				},
+			)
+			So(err, ShouldBeNil)
+
+			fi, err := GetObjectFromPath(dev, sid, getFullPath(destination, "a.txt"))
+			So(err, ShouldBeNil)
+
+			return fi.ObjectId
+		}
+
+		objectId1 := upload(false)
+
+		// the existing file is left untouched
+		objectId2 := upload(false)
+		So(objectId2, ShouldEqual, objectId1)
+
+		// the existing file is replaced
+		objectId3 := upload(true)
+		So(objectId3, ShouldNotEqual, objectId1)
+	})
+
+	Convey("Upload an existing file | ReuseHandleOnOverwrite | UploadFilesWithOpts", t, func() {
+		// destination directories: '/mtp-test-files/temp_dir/test_UploadFilesWithOpts/{random}'
+		// source files: 'mock_dir1/a.txt'
+		sources := []string{getTestMocksAsset("mock_dir1/a.txt")}
+		destination := fmt.Sprintf("/mtp-test-files/temp_dir/test_UploadFilesWithOpts/%x", rand.Int31())
+
+		upload := func() *FileInfo {
+			_, _, _, err := UploadFilesWithOpts(dev, sid,
+				sources,
+				destination,
+				UploadOpts{
+					ProgressCb: func(fi *ProgressInfo, err error) error {
+						return nil
+					},
+					StopOnError:            true,
+					ConflictPolicy:         ConflictOverwrite,
+					ReuseHandleOnOverwrite: true,
+				},
+			)
+			So(err, ShouldBeNil)
+
+			fi, err := GetObjectFromPath(dev, sid, getFullPath(destination, "a.txt"))
+			So(err, ShouldBeNil)
+
+			return fi
+		}
+
+		fi1 := upload()
+		fi2 := upload()
+		So(fi2.Size, ShouldEqual, fi1.Size)
+
+		c, err := GetDeviceCapabilities(dev)
+		So(err, ShouldBeNil)
+
+		if c.SupportsEditObject() {
+			// the existing file is rewritten in place
+			So(fi2.ObjectId, ShouldEqual, fi1.ObjectId)
+		} else {
+			// the existing file is replaced
+			So(fi2.ObjectId, ShouldNotEqual, fi1.ObjectId)
+		}
+	})
+
+	Convey("Upload an existing file | Atomic | UploadFilesWithOpts", t, func() {
+		// destination directories: '/mtp-test-files/temp_dir/test_UploadFilesWithOpts/{random}'
+		// source files: 'mock_dir1/a.txt'
+		sources := []string{getTestMocksAsset("mock_dir1/a.txt")}
+		destination := fmt.Sprintf("/mtp-test-files/temp_dir/test_UploadFilesWithOpts/%x", rand.Int31())
+
+		upload := func() *FileInfo {
+			var names []string
+			_, _, _, err := UploadFilesWithOpts(dev, sid,
+				sources,
+				destination,
+				UploadOpts{
+					ProgressCb: func(fi *ProgressInfo, err error) error {
+						names = append(names, fi.FileInfo.Name)
+
+						return nil
+					},
+					StopOnError:    true,
+					ConflictPolicy: ConflictOverwrite,
+					Atomic:         true,
+				},
+			)
+			So(err, ShouldBeNil)
+
+			// the progress reports the final name
+			So(names, ShouldNotContain, ".a.txt.mtpx-tmp")
+
+			fi, err := GetObjectFromPath(dev, sid, getFullPath(destination, "a.txt"))
+			So(err, ShouldBeNil)
+
+			// the temporary object was renamed
+			_, err = GetObjectFromPath(dev, sid, getFullPath(destination, ".a.txt.mtpx-tmp"))
+			So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+
+			// the replaced file, which was renamed aside, was deleted
+			_, err = GetObjectFromPath(dev, sid, getFullPath(destination, ".a.txt.mtpx-old"))
+			So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+
+			return fi
+		}
+
+		fi1 := upload()
+
+		// the existing file is replaced once the new file was sent
+		fi2 := upload()
+		So(fi2.ObjectId, ShouldNotEqual, fi1.ObjectId)
+		So(fi2.Size, ShouldEqual, fi1.Size)
+
+		_, err := GetObjectFromObjectId(dev, fi1.ObjectId, "")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Upload an existing file | ConflictPolicy | UploadFilesWithOpts", t, func() {
+		// destination directories: '/mtp-test-files/temp_dir/test_UploadFilesWithOpts/{random}'
+		// source files: 'mock_dir1/a.txt'
+		sources := []string{getTestMocksAsset("mock_dir1/a.txt")}
+		destination := fmt.Sprintf("/mtp-test-files/temp_dir/test_UploadFilesWithOpts/%x", rand.Int31())
+
+		upload := func(conflictPolicy ConflictPolicy) {
+			_, _, _, err := UploadFilesWithOpts(dev, sid,
+				sources,
+				destination,
+				UploadOpts{
+					ProgressCb: func(fi *ProgressInfo, err error) error {
+						return nil
+					},
+					StopOnError:    true,
+					ConflictPolicy: conflictPolicy,
+				},
+			)
+			So(err, ShouldBeNil)
+		}
+		objectId := func(filename string) uint32 {
+			fi, err := GetObjectFromPath(dev, sid, getFullPath(destination, filename))
+			So(err, ShouldBeNil)
+
+			return fi.ObjectId
+		}
+
+		upload(ConflictSkip)
+		objectId1 := objectId("a.txt")
+
+		// the sizes are equal, so the existing file is left untouched
+		upload(ConflictOverwriteIfDifferentSize)
+		So(objectId("a.txt"), ShouldEqual, objectId1)
+
+		// the existing file was uploaded after the local file was modified
+		upload(ConflictOverwriteIfNewer)
+		So(objectId("a.txt"), ShouldEqual, objectId1)
+
+		// the new files are renamed
+		upload(ConflictRenameWithSuffix)
+		upload(ConflictRenameWithSuffix)
+		So(objectId("a.txt"), ShouldEqual, objectId1)
+		So(objectId("a (1).txt"), ShouldNotEqual, objectId1)
+		So(objectId("a (2).txt"), ShouldNotEqual, objectId1)
+
+		_, _, _, err := UploadFilesWithOpts(dev, sid, sources, destination, UploadOpts{
+			ProgressCb: func(fi *ProgressInfo, err error) error {
+				return nil
+			},
+			ConflictPolicy: ConflictPolicy(-1),
+		})
+		So(err, ShouldHaveSameTypeAs, UnsupportedOperationError{})
+	})
+
+	Convey("Preserve the modification time | PreserveModTime=true | UploadFilesWithOpts", t, func() {
+		// destination directories: '/mtp-test-files/temp_dir/test_UploadFilesWithOpts/{random}'
+		// source files: 'mock_dir1/a.txt'
+		source := getTestMocksAsset("mock_dir1/a.txt")
+		destination := fmt.Sprintf("/mtp-test-files/temp_dir/test_UploadFilesWithOpts/%x", rand.Int31())
+
+		_, _, _, err := UploadFilesWithOpts(dev, sid,
+			[]string{source},
+			destination,
+			UploadOpts{
+				ProgressCb: func(fi *ProgressInfo, err error) error {
+					return nil
+				},
+				StopOnError:     true,
+				PreserveModTime: true,
+			},
+		)
+		So(err, ShouldBeNil)
+
+		writable, err := isObjectPropWritable(dev, objectFormat("a.txt"), mtp.OPC_DateModified)
+		So(err, ShouldBeNil)
+
+		if writable {
+			localFi, err := os.Stat(source)
+			So(err, ShouldBeNil)
+
+			fi, err := GetObjectFromPath(dev, sid, getFullPath(destination, "a.txt"))
+			So(err, ShouldBeNil)
+
+			// the device stores the local time with a resolution of a second
+			So(fi.ModTime, ShouldHappenWithin, time.Second, localFi.ModTime())
+		}
+	})
+
+	Convey("Upload a file with an invalid filename | FilenamePolicy | UploadFilesWithOpts", t, func() {
+		defer SetFilenamePolicy(dev, FilenamePolicy{})
+
+		// destination directories: '/mtp-test-files/temp_dir/test_UploadFilesWithOpts/{random}'
+		// source files: 'mock_dir1/a.txt'
+		source := getTestMocksAsset("mock_dir1/a.txt")
+		destination := fmt.Sprintf("/mtp-test-files/temp_dir/test_UploadFilesWithOpts/%x", rand.Int31())
+
+		var reportedPath string
+		upload := func() error {
+			_, _, _, err := UploadFilesWithOpts(dev, sid,
+				[]string{source},
+				destination,
+				UploadOpts{
+					ProgressCb: func(fi *ProgressInfo, err error) error {
+						reportedPath = fi.FileInfo.FullPath
+
+						return nil
+					},
+					StopOnError: true,
+				},
+			)
+
+			return err
+		}
+
+		SetFilenamePolicy(dev, FilenamePolicy{InvalidChars: "."})
+
+		err := upload()
+		So(err, ShouldHaveSameTypeAs, InvalidFilenameError{})
+		So(err.(InvalidFilenameError).Filename, ShouldEqual, "a.txt")
+
+		SetFilenamePolicy(dev, FilenamePolicy{InvalidChars: ".", Sanitize: true})
+
+		err = upload()
+		So(err, ShouldBeNil)
+
+		_, err = GetObjectFromPath(dev, sid, getFullPath(destination, "a_txt"))
+		So(err, ShouldBeNil)
+
+		// the sanitized name is reported
+		So(reportedPath, ShouldEqual, getFullPath(destination, "a_txt"))
+	})
+
+	Convey("Plan an upload | DryRun=true | UploadFilesWithOpts", t, func() {
+		// destination directories: '/mtp-test-files/temp_dir/test_UploadFilesWithOpts/{random}'
+		// source files: 'mock_dir1'
+		sources := []string{getTestMocksAsset("mock_dir1")}
+		destination := fmt.Sprintf("/mtp-test-files/temp_dir/test_UploadFilesWithOpts/%x", rand.Int31())
+
+		upload := func(dryRun bool) (actions map[DryRunAction]int, totalFiles, totalSize int64) {
+			actions = map[DryRunAction]int{}
+
+			_, totalFiles, totalSize, err := UploadFilesWithOpts(dev, sid,
+				sources,
+				destination,
+				UploadOpts{
+					ProgressCb: func(fi *ProgressInfo, err error) error {
+						return nil
+					},
+					DryRunCb: func(action DryRunAction, fullPath string, size int64) error {
+						So(fullPath, ShouldStartWith, destination)
+						actions[action] += 1
+
+						return nil
+					},
+					StopOnError:       true,
+					OverwriteExisting: true,
+					DryRun:            dryRun,
+				},
+			)
+			So(err, ShouldBeNil)
+
+			return actions, totalFiles, totalSize
+		}
+
+		actions, plannedFiles, plannedSize := upload(true)
+		So(actions[DryRunCreateDir], ShouldBeGreaterThan, 0)
+		So(actions[DryRunUpload], ShouldEqual, plannedFiles)
+		So(actions[DryRunOverwrite], ShouldEqual, 0)
+
+		// nothing is created on the device
+		_, err := GetObjectFromPath(dev, sid, destination)
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+
+		_, totalFiles, totalSize := upload(false)
+		So(totalFiles, ShouldEqual, plannedFiles)
+		So(totalSize, ShouldEqual, plannedSize)
+
+		// the uploaded files are overwritten
+		actions, plannedFiles, plannedSize = upload(true)
+		So(actions[DryRunCreateDir], ShouldEqual, 0)
+		So(actions[DryRunUpload], ShouldEqual, 0)
+		So(actions[DryRunOverwrite], ShouldEqual, totalFiles)
+		So(plannedFiles, ShouldEqual, totalFiles)
+		So(plannedSize, ShouldEqual, totalSize)
+	})
+
+	Convey("Upload a .mp3 file | ObjectFormat | UploadFilesWithOpts | The object format should match the extension", t, func() {
+		// destination directories: '/mtp-test-files/temp_dir/test_UploadFilesWithOpts/{random}'
+		source := newTempMocksDir("test_UploadFilesWithOpts_object_format", true)
+		So(ioutil.WriteFile(filepath.Join(source, "a.mp3"), []byte("ID3"), os.ModePerm), ShouldBeNil)
+
+		destination := fmt.Sprintf("/mtp-test-files/temp_dir/test_UploadFilesWithOpts/%x", rand.Int31())
+
+		upload := func(format uint16) *FileInfo {
+			_, _, _, err := UploadFilesWithOpts(dev, sid, []string{filepath.Join(source, "a.mp3")}, destination, UploadOpts{
+				ConflictPolicy: ConflictOverwrite,
+				ObjectFormat:   format,
+				ProgressCb: func(fi *ProgressInfo, err error) error {
+					return err
+				},
+			})
+			So(err, ShouldBeNil)
+
+			fi, err := GetObjectFromPath(dev, sid, getFullPath(destination, "a.mp3"))
+			So(err, ShouldBeNil)
+
+			return fi
+		}
+
+		So(upload(0).Info.ObjectFormat, ShouldEqual, mtp.OFC_MP3)
+
+		// the format is overridden
+		So(upload(mtp.OFC_Undefined).Info.ObjectFormat, ShouldEqual, mtp.OFC_Undefined)
+	})
+
+	Convey("Upload a directory with an empty sub directory | UploadFilesWithOpts | The empty directory should be created", t, func() {
+		// destination directories: '/mtp-test-files/temp_dir/test_UploadFilesWithOpts/{random}'
+		source := newTempMocksDir("test_UploadFilesWithOpts_empty_dirs", true)
+		So(os.MkdirAll(filepath.Join(source, "empty", "nested_empty"), os.ModePerm), ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join(source, "a.txt"), []byte("a"), os.ModePerm), ShouldBeNil)
+
+		destination := fmt.Sprintf("/mtp-test-files/temp_dir/test_UploadFilesWithOpts/%x", rand.Int31())
+
+		_, totalFiles, _, err := UploadFilesWithOpts(dev, sid, []string{source}, destination, UploadOpts{
+			ProgressCb: func(fi *ProgressInfo, err error) error {
+				return err
+			},
+		})
+		So(err, ShouldBeNil)
+		So(totalFiles, ShouldEqual, 1)
+
+		uploaded := getFullPath(destination, filepath.Base(source))
+
+		fi, err := GetObjectFromPath(dev, sid, getFullPath(uploaded, "empty/nested_empty"))
+		So(err, ShouldBeNil)
+		So(fi.IsDir, ShouldBeTrue)
+
+		children, err := ReadDir(dev, sid, fi.ObjectId, fi.FullPath)
+		So(err, ShouldBeNil)
+		So(children, ShouldBeEmpty)
+	})
+
+	Convey("Upload a file without a progress callback | UploadFilesWithOpts", t, func() {
+		// destination directories: '/mtp-test-files/temp_dir/test_UploadFilesWithOpts/{random}'
+		// source files: 'mock_dir1/a.txt'
+		source := getTestMocksAsset("mock_dir1/a.txt")
+		destination := fmt.Sprintf("/mtp-test-files/temp_dir/test_UploadFilesWithOpts/%x", rand.Int31())
+
+		_, totalFiles, _, err := UploadFilesWithOpts(dev, sid, []string{source}, destination, UploadOpts{})
+		So(err, ShouldBeNil)
+		So(totalFiles, ShouldEqual, 1)
+	})
+
+	Dispose(dev)
+}
+
+func TestPreScanLocal(t *testing.T) {
+	Convey("Scan a directory | PreScanLocal", t, func() {
+		// source directories: 'mock_dir1'
+		result, err := PreScanLocal([]string{getTestMocksAsset("mock_dir1")})
+
+		So(err, ShouldBeNil)
+		So(result.TotalFiles, ShouldEqual, 5)
+		So(result.TotalDirectories, ShouldEqual, 5)
+		So(result.TotalSize, ShouldEqual, 35)
+		So(len(result.LargestFiles), ShouldEqual, 5)
+
+		var totalSize int64
+		for i, f := range result.LargestFiles {
+			if i > 0 {
+				So(f.Size, ShouldBeLessThanOrEqualTo, result.LargestFiles[i-1].Size)
+			}
+
+			So(f.FullPath, ShouldStartWith, getTestMocksAsset("mock_dir1"))
+			So(f.FullPath, ShouldNotContainSubstring, "DS_Store")
+
+			totalSize += f.Size
+		}
+
+		So(totalSize, ShouldEqual, result.TotalSize)
+	})
+
+	Convey("Keep only the largest files | insertLargestFile", t, func() {
+		var files []ScannedFile
+		for i, size := range []int64{3, 10, 1, 7, 7, 12} {
+			files = insertLargestFile(files, ScannedFile{FullPath: fmt.Sprintf("%d", i), Size: size}, 3)
+		}
+
+		So(files, ShouldResemble, []ScannedFile{{"5", 12}, {"1", 10}, {"3", 7}})
+	})
+
+	Convey("Scan an invalid source | PreScanLocal | It should throw an error", t, func() {
+		result, err := PreScanLocal([]string{newTestMocksAsset("fake.txt")})
+
+		So(err, ShouldHaveSameTypeAs, LocalFileError{})
+		So(result, ShouldBeNil)
+	})
+}
+
+func TestCreateObjectWriter(t *testing.T) {
+	dev, err := Initialize(Init{})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	storages, err := FetchStorages(dev)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	sid := storages[0].Sid
+
+	content := []byte(strings.Repeat("streamed content\n", 1024))
+
+	Convey("Stream a new file | CreateObjectWriter", t, func() {
+		// test the directory '/mtp-test-files/temp_dir/test-CreateObjectWriter/{random}'
+		destination := fmt.Sprintf("/mtp-test-files/temp_dir/test-CreateObjectWriter/%x", rand.Int31())
+		parentId, err := MakeDirectory(dev, sid, destination)
+		So(err, ShouldBeNil)
+
+		w, objectId, err := CreateObjectWriter(dev, sid, parentId, "streamed.txt", int64(len(content)))
+		So(err, ShouldBeNil)
+		So(objectId, ShouldBeGreaterThan, 0)
+
+		half := len(content) / 2
+		_, err = w.Write(content[:half])
+		So(err, ShouldBeNil)
+		_, err = w.Write(content[half:])
+		So(err, ShouldBeNil)
+
+		err = w.Close()
+		So(err, ShouldBeNil)
+
+		fi, err := GetObjectFromPath(dev, sid, getFullPath(destination, "streamed.txt"))
+		So(err, ShouldBeNil)
+		So(fi.ObjectId, ShouldEqual, objectId)
+		So(fi.Size, ShouldEqual, len(content))
+
+		r, err := OpenObject(dev, objectId)
+		So(err, ShouldBeNil)
+		b, err := ioutil.ReadAll(r)
+		So(err, ShouldBeNil)
+		_ = r.Close()
+		So(string(b), ShouldEqual, string(content))
+
+		// the file already exists
+		_, _, err = CreateObjectWriter(dev, sid, parentId, "streamed.txt", int64(len(content)))
+		So(err, ShouldHaveSameTypeAs, FileAlreadyExistsError{})
+	})
+
+	Convey("Write more or fewer bytes than declared | CreateObjectWriter | It should throw an error", t, func() {
+		// test the directory '/mtp-test-files/temp_dir/test-CreateObjectWriter/{random}'
+		destination := fmt.Sprintf("/mtp-test-files/temp_dir/test-CreateObjectWriter/%x", rand.Int31())
+		parentId, err := MakeDirectory(dev, sid, destination)
+		So(err, ShouldBeNil)
+
+		w, _, err := CreateObjectWriter(dev, sid, parentId, "short.txt", int64(len(content)))
+		So(err, ShouldBeNil)
+
+		_, err = w.Write(content[:10])
+		So(err, ShouldBeNil)
+
+		err = w.Close()
+		So(err, ShouldHaveSameTypeAs, SendObjectError{})
+
+		// the incomplete object is removed
+		_, err = GetObjectFromPath(dev, sid, getFullPath(destination, "short.txt"))
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+
+		w, _, err = CreateObjectWriter(dev, sid, parentId, "long.txt", 10)
+		So(err, ShouldBeNil)
+
+		_, err = w.Write(content[:11])
+		So(err, ShouldHaveSameTypeAs, SendObjectError{})
+
+		_, err = w.Write(content[:10])
+		So(err, ShouldBeNil)
+
+		err = w.Close()
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Abort a half written file | CreateObjectWriter", t, func() {
+		// test the directory '/mtp-test-files/temp_dir/test-CreateObjectWriter/{random}'
+		destination := fmt.Sprintf("/mtp-test-files/temp_dir/test-CreateObjectWriter/%x", rand.Int31())
+		parentId, err := MakeDirectory(dev, sid, destination)
+		So(err, ShouldBeNil)
+
+		w, _, err := CreateObjectWriter(dev, sid, parentId, "aborted.txt", int64(len(content)))
+		So(err, ShouldBeNil)
+
+		_, err = w.Write(content[:10])
+		So(err, ShouldBeNil)
+
+		err = w.Abort()
+		So(err, ShouldBeNil)
+
+		// the incomplete object is removed
+		_, err = GetObjectFromPath(dev, sid, getFullPath(destination, "aborted.txt"))
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+
+		_, err = w.Write(content[10:])
+		So(err, ShouldHaveSameTypeAs, SendObjectError{})
+
+		So(w.Close(), ShouldBeNil)
+
+		// the stream was released
+		w, _, err = CreateObjectWriter(dev, sid, parentId, "aborted.txt", int64(len(content)))
+		So(err, ShouldBeNil)
+
+		_, err = w.Write(content)
+		So(err, ShouldBeNil)
+
+		err = w.Close()
+		So(err, ShouldBeNil)
+	})
+
+	Dispose(dev)
+}
+
+func TestUploadFileResume(t *testing.T) {
+	dev, err := Initialize(Init{})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	storages, err := FetchStorages(dev)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	sid := storages[0].Sid
+
+	source := getTestMocksAsset("4mb_txt_file")
+	original, err := ioutil.ReadFile(source)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	sourceFi, err := os.Stat(source)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	Convey("Upload a new file | UploadFileResume", t, func() {
+		// test the directory '/mtp-test-files/temp_dir/test-UploadFileResume/{random}'
+		destination := fmt.Sprintf("/mtp-test-files/temp_dir/test-UploadFileResume/%x", rand.Int31())
+		parentId, err := MakeDirectory(dev, sid, destination)
+		So(err, ShouldBeNil)
+
+		objectId, err := UploadFileResume(dev, sid, parentId, source)
+		So(err, ShouldBeNil)
+
+		fi, err := GetObjectFromPath(dev, sid, getFullPath(destination, "4mb_txt_file"))
+		So(err, ShouldBeNil)
+		So(fi.ObjectId, ShouldEqual, objectId)
+		So(fi.Size, ShouldEqual, len(original))
+
+		_, err = GetObjectFromParentIdAndFilename(dev, sid, parentId, resumableUploadFilename(dev, "4mb_txt_file", sourceFi.Size(), sourceFi.ModTime()))
+		So(err, ShouldHaveSameTypeAs, FileNotFoundError{})
+	})
+
+	Convey("Resume a partially uploaded file | UploadFileResume", t, func() {
+		// test the directory '/mtp-test-files/temp_dir/test-UploadFileResume/{random}'
+		destination := fmt.Sprintf("/mtp-test-files/temp_dir/test-UploadFileResume/%x", rand.Int31())
+		parentId, err := MakeDirectory(dev, sid, destination)
+		So(err, ShouldBeNil)
+
+		c, err := GetDeviceCapabilities(dev)
+		So(err, ShouldBeNil)
+
+		// the incomplete object of an interrupted upload
+		half := len(original) / 2
+		w, partialId, err := CreateObjectWriter(dev, sid, parentId, resumableUploadFilename(dev, "4mb_txt_file", sourceFi.Size(), sourceFi.ModTime()), int64(half))
+		So(err, ShouldBeNil)
+		_, err = w.Write(original[:half])
+		So(err, ShouldBeNil)
+		So(w.Close(), ShouldBeNil)
+
+		objectId, err := UploadFileResume(dev, sid, parentId, source)
+		So(err, ShouldBeNil)
+
+		if c.SupportsEditObject() {
+			So(objectId, ShouldEqual, partialId)
+		}
+
+		r, err := OpenObject(dev, objectId)
+		So(err, ShouldBeNil)
+		b, err := ioutil.ReadAll(r)
+		So(err, ShouldBeNil)
+		_ = r.Close()
+		So(string(b), ShouldEqual, string(original))
+
+		fi, err := GetObjectFromPath(dev, sid, getFullPath(destination, "4mb_txt_file"))
+		So(err, ShouldBeNil)
+		So(fi.ObjectId, ShouldEqual, objectId)
+	})
+
+	Convey("Resume a directory | UploadFileResume | It should throw an error", t, func() {
+		_, err := UploadFileResume(dev, sid, ParentObjectId, getTestMocksAsset("mock_dir1"))
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+	})
+
+	Dispose(dev)
+}
+
+// uploads 2000 small files in a single batch; compare the allocations (-benchmem) of the buffer sizes
+// the transfer buffers are shared by all the files of the batch, so the allocations don't grow with the file count
+func BenchmarkUploadSmallFiles(b *testing.B) {
+	dev, err := Initialize(Init{})
+	if err != nil {
+		log.Panic(err)
+	}
+	defer Dispose(dev)
+
+	storages, err := FetchStorages(dev)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	sid := storages[0].Sid
+
+	// source directories: 'mocks-build/benchmark_UploadSmallFiles/{0..1999}.txt'
+	source := newTempMocksDir("benchmark_UploadSmallFiles", true)
+	for i := 0; i < 2000; i++ {
+		if err := ioutil.WriteFile(fmt.Sprintf("%s/%d.txt", source, i), []byte(strings.Repeat("a", 4096)), os.ModePerm); err != nil {
+			log.Panic(err)
+		}
+	}
+
+	for _, bufferSize := range []int{16 * 1024, defaultTransferBufferSize} {
+		b.Run(fmt.Sprintf("BufferSize=%d", bufferSize), func(b *testing.B) {
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				// destination directories: '/mtp-test-files/temp_dir/benchmark_UploadSmallFiles/{random}'
+				destination := fmt.Sprintf("/mtp-test-files/temp_dir/benchmark_UploadSmallFiles/%x", rand.Int31())
+
+				_, _, _, err := UploadFilesWithOpts(dev, sid, []string{source}, destination, UploadOpts{
+					ProgressCb: func(fi *ProgressInfo, err error) error {
+						return nil
+					},
+					StopOnError: true,
+					BufferSize:  bufferSize,
+				})
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -2,8 +2,10 @@ package mtpx
 
 import (
 	"fmt"
+	"github.com/ganeshrvel/go-mtpfs/mtp"
 	"log"
 	"math"
+	"mime"
 	"os"
 	"path"
 	"path/filepath"
@@ -43,6 +45,62 @@ func extension(filename string, isDir bool) string {
 	return extension
 }
 
+// the content type of the file derived from its [FileInfo.Extension] (eg: "image/heic")
+// returns an empty string for a directory and "application/octet-stream" if the extension is unknown
+func (fi *FileInfo) MimeType() string {
+	return mimeType(fi.Extension, fi.IsDir)
+}
+
+func mimeType(ext string, isDir bool) string {
+	if isDir {
+		return ""
+	}
+
+	// the last extension of a double extension (eg: "tar.gz")
+	if i := strings.LastIndex(ext, "."); i >= 0 {
+		ext = ext[i+1:]
+	}
+
+	ext = strings.ToLower(ext)
+	if ext == "" {
+		return defaultMimeType
+	}
+
+	if t, ok := mediaMimeTypes[ext]; ok {
+		return t
+	}
+
+	if t := mime.TypeByExtension("." + ext); t != "" {
+		return t
+	}
+
+	return defaultMimeType
+}
+
+// the object format (mtp.OFC_*) of the file [filename] derived from its extension
+// the devices use it to pick the app showing the file; [mtp.OFC_Undefined] is returned for the unknown extensions
+func objectFormat(filename string) uint16 {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), "."))
+	if f, ok := objectFormats[ext]; ok {
+		return f
+	}
+
+	return mtp.OFC_Undefined
+}
+
+// add the suffix " (n)" to the [filename] before its extension; eg: "name.ext" -> "name (1).ext"
+func filenameWithSuffix(filename string, n int) string {
+	ext := extension(filename, false)
+	base := strings.TrimSuffix(filename, "."+ext)
+
+	// the hidden files without an extension (eg: ".bashrc")
+	if ext == "" || base == "" {
+		return fmt.Sprintf("%s (%d)", filename, n)
+	}
+
+	return fmt.Sprintf("%s (%d).%s", base, n, ext)
+}
+
 func getFullPath(parentPath, filename string) string {
 	pathSep := PathSep
 
@@ -51,6 +109,47 @@ func getFullPath(parentPath, filename string) string {
 	return fixSlash(_fullPath)
 }
 
+// Normalize a device path
+// the local separators are converted to [PathSep], the duplicate separators and the trailing separator are removed
+// and the path is made absolute (eg: `DCIM\Camera\` => `/DCIM/Camera` on windows)
+// a backslash is only a separator where the local os uses it; elsewhere it is kept as part of the filename
+// the `.` and `..` components are not resolved; a [RelativePathNotSupportedError] is returned if the path contains one of them
+func NormalizePath(fullPath string) (string, error) {
+	var components []string
+
+	for _, c := range strings.Split(toPathSep(fullPath), PathSep) {
+		switch c {
+		case "":
+			continue
+
+		case ".", "..":
+			return "", RelativePathNotSupportedError{error: fmt.Errorf("invalid path: %s. the '%s' path components are not supported", fullPath, c)}
+		}
+
+		components = append(components, c)
+	}
+
+	return PathSep + strings.Join(components, PathSep), nil
+}
+
+// number of the components of the device path [fullPath]; the root directory has 0
+func pathDepth(fullPath string) int {
+	depth := 0
+	for _, c := range strings.Split(toPathSep(fullPath), PathSep) {
+		if c != "" {
+			depth += 1
+		}
+	}
+
+	return depth
+}
+
+// convert the local os separators in [fullPath] to [PathSep]
+// the device filenames may contain a backslash, so it is only converted where it is the local separator
+func toPathSep(fullPath string) string {
+	return filepath.ToSlash(fullPath)
+}
+
 func fixSlash(absFilepath string) string {
 	_absFilepath := absFilepath
 
@@ -161,10 +260,30 @@ func isSymlinkLocal(fi os.FileInfo) bool {
 	return fi.Mode()&os.ModeSymlink != 0
 }
 
-func isDisallowedFiles(filename string) bool {
-	contains, _ := StringContains(disallowedFiles, filename)
+// the filename patterns of the files which are skipped by the walks and transfers by default
+// use it to extend the list passed to the options (eg: append(DefaultDisallowedFiles(), "Thumbs.db"))
+func DefaultDisallowedFiles() []string {
+	return append([]string{}, disallowedFiles...)
+}
+
+// check if [filename] matches one of the [patterns]; the [disallowedFiles] list is used if [patterns] is nil
+// a pattern matches the filename either literally or as a [path.Match] glob (eg: "~*", ".*")
+func isDisallowedFiles(patterns []string, filename string) bool {
+	if patterns == nil {
+		patterns = disallowedFiles
+	}
+
+	for _, p := range patterns {
+		if p == filename {
+			return true
+		}
+
+		if ok, _ := path.Match(p, filename); ok {
+			return true
+		}
+	}
 
-	return contains
+	return false
 }
 
 func existsLocal(filename string) bool {
@@ -219,7 +338,7 @@ func mapSourcePathToDestinationPath(
 	trimmedSourcePath := strings.TrimPrefix(sourcePath, sourceParentPath)
 	fullPath := getFullPath(destinationPath, trimmedSourcePath)
 
-	return filepath.Dir(fullPath), fullPath
+	return path.Dir(fullPath), fullPath
 }
 
 func SanitizeDosName(name string) string {
@@ -248,6 +367,163 @@ func transferRate(size int64, lastSentTime time.Time) float64 {
 	return math.Round(rate*100) / 100
 }
 
+// create a [throughputMeter] averaging over [window] which starts measuring at [start]
+// a [window] less than or equal to 0 defaults to [defaultThroughputWindow]
+func newThroughputMeter(window time.Duration, start time.Time) *throughputMeter {
+	if window <= 0 {
+		window = defaultThroughputWindow
+	}
+
+	return &throughputMeter{
+		window:  window,
+		samples: []throughputSample{{at: start}},
+	}
+}
+
+// record the total bytes [sent] at [now] and return the transfer rate (in bytes per second) over the window
+// the latest sample older than the window is kept as the reference point of the rate
+func (m *throughputMeter) add(now time.Time, sent int64) float64 {
+	m.samples = append(m.samples, throughputSample{at: now, sent: sent})
+
+	cutoff := now.Add(-m.window)
+
+	i := 0
+	for i+1 < len(m.samples) && !m.samples[i+1].at.After(cutoff) {
+		i++
+	}
+	m.samples = m.samples[i:]
+
+	first := m.samples[0]
+	elapsed := now.Sub(first.at)
+	if elapsed <= 0 || sent <= first.sent {
+		return 0
+	}
+
+	return float64(sent-first.sent) / elapsed.Seconds()
+}
+
+// wrap [cb] so that the intermediate progress of a file is reported at most once per [interval] and only after [minBytes]
+// were sent since the previous report; the skipped progress is coalesced into the next report
+// the first and the final (complete) progress and the errors are always reported; [cb] is returned as is if both limits are 0
+func throttleSizeProgress(interval time.Duration, minBytes int64, cb SizeProgressCb) SizeProgressCb {
+	if interval <= 0 && minBytes <= 0 {
+		return cb
+	}
+
+	var lastTime time.Time
+	var lastSent int64
+	reported := false
+
+	return func(total, sent int64, objectId uint32, err error) error {
+		now := time.Now()
+
+		// a retried transfer starts over from 0
+		restarted := sent < lastSent
+
+		if reported && !restarted && err == nil && sent < total {
+			if now.Sub(lastTime) < interval || sent-lastSent < minBytes {
+				return nil
+			}
+		}
+
+		reported = true
+		lastTime = now
+		lastSent = sent
+
+		return cb(total, sent, objectId, err)
+	}
+}
+
+// let [cb] pause the transfer by returning a [PauseSignal]
+// the call blocks until the transfer is resumed, so the transfer pauses at the chunk boundary at which [cb] was called:
+// a chunk of the USB transaction while a file is being sent or received and between the files otherwise
+// note: the transaction of the device stays open while a file is paused; the per call timeout (see [SetPerCallTimeout])
+// is suspended until the transfer is resumed, but a device which gives up on the open transaction fails the transfer
+// a nil [cb] only passes the transfer errors through
+func pausableProgress(cb ProgressCb) ProgressCb {
+	if cb == nil {
+		return func(fi *ProgressInfo, err error) error {
+			return err
+		}
+	}
+
+	return func(fi *ProgressInfo, err error) error {
+		cbErr := cb(fi, err)
+
+		p, ok := cbErr.(PauseSignal)
+		if !ok {
+			return cbErr
+		}
+
+		if p.Resume == nil {
+			return PausedTransferCanceledError{error: fmt.Errorf("the pause signal has no resume channel")}
+		}
+
+		if err := <-p.Resume; err != nil {
+			return PausedTransferCanceledError{error: err}
+		}
+
+		return nil
+	}
+}
+
 func isHiddenFile(filename string) bool {
 	return len(filename) > 0 && filename[0:1] == "."
 }
+
+// check if the [pattern] is a valid glob pattern
+func isValidGlobPattern(pattern string) bool {
+	for _, seg := range strings.Split(pattern, PathSep) {
+		if seg == "**" {
+			continue
+		}
+
+		if _, err := path.Match(seg, ""); err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// match [name] against a doublestar style glob [pattern]
+// "**" matches zero or more path segments while the other segments are matched using [path.Match]
+func matchGlob(pattern, name string) bool {
+	return matchGlobSegments(strings.Split(pattern, PathSep), strings.Split(name, PathSep))
+}
+
+func matchGlobSegments(patterns, names []string) bool {
+	for len(patterns) > 0 {
+		if patterns[0] == "**" {
+			// collapse the consecutive "**" segments
+			for len(patterns) > 0 && patterns[0] == "**" {
+				patterns = patterns[1:]
+			}
+
+			if len(patterns) == 0 {
+				return true
+			}
+
+			for i := range names {
+				if matchGlobSegments(patterns, names[i:]) {
+					return true
+				}
+			}
+
+			return false
+		}
+
+		if len(names) == 0 {
+			return false
+		}
+
+		if ok, err := path.Match(patterns[0], names[0]); err != nil || !ok {
+			return false
+		}
+
+		patterns = patterns[1:]
+		names = names[1:]
+	}
+
+	return len(names) == 0
+}
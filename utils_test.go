@@ -1,8 +1,12 @@
 package mtpx
 
 import (
+	"fmt"
+	"github.com/ganeshrvel/go-mtpfs/mtp"
 	. "github.com/smartystreets/goconvey/convey"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestUtils(t *testing.T) {
@@ -61,6 +65,70 @@ func TestUtils(t *testing.T) {
 		}
 	})
 
+	Convey("Test getFullPath | backslash in the filename", t, func() {
+		// a backslash is a valid character in a device filename
+		So(getFullPath("/DCIM", "Camera\\a.jpg"), ShouldEqual, "/DCIM/Camera\\a.jpg")
+		So(getFullPath("/DCIM/", "/Camera/"), ShouldEqual, "/DCIM/Camera")
+	})
+
+	Convey("Test NormalizePath", t, func() {
+		type s struct {
+			fullPath, normalized string
+		}
+
+		sl := []s{
+			{fullPath: "", normalized: "/"},
+			{fullPath: "/", normalized: "/"},
+			{fullPath: "//DCIM//Camera//", normalized: "/DCIM/Camera"},
+			{fullPath: "/DCIM/a..jpg", normalized: "/DCIM/a..jpg"},
+		}
+
+		// the backslashes are separators only where the local os uses them
+		if filepath.Separator == '\\' {
+			sl = append(sl,
+				s{fullPath: "\\", normalized: "/"},
+				s{fullPath: "DCIM\\Camera", normalized: "/DCIM/Camera"},
+				s{fullPath: "\\DCIM\\Camera\\", normalized: "/DCIM/Camera"},
+				s{fullPath: "DCIM/\\Camera\\/a.jpg", normalized: "/DCIM/Camera/a.jpg"},
+			)
+		} else {
+			sl = append(sl,
+				s{fullPath: "DCIM\\Camera", normalized: "/DCIM\\Camera"},
+				s{fullPath: "/DCIM/a\\b.jpg/", normalized: "/DCIM/a\\b.jpg"},
+			)
+		}
+
+		for _, f := range sl {
+			normalized, err := NormalizePath(f.fullPath)
+
+			So(err, ShouldBeNil)
+			So(normalized, ShouldEqual, f.normalized)
+		}
+
+		for _, f := range []string{".", "..", "/./", "/DCIM/../Camera", "/DCIM/.", "/a/./b", "/a/b/../c"} {
+			normalized, err := NormalizePath(f)
+
+			So(err, ShouldHaveSameTypeAs, RelativePathNotSupportedError{})
+			So(normalized, ShouldEqual, "")
+		}
+	})
+
+	Convey("Test objectFormat", t, func() {
+		So(objectFormat("song.mp3"), ShouldEqual, mtp.OFC_MP3)
+		So(objectFormat("IMG_0001.JPG"), ShouldEqual, mtp.OFC_EXIF_JPEG)
+		So(objectFormat("archive.tar.gz"), ShouldEqual, mtp.OFC_Undefined)
+		So(objectFormat("README"), ShouldEqual, mtp.OFC_Undefined)
+		So(objectFormat(".mp3"), ShouldEqual, mtp.OFC_MP3)
+	})
+
+	Convey("Test pathDepth", t, func() {
+		So(pathDepth("/"), ShouldEqual, 0)
+		So(pathDepth(""), ShouldEqual, 0)
+		So(pathDepth("/DCIM"), ShouldEqual, 1)
+		So(pathDepth("/DCIM/Camera/"), ShouldEqual, 2)
+		So(pathDepth("//DCIM//Camera//a.jpg"), ShouldEqual, 3)
+	})
+
 	Convey("Test extension", t, func() {
 		type s struct {
 			filename, ext string
@@ -153,4 +221,155 @@ func TestUtils(t *testing.T) {
 			So(ext, ShouldEqual, f.ext)
 		}
 	})
+
+	Convey("Test MimeType", t, func() {
+		type s struct {
+			filename, expected string
+			isDir              bool
+		}
+
+		sl := []s{
+			{filename: "IMG_0001.HEIC", expected: "image/heic"},
+			{filename: "movie.mkv", expected: "video/x-matroska"},
+			{filename: "raw.cr2", expected: "image/x-canon-cr2"},
+			{filename: "photo.jpg", expected: "image/jpeg"},
+			{filename: "clip.tar.mp4", expected: "video/mp4"},
+			{filename: "a.unknownext", expected: "application/octet-stream"},
+			{filename: "a", expected: "application/octet-stream"},
+			{filename: "DCIM", isDir: true, expected: ""},
+		}
+
+		for _, f := range sl {
+			fi := &FileInfo{Name: f.filename, IsDir: f.isDir, Extension: extension(f.filename, f.isDir)}
+
+			So(fi.MimeType(), ShouldEqual, f.expected)
+		}
+	})
+
+	Convey("Test filenameWithSuffix", t, func() {
+		type s struct {
+			filename, expected string
+			n                  int
+		}
+
+		sl := []s{
+			{filename: "a.txt", n: 1, expected: "a (1).txt"},
+			{filename: "a.b.txt", n: 2, expected: "a.b (2).txt"},
+			{filename: "a.tar.gz", n: 1, expected: "a (1).tar.gz"},
+			{filename: "a", n: 1, expected: "a (1)"},
+			{filename: ".bashrc", n: 3, expected: ".bashrc (3)"},
+		}
+
+		for _, f := range sl {
+			So(filenameWithSuffix(f.filename, f.n), ShouldEqual, f.expected)
+		}
+	})
+
+	Convey("Test matchGlob", t, func() {
+		type s struct {
+			pattern, name string
+			match         bool
+		}
+
+		sl := []s{
+			{pattern: "/DCIM/*.jpg", name: "/DCIM/a.jpg", match: true},
+			{pattern: "/DCIM/*.jpg", name: "/DCIM/Camera/a.jpg", match: false},
+			{pattern: "/DCIM/*.jpg", name: "/DCIM/a.png", match: false},
+			{pattern: "/DCIM/**/*.jpg", name: "/DCIM/a.jpg", match: true},
+			{pattern: "/DCIM/**/*.jpg", name: "/DCIM/Camera/2021/a.jpg", match: true},
+			{pattern: "/DCIM/**/*.jpg", name: "/Pictures/a.jpg", match: false},
+			{pattern: "/**/*.mp4", name: "/Movies/b.mp4", match: true},
+			{pattern: "/**/*.mp4", name: "/b.mp4", match: true},
+			{pattern: "/**/*.mp4", name: "/Movies/b.mp4/c.txt", match: false},
+			{pattern: "/DCIM/**", name: "/DCIM/Camera/a.jpg", match: true},
+			{pattern: "/DCIM/**/**/a.jpg", name: "/DCIM/a.jpg", match: true},
+			{pattern: "/DCIM/Camera", name: "/DCIM/Camera", match: true},
+			{pattern: "/DCIM/[", name: "/DCIM/[", match: false},
+		}
+
+		for _, f := range sl {
+			So(matchGlob(f.pattern, f.name), ShouldEqual, f.match)
+		}
+
+		So(isValidGlobPattern("/DCIM/**/*.jpg"), ShouldBeTrue)
+		So(isValidGlobPattern("/DCIM/["), ShouldBeFalse)
+	})
+
+	Convey("Test throughputMeter", t, func() {
+		start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+		m := newThroughputMeter(2*time.Second, start)
+
+		So(m.add(start, 0), ShouldEqual, 0)
+		So(m.add(start.Add(time.Second), 1000), ShouldEqual, 1000)
+		So(m.add(start.Add(2*time.Second), 3000), ShouldEqual, 1500)
+
+		// the samples older than the window are dropped
+		So(m.add(start.Add(4*time.Second), 5000), ShouldEqual, 1000)
+		So(len(m.samples), ShouldEqual, 2)
+
+		// the burst is averaged over the window
+		So(m.add(start.Add(5*time.Second), 9000), ShouldEqual, 2000)
+
+		// the sent size went back (eg: a retried file)
+		So(m.add(start.Add(6*time.Second), 100), ShouldEqual, 0)
+
+		So(newThroughputMeter(0, start).window, ShouldEqual, defaultThroughputWindow)
+	})
+
+	Convey("Test throttleSizeProgress", t, func() {
+		var reported []int64
+		cb := func(total, sent int64, objectId uint32, err error) error {
+			reported = append(reported, sent)
+
+			return nil
+		}
+
+		// only the byte delta is limited
+		throttled := throttleSizeProgress(0, 100, cb)
+		for sent := int64(0); sent <= 250; sent += 10 {
+			So(throttled(250, sent, 1, nil), ShouldBeNil)
+		}
+		So(reported, ShouldResemble, []int64{0, 100, 200, 250})
+
+		// the final progress is reported within the interval
+		reported = nil
+		throttled = throttleSizeProgress(time.Hour, 0, cb)
+		for sent := int64(0); sent <= 250; sent += 10 {
+			So(throttled(250, sent, 1, nil), ShouldBeNil)
+		}
+		So(reported, ShouldResemble, []int64{0, 250})
+
+		// a retried transfer is reported from the start
+		So(throttled(250, 0, 1, nil), ShouldBeNil)
+		So(reported, ShouldResemble, []int64{0, 250, 0})
+	})
+
+	Convey("Test pausableProgress", t, func() {
+		resume := make(chan error, 1)
+		var signal error
+		cb := pausableProgress(func(fi *ProgressInfo, err error) error {
+			return signal
+		})
+
+		So(pausableProgress(nil), ShouldBeNil)
+		So(cb(&ProgressInfo{}, nil), ShouldBeNil)
+
+		// the call blocks until the transfer is resumed
+		signal = PauseSignal{Resume: resume}
+		resume <- nil
+		So(cb(&ProgressInfo{}, nil), ShouldBeNil)
+
+		resume <- fmt.Errorf("canceled")
+		So(cb(&ProgressInfo{}, nil), ShouldHaveSameTypeAs, PausedTransferCanceledError{})
+
+		close(resume)
+		So(cb(&ProgressInfo{}, nil), ShouldBeNil)
+
+		signal = PauseSignal{}
+		So(cb(&ProgressInfo{}, nil), ShouldHaveSameTypeAs, PausedTransferCanceledError{})
+
+		// the other errors still abort the transfer
+		signal = fmt.Errorf("canceled")
+		So(cb(&ProgressInfo{}, nil), ShouldEqual, signal)
+	})
 }
@@ -1,10 +1,18 @@
 package mtpx
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"github.com/ganeshrvel/go-mtpfs/mtp"
 	. "github.com/smartystreets/goconvey/convey"
 	"log"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestWalk(t *testing.T) {
@@ -27,7 +35,7 @@ func TestWalk(t *testing.T) {
 		fullPath := "/mtp-test-files"
 
 		var children []*FileInfo
-		objectId1, totalFiles1, totalDirectories, err := Walk(dev, sid, fullPath, false, true, false,
+		objectId1, totalFiles1, totalDirectories, err := Walk(context.Background(), dev, sid, fullPath, false, true, false,
 			func(objectId uint32, fi *FileInfo, err error) error {
 				So(err, ShouldBeNil)
 				So(fi.FullPath, ShouldNotEqual, "/mtp-test-files")
@@ -64,7 +72,7 @@ func TestWalk(t *testing.T) {
 		/////////////////
 		fullPath = "/mtp-test-files/"
 		children = []*FileInfo{}
-		objectId2, totalFiles2, totalDirectories, err := Walk(dev, sid, fullPath, false, true, false,
+		objectId2, totalFiles2, totalDirectories, err := Walk(context.Background(), dev, sid, fullPath, false, true, false,
 			func(objectId uint32, fi *FileInfo, err error) error {
 				So(err, ShouldBeNil)
 				// make sure that the first item is not the parent path itself
@@ -103,7 +111,7 @@ func TestWalk(t *testing.T) {
 		/////////////////
 		fullPath = "mtp-test-files/"
 		children = []*FileInfo{}
-		objectId3, totalFiles3, totalDirectories, err := Walk(dev, sid, fullPath, false, true, false,
+		objectId3, totalFiles3, totalDirectories, err := Walk(context.Background(), dev, sid, fullPath, false, true, false,
 			func(objectId uint32, fi *FileInfo, err error) error {
 				So(err, ShouldBeNil)
 				// make sure that the first item is not the parent path itself
@@ -142,7 +150,7 @@ func TestWalk(t *testing.T) {
 		fullPath = "mtp-test-files/mock_dir3/"
 		children = []*FileInfo{}
 
-		objectId4, totalFiles4, totalDirectories, err := Walk(dev, sid, fullPath, false, true, false,
+		objectId4, totalFiles4, totalDirectories, err := Walk(context.Background(), dev, sid, fullPath, false, true, false,
 			func(objectId uint32, fi *FileInfo, err error) error {
 				So(err, ShouldBeNil)
 
@@ -183,7 +191,7 @@ func TestWalk(t *testing.T) {
 		fullPath := "/mtp-test-files/mock_dir1/1"
 
 		var children []*FileInfo
-		objectId, totalFiles, totalDirectories, err := Walk(dev, sid, fullPath, false, true, false,
+		objectId, totalFiles, totalDirectories, err := Walk(context.Background(), dev, sid, fullPath, false, true, false,
 			func(objectId uint32, fi *FileInfo, err error) error {
 				So(err, ShouldBeNil)
 
@@ -231,7 +239,7 @@ func TestWalk(t *testing.T) {
 		fullPath := "/mtp-test-files/mock_dir1/"
 
 		var children []*FileInfo
-		objectId, totalFiles, totalDirectories, err := Walk(dev, sid, fullPath, false, true, false,
+		objectId, totalFiles, totalDirectories, err := Walk(context.Background(), dev, sid, fullPath, false, true, false,
 			func(objectId uint32, fi *FileInfo, err error) error {
 				So(err, ShouldBeNil)
 
@@ -280,7 +288,7 @@ func TestWalk(t *testing.T) {
 		fullPath := "/mtp-test-files/mock_dir1/"
 
 		var children []*FileInfo
-		objectId, totalFiles, totalDirectories, err := Walk(dev, sid, fullPath, true, true, false,
+		objectId, totalFiles, totalDirectories, err := Walk(context.Background(), dev, sid, fullPath, true, true, false,
 			func(objectId uint32, fi *FileInfo, err error) error {
 				So(err, ShouldBeNil)
 
@@ -338,7 +346,7 @@ func TestWalk(t *testing.T) {
 	Convey("Testing valid file | recursive=true | Walk", t, func() {
 		// test the directory '/mtp-test-files/a.txt'
 		var children []*FileInfo
-		objectId, totalFiles, totalDirectories, err := Walk(dev, sid, "/mtp-test-files/a.txt", true, true, false,
+		objectId, totalFiles, totalDirectories, err := Walk(context.Background(), dev, sid, "/mtp-test-files/a.txt", true, true, false,
 			func(objectId uint32, fi *FileInfo, err error) error {
 				So(err, ShouldBeNil)
 				children = append(children, fi)
@@ -363,7 +371,7 @@ func TestWalk(t *testing.T) {
 	Convey("Testing recursive=false | Walk", t, func() {
 		// test the directory '/mtp-test-files/mock_dir1/' | recursive=false
 		count := 0
-		_, _, _, err := Walk(dev, sid, "/mtp-test-files/mock_dir1/", false, true, false,
+		_, _, _, err := Walk(context.Background(), dev, sid, "/mtp-test-files/mock_dir1/", false, true, false,
 			func(objectId uint32, fi *FileInfo, err error) error {
 				So(err, ShouldBeNil)
 
@@ -378,7 +386,7 @@ func TestWalk(t *testing.T) {
 	Convey("Testing skipDisallowedFiles=true inside the tree | Walk", t, func() {
 		// test the directory '/mtp-test-files/mock_dir1/' | recursive=true
 		count := 0
-		_, _, _, err := Walk(dev, sid, "/mtp-test-files/mock_dir1/", true, true, false,
+		_, _, _, err := Walk(context.Background(), dev, sid, "/mtp-test-files/mock_dir1/", true, true, false,
 			func(objectId uint32, fi *FileInfo, err error) error {
 				So(err, ShouldBeNil)
 
@@ -393,7 +401,7 @@ func TestWalk(t *testing.T) {
 	Convey("Testing skipDisallowedFiles=false inside the tree | Walk", t, func() {
 		// test the directory '/mtp-test-files/mock_dir1/' | recursive=true
 		count := 0
-		_, _, _, err := Walk(dev, sid, "/mtp-test-files/mock_dir1/", true, false, false,
+		_, _, _, err := Walk(context.Background(), dev, sid, "/mtp-test-files/mock_dir1/", true, false, false,
 			func(objectId uint32, fi *FileInfo, err error) error {
 				So(err, ShouldBeNil)
 
@@ -408,7 +416,7 @@ func TestWalk(t *testing.T) {
 	Convey("Testing skipDisallowedFiles=false | rootfile=[-----DS_Store.mtp.test----].txt | Walk", t, func() {
 		// test the directory '/mtp-test-files/mock_dir1/[-----DS_Store.mtp.test----].txt' | recursive=true
 		count := 0
-		_, _, _, err := Walk(dev, sid, "/mtp-test-files/mock_dir1/[-----DS_Store.mtp.test----].txt", true, false, false,
+		_, _, _, err := Walk(context.Background(), dev, sid, "/mtp-test-files/mock_dir1/[-----DS_Store.mtp.test----].txt", true, false, false,
 			func(objectId uint32, fi *FileInfo, err error) error {
 				So(err, ShouldBeNil)
 
@@ -422,7 +430,7 @@ func TestWalk(t *testing.T) {
 
 	Convey("Testing skipDisallowedFiles=true | Walk | It should throw an error", t, func() {
 		// test the directory '/mtp-test-files' | recursive=true
-		_, _, _, err := Walk(dev, sid, "/mtp-test-files/mock_dir1/.DS_Store", true, true, false,
+		_, _, _, err := Walk(context.Background(), dev, sid, "/mtp-test-files/mock_dir1/.DS_Store", true, true, false,
 			func(objectId uint32, fi *FileInfo, err error) error {
 				So(err, ShouldBeNil)
 
@@ -435,7 +443,7 @@ func TestWalk(t *testing.T) {
 
 	Convey("Testing skipDisallowedFiles=true | rootfile=.DS_Store | Walk | It should throw an error", t, func() {
 		// test the directory '/mtp-test-files/mock_dir1/.DS_Store' | recursive=true
-		_, _, _, err := Walk(dev, sid, "/mtp-test-files/mock_dir1/.DS_Store", true, true, false,
+		_, _, _, err := Walk(context.Background(), dev, sid, "/mtp-test-files/mock_dir1/.DS_Store", true, true, false,
 			func(objectId uint32, fi *FileInfo, err error) error {
 				So(err, ShouldBeNil)
 
@@ -449,7 +457,7 @@ func TestWalk(t *testing.T) {
 	Convey("Testing skipHiddenFiles=true inside the tree | Walk", t, func() {
 		// test the directory '/mtp-test-files/mock_dir4/' | recursive=true
 		count := 0
-		_, _, _, err := Walk(dev, sid, "/mtp-test-files/mock_dir4/", true, false, true,
+		_, _, _, err := Walk(context.Background(), dev, sid, "/mtp-test-files/mock_dir4/", true, false, true,
 			func(objectId uint32, fi *FileInfo, err error) error {
 				So(err, ShouldBeNil)
 
@@ -464,7 +472,7 @@ func TestWalk(t *testing.T) {
 	Convey("Testing skipHiddenFiles=true inside the tree | Walk", t, func() {
 		// test the directory '/mtp-test-files/mock_dir1/' | recursive=true
 		count := 0
-		_, _, _, err := Walk(dev, sid, "/mtp-test-files/mock_dir1/", true, false, true,
+		_, _, _, err := Walk(context.Background(), dev, sid, "/mtp-test-files/mock_dir1/", true, false, true,
 			func(objectId uint32, fi *FileInfo, err error) error {
 				So(err, ShouldBeNil)
 
@@ -479,7 +487,7 @@ func TestWalk(t *testing.T) {
 	Convey("Testing skipHiddenFiles=true inside the tree | Walk", t, func() {
 		// test the directory '/mtp-test-files/mock_dir4/.1' | recursive=true
 		count := 0
-		_, _, _, err := Walk(dev, sid, "/mtp-test-files/mock_dir4/.1", true, false, true,
+		_, _, _, err := Walk(context.Background(), dev, sid, "/mtp-test-files/mock_dir4/.1", true, false, true,
 			func(objectId uint32, fi *FileInfo, err error) error {
 				So(err, ShouldBeNil)
 
@@ -494,7 +502,7 @@ func TestWalk(t *testing.T) {
 	Convey("Testing skipHiddenFiles=true inside the tree | Walk", t, func() {
 		// test the directory '/mtp-test-files/mock_dir4/.a.txt' | recursive=true
 		count := 0
-		_, _, _, err := Walk(dev, sid, "/mtp-test-files/mock_dir4/.a.txt", true, false, true,
+		_, _, _, err := Walk(context.Background(), dev, sid, "/mtp-test-files/mock_dir4/.a.txt", true, false, true,
 			func(objectId uint32, fi *FileInfo, err error) error {
 				So(err, ShouldBeNil)
 
@@ -509,7 +517,7 @@ func TestWalk(t *testing.T) {
 	Convey("Testing skipHiddenFiles=true inside the tree | Walk", t, func() {
 		// test the directory '/mtp-test-files/mock_dir4/' | recursive=true
 		count := 0
-		_, _, _, err := Walk(dev, sid, "/mtp-test-files/mock_dir4/", false, false, true,
+		_, _, _, err := Walk(context.Background(), dev, sid, "/mtp-test-files/mock_dir4/", false, false, true,
 			func(objectId uint32, fi *FileInfo, err error) error {
 				So(err, ShouldBeNil)
 
@@ -524,7 +532,7 @@ func TestWalk(t *testing.T) {
 	Convey("Testing non exisiting file | Walk | It should throw an error", t, func() {
 		// test the directory '/fake' | recursive=true
 		var children []*FileInfo
-		objectId, totalFiles, totalDirectories, err := Walk(dev, sid, "/fake", true, true, false,
+		objectId, totalFiles, totalDirectories, err := Walk(context.Background(), dev, sid, "/fake", true, true, false,
 			func(objectId uint32, fi *FileInfo, err error) error {
 				So(err, ShouldBeNil)
 				children = append(children, fi)
@@ -541,7 +549,7 @@ func TestWalk(t *testing.T) {
 
 		// test the directory '/fake' | recursive=false
 		children = []*FileInfo{}
-		objectId, totalFiles, totalDirectories, err = Walk(dev, sid, "/fake", false, true, false,
+		objectId, totalFiles, totalDirectories, err = Walk(context.Background(), dev, sid, "/fake", false, true, false,
 			func(objectId uint32, fi *FileInfo, err error) error {
 				So(err, ShouldBeNil)
 				children = append(children, fi)
@@ -564,7 +572,7 @@ func TestWalk(t *testing.T) {
 
 		// test the directory '/mtp-test-files/fake' | recursive=true
 		children = []*FileInfo{}
-		objectId, totalFiles, totalDirectories, err = Walk(dev, sid, "/mtp-test-files/fake", true, true, false,
+		objectId, totalFiles, totalDirectories, err = Walk(context.Background(), dev, sid, "/mtp-test-files/fake", true, true, false,
 			func(objectId uint32, fi *FileInfo, err error) error {
 				So(err, ShouldBeNil)
 				children = append(children, fi)
@@ -587,7 +595,7 @@ func TestWalk(t *testing.T) {
 
 		// test the directory '/mtp-test-files/fake' | recursive=false
 		children = []*FileInfo{}
-		objectId, totalFiles, totalDirectories, err = Walk(dev, sid, "/mtp-test-files/fake", false, true, false,
+		objectId, totalFiles, totalDirectories, err = Walk(context.Background(), dev, sid, "/mtp-test-files/fake", false, true, false,
 			func(objectId uint32, fi *FileInfo, err error) error {
 				So(err, ShouldBeNil)
 				children = append(children, fi)
@@ -609,7 +617,7 @@ func TestWalk(t *testing.T) {
 		So(len(children), ShouldEqual, 0)
 
 		// test the directory=''
-		objectId, totalFiles, totalDirectories, err = Walk(dev, sid, "", true, true, false,
+		objectId, totalFiles, totalDirectories, err = Walk(context.Background(), dev, sid, "", true, true, false,
 			func(objectId uint32, fi *FileInfo, err error) error {
 				So(err, ShouldBeNil)
 				children = append(children, fi)
@@ -633,7 +641,7 @@ func TestWalk(t *testing.T) {
 
 	Convey("Testing callback error | Walk | It should throw an error", t, func() {
 		// test the directory '/mtp-test-files' | recursive=true
-		_, _, _, err := Walk(dev, sid, "/mtp-test-files", true, true,
+		_, _, _, err := Walk(context.Background(), dev, sid, "/mtp-test-files", true, true,
 			false, func(objectId uint32, fi *FileInfo, err error) error {
 				So(err, ShouldBeNil)
 
@@ -644,5 +652,938 @@ func TestWalk(t *testing.T) {
 		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
 	})
 
+	Convey("Testing expired context | Walk | It should throw an error", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), -1)
+		defer cancel()
+
+		// test the directory '/mtp-test-files' | recursive=true
+		objectId, totalFiles, totalDirectories, err := Walk(ctx, dev, sid, "/mtp-test-files", true, true,
+			false, func(objectId uint32, fi *FileInfo, err error) error {
+				So(fi, ShouldBeNil)
+
+				return nil
+			})
+
+		So(err, ShouldBeError)
+		So(err, ShouldHaveSameTypeAs, WalkCanceledError{})
+		So(objectId, ShouldEqual, 0)
+		So(totalFiles, ShouldEqual, 0)
+		So(totalDirectories, ShouldEqual, 0)
+	})
+
+	Convey("Testing canceled context during the walk | Walk | It should throw an error", t, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var children []*FileInfo
+
+		// test the directory '/mtp-test-files' | recursive=true
+		_, _, _, err := Walk(ctx, dev, sid, "/mtp-test-files", true, true,
+			false, func(objectId uint32, fi *FileInfo, err error) error {
+				So(err, ShouldBeNil)
+
+				children = append(children, fi)
+				cancel()
+
+				return nil
+			})
+
+		So(err, ShouldBeError)
+		So(err, ShouldHaveSameTypeAs, WalkCanceledError{})
+		So(len(children), ShouldEqual, 1)
+	})
+
+	Convey("Testing walk using objectId only | recursive=true | proccessWalk", t, func() {
+		//test the directory '/mtp-test-files/mock_dir1'
+		dir, err := GetObjectFromPath(dev, sid, "/mtp-test-files/mock_dir1")
+		So(err, ShouldBeNil)
+
+		var paths []string
+		totalFiles, totalDirectories, _, err := proccessWalk(context.Background(), dev, sid, FileProp{dir.ObjectId, ""}, walkProps{recursive: true, skipDisallowedFiles: true, skipErrors: true},
+			func(objectId uint32, fi *FileInfo, err error) error {
+				So(err, ShouldBeNil)
+
+				// the [FullPath] should be fully qualified regardless of the depth
+				So(fi.FullPath, ShouldStartWith, "/mtp-test-files/mock_dir1/")
+				So(fi.ParentPath, ShouldStartWith, "/mtp-test-files/mock_dir1")
+				So(fi.FullPath, ShouldEqual, getFullPath(fi.ParentPath, fi.Name))
+
+				paths = append(paths, fi.FullPath)
+
+				return nil
+			})
+
+		So(err, ShouldBeNil)
+		So(totalFiles, ShouldEqual, 5)
+		So(totalDirectories, ShouldEqual, 4)
+		So(paths, ShouldContain, "/mtp-test-files/mock_dir1/a.txt")
+		So(paths, ShouldContain, "/mtp-test-files/mock_dir1/3/2/b.txt")
+	})
+
+	Convey("Testing ReportErrors=true | WalkWithOpts", t, func() {
+		// test the directory '/mtp-test-files/mock_dir1'
+		fullPath := "/mtp-test-files/mock_dir1"
+
+		_, totalFiles, totalDirectories, err := Walk(context.Background(), dev, sid, fullPath, true, true, false,
+			func(objectId uint32, fi *FileInfo, err error) error {
+				return nil
+			})
+		So(err, ShouldBeNil)
+
+		objectId, totalFiles1, totalDirectories1, skippedCount, err := WalkWithOpts(context.Background(), dev, sid, fullPath,
+			WalkOpts{Recursive: true, SkipDisallowedFiles: true, ReportErrors: true},
+			func(objectId uint32, fi *FileInfo, err error) error {
+				So(err, ShouldBeNil)
+				So(fi.Name, ShouldNotBeEmpty)
+
+				return err
+			})
+
+		So(err, ShouldBeNil)
+		So(objectId, ShouldBeGreaterThan, 0)
+		So(totalFiles1, ShouldEqual, totalFiles)
+		So(totalDirectories1, ShouldEqual, totalDirectories)
+		So(skippedCount, ShouldEqual, 0)
+	})
+
+	Convey("Testing IncludeHidden | WalkWithOpts", t, func() {
+		// test the directory '/mtp-test-files'
+		fullPath := "/mtp-test-files"
+
+		walk := func(includeHidden bool) map[uint32]*FileInfo {
+			objects := map[uint32]*FileInfo{}
+
+			_, _, _, _, err := WalkWithOpts(context.Background(), dev, sid, fullPath,
+				WalkOpts{Recursive: true, IncludeHidden: includeHidden},
+				func(objectId uint32, fi *FileInfo, err error) error {
+					objects[objectId] = fi
+
+					return err
+				})
+			So(err, ShouldBeNil)
+
+			return objects
+		}
+
+		root, err := GetObjectFromPath(dev, sid, fullPath)
+		So(err, ShouldBeNil)
+
+		visible := walk(false)
+		all := walk(true)
+		So(len(visible), ShouldBeLessThanOrEqualTo, len(all))
+
+		for objectId, fi := range all {
+			if _, ok := visible[objectId]; ok {
+				continue
+			}
+
+			// an excluded object is either hidden or its parent directory was excluded
+			hidden, err := listHiddenObjects(dev, sid, fi.ParentId)
+			So(err, ShouldBeNil)
+
+			_, parentVisible := visible[fi.ParentId]
+			parentVisible = parentVisible || fi.ParentId == root.ObjectId
+			So(hidden[objectId] || (hidden == nil && isDisallowedFiles(nil, fi.Name)) || !parentVisible, ShouldBeTrue)
+		}
+	})
+
+	Convey("Testing WalkWithStats", t, func() {
+		// test the directory '/mtp-test-files/mock_dir1'
+		fullPath := "/mtp-test-files/mock_dir1"
+
+		_, totalFiles, totalDirectories, _, err := WalkWithOpts(context.Background(), dev, sid, fullPath,
+			WalkOpts{Recursive: true},
+			func(objectId uint32, fi *FileInfo, err error) error {
+				return err
+			})
+		So(err, ShouldBeNil)
+
+		maxDepth := 0
+		objectId, stats, err := WalkWithStats(context.Background(), dev, sid, fullPath,
+			WalkOpts{Recursive: true},
+			func(objectId uint32, fi *FileInfo, err error) error {
+				if depth := pathDepth(fi.FullPath) - pathDepth(fullPath); depth > maxDepth {
+					maxDepth = depth
+				}
+
+				return err
+			})
+		So(err, ShouldBeNil)
+		So(objectId, ShouldBeGreaterThan, 0)
+		So(stats.TotalFiles, ShouldEqual, totalFiles)
+		So(stats.TotalDirectories, ShouldEqual, totalDirectories)
+		So(stats.MaxDepth, ShouldEqual, maxDepth)
+		So(len(stats.DepthCounts), ShouldEqual, maxDepth+1)
+		So(stats.DepthCounts[0], ShouldEqual, 0)
+
+		var total int64
+		for _, c := range stats.DepthCounts {
+			total += c
+		}
+		So(total, ShouldEqual, totalFiles+totalDirectories)
+
+		// a single level
+		_, stats, err = WalkWithStats(context.Background(), dev, sid, fullPath, WalkOpts{},
+			func(objectId uint32, fi *FileInfo, err error) error {
+				return err
+			})
+		So(err, ShouldBeNil)
+		So(stats.MaxDepth, ShouldEqual, 1)
+	})
+
+	Convey("Testing the GetObjectInfo calls of a nested tree | Walk | Every object should be fetched once", t, func() {
+		// test the directory '/mtp-test-files/mock_dir1'
+		root, err := GetObjectFromPath(dev, sid, "/mtp-test-files/mock_dir1")
+		So(err, ShouldBeNil)
+
+		var walkCount, dirCount int
+		calls := countMtpRequests(dev, mtp.OC_GetObjectInfo, func() {
+			_, _, _, err = proccessWalk(context.Background(), dev, sid, FileProp{root.ObjectId, root.FullPath}, walkProps{recursive: true},
+				func(objectId uint32, fi *FileInfo, err error) error {
+					walkCount += 1
+					if fi.IsDir {
+						dirCount += 1
+					}
+
+					return err
+				})
+		})
+		So(err, ShouldBeNil)
+		So(dirCount, ShouldBeGreaterThan, 0)
+
+		// the walked objects and the root; the sub directories aren't fetched again
+		So(calls, ShouldEqual, walkCount+1)
+	})
+
+	Dispose(dev)
+}
+
+// count the MTP requests with the operation code [opCode] sent to [dev] while [fn] runs
+// the requests are counted from the debug log of the mtp library
+func countMtpRequests(dev *mtp.Device, opCode uint16, fn func()) int {
+	var buf bytes.Buffer
+
+	log.SetOutput(&buf)
+	dev.MTPDebug = true
+
+	fn()
+
+	dev.MTPDebug = false
+	log.SetOutput(os.Stderr)
+
+	return strings.Count(buf.String(), fmt.Sprintf("MTP request %s ", mtp.OC_names[int(opCode)]))
+}
+
+func TestWalkMatch(t *testing.T) {
+	dev, err := Initialize(Init{})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	storages, err := FetchStorages(dev)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	sid := storages[0].Sid
+
+	Convey("Testing a pattern relative to the directory | *.txt | WalkMatch", t, func() {
+		//test the directory '/mtp-test-files/mock_dir1'
+		fullPath := "/mtp-test-files/mock_dir1"
+
+		var children []*FileInfo
+		totalFiles, totalDirectories, err := WalkMatch(dev, sid, 0, fullPath, "*.txt", true,
+			func(objectId uint32, fi *FileInfo, err error) error {
+				So(err, ShouldBeNil)
+
+				children = append(children, fi)
+
+				return nil
+			})
+
+		So(err, ShouldBeNil)
+		So(totalFiles, ShouldEqual, 1)
+		So(totalDirectories, ShouldEqual, 0)
+		So(len(children), ShouldEqual, 1)
+		So(children[0].FullPath, ShouldEqual, "/mtp-test-files/mock_dir1/a.txt")
+	})
+
+	Convey("Testing a nested pattern | **/b.txt | WalkMatch", t, func() {
+		//test the directory '/mtp-test-files/mock_dir1'
+		fullPath := "/mtp-test-files/mock_dir1"
+
+		var paths []string
+		totalFiles, totalDirectories, err := WalkMatch(dev, sid, 0, fullPath, "/mtp-test-files/mock_dir1/**/b.txt", true,
+			func(objectId uint32, fi *FileInfo, err error) error {
+				So(err, ShouldBeNil)
+
+				paths = append(paths, fi.FullPath)
+
+				return nil
+			})
+
+		So(err, ShouldBeNil)
+		So(totalFiles, ShouldEqual, 3)
+		So(totalDirectories, ShouldEqual, 0)
+		So(paths, ShouldContain, "/mtp-test-files/mock_dir1/2/b.txt")
+		So(paths, ShouldContain, "/mtp-test-files/mock_dir1/3/b.txt")
+		So(paths, ShouldContain, "/mtp-test-files/mock_dir1/3/2/b.txt")
+
+		// [recursive] = false doesn't descend into the sub directories
+		totalFiles, _, err = WalkMatch(dev, sid, 0, fullPath, "**/b.txt", false,
+			func(objectId uint32, fi *FileInfo, err error) error {
+				return nil
+			})
+
+		So(err, ShouldBeNil)
+		So(totalFiles, ShouldEqual, 0)
+	})
+
+	Convey("Testing a pattern which matches nothing | **/*.mp4 | WalkMatch", t, func() {
+		//test the directory '/mtp-test-files/mock_dir1'
+		fullPath := "/mtp-test-files/mock_dir1"
+
+		totalFiles, totalDirectories, err := WalkMatch(dev, sid, 0, fullPath, "**/*.mp4", true,
+			func(objectId uint32, fi *FileInfo, err error) error {
+				t.Errorf("unexpected match: %s", fi.FullPath)
+
+				return nil
+			})
+
+		So(err, ShouldBeNil)
+		So(totalFiles, ShouldEqual, 0)
+		So(totalDirectories, ShouldEqual, 0)
+	})
+
+	Convey("Testing a pattern using objectId only | WalkMatch", t, func() {
+		//test the directory '/mtp-test-files/mock_dir1'
+		dir, err := GetObjectFromPath(dev, sid, "/mtp-test-files/mock_dir1")
+		So(err, ShouldBeNil)
+
+		var paths []string
+		totalFiles, _, err := WalkMatch(dev, sid, dir.ObjectId, "", "**/b.txt", true,
+			func(objectId uint32, fi *FileInfo, err error) error {
+				So(err, ShouldBeNil)
+
+				paths = append(paths, fi.FullPath)
+
+				return nil
+			})
+
+		So(err, ShouldBeNil)
+		So(totalFiles, ShouldEqual, 3)
+		So(paths, ShouldContain, "/mtp-test-files/mock_dir1/3/2/b.txt")
+	})
+
+	Convey("Testing an invalid pattern | WalkMatch | Should throw an error", t, func() {
+		_, _, err := WalkMatch(dev, sid, 0, "/mtp-test-files/mock_dir1", "[", true,
+			func(objectId uint32, fi *FileInfo, err error) error {
+				return nil
+			})
+
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+	})
+
+	Dispose(dev)
+}
+
+func TestCountObjects(t *testing.T) {
+	dev, err := Initialize(Init{})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	storages, err := FetchStorages(dev)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	sid := storages[0].Sid
+
+	Convey("Testing valid directory | CountObjects", t, func() {
+		// test the directory '/mtp-test-files/mock_dir1'
+		dir, err := GetObjectFromPath(dev, sid, "/mtp-test-files/mock_dir1")
+		So(err, ShouldBeNil)
+
+		files, directories, err := CountObjects(dev, sid, dir.ObjectId, true)
+		So(err, ShouldBeNil)
+		So(files, ShouldEqual, 5)
+		So(directories, ShouldEqual, 4)
+
+		_, totalFiles, totalDirectories, err := Walk(context.Background(), dev, sid, dir.FullPath, false, false, false,
+			func(objectId uint32, fi *FileInfo, err error) error {
+				return nil
+			})
+		So(err, ShouldBeNil)
+
+		files, directories, err = CountObjects(dev, sid, dir.ObjectId, false)
+		So(err, ShouldBeNil)
+		So(files, ShouldEqual, totalFiles)
+		So(directories, ShouldEqual, totalDirectories)
+	})
+
+	Convey("Testing a file | CountObjects", t, func() {
+		// test the file '/mtp-test-files/mock_dir1/a.txt'
+		fi, err := GetObjectFromPath(dev, sid, "/mtp-test-files/mock_dir1/a.txt")
+		So(err, ShouldBeNil)
+
+		files, directories, err := CountObjects(dev, sid, fi.ObjectId, true)
+		So(err, ShouldBeNil)
+		So(files, ShouldEqual, 1)
+		So(directories, ShouldEqual, 0)
+	})
+
+	Convey("Testing an invalid objectId | CountObjects | Should throw an error", t, func() {
+		_, _, err := CountObjects(dev, sid, 0xFFFFFFF0, true)
+		So(err, ShouldHaveSameTypeAs, FileObjectError{})
+	})
+
+	Dispose(dev)
+}
+
+func TestListHandles(t *testing.T) {
+	dev, err := Initialize(Init{})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	storages, err := FetchStorages(dev)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	sid := storages[0].Sid
+
+	Convey("Testing valid directory | ListHandles", t, func() {
+		// test the directory '/mtp-test-files/mock_dir1'
+		dir, err := GetObjectFromPath(dev, sid, "/mtp-test-files/mock_dir1")
+		So(err, ShouldBeNil)
+
+		handles, err := ListHandles(dev, sid, dir.ObjectId)
+		So(err, ShouldBeNil)
+
+		files, directories, err := CountObjects(dev, sid, dir.ObjectId, false)
+		So(err, ShouldBeNil)
+		So(len(handles), ShouldEqual, files+directories)
+
+		// only the directories
+		dirHandles, err := ListHandlesByFormat(dev, sid, dir.ObjectId, mtp.OFC_Association)
+		So(err, ShouldBeNil)
+		So(len(dirHandles), ShouldEqual, directories)
+
+		for _, objectId := range dirHandles {
+			So(handles, ShouldContain, objectId)
+
+			fi, err := GetObjectFromObjectId(dev, objectId, dir.FullPath)
+			So(err, ShouldBeNil)
+			So(fi.IsDir, ShouldBeTrue)
+		}
+	})
+
+	Convey("Testing root directory | ListHandles", t, func() {
+		handles, err := ListHandles(dev, sid, 0)
+		So(err, ShouldBeNil)
+
+		rootHandles, err := ListHandles(dev, sid, ParentObjectId)
+		So(err, ShouldBeNil)
+		So(handles, ShouldResemble, rootHandles)
+	})
+
+	Convey("Testing an invalid objectId | ListHandles | Should throw an error", t, func() {
+		_, err := ListHandles(dev, sid, 0xFFFFFFF0)
+		So(err, ShouldHaveSameTypeAs, ListDirectoryError{})
+	})
+
+	Dispose(dev)
+}
+
+func TestDirectorySize(t *testing.T) {
+	dev, err := Initialize(Init{})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	storages, err := FetchStorages(dev)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	sid := storages[0].Sid
+
+	Convey("Testing valid directory | DirectorySize", t, func() {
+		// test the directory '/mtp-test-files/mock_dir1'
+		fullPath := "/mtp-test-files/mock_dir1"
+
+		var walkSize int64
+		_, totalFiles, _, err := Walk(context.Background(), dev, sid, fullPath, true, true, false,
+			func(objectId uint32, fi *FileInfo, err error) error {
+				if !fi.IsDir {
+					walkSize += fi.Size
+				}
+
+				return nil
+			})
+		So(err, ShouldBeNil)
+
+		totalBytes, fileCount, err := DirectorySize(dev, sid, 0, fullPath)
+		So(err, ShouldBeNil)
+		So(totalBytes, ShouldEqual, walkSize)
+		So(totalBytes, ShouldBeGreaterThan, 0)
+		So(fileCount, ShouldEqual, totalFiles)
+
+		// using objectId
+		dir, err := GetObjectFromPath(dev, sid, fullPath)
+		So(err, ShouldBeNil)
+
+		totalBytes1, fileCount1, err := DirectorySize(dev, sid, dir.ObjectId, "")
+		So(err, ShouldBeNil)
+		So(totalBytes1, ShouldEqual, totalBytes)
+		So(fileCount1, ShouldEqual, fileCount)
+	})
+
+	Convey("Testing the root directory | DirectorySize | The root handle should not be counted as a size", t, func() {
+		root, err := GetObjectFromObjectId(dev, ParentObjectId, "")
+		So(err, ShouldBeNil)
+		So(root.Size, ShouldEqual, 0)
+
+		var walkSize int64
+		_, _, _, err = Walk(context.Background(), dev, sid, PathSep, true, true, false,
+			func(objectId uint32, fi *FileInfo, err error) error {
+				So(fi.ObjectId, ShouldNotEqual, ParentObjectId)
+				So(fi.Size, ShouldNotEqual, int64(ParentObjectId))
+
+				if fi.IsDir {
+					So(fi.Size, ShouldEqual, 0)
+				} else {
+					walkSize += fi.Size
+				}
+
+				return nil
+			})
+		So(err, ShouldBeNil)
+
+		totalBytes, _, err := DirectorySize(dev, sid, ParentObjectId, PathSep)
+		So(err, ShouldBeNil)
+		So(totalBytes, ShouldEqual, walkSize)
+
+		totalBytes, _, err = DirectorySize(dev, sid, 0, PathSep)
+		So(err, ShouldBeNil)
+		So(totalBytes, ShouldEqual, walkSize)
+	})
+
+	Convey("Testing a file | DirectorySize", t, func() {
+		// test the file '/mtp-test-files/4mb_txt_file'
+		fi, err := GetObjectFromPath(dev, sid, "/mtp-test-files/4mb_txt_file")
+		So(err, ShouldBeNil)
+
+		totalBytes, fileCount, err := DirectorySize(dev, sid, 0, "/mtp-test-files/4mb_txt_file")
+		So(err, ShouldBeNil)
+		So(totalBytes, ShouldEqual, fi.Size)
+		So(fileCount, ShouldEqual, 1)
+	})
+
+	Convey("Testing non existing directory | DirectorySize | It should throw an error", t, func() {
+		totalBytes, fileCount, err := DirectorySize(dev, sid, 0, "/mtp-test-files/fake_dir")
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+		So(totalBytes, ShouldEqual, 0)
+		So(fileCount, ShouldEqual, 0)
+	})
+
+	Dispose(dev)
+}
+
+func TestReadDir(t *testing.T) {
+	dev, err := Initialize(Init{})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	storages, err := FetchStorages(dev)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	sid := storages[0].Sid
+
+	Convey("Testing valid directory | ReadDir", t, func() {
+		// test the directory '/mtp-test-files/mock_dir1'
+		fullPath := "/mtp-test-files/mock_dir1"
+
+		var walkCount int
+		_, _, _, err := Walk(context.Background(), dev, sid, fullPath, false, true, false,
+			func(objectId uint32, fi *FileInfo, err error) error {
+				walkCount += 1
+
+				return nil
+			})
+		So(err, ShouldBeNil)
+
+		children, err := ReadDir(dev, sid, 0, fullPath)
+		So(err, ShouldBeNil)
+		So(len(children), ShouldEqual, walkCount)
+
+		// the directories are listed first
+		for i := 1; i < len(children); i++ {
+			So(children[i-1].IsDir || !children[i].IsDir, ShouldBeTrue)
+
+			if children[i-1].IsDir == children[i].IsDir {
+				So(strings.ToLower(children[i-1].Name), ShouldBeLessThanOrEqualTo, strings.ToLower(children[i].Name))
+			}
+		}
+
+		// using objectId
+		dir, err := GetObjectFromPath(dev, sid, fullPath)
+		So(err, ShouldBeNil)
+
+		children1, err := ReadDir(dev, sid, dir.ObjectId, "")
+		So(err, ShouldBeNil)
+		So(len(children1), ShouldEqual, len(children))
+		So(children1[0].FullPath, ShouldEqual, children[0].FullPath)
+	})
+
+	Convey("Testing GetObjectPropList and GetObjectInfo code paths | listDir", t, func() {
+		supported, err := isOperationSupported(dev, mtp.OC_MTP_GetObjPropList)
+		So(err, ShouldBeNil)
+
+		if !supported {
+			return
+		}
+
+		dir, err := GetObjectFromPath(dev, sid, "/mtp-test-files/mock_dir1")
+		So(err, ShouldBeNil)
+
+		children1, err := listDirUsingPropList(dev, sid, dir.ObjectId, dir.FullPath)
+		So(err, ShouldBeNil)
+
+		var children2 []*FileInfo
+		_, _, _, err = proccessWalk(context.Background(), dev, sid, FileProp{dir.ObjectId, dir.FullPath}, walkProps{skipDisallowedFiles: true, skipErrors: true},
+			func(objectId uint32, fi *FileInfo, err error) error {
+				children2 = append(children2, fi)
+
+				return err
+			})
+		So(err, ShouldBeNil)
+
+		sortDirEntries(children1)
+		sortDirEntries(children2)
+		So(len(children1), ShouldEqual, len(children2))
+
+		for i := range children1 {
+			So(children1[i].ObjectId, ShouldEqual, children2[i].ObjectId)
+			So(children1[i].FullPath, ShouldEqual, children2[i].FullPath)
+			So(children1[i].Size, ShouldEqual, children2[i].Size)
+			So(children1[i].IsDir, ShouldEqual, children2[i].IsDir)
+		}
+	})
+
+	Convey("Testing a file | ReadDir | It should throw an error", t, func() {
+		children, err := ReadDir(dev, sid, 0, "/mtp-test-files/4mb_txt_file")
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+		So(children, ShouldBeNil)
+	})
+
+	Convey("Testing sortDirEntries", t, func() {
+		files := []*FileInfo{
+			{Name: "b.txt"}, {Name: "B", IsDir: true}, {Name: "A.txt"}, {Name: "a", IsDir: true}, {Name: "a.txt"},
+		}
+
+		sortDirEntries(files)
+
+		var names []string
+		for _, f := range files {
+			names = append(names, f.Name)
+		}
+		So(names, ShouldResemble, []string{"a", "B", "A.txt", "a.txt", "b.txt"})
+	})
+
+	Dispose(dev)
+}
+
+func TestReadDirPage(t *testing.T) {
+	dev, err := Initialize(Init{})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	storages, err := FetchStorages(dev)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	sid := storages[0].Sid
+
+	Convey("Testing pages of a valid directory | ReadDirPage", t, func() {
+		// test the directory '/mtp-test-files/mock_dir1'
+		fullPath := "/mtp-test-files/mock_dir1"
+
+		children, err := ReadDir(dev, sid, 0, fullPath)
+		So(err, ShouldBeNil)
+
+		var names []string
+		for offset := 0; ; offset += 2 {
+			page, totalCount, err := ReadDirPage(dev, sid, 0, fullPath, offset, 2, SortByNameAsc)
+			So(err, ShouldBeNil)
+			So(totalCount, ShouldEqual, len(children))
+			So(len(page), ShouldBeLessThanOrEqualTo, 2)
+
+			if len(page) < 1 {
+				break
+			}
+
+			for _, fi := range page {
+				So(fi.FullPath, ShouldEqual, getFullPath(fullPath, fi.Name))
+				names = append(names, fi.Name)
+			}
+		}
+		So(len(names), ShouldEqual, len(children))
+
+		for i := 1; i < len(names); i++ {
+			So(names[i-1], ShouldBeLessThan, names[i])
+		}
+
+		// the whole directory in the descending order
+		page, _, err := ReadDirPage(dev, sid, 0, fullPath, 0, 0, SortByNameDesc)
+		So(err, ShouldBeNil)
+		So(len(page), ShouldEqual, len(names))
+		So(page[0].Name, ShouldEqual, names[len(names)-1])
+
+		page, _, err = ReadDirPage(dev, sid, 0, fullPath, 0, 0, SortBySizeDesc)
+		So(err, ShouldBeNil)
+		for i := 1; i < len(page); i++ {
+			So(page[i-1].Size, ShouldBeGreaterThanOrEqualTo, page[i].Size)
+		}
+	})
+
+	Convey("Testing invalid arguments | ReadDirPage | It should throw an error", t, func() {
+		_, _, err := ReadDirPage(dev, sid, 0, "/mtp-test-files/mock_dir1", 0, 10, SortField("fake"))
+		So(err, ShouldHaveSameTypeAs, UnsupportedOperationError{})
+
+		_, _, err = ReadDirPage(dev, sid, 0, "/mtp-test-files/mock_dir1", -1, 10, SortByNameAsc)
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+
+		_, _, err = ReadDirPage(dev, sid, 0, "/mtp-test-files/4mb_txt_file", 0, 10, SortByNameAsc)
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+	})
+
+	Convey("Testing dirPageEntryLess", t, func() {
+		now := time.Now()
+		entries := []dirPageEntry{
+			{name: "b", size: 1, modTime: now},
+			{name: "a", size: 2, modTime: now.Add(-time.Hour)},
+			{name: "c", size: 1, modTime: now.Add(time.Hour)},
+		}
+
+		for _, f := range []struct {
+			sortBy   SortField
+			expected []string
+		}{
+			{SortByNameAsc, []string{"a", "b", "c"}},
+			{SortByNameDesc, []string{"c", "b", "a"}},
+			{SortBySizeAsc, []string{"b", "c", "a"}},
+			{SortBySizeDesc, []string{"a", "b", "c"}},
+			{SortByModTimeAsc, []string{"a", "b", "c"}},
+			{SortByModTimeDesc, []string{"c", "b", "a"}},
+		} {
+			less, err := dirPageEntryLess(f.sortBy)
+			So(err, ShouldBeNil)
+
+			sorted := append([]dirPageEntry{}, entries...)
+			sort.SliceStable(sorted, func(i, j int) bool {
+				return less(&sorted[i], &sorted[j])
+			})
+
+			var names []string
+			for _, e := range sorted {
+				names = append(names, e.name)
+			}
+			So(names, ShouldResemble, f.expected)
+		}
+	})
+
+	Dispose(dev)
+}
+
+// create a file with the object format [format] inside [parentId]
+func makeTestObjectWithFormat(dev *mtp.Device, sid, parentId uint32, filename string, format uint16) (uint32, error) {
+	content := []byte(filename)
+
+	obj := mtp.ObjectInfo{
+		StorageID:        sid,
+		ObjectFormat:     format,
+		ParentObject:     parentId,
+		Filename:         filename,
+		CompressedSize:   uint32(len(content)),
+		ModificationDate: time.Now(),
+	}
+
+	_, _, objectId, err := dev.SendObjectInfo(sid, parentId, &obj)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := dev.SendObject(bytes.NewReader(content), int64(len(content)), mtp.EmptyProgressFunc); err != nil {
+		return 0, err
+	}
+
+	return objectId, nil
+}
+
+func TestWalkByFormat(t *testing.T) {
+	dev, err := Initialize(Init{})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	storages, err := FetchStorages(dev)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	sid := storages[0].Sid
+
+	// create a mixed directory
+	// test the directory '/mtp-test-files/temp_dir/test-WalkByFormat/{random}'
+	dirName := fmt.Sprintf("/mtp-test-files/temp_dir/test-WalkByFormat/%x", rand.Int31())
+	dirId, err := MakeDirectory(dev, sid, dirName)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	nestedId, err := MakeDirectory(dev, sid, getFullPath(dirName, "nested"))
+	if err != nil {
+		log.Panic(err)
+	}
+
+	for _, o := range []struct {
+		parentId uint32
+		name     string
+		format   uint16
+	}{
+		{dirId, "a.jpg", mtp.OFC_EXIF_JPEG},
+		{dirId, "b.mp4", mtp.OFC_MTP_MP4},
+		{dirId, "c.txt", mtp.OFC_Text},
+		{nestedId, "d.jpg", mtp.OFC_EXIF_JPEG},
+		{nestedId, "e.txt", mtp.OFC_Text},
+	} {
+		if _, err := makeTestObjectWithFormat(dev, sid, o.parentId, o.name, o.format); err != nil {
+			log.Panic(err)
+		}
+	}
+
+	Convey("Testing photos only | WalkByFormat", t, func() {
+		var names []string
+		totalFiles, totalDirectories, err := WalkByFormat(dev, sid, 0, dirName, []uint16{mtp.OFC_EXIF_JPEG}, true,
+			func(objectId uint32, fi *FileInfo, err error) error {
+				So(fi.Info.ObjectFormat, ShouldEqual, mtp.OFC_EXIF_JPEG)
+				names = append(names, fi.FullPath)
+
+				return nil
+			})
+
+		So(err, ShouldBeNil)
+		So(totalFiles, ShouldEqual, 2)
+		So(totalDirectories, ShouldEqual, 0)
+		So(names, ShouldContain, getFullPath(dirName, "a.jpg"))
+		So(names, ShouldContain, getFullPath(dirName, "nested/d.jpg"))
+	})
+
+	Convey("Testing photos and videos | non recursive | WalkByFormat", t, func() {
+		var names []string
+		totalFiles, _, err := WalkByFormat(dev, sid, dirId, "", []uint16{mtp.OFC_EXIF_JPEG, mtp.OFC_MTP_MP4}, false,
+			func(objectId uint32, fi *FileInfo, err error) error {
+				names = append(names, fi.Name)
+
+				return nil
+			})
+
+		So(err, ShouldBeNil)
+		So(totalFiles, ShouldEqual, 2)
+		So(names, ShouldContain, "a.jpg")
+		So(names, ShouldContain, "b.mp4")
+	})
+
+	Convey("Testing directories | WalkByFormat", t, func() {
+		totalFiles, totalDirectories, err := WalkByFormat(dev, sid, 0, dirName, []uint16{mtp.OFC_Association}, true,
+			func(objectId uint32, fi *FileInfo, err error) error {
+				So(fi.IsDir, ShouldBeTrue)
+
+				return nil
+			})
+
+		So(err, ShouldBeNil)
+		So(totalFiles, ShouldEqual, 0)
+		So(totalDirectories, ShouldEqual, 1)
+	})
+
+	Convey("Testing empty formats | WalkByFormat | It should throw an error", t, func() {
+		_, _, err := WalkByFormat(dev, sid, 0, dirName, nil, true,
+			func(objectId uint32, fi *FileInfo, err error) error {
+				return nil
+			})
+
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+	})
+
+	Dispose(dev)
+}
+
+func TestFindFiles(t *testing.T) {
+	dev, err := Initialize(Init{})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	storages, err := FetchStorages(dev)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	sid := storages[0].Sid
+
+	Convey("Testing a name pattern | b.txt | FindFiles", t, func() {
+		//test the directory '/mtp-test-files/mock_dir1'
+		found, err := FindFiles(dev, sid, "/mtp-test-files/mock_dir1", "b.txt", true)
+		So(err, ShouldBeNil)
+
+		var paths []string
+		for _, fi := range found {
+			paths = append(paths, fi.FullPath)
+		}
+
+		So(len(paths), ShouldEqual, 3)
+		So(paths, ShouldContain, "/mtp-test-files/mock_dir1/2/b.txt")
+		So(paths, ShouldContain, "/mtp-test-files/mock_dir1/3/b.txt")
+		So(paths, ShouldContain, "/mtp-test-files/mock_dir1/3/2/b.txt")
+
+		// [recursive] = false doesn't descend into the sub directories
+		found, err = FindFiles(dev, sid, "/mtp-test-files/mock_dir1", "*.txt", false)
+		So(err, ShouldBeNil)
+		So(len(found), ShouldEqual, 1)
+		So(found[0].FullPath, ShouldEqual, "/mtp-test-files/mock_dir1/a.txt")
+
+		// the whole storage is searched if [startPath] is empty
+		found, err = FindFiles(dev, sid, "", "b.txt", true)
+		So(err, ShouldBeNil)
+		So(len(found), ShouldBeGreaterThanOrEqualTo, 3)
+	})
+
+	Convey("Testing the first match | FindFirst", t, func() {
+		fi, err := FindFirst(dev, sid, "/mtp-test-files/mock_dir1", "b.txt", true)
+		So(err, ShouldBeNil)
+		So(fi.Name, ShouldEqual, "b.txt")
+
+		_, err = FindFirst(dev, sid, "/mtp-test-files/mock_dir1", "*.mp4", true)
+		So(err, ShouldHaveSameTypeAs, FileNotFoundError{})
+	})
+
+	Convey("Testing an invalid pattern | FindFiles | Should throw an error", t, func() {
+		_, err := FindFiles(dev, sid, "/mtp-test-files/mock_dir1", "[", true)
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+
+		// the pattern is matched against the filename only
+		_, err = FindFiles(dev, sid, "/mtp-test-files", "mock_dir1/*.txt", true)
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+	})
+
 	Dispose(dev)
 }